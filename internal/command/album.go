@@ -65,8 +65,7 @@ func CmdAlbum() cli.Command {
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					RunShareAlbumList()
 					return nil
@@ -87,11 +86,9 @@ func CmdAlbum() cli.Command {
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
-					RunShareAlbumListFile(c.Args().Get(0))
-					return nil
+					return reportError(RunShareAlbumListFile(c.Args().Get(0)))
 				},
 				Flags: []cli.Flag{},
 			},
@@ -106,16 +103,25 @@ func CmdAlbum() cli.Command {
 
     下载相簿 "我的相簿2022" 里面的所有文件
     aliyunpan album download-file 我的相簿2022
+
+    只下载 2024-01-01 之后的文件，并按照年月保存到子目录
+    aliyunpan album download-file --since 2024-01-01 --name-template "{taken:2006/01}/{name}" 我的相簿2022
+
+增量下载: 下载的文件记录在保存目录下的 .aliyunpan_album_download.json 文件中，再次下载时会跳过已下载的文件。
+本地已存在SHA1相同的文件也会跳过。
+
+保存路径模板支持的变量:
+    {album} 相簿名称, {name} 文件名, {base} 不含扩展名的文件名, {ext} 扩展名, {id} 文件ID
+    {taken:格式} 拍摄时间, {created:格式} 创建时间, {updated:格式} 修改时间，时间格式使用Go的时间格式，例如 2006/01
+    接口没有返回照片的拍摄时间，{taken} 和 --since 使用相簿文件的创建时间
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					subArgs := c.Args()
 					if len(subArgs) == 0 {
-						fmt.Println("请指定下载的相簿名称")
-						return nil
+						return reportError(usageErrorf("请指定下载的相簿名称"))
 					}
 
 					// 处理saveTo
@@ -141,10 +147,14 @@ func CmdAlbum() cli.Command {
 						ExcludeNames:         []string{},
 					}
 
-					RunShareAlbumDownloadFile(c.Args(), do)
+					albumOpt, err := parseAlbumDownloadOptions(c)
+					if err != nil {
+						return reportError(err)
+					}
+					RunShareAlbumDownloadFile(c.Args(), do, albumOpt)
 					return nil
 				},
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.BoolFlag{
 						Name:  "ow",
 						Usage: "overwrite, 覆盖已存在的文件",
@@ -157,7 +167,7 @@ func CmdAlbum() cli.Command {
 						Name:  "np",
 						Usage: "no progress 不展示下载进度条",
 					},
-				},
+				}, albumDownloadFlags...),
 			},
 		},
 	}
@@ -180,31 +190,29 @@ func RunShareAlbumList() {
 	tb.Render()
 }
 
-func getShareAlbumFromName(activeUser *config.PanUser, name string) *aliyunpan.AlbumEntity {
+func getShareAlbumFromName(activeUser *config.PanUser, name string) (*aliyunpan.AlbumEntity, error) {
 	records, err := activeUser.PanClient().OpenapiPanClient().ShareAlbumListGetAll()
 	if err != nil {
-		fmt.Printf("获取相簿列表失败: %s\n", err)
-		return nil
+		return nil, apiOutputError(err, "获取相簿列表失败: ")
 	}
 
 	for _, record := range records {
 		if name == record.Name {
-			return record
+			return record, nil
 		}
 	}
-	return nil
+	return nil, notFoundErrorf("相簿不存在: %s", name)
 }
 
-func RunShareAlbumListFile(name string) {
+func RunShareAlbumListFile(name string) error {
 	if len(name) == 0 {
-		fmt.Printf("相簿名称不能为空\n")
-		return
+		return usageErrorf("相簿名称不能为空")
 	}
 
 	activeUser := GetActiveUser()
-	record := getShareAlbumFromName(activeUser, name)
-	if record == nil {
-		return
+	record, err := getShareAlbumFromName(activeUser, name)
+	if err != nil {
+		return err
 	}
 
 	fileList, er := activeUser.PanClient().OpenapiPanClient().ShareAlbumListFileGetAll(&aliyunpan.ShareAlbumListFileParam{
@@ -212,13 +220,16 @@ func RunShareAlbumListFile(name string) {
 		Limit:   100,
 	})
 	if er != nil {
-		fmt.Printf("获取相簿文件列表失败：%s\n", er)
-		return
+		return apiOutputError(er, "获取相簿文件列表失败：")
+	}
+	if IsMachineOutput() {
+		return writeOutput(newFileOutputList(fileList, ""))
 	}
 	renderTable(opLs, false, "", fileList)
+	return nil
 }
 
-func RunShareAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
+func RunShareAlbumDownloadFile(albumNames []string, options *DownloadOptions, albumOpt *AlbumDownloadOptions) {
 	if len(albumNames) == 0 {
 		fmt.Printf("请指定相簿名称\n")
 		return
@@ -240,7 +251,7 @@ func RunShareAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 		CacheSize:                  config.Config.CacheSize,
 		BlockSize:                  MaxDownloadRangeSize,
 		MaxRate:                    config.Config.MaxDownloadRate,
-		InstanceStateStorageFormat: downloader.InstanceStateStorageFormatJSON,
+		InstanceStateStorageFormat: downloader.InstanceStateStorageFormatProto3,
 		ShowProgress:               options.ShowProgress,
 		ExcludeNames:               options.ExcludeNames,
 	}
@@ -307,6 +318,9 @@ func RunShareAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 	// 全局速度统计
 	globalSpeedsStat := &speeds.Speeds{}
 
+	// 增量下载记录
+	ad := newAlbumDownloader(originSaveRootPath, albumOpt)
+
 	// 处理队列
 	allShareAlbumList, err := activeUser.PanClient().OpenapiPanClient().ShareAlbumListGetAll()
 	if err != nil {
@@ -346,6 +360,9 @@ func RunShareAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 			}
 			f := fileList.Item(idx)
 			idx += 1
+			if ad.IsBeforeSince(f) {
+				continue
+			}
 			// 处理实况照片
 			if f.IsAlbumLivePhotoFile() {
 				// 如果是实况照片，则需要下载图片+视频两个文件
@@ -392,6 +409,10 @@ func RunShareAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 			}
 			// 补全虚拟网盘路径，规则：/共享相册/<相簿名称>/文件名称
 			f.Path = "/共享相册/" + albumNames[k] + "/" + f.FileName
+			savePath := ad.SavePath("/共享相册/"+albumNames[k], albumNames[k], f)
+			if ad.Skip(record.AlbumId, f, savePath) {
+				continue
+			}
 
 			// 生成下载项
 			newCfg := *cfg
@@ -416,15 +437,10 @@ func RunShareAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 			unit.SetFileInfo(global.AlbumSource, f)
 
 			// 设置储存的路径
-			if options.SaveTo != "" {
-				unit.OriginSaveRootPath = options.SaveTo
-				unit.SavePath = filepath.Join(options.SaveTo, f.Path)
-			} else {
-				// 使用默认的保存路径
-				unit.OriginSaveRootPath = GetActiveUser().GetSavePath("")
-				unit.SavePath = GetActiveUser().GetSavePath(f.Path)
-			}
+			unit.OriginSaveRootPath = originSaveRootPath
+			unit.SavePath = savePath
 			info := executor.Append(&unit, options.MaxRetry)
+			ad.Add(record.AlbumId, f, &unit, info)
 			fmt.Printf("[%s] 加入下载队列: %s\n", info.Id(), f.Path)
 		}
 	}
@@ -439,15 +455,19 @@ func RunShareAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 
 	// 输出失败的文件列表
 	failedList := executor.FailedDeque()
-	if failedList.Size() != 0 {
+	failedItems := []*taskframework.TaskInfoItem{}
+	for e := failedList.Shift(); e != nil; e = failedList.Shift() {
+		failedItems = append(failedItems, e.(*taskframework.TaskInfoItem))
+	}
+	if len(failedItems) != 0 {
 		fmt.Printf("以下文件下载失败: \n")
 		tb := cmdtable.NewTable(os.Stdout)
-		for e := failedList.Shift(); e != nil; e = failedList.Shift() {
-			item := e.(*taskframework.TaskInfoItem)
+		for _, item := range failedItems {
 			tb.Append([]string{item.Info.Id(), item.Unit.(*pandownload.DownloadTaskUnit).FilePanPath})
 		}
 		tb.Render()
 	}
+	ad.Finish(failedItems)
 }
 
 func cloneFileEntity(entity *aliyunpan.FileEntity) *aliyunpan.FileEntity {
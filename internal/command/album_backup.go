@@ -0,0 +1,261 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_web"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions/panalbum"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// DefaultAlbumBackupPanDir 相册备份默认的云盘目录，文件保存在 <目录>/<相簿名称>/YYYY/MM 下
+	DefaultAlbumBackupPanDir = "/相册备份"
+
+	// albumAddFileBatchSize 每次加入相簿的文件数量
+	albumAddFileBatchSize = 100
+)
+
+type (
+	// AlbumBackupOptions 相册备份可选项
+	AlbumBackupOptions struct {
+		Parallel     int // 文件并发数量
+		ShowProgress bool
+		DriveId      string
+		PanDir       string   // 云盘保存目录
+		ExcludeNames []string // 排除的文件名，支持正则表达式
+		BlockSize    int64    // 上传分片大小
+	}
+)
+
+// listAlbumBackupLocalFiles 获取本地目录下的图片和视频文件，不计算SHA1
+func listAlbumBackupLocalFiles(localDir string, excludeNames []string, videoExtensions []string) ([]*panalbum.BackupFile, error) {
+	files := []*panalbum.BackupFile{}
+	walkFunc := func(file localfile.SymlinkFile, fi os.FileInfo, err error) error {
+		if err != nil {
+			logger.Verboseln("album backup process file: ", file, " error: ", err)
+			return nil
+		}
+		if utils.IsExcludeFile(file.LogicPath, &excludeNames) {
+			return filepath.SkipDir
+		}
+		if fi.IsDir() || !panalbum.IsMediaFile(fi.Name(), videoExtensions) {
+			return nil
+		}
+		files = append(files, &panalbum.BackupFile{
+			LocalPath: file.RealPath,
+			Size:      fi.Size(),
+			ModTime:   fi.ModTime(),
+		})
+		return nil
+	}
+	if e := localfile.WalkAllFile(localfile.NewSymlinkFile(localDir), walkFunc); e != nil && e != filepath.SkipDir {
+		return nil, e
+	}
+	return files, nil
+}
+
+// albumBackupSha1Sum 计算本地文件的SHA1
+func albumBackupSha1Sum(localPath string) (string, error) {
+	lfc, e := localfile.GetFileSum(localPath, localfile.CHECKSUM_SHA1)
+	if e != nil {
+		return "", e
+	}
+	return lfc.SHA1, nil
+}
+
+// RunAlbumBackup 备份本地目录下的图片和视频到相簿，部分文件备份失败时返回 ExitCodePartialFailure 错误
+func RunAlbumBackup(localDir, albumName string, opt *AlbumBackupOptions) error {
+	activeUser := GetActiveUser()
+	panClient := activeUser.PanClient()
+	if opt == nil {
+		opt = &AlbumBackupOptions{}
+	}
+	if albumName == "" {
+		return usageErrorf("必须指定相簿名称")
+	}
+	localDir = filepath.Clean(localDir)
+	if fi, e := os.Stat(localDir); e != nil || !fi.IsDir() {
+		return notFoundErrorf("本地目录不存在或者不是文件夹: %s", localDir)
+	}
+	if opt.PanDir == "" {
+		opt.PanDir = path.Join(DefaultAlbumBackupPanDir, albumName)
+	}
+	panDir := activeUser.PathJoin(opt.DriveId, opt.PanDir)
+
+	// 相簿不存在则创建
+	album := getAlbumFromName(activeUser, albumName)
+	if album == nil {
+		var apierr *apierror.ApiError
+		album, apierr = panClient.WebapiPanClient().AlbumCreate(&aliyunpan_web.AlbumCreateParam{Name: albumName})
+		if apierr != nil {
+			return apiOutputError(apierr, "创建相簿失败: ")
+		}
+		fmt.Printf("创建相簿: %s\n", albumName)
+	}
+
+	db, e := panalbum.OpenBackupDatabase(filepath.Join(config.GetConfigDir(), panalbum.BackupDatabaseFileName))
+	if e != nil {
+		return errorf("打开相册备份记录失败: %s", e)
+	}
+	defer db.Close()
+
+	// 生成备份计划，已经备份过的文件和内容重复的文件不再上传
+	localFiles, e := listAlbumBackupLocalFiles(localDir, opt.ExcludeNames, config.Config.GetVideoExtensionList())
+	if e != nil {
+		return errorf("遍历本地目录错误: %s", e)
+	}
+	fmt.Printf("正在检查 %d 个图片和视频文件，请稍候...\n", len(localFiles))
+	plan := panalbum.NewBackupPlan(db, album.AlbumId, localFiles, albumBackupSha1Sum)
+	fmt.Printf("需要备份: %d, 已备份: %d, 内容重复: %d\n", plan.UploadCount(), len(plan.Skipped), len(plan.Duplicates))
+
+	backupCount := 0
+	failedCount := len(plan.Failed)
+	for _, f := range plan.Failed {
+		fmt.Printf("读取文件失败: %s, %s\n", f.File.LocalPath, f.Err)
+	}
+	for _, folder := range plan.Folders() {
+		files := plan.Upload[folder]
+		panFolder := path.Join(panDir, folder)
+		localPaths := make([]string, 0, len(files))
+		for _, f := range files {
+			localPaths = append(localPaths, f.LocalPath)
+		}
+		summary := RunUpload(localPaths, panFolder, &UploadOptions{
+			AllParallel:  opt.Parallel,
+			Parallel:     1,
+			MaxRetry:     DefaultUploadMaxRetry,
+			ShowProgress: opt.ShowProgress,
+			DriveId:      opt.DriveId,
+			BlockSize:    opt.BlockSize,
+		})
+		if summary.Error != nil {
+			fmt.Printf("上传失败: %s, %s\n", panFolder, summary.Error.Message)
+		}
+
+		// 按照SHA1找到上传后的云盘文件，同名文件会被自动重命名
+		uploaded, e := listAlbumBackupPanFiles(panClient.OpenapiPanClient(), opt.DriveId, panFolder)
+		if e != nil {
+			fmt.Printf("获取云盘目录文件失败: %s, %s\n", panFolder, e)
+			failedCount += len(files)
+			continue
+		}
+		param := &aliyunpan_web.AlbumAddFileParam{
+			AlbumId:       album.AlbumId,
+			DriveFileList: []aliyunpan.FileBatchActionParam{},
+		}
+		records := []*panalbum.BackupRecord{}
+		recordFiles := []*panalbum.BackupFile{}
+		for _, f := range files {
+			pf := uploaded[f.Sha1]
+			if pf == nil {
+				fmt.Printf("上传失败: %s\n", f.LocalPath)
+				failedCount++
+				continue
+			}
+			param.AddFileItem(pf.DriveId, pf.FileId)
+			records = append(records, &panalbum.BackupRecord{
+				LocalPath: f.LocalPath,
+				Sha1:      f.Sha1,
+				DriveId:   pf.DriveId,
+				FileId:    pf.FileId,
+				PanPath:   path.Join(panFolder, pf.FileName),
+				BackupAt:  time.Now().Unix(),
+			})
+			recordFiles = append(recordFiles, f)
+		}
+
+		// 加入相簿，成功后才记录为已备份
+		for start := 0; start < len(records); start += albumAddFileBatchSize {
+			end := start + albumAddFileBatchSize
+			if end > len(records) {
+				end = len(records)
+			}
+			batch := &aliyunpan_web.AlbumAddFileParam{
+				AlbumId:       album.AlbumId,
+				DriveFileList: param.DriveFileList[start:end],
+			}
+			if _, apierr := panClient.WebapiPanClient().AlbumAddFile(batch); apierr != nil {
+				fmt.Printf("增加相簿文件失败: %s, %s\n", panFolder, apierr)
+				failedCount += end - start
+				continue
+			}
+			for k := start; k < end; k++ {
+				f := recordFiles[k]
+				if e := db.Put(album.AlbumId, f.Size, f.ModTime.Unix(), records[k]); e != nil {
+					logger.Verboseln("save album backup record error: ", e)
+				}
+			}
+			backupCount += end - start
+		}
+	}
+
+	// 内容重复的文件指向已备份的云盘文件
+	for _, f := range plan.Duplicates {
+		original := db.GetHash(album.AlbumId, f.Sha1)
+		if original == nil {
+			continue
+		}
+		record := *original
+		record.LocalPath = f.LocalPath
+		if e := db.PutFile(album.AlbumId, f.Size, f.ModTime.Unix(), &record); e != nil {
+			logger.Verboseln("save album backup record error: ", e)
+		}
+	}
+
+	fmt.Printf("\n相册备份结束: %s => %s(%s), 新增: %d, 已备份: %d, 内容重复: %d, 失败: %d\n",
+		localDir, albumName, panDir, backupCount, len(plan.Skipped), len(plan.Duplicates), failedCount)
+	if failedCount > 0 {
+		if backupCount > 0 {
+			return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分文件备份失败: %d", failedCount)
+		}
+		return errorf("相册备份失败: %d", failedCount)
+	}
+	return nil
+}
+
+// listAlbumBackupPanFiles 获取云盘目录下的文件，key 为大写的SHA1
+func listAlbumBackupPanFiles(client *aliyunpan_open.OpenPanClient, driveId, panFolder string) (map[string]*aliyunpan.FileEntity, error) {
+	dirInfo, apierr := client.FileInfoByPath(driveId, panFolder)
+	if apierr != nil {
+		return nil, apierr
+	}
+	fileList, apierr := client.FileListGetAll(&aliyunpan.FileListParam{
+		DriveId:      driveId,
+		ParentFileId: dirInfo.FileId,
+	}, 500)
+	if apierr != nil {
+		return nil, apierr
+	}
+	files := map[string]*aliyunpan.FileEntity{}
+	for _, f := range fileList {
+		if f.IsFile() && f.ContentHash != "" {
+			files[strings.ToUpper(f.ContentHash)] = f
+		}
+	}
+	return files, nil
+}
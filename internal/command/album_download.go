@@ -0,0 +1,201 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/functions/panalbum"
+	"github.com/tickstep/aliyunpan/internal/functions/pandownload"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+	"github.com/tickstep/library-go/logger"
+	"github.com/urfave/cli"
+)
+
+type (
+	// AlbumDownloadOptions 相簿增量下载可选项
+	AlbumDownloadOptions struct {
+		// Since 只下载该时间之后的文件，零值代表不限制
+		Since time.Time
+		// NameTemplate 文件保存路径模板，为空则直接保存在相簿目录下
+		NameTemplate *panalbum.NameTemplate
+	}
+
+	// albumDownloader 处理相簿文件的过滤、保存路径和增量下载记录
+	albumDownloader struct {
+		opt      *AlbumDownloadOptions
+		saveRoot string
+		state    *panalbum.DownloadState
+		items    []*albumDownloadItem
+		skipped  int
+	}
+
+	albumDownloadItem struct {
+		albumId string
+		key     string
+		file    *aliyunpan.FileEntity
+		unit    *pandownload.DownloadTaskUnit
+		taskId  string
+	}
+)
+
+var (
+	albumDownloadFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "只下载该时间之后的文件，格式为 2006-01-02 或者 \"2006-01-02 15:04:05\"",
+		},
+		cli.StringFlag{
+			Name:  "name-template",
+			Usage: "文件保存路径模板，例如 {taken:2006/01}/{name}",
+		},
+	}
+)
+
+// parseAlbumDownloadOptions 解析命令行的相簿增量下载参数
+func parseAlbumDownloadOptions(c *cli.Context) (*AlbumDownloadOptions, error) {
+	opt := &AlbumDownloadOptions{}
+	if since := c.String("since"); since != "" {
+		t, ok := time.Time{}, false
+		for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05"} {
+			if st, err := time.ParseInLocation(layout, since, time.Local); err == nil {
+				t, ok = st, true
+				break
+			}
+		}
+		if !ok {
+			return nil, usageErrorf("时间格式错误: %s", since)
+		}
+		opt.Since = t
+	}
+	if tpl := c.String("name-template"); tpl != "" {
+		nt, err := panalbum.ParseNameTemplate(tpl)
+		if err != nil {
+			return nil, usageErrorf("%s", err)
+		}
+		opt.NameTemplate = nt
+	}
+	return opt, nil
+}
+
+// newAlbumDownloader 读取保存根目录下的增量下载记录
+func newAlbumDownloader(saveRoot string, opt *AlbumDownloadOptions) *albumDownloader {
+	if opt == nil {
+		opt = &AlbumDownloadOptions{}
+	}
+	statePath := filepath.Join(saveRoot, panalbum.DownloadStateFileName)
+	state, err := panalbum.LoadDownloadState(statePath)
+	if err != nil {
+		// 记录损坏则重新记录，已存在的文件依然会通过SHA1跳过
+		logger.Verboseln("load album download state error: ", err)
+		state = panalbum.NewDownloadState(statePath)
+	}
+	return &albumDownloader{
+		opt:      opt,
+		saveRoot: saveRoot,
+		state:    state,
+	}
+}
+
+// IsBeforeSince 文件是否在 --since 指定的时间之前
+func (ad *albumDownloader) IsBeforeSince(f *aliyunpan.FileEntity) bool {
+	if ad.opt.Since.IsZero() {
+		return false
+	}
+	t, ok := panalbum.TakenTime(f)
+	return ok && t.Before(ad.opt.Since)
+}
+
+// SavePath 文件的本地保存路径，albumDir 为相簿在保存根目录下的目录
+func (ad *albumDownloader) SavePath(albumDir, albumName string, f *aliyunpan.FileEntity) string {
+	name := f.FileName
+	if ad.opt.NameTemplate != nil {
+		name = ad.opt.NameTemplate.Render(albumName, f)
+	}
+	return filepath.Join(ad.saveRoot, albumDir, filepath.FromSlash(name))
+}
+
+// Skip 文件已经下载过，或者本地已存在内容相同的文件
+func (ad *albumDownloader) Skip(albumId string, f *aliyunpan.FileEntity, savePath string) bool {
+	key := panalbum.DownloadFileKey(f)
+	if ad.state.IsDownloaded(albumId, key, savePath) {
+		ad.skipped++
+		return true
+	}
+	if f.ContentHash == "" {
+		return false
+	}
+	info, err := os.Stat(savePath)
+	if err != nil || info.IsDir() || info.Size() != f.FileSize {
+		return false
+	}
+	lfc, err := localfile.GetFileSum(savePath, localfile.CHECKSUM_SHA1)
+	if err != nil || !strings.EqualFold(lfc.SHA1, f.ContentHash) {
+		return false
+	}
+	ad.markDownloaded(albumId, key, f.ContentHash, savePath)
+	ad.skipped++
+	return true
+}
+
+// Add 记录加入下载队列的文件，下载结束后更新增量下载记录
+func (ad *albumDownloader) Add(albumId string, f *aliyunpan.FileEntity, unit *pandownload.DownloadTaskUnit, info *taskframework.TaskInfo) {
+	ad.items = append(ad.items, &albumDownloadItem{
+		albumId: albumId,
+		key:     panalbum.DownloadFileKey(f),
+		file:    f,
+		unit:    unit,
+		taskId:  info.Id(),
+	})
+}
+
+func (ad *albumDownloader) markDownloaded(albumId, key, contentHash, savePath string) {
+	info, err := os.Stat(savePath)
+	if err != nil || info.IsDir() {
+		return
+	}
+	ad.state.MarkDownloaded(albumId, key, &panalbum.DownloadedFile{
+		LocalPath:   savePath,
+		ContentHash: contentHash,
+		Size:        info.Size(),
+		DownloadAt:  time.Now().Unix(),
+	})
+}
+
+// Finish 记录下载成功的文件并保存增量下载记录，failed 为下载失败的任务
+func (ad *albumDownloader) Finish(failed []*taskframework.TaskInfoItem) {
+	failedIds := map[string]bool{}
+	for _, item := range failed {
+		failedIds[item.Info.Id()] = true
+	}
+	for _, item := range ad.items {
+		if failedIds[item.taskId] {
+			continue
+		}
+		// 插件可能修改了保存路径
+		ad.markDownloaded(item.albumId, item.key, item.file.ContentHash, item.unit.SavePath)
+	}
+	if err := ad.state.Save(); err != nil {
+		fmt.Printf("保存相簿下载记录失败: %s\n", err)
+	}
+	if ad.skipped > 0 {
+		fmt.Printf("已下载过的文件: %d, 跳过\n", ad.skipped)
+	}
+}
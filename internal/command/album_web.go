@@ -76,12 +76,10 @@ func CmdAlbumWeb() cli.Command {
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					RunAlbumList()
 					return nil
@@ -104,12 +102,10 @@ func CmdAlbumWeb() cli.Command {
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					RunAlbumCreate(c.Args().Get(0), c.Args().Get(1))
 					return nil
@@ -133,12 +129,10 @@ func CmdAlbumWeb() cli.Command {
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					RunAlbumDelete(c.Args())
 					return nil
@@ -159,12 +153,10 @@ func CmdAlbumWeb() cli.Command {
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					RunAlbumRename(c.Args().Get(0), c.Args().Get(1))
 					return nil
@@ -185,12 +177,10 @@ func CmdAlbumWeb() cli.Command {
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					RunAlbumListFile(c.Args().Get(0))
 					return nil
@@ -211,17 +201,14 @@ func CmdAlbumWeb() cli.Command {
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					subArgs := c.Args()
 					if len(subArgs) < 2 {
-						fmt.Println("请指定移除的文件")
-						return nil
+						return reportError(usageErrorf("请指定移除的文件"))
 					}
 					RunAlbumRmFile(subArgs[0], subArgs[1:])
 					return nil
@@ -245,17 +232,14 @@ func CmdAlbumWeb() cli.Command {
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					subArgs := c.Args()
 					if len(subArgs) < 2 {
-						fmt.Println("请指定增加的文件")
-						return nil
+						return reportError(usageErrorf("请指定增加的文件"))
 					}
 					RunAlbumAddFile(subArgs[0], subArgs[1:], ImageVideoOnlyOption)
 					return nil
@@ -274,20 +258,27 @@ func CmdAlbumWeb() cli.Command {
     下载相簿 "我的相簿2022" 里面的所有文件
     aliyunpan albumw download-file 我的相簿2022
 
+    只下载 2024-01-01 之后的文件，并按照年月保存到子目录
+    aliyunpan albumw download-file --since 2024-01-01 --name-template "{taken:2006/01}/{name}" 我的相簿2022
+
+增量下载: 下载的文件记录在保存目录下的 .aliyunpan_album_download.json 文件中，再次下载时会跳过已下载的文件。
+本地已存在SHA1相同的文件也会跳过。
+
+保存路径模板支持的变量:
+    {album} 相簿名称, {name} 文件名, {base} 不含扩展名的文件名, {ext} 扩展名, {id} 文件ID
+    {taken:格式} 拍摄时间, {created:格式} 创建时间, {updated:格式} 修改时间，时间格式使用Go的时间格式，例如 2006/01
+    接口没有返回照片的拍摄时间，{taken} 和 --since 使用相簿文件的创建时间
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					subArgs := c.Args()
 					if len(subArgs) == 0 {
-						fmt.Println("请指定下载的相簿名称")
-						return nil
+						return reportError(usageErrorf("请指定下载的相簿名称"))
 					}
 
 					// 处理saveTo
@@ -312,10 +303,14 @@ func CmdAlbumWeb() cli.Command {
 						ExcludeNames:         []string{},
 					}
 
-					RunAlbumDownloadFile(c.Args(), do)
+					albumOpt, err := parseAlbumDownloadOptions(c)
+					if err != nil {
+						return reportError(err)
+					}
+					RunAlbumDownloadFile(c.Args(), do, albumOpt)
 					return nil
 				},
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.BoolFlag{
 						Name:  "ow",
 						Usage: "overwrite, 覆盖已存在的文件",
@@ -328,6 +323,80 @@ func CmdAlbumWeb() cli.Command {
 						Name:  "np",
 						Usage: "no progress 不展示下载进度条",
 					},
+				}, albumDownloadFlags...),
+			},
+			{
+				Name:      "backup",
+				Usage:     "备份本地图片和视频到相簿",
+				UsageText: cmder.App().Name + " albumw backup <本地目录> <相簿名称>",
+				Description: `
+备份本地目录下的图片和视频到相簿，支持增量备份
+  1. 视频文件的类型使用配置 video_file_extensions 设置
+  2. 文件按照拍摄时间保存到云盘 <pdir>/YYYY/MM 目录下，图片优先使用EXIF拍摄时间，没有EXIF信息的使用文件修改时间
+  3. 内容相同的文件只会备份一次
+  4. 已经备份并加入相簿的文件会记录在配置目录下的 aliyunpan_album_backup.db 文件中，再次备份时会跳过没有修改的文件
+  5. 相簿不存在会自动创建
+
+示例:
+
+    备份本地目录 D:\Photos 下的图片和视频到相簿"家庭照片"，文件保存在云盘 /相册备份/家庭照片 目录
+    aliyunpan albumw backup D:/Photos "家庭照片"
+
+    备份到云盘 /照片 目录
+    aliyunpan albumw backup -pdir /照片 D:/Photos "家庭照片"
+
+    排除所有 @eadir 文件夹
+    aliyunpan albumw backup -exn "^@eadir$" D:/Photos "家庭照片"
+`,
+				Action: func(c *cli.Context) error {
+					if config.Config.ActiveUser() == nil {
+						return reportError(notLoggedInError())
+					}
+					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+						return reportError(webNotLoggedInError())
+					}
+					if c.NArg() != 2 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					return reportError(RunAlbumBackup(c.Args().Get(0), c.Args().Get(1), &AlbumBackupOptions{
+						Parallel:     c.Int("p"),
+						ShowProgress: !c.Bool("np"),
+						DriveId:      parseDriveId(c),
+						PanDir:       c.String("pdir"),
+						ExcludeNames: c.StringSlice("exn"),
+						BlockSize:    int64(c.Int("bs") * 1024),
+					}))
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "pdir",
+						Usage: "备份文件保存的云盘目录，默认为 /相册备份/<相簿名称>",
+					},
+					cli.StringFlag{
+						Name:  "driveId",
+						Usage: "网盘ID",
+						Value: "",
+					},
+					cli.IntFlag{
+						Name:  "p",
+						Usage: "文件上传并发数量，0代表跟从配置文件设置（取值范围:1 ~ 20）",
+						Value: 0,
+					},
+					cli.BoolFlag{
+						Name:  "np",
+						Usage: "no progress 不展示上传进度条",
+					},
+					cli.StringSliceFlag{
+						Name:  "exn",
+						Usage: "exclude name，指定排除的文件夹或者文件的名称，只支持正则表达式。支持同时排除多个名称，每一个名称就是一个exn参数",
+						Value: nil,
+					},
+					cli.IntFlag{
+						Name:  "bs",
+						Usage: "block size，上传分片大小，单位KB。推荐值：1024 ~ 10240",
+						Value: 10240,
+					},
 				},
 			},
 		},
@@ -610,7 +679,7 @@ func isFileMatchCondition(fileInfo *aliyunpan.FileEntity, filterOption AlbumFile
 	return false
 }
 
-func RunAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
+func RunAlbumDownloadFile(albumNames []string, options *DownloadOptions, albumOpt *AlbumDownloadOptions) {
 	if len(albumNames) == 0 {
 		fmt.Printf("相簿名称不能为空\n")
 		return
@@ -651,7 +720,7 @@ func RunAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 		CacheSize:                  config.Config.CacheSize,
 		BlockSize:                  MaxDownloadRangeSize,
 		MaxRate:                    config.Config.MaxDownloadRate,
-		InstanceStateStorageFormat: downloader.InstanceStateStorageFormatJSON,
+		InstanceStateStorageFormat: downloader.InstanceStateStorageFormatProto3,
 		ShowProgress:               options.ShowProgress,
 		ExcludeNames:               options.ExcludeNames,
 	}
@@ -707,6 +776,9 @@ func RunAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 	// 全局速度统计
 	globalSpeedsStat := &speeds.Speeds{}
 
+	// 增量下载记录
+	ad := newAlbumDownloader(originSaveRootPath, albumOpt)
+
 	// 处理队列
 	for k := range albumNames {
 		record := getAlbumFromName(activeUser, albumNames[k])
@@ -726,8 +798,15 @@ func RunAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 			continue
 		}
 		for _, f := range fileList {
+			if ad.IsBeforeSince(f) {
+				continue
+			}
 			// 补全虚拟网盘路径，规则：/<相簿名称>/文件名称
 			f.Path = "/" + albumNames[k] + "/" + f.FileName
+			savePath := ad.SavePath("/"+albumNames[k], albumNames[k], f)
+			if ad.Skip(record.AlbumId, f, savePath) {
+				continue
+			}
 
 			// 生成下载项
 			newCfg := *cfg
@@ -752,15 +831,10 @@ func RunAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 			//unit.SetFileInfo(pandownload.AlbumFileSource, f)
 
 			// 设置储存的路径
-			if options.SaveTo != "" {
-				unit.OriginSaveRootPath = options.SaveTo
-				unit.SavePath = filepath.Join(options.SaveTo, f.Path)
-			} else {
-				// 使用默认的保存路径
-				unit.OriginSaveRootPath = GetActiveUser().GetSavePath("")
-				unit.SavePath = GetActiveUser().GetSavePath(f.Path)
-			}
+			unit.OriginSaveRootPath = originSaveRootPath
+			unit.SavePath = savePath
 			info := executor.Append(&unit, options.MaxRetry)
+			ad.Add(record.AlbumId, f, &unit, info)
 			fmt.Printf("[%s] 加入下载队列: %s\n", info.Id(), f.Path)
 		}
 	}
@@ -775,13 +849,17 @@ func RunAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 
 	// 输出失败的文件列表
 	failedList := executor.FailedDeque()
-	if failedList.Size() != 0 {
+	failedItems := []*taskframework.TaskInfoItem{}
+	for e := failedList.Shift(); e != nil; e = failedList.Shift() {
+		failedItems = append(failedItems, e.(*taskframework.TaskInfoItem))
+	}
+	if len(failedItems) != 0 {
 		fmt.Printf("以下文件下载失败: \n")
 		tb := cmdtable.NewTable(os.Stdout)
-		for e := failedList.Shift(); e != nil; e = failedList.Shift() {
-			item := e.(*taskframework.TaskInfoItem)
+		for _, item := range failedItems {
 			tb.Append([]string{item.Info.Id(), item.Unit.(*pandownload.DownloadTaskUnit).FilePanPath})
 		}
 		tb.Render()
 	}
+	ad.Finish(failedItems)
 }
@@ -0,0 +1,678 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions/panbackup"
+	"github.com/tickstep/aliyunpan/internal/functions/pandownload"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+	"github.com/urfave/cli"
+)
+
+type (
+	// BackupOptions 快照备份可选项
+	BackupOptions struct {
+		Parallel     int // 文件并发数量
+		ShowProgress bool
+		DriveId      string
+		ExcludeNames []string // 排除的文件名，支持正则表达式
+		BlockSize    int64    // 上传分片大小
+		Retention    *panbackup.RetentionPolicy
+	}
+
+	// BackupRestoreOptions 快照恢复可选项
+	BackupRestoreOptions struct {
+		Parallel     int // 文件并发数量
+		ShowProgress bool
+		DriveId      string
+		IsOverwrite  bool // 覆盖本地已存在的文件
+	}
+)
+
+func CmdBackup() cli.Command {
+	return cli.Command{
+		Name:      "backup",
+		Usage:     "快照备份",
+		UsageText: cmder.App().Name + " backup",
+		Description: `
+    快照备份功能。每次备份都会在云盘备份目录下创建一个以时间命名的快照目录，例如：<云盘目录>/2026-10-18T02-00/...
+    备份使用秒传，未修改的文件不会重复上传数据。每个快照目录下会保存一份清单文件 ` + panbackup.ManifestFileName + `，记录文件的路径，大小和SHA1。
+    支持按照 祖父-父-子(GFS) 策略自动清理过期快照，过期快照会被移到回收站。
+
+	请输入以下命令查看如何使用：
+    aliyunpan backup run -h
+    aliyunpan backup restore -h
+    aliyunpan backup verify -h
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			cli.ShowCommandHelp(c, c.Command.Name)
+			return nil
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "run",
+				Usage:     "创建一个备份快照",
+				UsageText: cmder.App().Name + " backup run [arguments...] <本地目录> <云盘目录>",
+				Description: `
+备份本地目录到云盘目录下的一个新快照中，然后按照保留策略清理过期的快照。只有快照完整的情况下才会清理过期快照。
+
+保留策略说明，多个规则保留的快照取并集，都不配置则保留全部快照：
+    keep-last - 保留最近的N个快照
+    keep-daily - 保留最近N天，每天最新的一个快照
+    keep-weekly - 保留最近N周，每周最新的一个快照
+    keep-monthly - 保留最近N个月，每月最新的一个快照
+    keep-yearly - 保留最近N年，每年最新的一个快照
+
+	例子:
+	1. 将本地目录 D:\tickstep\Documents 备份到云盘目录 /backup/documents
+	aliyunpan backup run D:\tickstep\Documents /backup/documents
+
+	2. 备份并保留最近7天每天一个，最近4周每周一个，最近12个月每月一个快照
+	aliyunpan backup run -keep-daily 7 -keep-weekly 4 -keep-monthly 12 D:\tickstep\Documents /backup/documents
+`,
+				Action: func(c *cli.Context) error {
+					if config.Config.ActiveUser() == nil {
+						return reportError(notLoggedInError())
+					}
+					if c.NArg() != 2 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					return reportError(RunBackup(c.Args().Get(0), c.Args().Get(1), &BackupOptions{
+						Parallel:     c.Int("p"),
+						ShowProgress: !c.Bool("np"),
+						DriveId:      parseDriveId(c),
+						ExcludeNames: c.StringSlice("exn"),
+						BlockSize:    int64(c.Int("bs") * 1024),
+						Retention: &panbackup.RetentionPolicy{
+							KeepLast:    c.Int("keep-last"),
+							KeepDaily:   c.Int("keep-daily"),
+							KeepWeekly:  c.Int("keep-weekly"),
+							KeepMonthly: c.Int("keep-monthly"),
+							KeepYearly:  c.Int("keep-yearly"),
+						},
+					}))
+				},
+				Flags: []cli.Flag{
+					cli.IntFlag{
+						Name:  "p",
+						Usage: "本次操作文件上传并发数量。0代表跟从配置文件设置（取值范围:1 ~ 20）",
+						Value: 0,
+					},
+					cli.BoolFlag{
+						Name:  "np",
+						Usage: "no progress 不展示上传进度条",
+					},
+					cli.StringFlag{
+						Name:  "driveId",
+						Usage: "网盘ID",
+						Value: "",
+					},
+					cli.StringSliceFlag{
+						Name:  "exn",
+						Usage: "exclude name，指定排除的文件夹或者文件的名称，只支持正则表达式。支持同时排除多个名称，每一个名称就是一个exn参数",
+						Value: nil,
+					},
+					cli.IntFlag{
+						Name:  "bs",
+						Usage: "block size，上传分片大小，单位KB。推荐值：1024 ~ 10240。当上传极大单文件时候请适当调高该值",
+						Value: 10240,
+					},
+					cli.IntFlag{
+						Name:  "keep-last",
+						Usage: "保留最近的N个快照",
+					},
+					cli.IntFlag{
+						Name:  "keep-daily",
+						Usage: "保留最近N天，每天最新的一个快照",
+					},
+					cli.IntFlag{
+						Name:  "keep-weekly",
+						Usage: "保留最近N周，每周最新的一个快照",
+					},
+					cli.IntFlag{
+						Name:  "keep-monthly",
+						Usage: "保留最近N个月，每月最新的一个快照",
+					},
+					cli.IntFlag{
+						Name:  "keep-yearly",
+						Usage: "保留最近N年，每年最新的一个快照",
+					},
+				},
+			},
+			{
+				Name:      "list",
+				Aliases:   []string{"ls"},
+				Usage:     "列出云盘目录下的备份快照",
+				UsageText: cmder.App().Name + " backup list <云盘目录>",
+				Action: func(c *cli.Context) error {
+					if config.Config.ActiveUser() == nil {
+						return reportError(notLoggedInError())
+					}
+					if c.NArg() != 1 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					return reportError(RunBackupList(parseDriveId(c), c.Args().Get(0)))
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "driveId",
+						Usage: "网盘ID",
+						Value: "",
+					},
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "恢复备份快照到本地目录",
+				UsageText: cmder.App().Name + " backup restore [arguments...] <云盘快照目录> <本地目录>",
+				Description: `
+下载云盘快照中的所有文件到本地目录，并根据快照清单校验文件的大小和SHA1。
+
+	例子:
+	1. 将快照 /backup/documents/2026-10-18T02-00 恢复到本地目录 D:\restore
+	aliyunpan backup restore /backup/documents/2026-10-18T02-00 D:\restore
+
+	2. 恢复快照，并覆盖本地已存在的文件
+	aliyunpan backup restore -ow /backup/documents/2026-10-18T02-00 D:\restore
+`,
+				Action: func(c *cli.Context) error {
+					if config.Config.ActiveUser() == nil {
+						return reportError(notLoggedInError())
+					}
+					if c.NArg() != 2 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					return reportError(RunBackupRestore(c.Args().Get(0), c.Args().Get(1), &BackupRestoreOptions{
+						Parallel:     c.Int("p"),
+						ShowProgress: !c.Bool("np"),
+						DriveId:      parseDriveId(c),
+						IsOverwrite:  c.Bool("ow"),
+					}))
+				},
+				Flags: []cli.Flag{
+					cli.IntFlag{
+						Name:  "p",
+						Usage: "parallel,指定同时进行下载文件的数量（取值范围:1 ~ 3）",
+						Value: 1,
+					},
+					cli.BoolFlag{
+						Name:  "np",
+						Usage: "no progress 不展示下载进度条",
+					},
+					cli.BoolFlag{
+						Name:  "ow",
+						Usage: "overwrite, 覆盖本地已存在的文件",
+					},
+					cli.StringFlag{
+						Name:  "driveId",
+						Usage: "网盘ID",
+						Value: "",
+					},
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "校验备份快照",
+				UsageText: cmder.App().Name + " backup verify [arguments...] <云盘快照目录>",
+				Description: `
+根据快照清单校验云盘快照中文件的大小和SHA1。指定 -local 参数可以同时校验已经恢复到本地目录的文件。
+
+	例子:
+	1. 校验云盘快照 /backup/documents/2026-10-18T02-00
+	aliyunpan backup verify /backup/documents/2026-10-18T02-00
+
+	2. 校验云盘快照，并校验本地目录 D:\restore 中恢复的文件
+	aliyunpan backup verify -local D:\restore /backup/documents/2026-10-18T02-00
+`,
+				Action: func(c *cli.Context) error {
+					if config.Config.ActiveUser() == nil {
+						return reportError(notLoggedInError())
+					}
+					if c.NArg() != 1 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					return reportError(RunBackupVerify(parseDriveId(c), c.Args().Get(0), c.String("local")))
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "local",
+						Usage: "同时校验本地目录中恢复的文件",
+					},
+					cli.StringFlag{
+						Name:  "driveId",
+						Usage: "网盘ID",
+						Value: "",
+					},
+				},
+			},
+		},
+	}
+}
+
+// listBackupLocalFiles 获取本地备份目录下的文件列表，并计算文件的SHA1。无法读取的文件SHA1为空
+func listBackupLocalFiles(localDir string, excludeNames []string) ([]*panbackup.ManifestFile, error) {
+	rootPath := path.Clean(strings.ReplaceAll(localDir, "\\", "/"))
+	files := []*panbackup.ManifestFile{}
+	walkFunc := func(file localfile.SymlinkFile, fi os.FileInfo, err error) error {
+		if err != nil {
+			logger.Verboseln("backup process file: ", file, " error: ", err)
+			return nil
+		}
+		if utils.IsExcludeFile(file.LogicPath, &excludeNames) {
+			return filepath.SkipDir
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		mf := &panbackup.ManifestFile{
+			Path: strings.TrimPrefix(strings.TrimPrefix(file.LogicPath, rootPath), "/"),
+			Size: fi.Size(),
+		}
+		if lfc, e := localfile.GetFileSum(file.RealPath, localfile.CHECKSUM_SHA1); e == nil {
+			mf.Size = lfc.Length
+			mf.Sha1 = strings.ToUpper(lfc.SHA1)
+		} else {
+			logger.Verboseln("calc local file sha1 error: ", file.RealPath, e)
+		}
+		files = append(files, mf)
+		return nil
+	}
+	if e := localfile.WalkAllFile(localfile.NewSymlinkFile(localDir), walkFunc); e != nil && e != filepath.SkipDir {
+		return nil, e
+	}
+	return files, nil
+}
+
+// verifyBackupLocalFiles 计算本地文件SHA1，并和快照清单进行对比。本地多余的文件不做检查
+func verifyBackupLocalFiles(manifest *panbackup.Manifest, localDir string) *panbackup.ManifestDiff {
+	actualFiles := []*panbackup.ManifestFile{}
+	for _, f := range manifest.Files {
+		localPath := filepath.Join(localDir, filepath.FromSlash(f.Path))
+		lfc, e := localfile.GetFileSum(localPath, localfile.CHECKSUM_SHA1)
+		if e != nil {
+			logger.Verboseln("calc local file sha1 error: ", localPath, e)
+			continue
+		}
+		actualFiles = append(actualFiles, &panbackup.ManifestFile{
+			Path: f.Path,
+			Size: lfc.Length,
+			Sha1: lfc.SHA1,
+		})
+	}
+	diff := manifest.Compare(actualFiles)
+	diff.Extra = nil
+	return diff
+}
+
+// printManifestDiff 输出清单对比结果
+func printManifestDiff(diff *panbackup.ManifestDiff) {
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "问题", "文件", "文件大小"})
+	idx := 0
+	appendRows := func(files []*panbackup.ManifestFile, problem string) {
+		for _, f := range files {
+			idx++
+			tb.Append([]string{strconv.Itoa(idx), problem, f.Path, converter.ConvertFileSize(f.Size, 2)})
+		}
+	}
+	appendRows(diff.Missing, "缺失")
+	appendRows(diff.Mismatch, "不一致")
+	appendRows(diff.Extra, "多余")
+	tb.Render()
+}
+
+// downloadBackupManifest 下载快照清单文件
+func downloadBackupManifest(driveId, snapshotPath string) (*panbackup.Manifest, error) {
+	tmpDir, e := os.MkdirTemp("", "aliyunpan-backup-")
+	if e != nil {
+		return nil, e
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifestPanPath := path.Join(snapshotPath, panbackup.ManifestFileName)
+	RunDownload([]string{manifestPanPath}, &DownloadOptions{
+		DownloadActionId: utils.UuidStr(),
+		SaveTo:           tmpDir,
+		Parallel:         1,
+		MaxRetry:         pandownload.DefaultDownloadMaxRetry,
+		DriveId:          driveId,
+	})
+	return panbackup.LoadManifestFile(filepath.Join(tmpDir, manifestPanPath))
+}
+
+// RunBackup 创建备份快照
+func RunBackup(localDir, panDir string, opt *BackupOptions) error {
+	activeUser := GetActiveUser()
+	panClient := activeUser.PanClient()
+	if opt == nil {
+		opt = &BackupOptions{}
+	}
+
+	localDir = filepath.Clean(localDir)
+	if fi, e := os.Stat(localDir); e != nil || !fi.IsDir() {
+		return notFoundErrorf("本地目录不存在或者不是文件夹: %s", localDir)
+	}
+	panDir = activeUser.PathJoin(opt.DriveId, panDir)
+
+	// 创建快照目录
+	snapshotName := panbackup.NewSnapshotName(time.Now())
+	snapshotPath := path.Join(panDir, snapshotName)
+	panClient.OpenapiPanClient().ClearCache()
+	if fi, apierr := panClient.OpenapiPanClient().FileInfoByPath(opt.DriveId, snapshotPath); apierr == nil && fi != nil && fi.FileId != "" {
+		return errorf("快照已存在，请稍后再试: %s", snapshotPath)
+	} else if apierr != nil && apierr.Code != apierror.ApiCodeFileNotFoundCode {
+		return apiOutputError(apierr, "获取云盘快照目录错误: ")
+	}
+	if _, apierr := panClient.OpenapiPanClient().MkdirByFullPath(opt.DriveId, snapshotPath); apierr != nil {
+		return apiOutputError(apierr, "创建云盘快照目录失败: "+snapshotPath+", ")
+	}
+	fmt.Printf("创建快照: %s\n", snapshotPath)
+
+	// 上传本地文件，使用秒传，未修改的文件无需重复上传
+	fmt.Println("正在计算本地文件SHA1，请稍候...")
+	localFiles, e := listBackupLocalFiles(localDir, opt.ExcludeNames)
+	if e != nil {
+		return errorf("遍历本地目录错误: %s", e)
+	}
+	entries, e := os.ReadDir(localDir)
+	if e != nil {
+		return errorf("读取本地目录错误: %s", e)
+	}
+	localPaths := []string{}
+	for _, entry := range entries {
+		localPaths = append(localPaths, filepath.Join(localDir, entry.Name()))
+	}
+	if len(localPaths) > 0 {
+		RunUpload(localPaths, snapshotPath, &UploadOptions{
+			AllParallel:  opt.Parallel,
+			Parallel:     1,
+			MaxRetry:     DefaultUploadMaxRetry,
+			ShowProgress: opt.ShowProgress,
+			DriveId:      opt.DriveId,
+			ExcludeNames: opt.ExcludeNames,
+			BlockSize:    opt.BlockSize,
+		})
+	}
+
+	// 生成快照清单，SHA1使用本地文件的哈希值，云盘文件的哈希值和本地一致才算备份成功
+	panClient.OpenapiPanClient().ClearCache()
+	panFiles, e := panbackup.ListPanSnapshotFiles(panClient, opt.DriveId, snapshotPath)
+	if e != nil {
+		return apiOutputError(e, "获取云盘快照文件列表错误: ")
+	}
+	manifest := &panbackup.Manifest{
+		Version:         panbackup.ManifestVersion,
+		Snapshot:        snapshotName,
+		LocalFolderPath: localDir,
+		CreatedAt:       utils.NowTimeStr(),
+		Files:           []*panbackup.ManifestFile{},
+	}
+	for _, f := range localFiles {
+		manifest.AddFile(f)
+	}
+	manifest.Sort()
+	diff := manifest.Compare(panFiles)
+	// 读取失败的本地文件没有SHA1，无法确认是否备份成功
+	reported := map[*panbackup.ManifestFile]bool{}
+	for _, f := range append(diff.Missing, diff.Mismatch...) {
+		reported[f] = true
+	}
+	for _, f := range localFiles {
+		if f.Sha1 == "" && !reported[f] {
+			diff.Mismatch = append(diff.Mismatch, f)
+		}
+	}
+	manifest.Complete = len(diff.Missing) == 0 && len(diff.Mismatch) == 0
+
+	tmpDir, e := os.MkdirTemp("", "aliyunpan-backup-")
+	if e != nil {
+		return errorf("创建临时目录错误: %s", e)
+	}
+	defer os.RemoveAll(tmpDir)
+	manifestFilePath := filepath.Join(tmpDir, panbackup.ManifestFileName)
+	if e = panbackup.SaveManifestFile(manifest, manifestFilePath); e != nil {
+		return errorf("保存快照清单错误: %s", e)
+	}
+	summary := RunUpload([]string{manifestFilePath}, snapshotPath, &UploadOptions{
+		AllParallel: 1,
+		Parallel:    1,
+		MaxRetry:    DefaultUploadMaxRetry,
+		DriveId:     opt.DriveId,
+		BlockSize:   opt.BlockSize,
+	})
+	if summary.exitCode() != ExitCodeSuccess {
+		return errorf("上传快照清单失败: %s", snapshotPath)
+	}
+
+	fmt.Printf("\n快照: %s, 文件数量: %d, 数据总量: %s\n", snapshotPath, len(manifest.Files), converter.ConvertFileSize(manifest.TotalSize, 2))
+	if !manifest.Complete {
+		fmt.Printf("快照不完整，以下文件备份失败，本次不清理过期快照: \n")
+		printManifestDiff(&panbackup.ManifestDiff{Missing: diff.Missing, Mismatch: diff.Mismatch})
+		return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "快照不完整: %s", snapshotPath)
+	}
+
+	// 清理过期快照
+	if opt.Retention.IsEmpty() {
+		return nil
+	}
+	fmt.Printf("快照保留策略: %s\n", opt.Retention)
+	snapshots, e := panbackup.ListSnapshots(panClient, opt.DriveId, panDir)
+	if e != nil {
+		return apiOutputError(e, "获取快照列表错误: ")
+	}
+	// 读取快照清单，不完整的快照不占用保留名额
+	for _, s := range snapshots {
+		if s.Name == snapshotName {
+			continue
+		}
+		m, e := panbackup.LoadPanManifest(panClient, opt.DriveId, s.Path)
+		if e != nil {
+			logger.Verboseln("load snapshot manifest error: ", s.Path, e)
+		}
+		s.Incomplete = e != nil || !m.Complete
+	}
+	failedCount := 0
+	for _, s := range panbackup.SelectExpiredSnapshots(snapshots, opt.Retention) {
+		if s.Name == snapshotName {
+			continue
+		}
+		if _, apierr := panClient.OpenapiPanClient().FileDelete(&aliyunpan.FileBatchActionParam{
+			DriveId: opt.DriveId,
+			FileId:  s.File.FileId,
+		}); apierr != nil {
+			fmt.Printf("删除过期快照失败: %s, %s\n", s.Path, apierr)
+			failedCount++
+			continue
+		}
+		fmt.Printf("删除过期快照: %s\n", s.Path)
+		time.Sleep(200 * time.Millisecond)
+	}
+	activeUser.DeleteCache([]string{panDir})
+	if failedCount > 0 {
+		return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分过期快照删除失败")
+	}
+	return nil
+}
+
+// RunBackupList 列出备份快照
+func RunBackupList(driveId, panDir string) error {
+	activeUser := GetActiveUser()
+	panDir = activeUser.PathJoin(driveId, panDir)
+	snapshots, e := panbackup.ListSnapshots(activeUser.PanClient(), driveId, panDir)
+	if e != nil {
+		return apiOutputError(e, "获取快照列表错误: ")
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("没有备份快照")
+		return nil
+	}
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "快照", "快照时间", "路径"})
+	for k, s := range snapshots {
+		tb.Append([]string{strconv.Itoa(k + 1), s.Name, s.Time.Format("2006-01-02 15:04"), s.Path})
+	}
+	tb.Render()
+	return nil
+}
+
+// RunBackupRestore 恢复备份快照到本地目录
+func RunBackupRestore(snapshotPath, localDir string, opt *BackupRestoreOptions) error {
+	activeUser := GetActiveUser()
+	if opt == nil {
+		opt = &BackupRestoreOptions{}
+	}
+	snapshotPath = activeUser.PathJoin(opt.DriveId, snapshotPath)
+	fi, apierr := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(opt.DriveId, snapshotPath)
+	if apierr != nil || !fi.IsFolder() {
+		return notFoundErrorf("快照目录不存在: %s", snapshotPath)
+	}
+	localDir = filepath.Clean(localDir)
+	if e := os.MkdirAll(localDir, 0755); e != nil {
+		return errorf("创建本地目录错误: %s", e)
+	}
+
+	// 先下载到临时目录，下载的文件会保留云盘的完整路径
+	stagingDir := filepath.Join(localDir, ".aliyunpan-restore-"+path.Base(snapshotPath))
+	defer os.RemoveAll(stagingDir)
+	RunDownload([]string{snapshotPath}, &DownloadOptions{
+		DownloadActionId: utils.UuidStr(),
+		IsOverwrite:      true,
+		SaveTo:           stagingDir,
+		Parallel:         opt.Parallel,
+		MaxRetry:         pandownload.DefaultDownloadMaxRetry,
+		ShowProgress:     opt.ShowProgress,
+		DriveId:          opt.DriveId,
+	})
+	downloadRoot := filepath.Join(stagingDir, filepath.FromSlash(snapshotPath))
+	manifest, e := panbackup.LoadManifestFile(filepath.Join(downloadRoot, panbackup.ManifestFileName))
+	if e != nil {
+		fmt.Printf("警告: 读取快照清单失败，无法校验恢复的文件: %s\n", e)
+	}
+
+	// 移动文件到本地目录
+	fmt.Printf("\n正在恢复文件到: %s\n", localDir)
+	restoreCount, failedCount := 0, 0
+	filepath.Walk(downloadRoot, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		relativePath, _ := filepath.Rel(downloadRoot, p)
+		if relativePath == panbackup.ManifestFileName || strings.HasSuffix(p, pandownload.DownloadSuffix) {
+			return nil
+		}
+		target := filepath.Join(localDir, relativePath)
+		if _, e := os.Stat(target); e == nil && !opt.IsOverwrite {
+			fmt.Printf("本地文件已存在，跳过: %s\n", target)
+			return nil
+		}
+		os.MkdirAll(filepath.Dir(target), 0755)
+		if e := os.Rename(p, target); e != nil {
+			fmt.Printf("恢复文件失败: %s, %s\n", target, e)
+			failedCount++
+			return nil
+		}
+		restoreCount++
+		return nil
+	})
+	fmt.Printf("恢复文件数量: %d\n", restoreCount)
+
+	if failedCount > 0 {
+		return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分文件恢复失败")
+	}
+
+	// 校验文件
+	if manifest == nil {
+		return nil
+	}
+	fmt.Println("正在校验恢复的文件，请稍候...")
+	diff := verifyBackupLocalFiles(manifest, localDir)
+	if diff.IsEmpty() {
+		fmt.Printf("校验通过，共 %d 个文件\n", len(manifest.Files))
+		return nil
+	}
+	fmt.Println("以下文件校验失败: ")
+	printManifestDiff(diff)
+	return newOutputError(errCodeChecksumMismatch, ExitCodeChecksumMismatch, "恢复的文件校验失败")
+}
+
+// RunBackupVerify 校验备份快照
+func RunBackupVerify(driveId, snapshotPath, localDir string) error {
+	activeUser := GetActiveUser()
+	panClient := activeUser.PanClient()
+	snapshotPath = activeUser.PathJoin(driveId, snapshotPath)
+	manifest, e := downloadBackupManifest(driveId, snapshotPath)
+	if e != nil {
+		return apiOutputError(e, "读取快照清单失败: ")
+	}
+	fmt.Printf("\n快照: %s, 创建时间: %s, 文件数量: %d, 数据总量: %s\n", snapshotPath, manifest.CreatedAt,
+		len(manifest.Files), converter.ConvertFileSize(manifest.TotalSize, 2))
+	if !manifest.Complete {
+		fmt.Println("警告: 该快照创建时未完整备份")
+	}
+
+	// 校验云盘文件
+	panClient.OpenapiPanClient().ClearCache()
+	panFiles, e := panbackup.ListPanSnapshotFiles(panClient, driveId, snapshotPath)
+	if e != nil {
+		return apiOutputError(e, "获取云盘快照文件列表错误: ")
+	}
+	verifyFailed := false
+	diff := manifest.Compare(panFiles)
+	if diff.IsEmpty() {
+		fmt.Println("云盘快照校验通过")
+	} else {
+		fmt.Println("云盘快照校验失败: ")
+		printManifestDiff(diff)
+		verifyFailed = true
+	}
+
+	// 校验本地文件
+	if localDir != "" {
+		fmt.Println("正在校验本地文件，请稍候...")
+		diff = verifyBackupLocalFiles(manifest, filepath.Clean(localDir))
+		if diff.IsEmpty() {
+			fmt.Println("本地文件校验通过")
+		} else {
+			fmt.Println("本地文件校验失败: ")
+			printManifestDiff(diff)
+			verifyFailed = true
+		}
+	}
+	if verifyFailed {
+		return newOutputError(errCodeChecksumMismatch, ExitCodeChecksumMismatch, "快照校验失败: %s", snapshotPath)
+	}
+	return nil
+}
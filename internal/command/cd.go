@@ -50,8 +50,7 @@ func CmdCd() cli.Command {
 				return nil
 			}
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
 			RunChangeDirectory(parseDriveId(c), c.Args().Get(0))
 			return nil
@@ -75,8 +74,7 @@ func CmdPwd() cli.Command {
 		Before:    ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
 			activeUser := config.Config.ActiveUser()
 			if activeUser.IsFileDriveActive() {
@@ -211,6 +211,7 @@ func CmdTool() cli.Command {
 			return nil
 		},
 		Subcommands: []cli.Command{
+			cmdToolUploads(),
 			{
 				Name:  "getip",
 				Usage: "获取IP地址",
@@ -0,0 +1,393 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/library/homedir"
+	"github.com/urfave/cli"
+)
+
+const (
+	// CompleteCommandName 补全脚本调用的隐藏命令
+	CompleteCommandName = "__complete"
+
+	completePathPan   = "pan"
+	completePathLocal = "local"
+)
+
+var (
+	// completePathCommands 支持补全路径的命令，值为路径类型
+	completePathCommands = map[string]string{
+		"cd": completePathPan, "cp": completePathPan, "xcp": completePathPan, "download": completePathPan,
+		"ls": completePathPan, "mkdir": completePathPan, "mv": completePathPan, "rename": completePathPan,
+		"rm": completePathPan, "tree": completePathPan, "du": completePathPan,
+		"verify": completePathPan,
+		"upload": completePathLocal, "lcd": completePathLocal, "lls": completePathLocal, "run-script": completePathLocal,
+	}
+
+	// completeTargetPathCommands 最后一个参数为目标路径的命令，值为目标路径的类型。
+	// 无法确定正在输入的是否是最后一个参数，因此从第二个参数开始同时补全目标路径的文件夹
+	completeTargetPathCommands = map[string]string{
+		"upload": completePathPan,
+		"verify": completePathLocal,
+	}
+
+	// completeTwoPathCommands 只有两个路径参数的命令，第二个参数只补全目标路径
+	completeTwoPathCommands = []string{"verify"}
+
+	// completeFolderOnlyCommands 只需要补全文件夹的命令
+	completeFolderOnlyCommands = []string{"cd", "ls", "du", "verify", "lcd", "lls"}
+
+	// completePathFlags 值为路径的选项，值为路径类型
+	completePathFlags = map[string]string{
+		"dir":    completePathPan,
+		"ldir":   completePathLocal,
+		"pdir":   completePathPan,
+		"report": completePathLocal,
+		"saveto": completePathLocal,
+	}
+
+	completionScripts = map[string]string{
+		"bash": `# bash completion for %[1]s
+_%[1]s_complete() {
+    local IFS=$'\n'
+    COMPREPLY=($(%[1]s %[2]s "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+        compopt -o nospace
+    fi
+}
+complete -F _%[1]s_complete %[1]s
+`,
+		"zsh": `#compdef %[1]s
+# zsh completion for %[1]s
+_%[1]s() {
+    local -a candidates folders others
+    local c
+    candidates=("${(@f)$(%[1]s %[2]s "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    for c in $candidates; do
+        [[ -z $c ]] && continue
+        if [[ $c == */ ]]; then
+            folders+=("$c")
+        else
+            others+=("$c")
+        fi
+    done
+    (( ${#folders} )) && compadd -S '' -- "${folders[@]}"
+    (( ${#others} )) && compadd -- "${others[@]}"
+}
+compdef _%[1]s %[1]s
+`,
+		"fish": `# fish completion for %[1]s
+function __%[1]s_complete
+    set -l args (commandline -opc)[2..-1] (commandline -ct)
+    %[1]s %[2]s $args 2>/dev/null
+end
+complete -c %[1]s -f -a '(__%[1]s_complete)'
+`,
+	}
+)
+
+func CmdCompletion() cli.Command {
+	return cli.Command{
+		Name:      "completion",
+		Usage:     "生成命令行自动补全脚本",
+		UsageText: cmder.App().Name + " completion bash|zsh|fish",
+		Description: `
+	生成 bash, zsh, fish 的自动补全脚本，支持补全命令、选项，以及云盘文件路径和本地文件路径。
+
+	示例:
+
+	bash 当前会话生效
+	source <(aliyunpan completion bash)
+
+	bash 永久生效
+	aliyunpan completion bash > /etc/bash_completion.d/aliyunpan
+
+	zsh，需要确保已经执行 compinit
+	aliyunpan completion zsh > "${fpath[1]}/_aliyunpan"
+
+	fish
+	aliyunpan completion fish > ~/.config/fish/completions/aliyunpan.fish
+`,
+		Category: "其他",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			script, ok := completionScripts[strings.ToLower(c.Args().First())]
+			if !ok {
+				return reportError(usageErrorf("不支持的shell: %s，可选值：bash, zsh, fish", c.Args().First()))
+			}
+			fmt.Printf(script, c.App.Name, CompleteCommandName)
+			return nil
+		},
+	}
+}
+
+// CmdComplete 补全脚本调用的隐藏命令，参数为已输入的命令行参数，最后一个为正在输入的参数，每行输出一个候选项
+func CmdComplete() cli.Command {
+	return cli.Command{
+		Name:            CompleteCommandName,
+		Hidden:          true,
+		HideHelp:        true,
+		SkipFlagParsing: true,
+		Action: func(c *cli.Context) error {
+			for _, s := range completeArgs(c.App, c.Args()) {
+				fmt.Println(s)
+			}
+			return nil
+		},
+	}
+}
+
+// IsCompleteMode 是否是补全脚本调用本程序，补全时不需要检查登录状态
+func IsCompleteMode(args []string) bool {
+	return len(args) > 1 && args[1] == CompleteCommandName
+}
+
+// completeArgs 根据命令定义获取候选项
+func completeArgs(app *cli.App, args []string) []string {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	var (
+		cur      = args[len(args)-1]
+		commands = app.Commands
+		flags    = app.Flags
+		cmd      *cli.Command
+		rootName string
+		// hasArg 已经输入了命令的参数，不再补全子命令
+		hasArg bool
+		// argCount 已经输入的命令参数数量
+		argCount int
+		// valueFlag 上一个参数是需要值的选项
+		valueFlag cli.Flag
+	)
+	for _, w := range args[:len(args)-1] {
+		if valueFlag != nil {
+			valueFlag = nil
+			continue
+		}
+		if strings.HasPrefix(w, "-") && w != "-" {
+			if f := findFlag(flags, w); f != nil && flagTakesValue(f) && !strings.Contains(w, "=") {
+				valueFlag = f
+			}
+			continue
+		}
+		if hasArg {
+			continue
+		}
+		if sub := findCommand(commands, w); sub != nil {
+			cmd = sub
+			if rootName == "" {
+				rootName = sub.Name
+			}
+			commands = sub.Subcommands
+			flags = sub.Flags
+			continue
+		}
+		hasArg = true
+		argCount++
+	}
+
+	// 选项的值
+	if valueFlag != nil {
+		if t, ok := completePathFlags[flagNames(valueFlag)[0]]; ok {
+			return completePath(t, cur, false)
+		}
+		return nil
+	}
+
+	// 选项
+	if strings.HasPrefix(cur, "-") {
+		r := []string{}
+		for _, f := range flags {
+			for _, name := range flagNames(f) {
+				prefix := "--"
+				if len(name) == 1 || !strings.HasPrefix(cur, "--") {
+					prefix = "-"
+				}
+				if strings.HasPrefix(prefix+name, cur) {
+					r = append(r, prefix+name)
+				}
+			}
+		}
+		return r
+	}
+
+	// 子命令
+	if !hasArg && (cmd == nil || len(commands) > 0) {
+		r := []string{}
+		for _, sub := range commands {
+			if sub.Hidden {
+				continue
+			}
+			for _, name := range sub.Names() {
+				if strings.HasPrefix(name, cur) {
+					r = append(r, name)
+				}
+			}
+		}
+		if cmd == nil && strings.HasPrefix("help", cur) {
+			r = append(r, "help")
+		}
+		return r
+	}
+
+	// 文件路径
+	if t, ok := completePathCommands[rootName]; ok {
+		onlyFolder := false
+		for _, name := range completeFolderOnlyCommands {
+			if name == rootName {
+				onlyFolder = true
+			}
+		}
+		r := completePath(t, cur, onlyFolder)
+		if target, ok := completeTargetPathCommands[rootName]; ok && argCount > 0 {
+			for _, name := range completeTwoPathCommands {
+				if name == rootName {
+					return completePath(target, cur, onlyFolder)
+				}
+			}
+			existed := map[string]bool{}
+			for _, p := range r {
+				existed[p] = true
+			}
+			for _, p := range completePath(target, cur, true) {
+				if !existed[p] {
+					r = append(r, p)
+				}
+			}
+		}
+		return r
+	}
+	return nil
+}
+
+func findCommand(commands []cli.Command, name string) *cli.Command {
+	for k := range commands {
+		if commands[k].HasName(name) {
+			return &commands[k]
+		}
+	}
+	return nil
+}
+
+func findFlag(flags []cli.Flag, arg string) cli.Flag {
+	name := strings.TrimLeft(arg, "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+	for _, f := range flags {
+		for _, n := range flagNames(f) {
+			if n == name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// flagNames 选项的名称，包括别名
+func flagNames(f cli.Flag) []string {
+	names := []string{}
+	for _, name := range strings.Split(f.GetName(), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func flagTakesValue(f cli.Flag) bool {
+	switch f.(type) {
+	case cli.BoolFlag, *cli.BoolFlag, cli.BoolTFlag, *cli.BoolTFlag:
+		return false
+	}
+	return true
+}
+
+// completePath 补全文件路径，文件夹以 / 结尾
+func completePath(pathType, cur string, onlyFolder bool) []string {
+	// 已输入的目录部分原样保留，只匹配文件名前缀
+	dir, prefix := "", cur
+	if i := strings.LastIndex(cur, "/"); i >= 0 {
+		dir, prefix = cur[:i+1], cur[i+1:]
+	}
+
+	type entry struct {
+		name     string
+		isFolder bool
+	}
+	entries := []entry{}
+	if pathType == completePathPan {
+		activeUser := GetActiveUser()
+		if activeUser == nil {
+			return nil
+		}
+		targetDir := dir
+		if strings.HasPrefix(targetDir, "~") {
+			// 云盘的主目录~默认为根目录
+			targetDir = "/" + strings.TrimLeft(strings.TrimPrefix(targetDir, "~"), "/")
+		}
+		targetDir = activeUser.PathJoin(activeUser.ActiveDriveId, targetDir)
+		files, err := activeUser.CacheFilesDirectoriesList(targetDir)
+		if err != nil {
+			return nil
+		}
+		for _, f := range files {
+			entries = append(entries, entry{f.FileName, f.IsFolder()})
+		}
+	} else {
+		targetDir := dir
+		if targetDir == "" {
+			targetDir = "."
+		} else if p, e := homedir.Expand(targetDir); e == nil {
+			targetDir = p
+		}
+		files, err := os.ReadDir(filepath.FromSlash(targetDir))
+		if err != nil {
+			return nil
+		}
+		for _, f := range files {
+			isFolder := f.IsDir()
+			if !isFolder && f.Type()&os.ModeSymlink != 0 {
+				if fi, e := os.Stat(filepath.Join(targetDir, f.Name())); e == nil {
+					isFolder = fi.IsDir()
+				}
+			}
+			entries = append(entries, entry{f.Name(), isFolder})
+		}
+	}
+
+	r := []string{}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.name, prefix) || (onlyFolder && !e.isFolder) {
+			continue
+		}
+		if e.isFolder {
+			r = append(r, dir+e.name+"/")
+		} else {
+			r = append(r, dir+e.name)
+		}
+	}
+	return r
+}
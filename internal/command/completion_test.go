@@ -0,0 +1,96 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestCompleteArgs(t *testing.T) {
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{cli.StringFlag{Name: "output"}}
+	app.Commands = []cli.Command{
+		{Name: "login"},
+		{Name: "logout", Hidden: true},
+		{Name: "ls", Aliases: []string{"l", "ll"}},
+		{
+			Name: "sync",
+			Subcommands: []cli.Command{
+				{
+					Name: "start",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "ldir"},
+						cli.StringFlag{Name: "mode"},
+						cli.BoolFlag{Name: "log"},
+					},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		args   []string
+		expect []string
+	}{
+		{[]string{"lo"}, []string{"login"}},
+		{[]string{"l"}, []string{"login", "ls", "l", "ll"}},
+		{[]string{"--output", "json", "s"}, []string{"sync"}},
+		{[]string{"sync", ""}, []string{"start"}},
+		{[]string{"sync", "start", "-l"}, []string{"-ldir", "-log"}},
+		{[]string{"sync", "start", "--m"}, []string{"--mode"}},
+		{[]string{"sync", "start", "-mode", ""}, nil},
+		{[]string{"sync", "start", "-log", ""}, nil},
+		{[]string{"sync", "start", "x", ""}, nil},
+	}
+	for _, c := range cases {
+		r := completeArgs(app, c.args)
+		if len(r) == 0 && len(c.expect) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(r, c.expect) {
+			t.Errorf("args %v: expected %v, got %v", c.args, c.expect, r)
+		}
+	}
+}
+
+func TestCompleteLocalPath(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "doc"), 0755)
+	os.WriteFile(filepath.Join(dir, "data.txt"), []byte("1"), 0644)
+	os.WriteFile(filepath.Join(dir, "readme.md"), []byte("1"), 0644)
+
+	prefix := filepath.ToSlash(dir) + "/"
+	r := completePath(completePathLocal, prefix+"d", false)
+	if !reflect.DeepEqual(r, []string{prefix + "data.txt", prefix + "doc/"}) {
+		t.Errorf("unexpected result: %v", r)
+	}
+	r = completePath(completePathLocal, prefix, true)
+	if !reflect.DeepEqual(r, []string{prefix + "doc/"}) {
+		t.Errorf("unexpected result: %v", r)
+	}
+
+	// upload 的第一个参数只补全本地路径，未登录时不补全云盘路径
+	app := cli.NewApp()
+	app.Commands = []cli.Command{{Name: "upload"}}
+	r = completeArgs(app, []string{"upload", prefix + "d"})
+	if !reflect.DeepEqual(r, []string{prefix + "data.txt", prefix + "doc/"}) {
+		t.Errorf("unexpected result: %v", r)
+	}
+	r = completeArgs(app, []string{"upload", prefix + "data.txt", prefix + "d"})
+	if !reflect.DeepEqual(r, []string{prefix + "data.txt", prefix + "doc/"}) {
+		t.Errorf("unexpected result: %v", r)
+	}
+
+	// verify 的第二个参数是本地目录，只补全本地文件夹
+	app.Commands = append(app.Commands, cli.Command{Name: "verify"})
+	r = completeArgs(app, []string{"verify", "/photos", prefix + "d"})
+	if !reflect.DeepEqual(r, []string{prefix + "doc/"}) {
+		t.Errorf("unexpected result: %v", r)
+	}
+	if r = completeArgs(app, []string{"verify", prefix + "d"}); len(r) != 0 {
+		t.Errorf("first verify argument should not complete local paths: %v", r)
+	}
+}
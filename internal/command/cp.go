@@ -48,11 +48,9 @@ func CmdCp() cli.Command {
 				return nil
 			}
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
-			RunCopy(parseDriveId(c), c.Args()...)
-			return nil
+			return reportError(RunCopy(parseDriveId(c), c.Args()...))
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -65,21 +63,18 @@ func CmdCp() cli.Command {
 }
 
 // RunCopy 执行复制文件/目录
-func RunCopy(driveId string, paths ...string) {
+func RunCopy(driveId string, paths ...string) error {
 	activeUser := GetActiveUser()
 	cacheCleanPaths := []string{}
 	opFileList, targetFile, _, err := getFileInfo(driveId, paths...)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 	if targetFile == nil {
-		fmt.Println("目标文件不存在")
-		return
+		return notFoundErrorf("目标文件不存在")
 	}
 	if opFileList == nil || len(opFileList) == 0 {
-		fmt.Println("没有有效的文件可复制")
-		return
+		return notFoundErrorf("没有有效的文件可复制")
 	}
 	cacheCleanPaths = append(cacheCleanPaths, targetFile.Path)
 
@@ -118,6 +113,10 @@ func RunCopy(driveId string, paths ...string) {
 		pnt()
 		activeUser.DeleteCache(cacheCleanPaths)
 	} else {
-		fmt.Println("无法复制文件，请稍后重试")
+		return errorf("无法复制文件，请稍后重试")
+	}
+	if len(failedCopyFiles) > 0 {
+		return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分文件复制失败")
 	}
+	return nil
 }
@@ -0,0 +1,693 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/plugins"
+	"github.com/tickstep/library-go/converter"
+	"github.com/urfave/cli"
+)
+
+const (
+	// DedupeKeepOldest 保留创建时间最早的文件
+	DedupeKeepOldest = "oldest"
+	// DedupeKeepNewest 保留创建时间最晚的文件
+	DedupeKeepNewest = "newest"
+	// DedupeKeepPathPrefix 保留指定路径前缀下的文件
+	DedupeKeepPathPrefix = "path-prefix"
+)
+
+type (
+	// DedupeReport 重复文件扫描报告，保存为JSON文件后可以人工检查，再使用 dedupe apply -report 执行清理
+	DedupeReport struct {
+		CreatedAt string   `json:"createdAt"`
+		DriveIds  []string `json:"driveIds"`
+		Paths     []string `json:"paths"`
+		// FileCount 扫描的文件数量
+		FileCount int `json:"fileCount"`
+		// GroupCount 重复文件组数量
+		GroupCount int `json:"groupCount"`
+		// DuplicateCount 多余的文件副本数量
+		DuplicateCount int `json:"duplicateCount"`
+		// WastedSize 多余的文件副本占用的空间
+		WastedSize int64          `json:"wastedSize"`
+		Groups     []*DedupeGroup `json:"groups"`
+	}
+
+	// DedupeGroup 内容相同的一组文件
+	DedupeGroup struct {
+		ContentHash string        `json:"contentHash"`
+		Size        int64         `json:"size"`
+		WastedSize  int64         `json:"wastedSize"`
+		Files       []*FileOutput `json:"files"`
+	}
+
+	// DedupeFileOutput 重复文件输出格式，dedupe scan 命令使用
+	DedupeFileOutput struct {
+		// Group 重复文件组序号，从1开始
+		Group int `json:"group"`
+		FileOutput
+	}
+
+	// DedupeResultOutput 重复文件清理结果输出格式，dedupe apply 命令使用
+	DedupeResultOutput struct {
+		Group int `json:"group"`
+		// Status 处理结果：keep-保留，removed-已删除，skipped-跳过，failed-删除失败，planned-待删除(-dry)
+		Status string `json:"status"`
+		// Reason 跳过或者失败的原因
+		Reason string `json:"reason"`
+		FileOutput
+	}
+
+	// DedupeScanOptions 重复文件扫描可选项
+	DedupeScanOptions struct {
+		DriveIds []string
+		Paths    []string
+		MinSize  int64
+	}
+
+	// dedupePlanItem 一组重复文件的清理计划
+	dedupePlanItem struct {
+		group  int
+		keep   *FileOutput
+		remove []*FileOutput
+		// reason 不清理的原因
+		reason string
+	}
+)
+
+func CmdDedupe() cli.Command {
+	scanFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "driveId",
+			Usage: "网盘ID",
+			Value: "",
+		},
+		cli.StringFlag{
+			Name:  "drive",
+			Usage: "扫描的网盘，多个使用逗号分隔，可选值：backup(备份盘), resource(资源库), all(备份盘和资源库) 或者网盘ID",
+		},
+		cli.StringFlag{
+			Name:  "minSize",
+			Usage: "min size， 只扫描大于等于指定大小的文件，例如：1mb",
+		},
+	}
+	return cli.Command{
+		Name:      "dedupe",
+		Usage:     "查找和清理重复文件",
+		UsageText: cmder.App().Name + " dedupe <scan|apply> [选项] [目录...]",
+		Description: `
+	根据文件的内容哈希(SHA1)和大小查找重复文件, 统计可以释放的空间, 并且可以把多余的副本移到回收站.
+	可以同时扫描多个网盘(备份盘和资源库), 跨网盘查找重复文件.
+
+	建议先使用 dedupe scan -report 生成JSON报告, 检查无误后再使用 dedupe apply -report 清理.
+
+	请输入以下命令查看如何使用：
+	aliyunpan dedupe scan -h
+	aliyunpan dedupe apply -h
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			cli.ShowCommandHelp(c, c.Command.Name)
+			return nil
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "scan",
+				Usage:     "扫描重复文件",
+				UsageText: cmder.App().Name + " dedupe scan [选项] [目录...]",
+				Description: `
+	扫描指定目录(默认为根目录)下的所有文件, 按照内容哈希分组, 输出重复的文件和可以释放的空间.
+
+	示例:
+
+	扫描当前网盘的所有文件
+	aliyunpan dedupe scan
+
+	扫描备份盘和资源库, 跨网盘查找大于1MB的重复文件, 并保存报告
+	aliyunpan dedupe scan -drive all -minSize 1mb -report dedupe.json
+
+	扫描指定目录
+	aliyunpan dedupe scan /我的资源 /照片
+`,
+				Action: func(c *cli.Context) error {
+					if config.Config.ActiveUser() == nil {
+						return reportError(notLoggedInError())
+					}
+					opt, err := newDedupeScanOptions(c)
+					if err != nil {
+						return reportError(err)
+					}
+					return reportError(RunDedupeScan(opt, c.String("report")))
+				},
+				Flags: append(scanFlags,
+					cli.StringFlag{
+						Name:  "report",
+						Usage: "保存JSON格式的扫描报告到指定的本地文件",
+					},
+				),
+			},
+			{
+				Name:      "apply",
+				Usage:     "清理重复文件",
+				UsageText: cmder.App().Name + " dedupe apply [选项] [目录...]",
+				Description: `
+	每组重复文件只保留一个, 其余的副本移到回收站. 可以使用 -report 指定 dedupe scan 生成的报告,
+	否则会先按照相同的参数扫描. 删除前会重新检查文件的内容哈希, 已经变化的文件不会被删除.
+	删除文件会调用插件的 removeFilePrepareCallback 回调, 插件可以拒绝删除指定的文件.
+
+	保留策略 keep:
+	oldest - 保留创建时间最早的文件，默认
+	newest - 保留创建时间最晚的文件
+	path-prefix - 保留路径以 -prefix 开头的文件(多个时保留最早的), 没有匹配的组不处理
+
+	示例:
+
+	查看清理计划, 不删除文件
+	aliyunpan dedupe apply -report dedupe.json -dry
+
+	按照报告清理, 保留最早的文件
+	aliyunpan dedupe apply -report dedupe.json -keep oldest
+
+	保留 /照片/整理 目录下的文件, 删除其他位置的副本, 跳过确认
+	aliyunpan dedupe apply -keep path-prefix -prefix /照片/整理 -y /照片
+`,
+				Action: func(c *cli.Context) error {
+					if config.Config.ActiveUser() == nil {
+						return reportError(notLoggedInError())
+					}
+					keep, prefix := c.String("keep"), c.String("prefix")
+					switch keep {
+					case DedupeKeepOldest, DedupeKeepNewest:
+					case DedupeKeepPathPrefix:
+						if prefix == "" {
+							return reportError(usageErrorf("保留策略 path-prefix 需要使用 -prefix 指定路径前缀"))
+						}
+					default:
+						return reportError(usageErrorf("不支持的保留策略: %s", keep))
+					}
+					if IsMachineOutput() && !c.Bool("y") && !c.Bool("dry") {
+						return reportError(usageErrorf("机器可读输出时不能人工确认, 请指定 -y 或者 -dry"))
+					}
+
+					var report *DedupeReport
+					if c.IsSet("report") {
+						r, err := loadDedupeReport(c.String("report"))
+						if err != nil {
+							return reportError(err)
+						}
+						report = r
+					} else {
+						opt, err := newDedupeScanOptions(c)
+						if err != nil {
+							return reportError(err)
+						}
+						if report, err = scanDedupe(opt); err != nil {
+							return reportError(err)
+						}
+					}
+					return reportError(RunDedupeApply(report, keep, prefix, c.Bool("dry"), c.Bool("y")))
+				},
+				Flags: append(scanFlags,
+					cli.StringFlag{
+						Name:  "report",
+						Usage: "使用 dedupe scan 生成的JSON报告，不再重新扫描",
+					},
+					cli.StringFlag{
+						Name:  "keep",
+						Usage: "保留策略：oldest, newest, path-prefix",
+						Value: DedupeKeepOldest,
+					},
+					cli.StringFlag{
+						Name:  "prefix",
+						Usage: "保留策略为 path-prefix 时保留的路径前缀",
+					},
+					cli.BoolFlag{
+						Name:  "dry",
+						Usage: "只显示清理计划，不删除文件",
+					},
+					cli.BoolFlag{
+						Name:  "y",
+						Usage: "跳过人工确认",
+					},
+				),
+			},
+		},
+	}
+}
+
+// newDedupeScanOptions 解析扫描参数
+func newDedupeScanOptions(c *cli.Context) (*DedupeScanOptions, error) {
+	activeUser := config.Config.ActiveUser()
+	opt := &DedupeScanOptions{
+		Paths: c.Args(),
+	}
+	if len(opt.Paths) == 0 {
+		opt.Paths = []string{"/"}
+	}
+	if c.IsSet("minSize") {
+		s, err := converter.ParseFileSizeStr(c.String("minSize"))
+		if err != nil {
+			return nil, usageErrorf("文件大小格式错误: %s", c.String("minSize"))
+		}
+		opt.MinSize = s
+	}
+	if !c.IsSet("drive") {
+		opt.DriveIds = []string{parseDriveId(c)}
+		return opt, nil
+	}
+	for _, d := range splitSearchValues(c.String("drive"), "") {
+		var ids []string
+		switch d {
+		case "backup", "file":
+			ids = []string{activeUser.DriveList.GetFileDriveId()}
+		case "resource":
+			ids = []string{activeUser.DriveList.GetResourceDriveId()}
+		case "all":
+			ids = []string{activeUser.DriveList.GetFileDriveId(), activeUser.DriveList.GetResourceDriveId()}
+		default:
+			if activeUser.GetDriveById(d) == nil {
+				return nil, usageErrorf("网盘不存在: %s", d)
+			}
+			ids = []string{d}
+		}
+		for _, id := range ids {
+			if id != "" && !containsString(opt.DriveIds, id) {
+				opt.DriveIds = append(opt.DriveIds, id)
+			}
+		}
+	}
+	if len(opt.DriveIds) == 0 {
+		return nil, usageErrorf("没有可以扫描的网盘")
+	}
+	return opt, nil
+}
+
+// scanDedupe 遍历网盘目录并生成重复文件报告
+func scanDedupe(opt *DedupeScanOptions) (*DedupeReport, error) {
+	activeUser := config.Config.ActiveUser()
+	files := aliyunpan.FileList{}
+	scanned := map[string]bool{}
+	for _, driveId := range opt.DriveIds {
+		for _, p := range opt.Paths {
+			targetPath := path.Clean(activeUser.PathJoin(driveId, p))
+			if !IsMachineOutput() {
+				fmt.Printf("正在扫描 %s: %s\n", activeUser.DriveList.GetDriveNameById(driveId), targetPath)
+			}
+			var apiErr *apierror.ApiError
+			activeUser.PanClient().OpenapiPanClient().FilesDirectoriesRecurseList(driveId, targetPath, func(depth int, _ string, fd *aliyunpan.FileEntity, apierr *apierror.ApiError) bool {
+				if apierr != nil {
+					apiErr = apierr
+					return false
+				}
+				// 多个目录有重叠时，同一个文件只统计一次
+				key := driveId + "/" + fd.FileId
+				if fd.IsFile() && !scanned[key] {
+					scanned[key] = true
+					if fd.DriveId == "" {
+						fd.DriveId = driveId
+					}
+					files = append(files, fd)
+				}
+				return true
+			})
+			if apiErr != nil {
+				if apiErr.Code == apierror.ApiCodeFileNotFoundCode {
+					return nil, notFoundErrorf("目录不存在: %s", targetPath)
+				}
+				return nil, apiOutputError(apiErr, "扫描目录失败: ")
+			}
+		}
+	}
+	report := buildDedupeReport(files, opt.MinSize)
+	report.DriveIds = opt.DriveIds
+	report.Paths = opt.Paths
+	return report, nil
+}
+
+// buildDedupeReport 按照内容哈希和文件大小对文件分组，空文件和没有哈希的文件不参与比较
+func buildDedupeReport(files aliyunpan.FileList, minSize int64) *DedupeReport {
+	report := &DedupeReport{
+		CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
+		FileCount: len(files),
+		Groups:    []*DedupeGroup{},
+	}
+	groups := map[string]*DedupeGroup{}
+	for _, f := range files {
+		if f.IsFolder() || f.ContentHash == "" || f.FileSize <= 0 || f.FileSize < minSize {
+			continue
+		}
+		hash := strings.ToUpper(f.ContentHash)
+		key := hash + "_" + strconv.FormatInt(f.FileSize, 10)
+		g, ok := groups[key]
+		if !ok {
+			g = &DedupeGroup{ContentHash: hash, Size: f.FileSize}
+			groups[key] = g
+		}
+		g.Files = append(g.Files, newFileOutput(f, ""))
+	}
+	for _, g := range groups {
+		if len(g.Files) < 2 {
+			continue
+		}
+		sort.Slice(g.Files, func(i, j int) bool {
+			if g.Files[i].DriveId != g.Files[j].DriveId {
+				return g.Files[i].DriveId < g.Files[j].DriveId
+			}
+			return g.Files[i].Path < g.Files[j].Path
+		})
+		g.WastedSize = g.Size * int64(len(g.Files)-1)
+		report.Groups = append(report.Groups, g)
+		report.DuplicateCount += len(g.Files) - 1
+		report.WastedSize += g.WastedSize
+	}
+	// 可释放空间大的排在前面
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].WastedSize != report.Groups[j].WastedSize {
+			return report.Groups[i].WastedSize > report.Groups[j].WastedSize
+		}
+		return report.Groups[i].ContentHash < report.Groups[j].ContentHash
+	})
+	report.GroupCount = len(report.Groups)
+	return report
+}
+
+// loadDedupeReport 读取JSON格式的扫描报告
+func loadDedupeReport(file string) (*DedupeReport, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFoundErrorf("报告文件不存在: %s", file)
+		}
+		return nil, errorf("读取报告文件失败: %s", err)
+	}
+	report := &DedupeReport{}
+	if err = json.Unmarshal(data, report); err != nil {
+		return nil, usageErrorf("报告文件格式错误: %s", err)
+	}
+	return report, nil
+}
+
+// saveDedupeReport 保存JSON格式的扫描报告
+func saveDedupeReport(file string, report *DedupeReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// planDedupe 按照保留策略生成每组文件的清理计划
+func planDedupe(report *DedupeReport, keep, prefix string) []*dedupePlanItem {
+	plans := []*dedupePlanItem{}
+	if prefix != "" {
+		prefix = strings.TrimSuffix(path.Clean(prefix), "/")
+	}
+	for k, g := range report.Groups {
+		plan := &dedupePlanItem{group: k + 1}
+		candidates := make([]*FileOutput, len(g.Files))
+		copy(candidates, g.Files)
+		if keep == DedupeKeepPathPrefix {
+			matched := []*FileOutput{}
+			for _, f := range candidates {
+				if f.Path == prefix || strings.HasPrefix(f.Path, prefix+"/") {
+					matched = append(matched, f)
+				}
+			}
+			if len(matched) == 0 {
+				plan.reason = "没有路径前缀为 " + prefix + " 的文件"
+				plan.remove = nil
+				plans = append(plans, plan)
+				continue
+			}
+			candidates = matched
+		}
+		// 时间格式为 2006-01-02 15:04:05，可以直接按字符串比较
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].CreatedAt != candidates[j].CreatedAt {
+				if keep == DedupeKeepNewest {
+					return candidates[i].CreatedAt > candidates[j].CreatedAt
+				}
+				return candidates[i].CreatedAt < candidates[j].CreatedAt
+			}
+			return candidates[i].Path < candidates[j].Path
+		})
+		plan.keep = candidates[0]
+		for _, f := range g.Files {
+			if f != plan.keep {
+				plan.remove = append(plan.remove, f)
+			}
+		}
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// RunDedupeScan 扫描重复文件并输出报告
+func RunDedupeScan(opt *DedupeScanOptions, reportFile string) error {
+	report, err := scanDedupe(opt)
+	if err != nil {
+		return err
+	}
+	if reportFile != "" {
+		if err = saveDedupeReport(reportFile, report); err != nil {
+			return errorf("保存报告文件失败: %s", err)
+		}
+	}
+
+	if IsMachineOutput() {
+		items := []*DedupeFileOutput{}
+		for k, g := range report.Groups {
+			for _, f := range g.Files {
+				items = append(items, &DedupeFileOutput{Group: k + 1, FileOutput: *f})
+			}
+		}
+		return writeOutput(items)
+	}
+
+	activeUser := config.Config.ActiveUser()
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "文件大小", "SHA1", "网盘", "路径"})
+	for k, g := range report.Groups {
+		for i, f := range g.Files {
+			idx, size, hash := "", "", ""
+			if i == 0 {
+				idx, size, hash = strconv.Itoa(k+1), converter.ConvertFileSize(g.Size, 2), g.ContentHash
+			}
+			tb.Append([]string{idx, size, hash, activeUser.DriveList.GetDriveNameById(f.DriveId), f.Path})
+		}
+	}
+	tb.Render()
+	fmt.Printf("\n共扫描文件 %d 个, 重复文件 %d 组, 多余副本 %d 个, 可释放空间 %s\n",
+		report.FileCount, report.GroupCount, report.DuplicateCount, converter.ConvertFileSize(report.WastedSize, 2))
+	if reportFile != "" {
+		fmt.Printf("扫描报告已保存到: %s\n", reportFile)
+	}
+	return nil
+}
+
+// RunDedupeApply 按照保留策略清理重复文件，多余的副本移到回收站
+func RunDedupeApply(report *DedupeReport, keep, prefix string, dryRun, skipConfirm bool) error {
+	activeUser := config.Config.ActiveUser()
+	plans := planDedupe(report, keep, prefix)
+	results := []*DedupeResultOutput{}
+	addResult := func(group int, status, reason string, f *FileOutput) {
+		results = append(results, &DedupeResultOutput{Group: group, Status: status, Reason: reason, FileOutput: *f})
+	}
+
+	removeCount, removeSize := 0, int64(0)
+	for _, plan := range plans {
+		if plan.keep == nil {
+			for _, f := range report.Groups[plan.group-1].Files {
+				addResult(plan.group, "skipped", plan.reason, f)
+			}
+		}
+		removeCount += len(plan.remove)
+		for _, f := range plan.remove {
+			removeSize += f.Size
+		}
+	}
+	if removeCount == 0 {
+		if IsMachineOutput() {
+			return writeOutput(results)
+		}
+		fmt.Println("没有需要清理的重复文件")
+		return nil
+	}
+
+	if !IsMachineOutput() {
+		fmt.Printf("以下重复文件将移到回收站\n\n")
+		tb := cmdtable.NewTable(os.Stdout)
+		tb.SetHeader([]string{"#", "保留", "删除"})
+		for _, plan := range plans {
+			if plan.keep == nil {
+				continue
+			}
+			for i, f := range plan.remove {
+				idx, kept := "", ""
+				if i == 0 {
+					idx, kept = strconv.Itoa(plan.group), plan.keep.Path
+				}
+				tb.Append([]string{idx, kept, f.Path})
+			}
+		}
+		tb.Render()
+		fmt.Printf("\n共删除 %d 个文件, 释放空间 %s\n", removeCount, converter.ConvertFileSize(removeSize, 2))
+	}
+	if dryRun {
+		if IsMachineOutput() {
+			for _, plan := range plans {
+				if plan.keep != nil {
+					addResult(plan.group, "keep", "", plan.keep)
+				}
+				for _, f := range plan.remove {
+					addResult(plan.group, "planned", "", f)
+				}
+			}
+			return writeOutput(results)
+		}
+		return nil
+	}
+	if !skipConfirm {
+		fmt.Printf("是否清理重复文件，文件可以在回收站找回(y/n): ")
+		confirm := ""
+		_, err := fmt.Scanln(&confirm)
+		if err != nil || (confirm != "y" && confirm != "Y") {
+			fmt.Println("用户取消了操作")
+			return nil
+		}
+	}
+
+	pluginManger := plugins.NewPluginManager(config.GetPluginDir())
+	plugin, _ := pluginManger.GetPlugin()
+	panClient := activeUser.PanClient().OpenapiPanClient()
+	// checkFile 删除前检查文件是否还存在并且内容没有变化
+	checkFile := func(f *FileOutput, contentHash string) (*aliyunpan.FileEntity, string) {
+		fe, err := panClient.FileInfoById(f.DriveId, f.FileId)
+		if err != nil {
+			return nil, "文件已不存在或者无法访问"
+		}
+		if !strings.EqualFold(fe.ContentHash, contentHash) {
+			return nil, "文件内容已经变化"
+		}
+		fe.Path = f.Path
+		return fe, ""
+	}
+
+	failed, removed := 0, 0
+	// 重复文件可能分布在多个网盘，按照网盘分别清理缓存
+	cacheCleanDirs := map[string][]string{}
+	for _, plan := range plans {
+		if plan.keep == nil {
+			continue
+		}
+		contentHash := report.Groups[plan.group-1].ContentHash
+		// 保留的文件必须还存在，否则这一组不处理
+		if _, reason := checkFile(plan.keep, contentHash); reason != "" {
+			for _, f := range plan.remove {
+				addResult(plan.group, "skipped", "保留的文件"+reason, f)
+			}
+			continue
+		}
+		addResult(plan.group, "keep", "", plan.keep)
+
+		toRemove := aliyunpan.FileList{}
+		for _, f := range plan.remove {
+			fe, reason := checkFile(f, contentHash)
+			if reason != "" {
+				addResult(plan.group, "skipped", reason, f)
+				continue
+			}
+			toRemove = append(toRemove, fe)
+		}
+		if len(toRemove) == 0 {
+			continue
+		}
+		approved := approveRemoveFiles(plugin, toRemove)
+		for _, f := range plan.remove {
+			fe := findFileById(toRemove, f.FileId)
+			if fe == nil {
+				continue
+			}
+			if findFileById(approved, f.FileId) == nil {
+				addResult(plan.group, "skipped", "插件不允许删除该文件", f)
+				continue
+			}
+			r, err := panClient.FileDelete(&aliyunpan.FileBatchActionParam{
+				DriveId: fe.DriveId,
+				FileId:  fe.FileId,
+			})
+			if err != nil || !r.Success {
+				reason := "删除失败"
+				if err != nil {
+					reason = err.Error()
+				}
+				failed++
+				addResult(plan.group, "failed", reason, f)
+				continue
+			}
+			removed++
+			cacheCleanDirs[fe.DriveId] = append(cacheCleanDirs[fe.DriveId], path.Dir(f.Path))
+			addResult(plan.group, "removed", "", f)
+		}
+	}
+	for driveId, dirs := range cacheCleanDirs {
+		activeUser.DeleteDriveCache(driveId, dirs)
+	}
+
+	if IsMachineOutput() {
+		if e := writeOutput(results); e != nil {
+			return e
+		}
+	} else {
+		for _, r := range results {
+			switch r.Status {
+			case "skipped", "failed":
+				fmt.Printf("未删除 %s: %s\n", r.Path, r.Reason)
+			}
+		}
+		fmt.Printf("清理完成, 已删除 %d 个文件到回收站, 失败 %d 个\n", removed, failed)
+	}
+	if failed > 0 {
+		if removed > 0 {
+			return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分重复文件删除失败")
+		}
+		return errorf("重复文件删除失败")
+	}
+	return nil
+}
+
+func findFileById(files aliyunpan.FileList, fileId string) *aliyunpan.FileEntity {
+	for _, f := range files {
+		if f.FileId == fileId {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestBuildDedupeReport(t *testing.T) {
+	files := aliyunpan.FileList{
+		{DriveId: "1", FileId: "a", FileName: "a.mp4", Path: "/a.mp4", FileType: "file", FileSize: 100, ContentHash: "abc", CreatedAt: "2023-01-02 00:00:00"},
+		{DriveId: "2", FileId: "b", FileName: "b.mp4", Path: "/备份/b.mp4", FileType: "file", FileSize: 100, ContentHash: "ABC", CreatedAt: "2023-01-01 00:00:00"},
+		{DriveId: "1", FileId: "c", FileName: "c.mp4", Path: "/照片/c.mp4", FileType: "file", FileSize: 100, ContentHash: "abc", CreatedAt: "2023-01-03 00:00:00"},
+		{DriveId: "1", FileId: "d", FileName: "d.txt", Path: "/d.txt", FileType: "file", FileSize: 10, ContentHash: "def"},
+		{DriveId: "1", FileId: "e", FileName: "e.txt", Path: "/e.txt", FileType: "file", FileSize: 10, ContentHash: "def"},
+		{DriveId: "1", FileId: "f", FileName: "f.txt", Path: "/f.txt", FileType: "file", FileSize: 0, ContentHash: "empty"},
+		{DriveId: "1", FileId: "g", FileName: "g.txt", Path: "/g.txt", FileType: "file", FileSize: 0, ContentHash: "empty"},
+		{DriveId: "1", FileId: "h", FileName: "h.txt", Path: "/h.txt", FileType: "file", FileSize: 20, ContentHash: "def"},
+	}
+	report := buildDedupeReport(files, 0)
+	if report.FileCount != 8 || report.GroupCount != 2 || report.DuplicateCount != 3 || report.WastedSize != 210 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	g := report.Groups[0]
+	if g.ContentHash != "ABC" || len(g.Files) != 3 || g.Files[0].FileId != "a" || g.Files[2].FileId != "b" {
+		t.Errorf("unexpected group: %+v", g)
+	}
+	if r := buildDedupeReport(files, 50); r.GroupCount != 1 {
+		t.Errorf("min size should be applied, got %d groups", r.GroupCount)
+	}
+
+	// 保存后读取
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+	if err := saveDedupeReport(reportFile, report); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadDedupeReport(reportFile)
+	if err != nil || !reflect.DeepEqual(loaded, report) {
+		t.Errorf("unexpected loaded report: %+v, %v", loaded, err)
+	}
+}
+
+func TestPlanDedupe(t *testing.T) {
+	report := &DedupeReport{Groups: []*DedupeGroup{{
+		ContentHash: "ABC",
+		Size:        100,
+		Files: []*FileOutput{
+			{FileId: "a", Path: "/a.mp4", CreatedAt: "2023-01-02 00:00:00"},
+			{FileId: "b", Path: "/备份/b.mp4", CreatedAt: "2023-01-01 00:00:00"},
+			{FileId: "c", Path: "/照片/c.mp4", CreatedAt: "2023-01-03 00:00:00"},
+		},
+	}}}
+
+	fileIds := func(files []*FileOutput) []string {
+		r := []string{}
+		for _, f := range files {
+			r = append(r, f.FileId)
+		}
+		return r
+	}
+	cases := []struct {
+		keep, prefix string
+		expectKeep   string
+		expectRemove []string
+	}{
+		{DedupeKeepOldest, "", "b", []string{"a", "c"}},
+		{DedupeKeepNewest, "", "c", []string{"a", "b"}},
+		{DedupeKeepPathPrefix, "/照片/", "c", []string{"a", "b"}},
+		{DedupeKeepPathPrefix, "/照", "", []string{}},
+	}
+	for _, c := range cases {
+		plans := planDedupe(report, c.keep, c.prefix)
+		if len(plans) != 1 {
+			t.Fatalf("unexpected plans: %v", plans)
+		}
+		keep := ""
+		if plans[0].keep != nil {
+			keep = plans[0].keep.FileId
+		} else if plans[0].reason == "" {
+			t.Errorf("skipped group should have a reason")
+		}
+		if keep != c.expectKeep || !reflect.DeepEqual(fileIds(plans[0].remove), c.expectRemove) {
+			t.Errorf("%s %s: unexpected plan keep=%s remove=%v", c.keep, c.prefix, keep, fileIds(plans[0].remove))
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/syncdrive"
+	"github.com/tickstep/library-go/converter"
+	"github.com/urfave/cli"
+)
+
+const (
+	// localHashCacheFileName 本地文件SHA1缓存文件名称，位于配置目录下
+	localHashCacheFileName = "local_hash_cache.json"
+
+	diffStatusOnlyLocal = "only_local"
+	diffStatusOnlyPan   = "only_pan"
+	diffStatusMismatch  = "mismatch"
+)
+
+type (
+	// DiffOutput 目录对比结果输出格式，diff 命令使用
+	DiffOutput struct {
+		// Status 对比结果：only_local-只在本地存在，only_pan-只在云盘存在，mismatch-内容不一致
+		Status string `json:"status"`
+		// Path 相对对比目录的路径
+		Path string `json:"path"`
+		// Type 文件类型：file, folder。类型不一致时为本地文件的类型
+		Type string `json:"type"`
+		// Reason 内容不一致的原因：type, size, sha1
+		Reason    string `json:"reason"`
+		LocalPath string `json:"localPath"`
+		PanPath   string `json:"panPath"`
+		LocalSize int64  `json:"localSize"`
+		PanSize   int64  `json:"panSize"`
+	}
+)
+
+func CmdDiff() cli.Command {
+	return cli.Command{
+		Name:      "diff",
+		Usage:     "对比本地目录和云盘目录",
+		UsageText: cmder.App().Name + " diff [选项] <本地目录> <云盘目录>",
+		Description: `
+	对比本地目录和云盘目录下的所有文件, 列出只在本地存在, 只在云盘存在, 以及内容不一致的文件.
+	默认按照文件大小对比, 指定 -sha1 后大小相同的文件还会对比SHA1, 本地文件的SHA1会缓存在配置目录下, 文件没有变化时不会重复计算.
+	对比不会创建同步任务, 也不会修改同步数据库. 两边完全一致时退出码为0, 存在差异时退出码为1.
+
+	示例:
+
+	对比本地目录 D:\Photos 和云盘目录 /照片
+	aliyunpan diff D:\Photos /照片
+
+	同时对比SHA1
+	aliyunpan diff -sha1 /home/tickstep/Documents /文档
+
+	以 json 格式输出差异
+	aliyunpan --output json diff /home/tickstep/Documents /文档
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 2 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return reportError(usageErrorf("请指定本地目录和云盘目录"))
+			}
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			return reportError(RunDiff(parseDriveId(c), c.Args().Get(0), c.Args().Get(1), c.Bool("sha1")))
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "driveId",
+				Usage: "网盘ID",
+				Value: "",
+			},
+			cli.BoolFlag{
+				Name:  "sha1",
+				Usage: "大小相同的文件对比SHA1",
+			},
+		},
+	}
+}
+
+// newDiffOutputList 转换对比结果
+func newDiffOutputList(result *syncdrive.DirDiffResult, localDir, panDir string) []*DiffOutput {
+	relativePath := func(p, root string) string {
+		p = strings.ReplaceAll(p, "\\", "/")
+		root = strings.ReplaceAll(root, "\\", "/")
+		return strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+	}
+	items := []*DiffOutput{}
+	for _, f := range result.OnlyLocal {
+		items = append(items, &DiffOutput{
+			Status:    diffStatusOnlyLocal,
+			Path:      relativePath(f.Path, localDir),
+			Type:      f.FileType,
+			LocalPath: f.Path,
+			LocalSize: f.FileSize,
+		})
+	}
+	for _, f := range result.OnlyPan {
+		items = append(items, &DiffOutput{
+			Status:  diffStatusOnlyPan,
+			Path:    relativePath(f.Path, panDir),
+			Type:    f.FileType,
+			PanPath: f.Path,
+			PanSize: f.FileSize,
+		})
+	}
+	for _, m := range result.Mismatch {
+		items = append(items, &DiffOutput{
+			Status:    diffStatusMismatch,
+			Path:      m.RelativePath,
+			Type:      m.LocalFile.FileType,
+			Reason:    m.Reason,
+			LocalPath: m.LocalFile.Path,
+			PanPath:   m.PanFile.Path,
+			LocalSize: m.LocalFile.FileSize,
+			PanSize:   m.PanFile.FileSize,
+		})
+	}
+	return items
+}
+
+// RunDiff 执行本地目录和云盘目录对比
+func RunDiff(driveId, localDir, panDir string, compareSha1 bool) error {
+	activeUser := config.Config.ActiveUser()
+	localDir, err := filepath.Abs(localDir)
+	if err != nil {
+		return usageErrorf("本地目录路径错误: %s", err)
+	}
+	if info, e := os.Stat(localDir); e != nil || !info.IsDir() {
+		return notFoundErrorf("本地目录不存在: %s", localDir)
+	}
+	panDir = path.Clean(activeUser.PathJoin(driveId, panDir))
+	panDirInfo, apiErr := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, panDir)
+	if apiErr != nil {
+		if apiErr.Code == apierror.ApiCodeFileNotFoundCode {
+			return notFoundErrorf("云盘目录不存在: %s", panDir)
+		}
+		return apiOutputError(apiErr, "")
+	}
+	if !panDirInfo.IsFolder() {
+		return usageErrorf("%s 不是目录", panDir)
+	}
+
+	localFiles, err := syncdrive.ScanLocalDirectory(localDir)
+	if err != nil {
+		return errorf("扫描本地目录失败: %s", err)
+	}
+	panFiles, apiErr := syncdrive.ScanPanDirectory(activeUser.PanClient(), driveId, panDir)
+	if apiErr != nil {
+		return apiOutputError(apiErr, "扫描云盘目录失败: ")
+	}
+
+	var sha1Func syncdrive.LocalSha1Func
+	if compareSha1 {
+		hashCache := syncdrive.NewLocalHashCache(filepath.Join(config.GetConfigDir(), localHashCacheFileName))
+		defer hashCache.Save()
+		sha1Func = hashCache.Sha1
+	}
+	result, err := syncdrive.DiffDirectory(localDir, localFiles, panDir, panFiles, sha1Func)
+	if err != nil {
+		return errorf("计算本地文件SHA1失败: %s", err)
+	}
+
+	items := newDiffOutputList(result, localDir, panDir)
+	if IsMachineOutput() {
+		if e := writeOutput(items); e != nil {
+			return e
+		}
+	} else {
+		renderDiffTable(items, result.SameCount)
+	}
+	if len(items) > 0 {
+		return exitError(ExitCodeError)
+	}
+	return nil
+}
+
+func renderDiffTable(items []*DiffOutput, sameCount int) {
+	titles := map[string]string{
+		diffStatusOnlyLocal: "只在本地存在",
+		diffStatusOnlyPan:   "只在云盘存在",
+		diffStatusMismatch:  "内容不一致",
+	}
+	reasons := map[string]string{
+		syncdrive.DiffReasonType: "类型不同",
+		syncdrive.DiffReasonSize: "大小不同",
+		syncdrive.DiffReasonSha1: "SHA1不同",
+	}
+	counts := map[string]int{}
+	for _, status := range []string{diffStatusOnlyLocal, diffStatusOnlyPan, diffStatusMismatch} {
+		tb := cmdtable.NewTable(os.Stdout)
+		tb.SetHeader([]string{"#", "本地大小", "云盘大小", "原因", "路径"})
+		for _, item := range items {
+			if item.Status != status {
+				continue
+			}
+			counts[status]++
+			localSize, panSize, name := "-", "-", item.Path
+			if item.Type == "folder" {
+				name += "/"
+			} else {
+				if item.Status != diffStatusOnlyPan {
+					localSize = converter.ConvertFileSize(item.LocalSize, 2)
+				}
+				if item.Status != diffStatusOnlyLocal {
+					panSize = converter.ConvertFileSize(item.PanSize, 2)
+				}
+			}
+			tb.Append([]string{strconv.Itoa(counts[status]), localSize, panSize, reasons[item.Reason], name})
+		}
+		if counts[status] > 0 {
+			fmt.Printf("\n%s:\n", titles[status])
+			tb.Render()
+		}
+	}
+	fmt.Printf("\n一致: %d, 只在本地存在: %d, 只在云盘存在: %d, 内容不一致: %d\n",
+		sameCount, counts[diffStatusOnlyLocal], counts[diffStatusOnlyPan], counts[diffStatusMismatch])
+}
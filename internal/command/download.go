@@ -52,6 +52,7 @@ type (
 		Load                 int
 		MaxRetry             int
 		NoCheck              bool
+		VerifyChecksum       bool // 下载完成后对比云盘记录的SHA1和CRC64
 		ShowProgress         bool
 		DriveId              string
 		ExcludeNames         []string // 排除的文件名，包括文件夹和文件。即这些文件/文件夹不进行下载，支持正则表达式
@@ -66,7 +67,7 @@ type (
 )
 
 var (
-	// MaxDownloadRangeSize 文件片段最大值
+	// MaxDownloadRangeSize 文件片段最大值，小文件会自动切分成更小的片段，超大文件会自动调大片段
 	MaxDownloadRangeSize = 55 * converter.MB
 
 	// DownloadCacheSize 默认每个线程下载缓存大小
@@ -147,6 +148,7 @@ func CmdDownload() cli.Command {
 				Load:                 0,
 				MaxRetry:             c.Int("retry"),
 				NoCheck:              c.Bool("nocheck"),
+				VerifyChecksum:       c.Bool("verify"),
 				ShowProgress:         !c.Bool("np"),
 				DriveId:              parseDriveId(c),
 				ExcludeNames:         c.StringSlice("exn"),
@@ -154,8 +156,7 @@ func CmdDownload() cli.Command {
 				IsUseUIDashboard:     c.Bool("ui"),
 			}
 
-			RunDownload(c.Args(), do)
-			return nil
+			return RunDownload(c.Args(), do).report()
 		},
 		Flags: []cli.Flag{
 			cli.BoolFlag{
@@ -164,7 +165,7 @@ func CmdDownload() cli.Command {
 			},
 			cli.BoolFlag{
 				Name:  "status",
-				Usage: "输出所有线程的工作状态",
+				Usage: "输出所有线程和下载地址的工作状态",
 			},
 			cli.BoolFlag{
 				Name:  "save",
@@ -185,7 +186,7 @@ func CmdDownload() cli.Command {
 			},
 			cli.IntFlag{
 				Name:  "sp",
-				Usage: "slice parallel,指定单个文件下载的最大线程(分片)数（取值范围:1 ~ 3）",
+				Usage: "slice parallel,指定单个文件下载的最大线程(分片)数，下载时会根据速度和限流情况在上限内自动调整（取值范围:1 ~ 3）",
 				Value: 0,
 			},
 			cli.IntFlag{
@@ -197,6 +198,10 @@ func CmdDownload() cli.Command {
 				Name:  "nocheck",
 				Usage: "下载文件完成后不校验文件",
 			},
+			cli.BoolFlag{
+				Name:  "verify",
+				Usage: "下载文件完成后重新读取文件，对比云盘记录的SHA1和CRC64，校验失败自动重新下载",
+			},
 			cli.BoolFlag{
 				Name:  "np",
 				Usage: "no progress 不展示下载进度条",
@@ -224,7 +229,8 @@ func CmdDownload() cli.Command {
 }
 
 // RunDownload 执行下载网盘内文件
-func RunDownload(paths []string, options *DownloadOptions) {
+func RunDownload(paths []string, options *DownloadOptions) *TransferSummary {
+	summary := newTransferSummary(transferActionDownload)
 	activeUser := GetActiveUser()
 	activeUser.PanClient().OpenapiPanClient().EnableCache()
 	activeUser.PanClient().OpenapiPanClient().ClearCache()
@@ -264,7 +270,7 @@ func RunDownload(paths []string, options *DownloadOptions) {
 		CacheSize:                  config.Config.CacheSize,
 		BlockSize:                  MaxDownloadRangeSize,
 		MaxRate:                    config.Config.MaxDownloadRate,
-		InstanceStateStorageFormat: downloader.InstanceStateStorageFormatJSON,
+		InstanceStateStorageFormat: downloader.InstanceStateStorageFormatProto3,
 		ShowProgress:               options.ShowProgress,
 		ExcludeNames:               options.ExcludeNames,
 	}
@@ -283,7 +289,7 @@ func RunDownload(paths []string, options *DownloadOptions) {
 		options.Parallel = config.MaxFileDownloadParallelNum
 	}
 
-	// 设置单个文件下载分片线程数
+	// 设置单个文件下载分片线程数上限，下载时会根据速度和限流情况在上限内自动调整
 	if options.SliceParallel < 1 { // 用户没有主动设置，则使用下面自动配置的策略
 		if options.Parallel > 1 {
 			// 如果是多文件下载，则一个文件只能同时使用1个线程
@@ -307,15 +313,13 @@ func RunDownload(paths []string, options *DownloadOptions) {
 		os.MkdirAll(originSaveRootPath, 0777) // 首先在本地创建目录
 	} else {
 		if !fi.IsDir() {
-			fmt.Println("本地保存路径不是文件夹，请删除或者创建对应的文件夹：", originSaveRootPath)
-			return
+			return summary.setError(usageErrorf("本地保存路径不是文件夹，请删除或者创建对应的文件夹：%s", originSaveRootPath))
 		}
 	}
 
 	paths, err := makePathAbsolute(options.DriveId, paths...)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return summary.setError(err)
 	}
 
 	// 多用户下载的辅助账号列表
@@ -409,11 +413,13 @@ func RunDownload(paths []string, options *DownloadOptions) {
 		fileList, err2 := matchPathByShellPattern(options.DriveId, paths[k])
 		if err2 != nil {
 			logf("获取文件出错，请稍后重试: %s\n", paths[k])
+			summary.addFailure("", paths[k], err2)
 			continue
 		}
 		if fileList == nil || len(fileList) == 0 {
 			// 文件不存在
 			logf("文件不存在: %s\n", paths[k])
+			summary.addFailure("", paths[k], notFoundErrorf("文件不存在: %s", paths[k]))
 			continue
 		}
 		// 排序，按名称排序，从小到大
@@ -443,6 +449,7 @@ func RunDownload(paths []string, options *DownloadOptions) {
 				IsExecutedPermission: options.IsExecutedPermission,
 				IsOverwrite:          options.IsOverwrite,
 				NoCheck:              options.NoCheck,
+				VerifyChecksum:       options.VerifyChecksum,
 				FilePanSource:        global.FileSource,
 				FilePanPath:          f.Path,
 				DriveId:              options.DriveId,
@@ -469,6 +476,7 @@ func RunDownload(paths []string, options *DownloadOptions) {
 	}
 
 	// 开始计时
+	taskCount := executor.Count()
 	statistic.StartTimer()
 
 	// 启动UI面板显示
@@ -495,7 +503,10 @@ func RunDownload(paths []string, options *DownloadOptions) {
 		for e := failedList.Shift(); e != nil; e = failedList.Shift() {
 			item := e.(*taskframework.TaskInfoItem)
 			tb.Append([]string{item.Info.Id(), item.Unit.(*pandownload.DownloadTaskUnit).FilePanPath})
+			summary.addFailedTask(item, item.Unit.(*pandownload.DownloadTaskUnit).FilePanPath)
 		}
 		tb.Render()
 	}
+	summary.finish(taskCount, statistic.TotalSize())
+	return summary
 }
@@ -40,8 +40,14 @@ func CmdDrive() cli.Command {
 		Before:   ReloadConfigFunc,
 		After:    SaveConfigFunc,
 		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
 			inputData := c.Args().Get(0)
 			targetDriveId := strings.TrimSpace(inputData)
+			if IsMachineOutput() {
+				return reportError(RunDriveListOutput(targetDriveId))
+			}
 			RunSwitchDriveList(targetDriveId)
 			return nil
 		},
@@ -49,7 +55,6 @@ func CmdDrive() cli.Command {
 }
 
 func RunSwitchDriveList(targetDriveId string) {
-	currentDriveId := config.Config.ActiveUser().ActiveDriveId
 	var activeDriveInfo *config.DriveInfo = nil
 	driveList, renderStr := getDriveOptionList()
 
@@ -91,6 +96,13 @@ func RunSwitchDriveList(targetDriveId string) {
 		return
 	}
 
+	switchActiveDrive(activeDriveInfo)
+	fmt.Printf("切换到网盘：%s\n", activeDriveInfo.DriveName)
+}
+
+// switchActiveDrive 切换当前网盘，并初始化网盘的工作目录
+func switchActiveDrive(activeDriveInfo *config.DriveInfo) {
+	currentDriveId := config.Config.ActiveUser().ActiveDriveId
 	config.Config.ActiveUser().ActiveDriveId = activeDriveInfo.DriveId
 	activeUser := config.Config.ActiveUser()
 	if currentDriveId != config.Config.ActiveUser().ActiveDriveId {
@@ -112,7 +124,35 @@ func RunSwitchDriveList(targetDriveId string) {
 			}
 		}
 	}
-	fmt.Printf("切换到网盘：%s\n", activeDriveInfo.DriveName)
+}
+
+// RunDriveListOutput 机器可读格式输出网盘列表，指定了 targetDriveId 则切换网盘后输出当前网盘
+func RunDriveListOutput(targetDriveId string) error {
+	activeUser := config.Config.ActiveUser()
+	if targetDriveId != "" {
+		driveInfo := activeUser.GetDriveById(targetDriveId)
+		if driveInfo == nil || driveInfo.IsAlbumDrive() {
+			return notFoundErrorf("网盘不存在: %s", targetDriveId)
+		}
+		switchActiveDrive(driveInfo)
+	}
+	drives := []*DriveOutput{}
+	for k, info := range activeUser.DriveList {
+		if info.IsAlbumDrive() {
+			continue
+		}
+		if targetDriveId != "" && info.DriveId != targetDriveId {
+			continue
+		}
+		drives = append(drives, &DriveOutput{
+			Index:     k + 1,
+			DriveId:   info.DriveId,
+			DriveName: info.DriveName,
+			DriveTag:  info.DriveTag,
+			Active:    info.DriveId == activeUser.ActiveDriveId,
+		})
+	}
+	return writeOutput(drives)
 }
 
 func getDriveOptionList() (config.DriveInfoList, string) {
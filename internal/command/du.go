@@ -0,0 +1,457 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/library-go/converter"
+	"github.com/urfave/cli"
+)
+
+const (
+	duSortSize  = "size"
+	duSortCount = "count"
+	duSortName  = "name"
+
+	// duBarWidth 交互模式下占比条的宽度
+	duBarWidth = 20
+)
+
+// duCategories 统计的文件分类，其他分类都归为 others
+var duCategories = []string{"video", "image", "doc", "others"}
+
+type (
+	// DuOptions du 命令可选项
+	DuOptions struct {
+		// Depth 显示的目录层级，1为只显示指定目录的直接下级
+		Depth int
+		// Sort 排序方式：size, count, name
+		Sort string
+		// Top 每个目录最多显示的条目数量，0为不限制
+		Top int
+		// ShowFiles 是否显示文件，默认只显示目录
+		ShowFiles   bool
+		Interactive bool
+	}
+
+	// DuOutput 目录占用空间输出格式，du 命令使用
+	DuOutput struct {
+		Path string `json:"path"`
+		// Type 文件类型：file, folder
+		Type string `json:"type"`
+		// Depth 相对指定目录的层级，指定目录为0
+		Depth int `json:"depth"`
+		// Size 目录下所有文件的大小
+		Size int64 `json:"size"`
+		// FileCount 目录下所有层级的文件数量
+		FileCount int64 `json:"fileCount"`
+		// DirCount 目录下所有层级的目录数量
+		DirCount   int64 `json:"dirCount"`
+		VideoSize  int64 `json:"videoSize"`
+		ImageSize  int64 `json:"imageSize"`
+		DocSize    int64 `json:"docSize"`
+		OthersSize int64 `json:"othersSize"`
+	}
+
+	// duNode 目录树节点，目录的大小和数量为所有下级的合计
+	duNode struct {
+		name      string
+		path      string
+		isFolder  bool
+		size      int64
+		fileCount int64
+		dirCount  int64
+		// categorySize 各分类文件的大小
+		categorySize  map[string]int64
+		categoryCount map[string]int64
+		parent        *duNode
+		children      []*duNode
+	}
+
+	// duListFunc 获取目录下的文件列表
+	duListFunc func(dirPath string) (aliyunpan.FileList, *apierror.ApiError)
+)
+
+func CmdDu() cli.Command {
+	return cli.Command{
+		Name:      "du",
+		Usage:     "统计目录占用空间",
+		UsageText: cmder.App().Name + " du [选项] [目录]",
+		Description: `
+	递归统计目录的大小, 文件数量和目录数量, 以及视频, 图片, 文档和其他文件的占用空间.
+	目录列表会被缓存, 在交互模式下重复统计或者浏览时不会重复请求.
+
+	示例:
+
+	统计当前工作目录下各个目录的占用空间
+	aliyunpan du
+
+	统计 /我的资源 下两层目录的占用空间, 每个目录只显示最大的10个
+	aliyunpan du -depth 2 -top 10 /我的资源
+
+	同时显示文件, 按照文件数量排序
+	aliyunpan du -a -sort count /我的资源
+
+	交互式浏览, 类似 ncdu
+	aliyunpan du -i /我的资源
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			opt := &DuOptions{
+				Depth:       c.Int("depth"),
+				Sort:        c.String("sort"),
+				Top:         c.Int("top"),
+				ShowFiles:   c.Bool("a"),
+				Interactive: c.Bool("i"),
+			}
+			if opt.Sort != duSortSize && opt.Sort != duSortCount && opt.Sort != duSortName {
+				return reportError(usageErrorf("不支持的排序方式: %s", opt.Sort))
+			}
+			if opt.Depth < 0 || opt.Top < 0 {
+				return reportError(usageErrorf("depth 和 top 不能小于0"))
+			}
+			if opt.Interactive && IsMachineOutput() {
+				return reportError(usageErrorf("机器可读输出不支持交互模式"))
+			}
+			return reportError(RunDu(parseDriveId(c), c.Args().Get(0), opt))
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "driveId",
+				Usage: "网盘ID",
+				Value: "",
+			},
+			cli.IntFlag{
+				Name:  "depth",
+				Usage: "显示的目录层级，0为只显示指定目录的合计",
+				Value: 1,
+			},
+			cli.StringFlag{
+				Name:  "sort",
+				Usage: "排序方式：size-大小，count-文件数量，name-名称",
+				Value: duSortSize,
+			},
+			cli.IntFlag{
+				Name:  "top",
+				Usage: "每个目录最多显示的条目数量，0为不限制",
+			},
+			cli.BoolFlag{
+				Name:  "a",
+				Usage: "同时显示文件",
+			},
+			cli.BoolFlag{
+				Name:  "i",
+				Usage: "交互式浏览",
+			},
+		},
+	}
+}
+
+// duCategory 统一文件分类
+func duCategory(category string) string {
+	switch category {
+	case "video", "image", "doc":
+		return category
+	}
+	return "others"
+}
+
+func newDuNode(name, nodePath string, isFolder bool, parent *duNode) *duNode {
+	return &duNode{
+		name:          name,
+		path:          nodePath,
+		isFolder:      isFolder,
+		categorySize:  map[string]int64{},
+		categoryCount: map[string]int64{},
+		parent:        parent,
+	}
+}
+
+// add 把下级节点的统计累加到当前节点
+func (n *duNode) add(child *duNode) {
+	n.size += child.size
+	n.fileCount += child.fileCount
+	n.dirCount += child.dirCount
+	if child.isFolder {
+		n.dirCount++
+	}
+	for k, v := range child.categorySize {
+		n.categorySize[k] += v
+	}
+	for k, v := range child.categoryCount {
+		n.categoryCount[k] += v
+	}
+}
+
+// buildDuTree 递归统计目录，progress 在每个目录统计完成后调用
+func buildDuTree(list duListFunc, dirPath string, parent *duNode, progress func(dirCount int64)) (*duNode, *apierror.ApiError) {
+	node := newDuNode(path.Base(dirPath), dirPath, true, parent)
+	files, err := list(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		childPath := path.Join(dirPath, f.FileName)
+		var child *duNode
+		if f.IsFolder() {
+			if child, err = buildDuTree(list, childPath, node, progress); err != nil {
+				return nil, err
+			}
+		} else {
+			child = newDuNode(f.FileName, childPath, false, node)
+			child.size = f.FileSize
+			child.fileCount = 1
+			category := duCategory(f.Category)
+			child.categorySize[category] = f.FileSize
+			child.categoryCount[category] = 1
+		}
+		node.children = append(node.children, child)
+		node.add(child)
+	}
+	if progress != nil {
+		progress(node.dirCount)
+	}
+	return node, nil
+}
+
+// sortedChildren 按照排序方式返回下级节点，top 大于0时只返回前 top 个
+func (n *duNode) sortedChildren(sortBy string, top int, showFiles bool) []*duNode {
+	children := []*duNode{}
+	for _, c := range n.children {
+		if c.isFolder || showFiles {
+			children = append(children, c)
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		a, b := children[i], children[j]
+		switch sortBy {
+		case duSortCount:
+			if a.fileCount != b.fileCount {
+				return a.fileCount > b.fileCount
+			}
+		case duSortName:
+			return a.name < b.name
+		}
+		if a.size != b.size {
+			return a.size > b.size
+		}
+		return a.name < b.name
+	})
+	if top > 0 && len(children) > top {
+		children = children[:top]
+	}
+	return children
+}
+
+// flattenDuTree 按照层级和排序展开目录树，指定目录为第一个
+func flattenDuTree(root *duNode, opt *DuOptions) []*DuOutput {
+	result := []*DuOutput{}
+	var walk func(n *duNode, depth int)
+	walk = func(n *duNode, depth int) {
+		result = append(result, n.output(depth))
+		if depth >= opt.Depth {
+			return
+		}
+		for _, c := range n.sortedChildren(opt.Sort, opt.Top, opt.ShowFiles) {
+			walk(c, depth+1)
+		}
+	}
+	walk(root, 0)
+	return result
+}
+
+func (n *duNode) output(depth int) *DuOutput {
+	fileType := "file"
+	if n.isFolder {
+		fileType = "folder"
+	}
+	return &DuOutput{
+		Path:       n.path,
+		Type:       fileType,
+		Depth:      depth,
+		Size:       n.size,
+		FileCount:  n.fileCount,
+		DirCount:   n.dirCount,
+		VideoSize:  n.categorySize["video"],
+		ImageSize:  n.categorySize["image"],
+		DocSize:    n.categorySize["doc"],
+		OthersSize: n.categorySize["others"],
+	}
+}
+
+// duPercent 占比
+func duPercent(size, total int64) string {
+	if total <= 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(size)*100/float64(total))
+}
+
+// duBar 占比条
+func duBar(size, total int64) string {
+	n := 0
+	if total > 0 {
+		n = int(float64(size) * duBarWidth / float64(total))
+	}
+	return "[" + strings.Repeat("#", n) + strings.Repeat(" ", duBarWidth-n) + "]"
+}
+
+// RunDu 执行目录占用空间统计
+func RunDu(driveId, targetPath string, opt *DuOptions) error {
+	activeUser := config.Config.ActiveUser()
+	targetPath = path.Clean(activeUser.PathJoin(driveId, targetPath))
+
+	targetInfo, err := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, targetPath)
+	if err != nil {
+		if err.Code == apierror.ApiCodeFileNotFoundCode {
+			return notFoundErrorf("指定目录不存在: %s", targetPath)
+		}
+		return apiOutputError(err, "")
+	}
+	if !targetInfo.IsFolder() {
+		return usageErrorf("%s 不是目录", targetPath)
+	}
+
+	var progress func(int64)
+	if !IsMachineOutput() {
+		scanned := 0
+		progress = func(int64) {
+			scanned++
+			fmt.Fprintf(os.Stderr, "\r正在统计, 已扫描 %d 个目录", scanned)
+		}
+	}
+	root, err := buildDuTree(func(dirPath string) (aliyunpan.FileList, *apierror.ApiError) {
+		return activeUser.CacheDriveFilesDirectoriesList(driveId, dirPath)
+	}, targetPath, nil, progress)
+	if progress != nil {
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+	if err != nil {
+		return apiOutputError(err, "统计目录失败: ")
+	}
+
+	if IsMachineOutput() {
+		return writeOutput(flattenDuTree(root, opt))
+	}
+	if opt.Interactive {
+		browseDuTree(root, opt)
+		return nil
+	}
+	renderDuTable(root, opt)
+	return nil
+}
+
+func renderDuTable(root *duNode, opt *DuOptions) {
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "大小", "文件数", "目录数", "占比", "路径"})
+	for k, item := range flattenDuTree(root, opt) {
+		name := item.Path
+		if item.Type == "folder" {
+			name = strings.TrimSuffix(name, "/") + "/"
+		}
+		count, dirCount := strconv.FormatInt(item.FileCount, 10), strconv.FormatInt(item.DirCount, 10)
+		if item.Type == "file" {
+			count, dirCount = "-", "-"
+		}
+		tb.Append([]string{strconv.Itoa(k), converter.ConvertFileSize(item.Size, 2), count, dirCount,
+			duPercent(item.Size, root.size), strings.Repeat("  ", item.Depth) + name})
+	}
+	tb.Render()
+
+	fmt.Printf("\n分类统计:\n")
+	renderDuCategories(root)
+}
+
+func renderDuCategories(n *duNode) {
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"分类", "大小", "文件数", "占比"})
+	for _, category := range duCategories {
+		tb.Append([]string{category, converter.ConvertFileSize(n.categorySize[category], 2),
+			strconv.FormatInt(n.categoryCount[category], 10), duPercent(n.categorySize[category], n.size)})
+	}
+	tb.Append([]string{"总计", converter.ConvertFileSize(n.size, 2), strconv.FormatInt(n.fileCount, 10), ""})
+	tb.Render()
+}
+
+// browseDuTree 交互式浏览目录树，输入序号进入目录，.. 返回上级，c 显示分类统计，s 切换排序，q 退出
+func browseDuTree(root *duNode, opt *DuOptions) {
+	current := root
+	sortBy := opt.Sort
+	for {
+		children := current.sortedChildren(sortBy, opt.Top, true)
+		fmt.Printf("\n--- %s  总大小: %s, 文件: %d, 目录: %d, 排序: %s ---\n",
+			current.path, converter.ConvertFileSize(current.size, 2), current.fileCount, current.dirCount, sortBy)
+		for k, c := range children {
+			name := c.name
+			if c.isFolder {
+				name += "/"
+			}
+			fmt.Printf("%4d %10s %6s %s %s\n", k+1, converter.ConvertFileSize(c.size, 2),
+				duPercent(c.size, current.size), duBar(c.size, current.size), name)
+		}
+		fmt.Printf("\n输入序号进入目录, .. 返回上级, c 分类统计, s 切换排序, q 退出 > ")
+		input := ""
+		if _, err := fmt.Scanln(&input); err != nil && input == "" {
+			if err.Error() == "unexpected newline" {
+				continue
+			}
+			return
+		}
+		switch input {
+		case "q", "quit", "exit":
+			return
+		case "..":
+			if current.parent != nil {
+				current = current.parent
+			}
+		case "c":
+			renderDuCategories(current)
+		case "s":
+			switch sortBy {
+			case duSortSize:
+				sortBy = duSortCount
+			case duSortCount:
+				sortBy = duSortName
+			default:
+				sortBy = duSortSize
+			}
+		default:
+			idx, err := strconv.Atoi(input)
+			if err != nil || idx < 1 || idx > len(children) {
+				fmt.Println("输入错误")
+				continue
+			}
+			if !children[idx-1].isFolder {
+				fmt.Println("只能进入目录")
+				continue
+			}
+			current = children[idx-1]
+		}
+	}
+}
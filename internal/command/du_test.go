@@ -0,0 +1,77 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+)
+
+func TestBuildDuTree(t *testing.T) {
+	dirs := map[string]aliyunpan.FileList{
+		"/data": {
+			{FileName: "movies", FileType: "folder"},
+			{FileName: "photos", FileType: "folder"},
+			{FileName: "notes.txt", FileType: "file", FileSize: 10, Category: "doc"},
+		},
+		"/data/movies": {
+			{FileName: "a.mp4", FileType: "file", FileSize: 1000, Category: "video"},
+			{FileName: "sub", FileType: "folder"},
+		},
+		"/data/movies/sub": {
+			{FileName: "b.zip", FileType: "file", FileSize: 300, Category: "zip"},
+		},
+		"/data/photos": {
+			{FileName: "1.jpg", FileType: "file", FileSize: 200, Category: "image"},
+			{FileName: "2.jpg", FileType: "file", FileSize: 200, Category: "image"},
+			{FileName: "3.jpg", FileType: "file", FileSize: 200, Category: "image"},
+		},
+	}
+	listed := 0
+	list := func(dirPath string) (aliyunpan.FileList, *apierror.ApiError) {
+		listed++
+		if files, ok := dirs[dirPath]; ok {
+			return files, nil
+		}
+		return nil, apierror.NewFailedApiError("not found")
+	}
+	root, err := buildDuTree(list, "/data", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listed != 4 || root.size != 1910 || root.fileCount != 6 || root.dirCount != 3 {
+		t.Fatalf("unexpected root: size=%d files=%d dirs=%d", root.size, root.fileCount, root.dirCount)
+	}
+	if root.categorySize["video"] != 1000 || root.categorySize["image"] != 600 || root.categorySize["doc"] != 10 ||
+		root.categorySize["others"] != 300 || root.categoryCount["image"] != 3 {
+		t.Errorf("unexpected categories: %v %v", root.categorySize, root.categoryCount)
+	}
+
+	paths := func(items []*DuOutput) []string {
+		r := []string{}
+		for _, item := range items {
+			r = append(r, item.Path)
+		}
+		return r
+	}
+	items := flattenDuTree(root, &DuOptions{Depth: 1, Sort: duSortSize})
+	if !reflect.DeepEqual(paths(items), []string{"/data", "/data/movies", "/data/photos"}) || items[1].Size != 1300 || items[1].DirCount != 1 {
+		t.Errorf("unexpected items: %v", paths(items))
+	}
+	items = flattenDuTree(root, &DuOptions{Depth: 2, Sort: duSortCount, Top: 1, ShowFiles: true})
+	if !reflect.DeepEqual(paths(items), []string{"/data", "/data/photos", "/data/photos/1.jpg"}) || items[2].Depth != 2 {
+		t.Errorf("unexpected items: %v", paths(items))
+	}
+	items = flattenDuTree(root, &DuOptions{Depth: 1, Sort: duSortName, ShowFiles: true})
+	if !reflect.DeepEqual(paths(items), []string{"/data", "/data/movies", "/data/notes.txt", "/data/photos"}) {
+		t.Errorf("unexpected items: %v", paths(items))
+	}
+
+	if _, err = buildDuTree(list, "/missing", nil, nil); err == nil {
+		t.Errorf("missing dir should fail")
+	}
+	if duBar(5, 10) != "[##########          ]" || duPercent(1, 3) != "33.3%" {
+		t.Errorf("unexpected bar: %s %s", duBar(5, 10), duPercent(1, 3))
+	}
+}
@@ -24,7 +24,9 @@ import (
 	"github.com/tickstep/library-go/converter"
 	"github.com/urfave/cli"
 	"os"
+	"regexp"
 	"strconv"
+	"time"
 )
 
 type (
@@ -37,6 +39,28 @@ type (
 	SearchOptions struct {
 		Total   bool
 		Recurse bool
+
+		// Name 文件名，支持通配符，不包含通配符时按包含关键字匹配
+		Name  string
+		Regex *regexp.Regexp
+		// Categories 文件分类，例如：video, image, doc
+		Categories []string
+		// Exts 文件扩展名，不包含"."
+		Exts []string
+		// Type 文件类型，file 或者 folder
+		Type           string
+		MinSize        int64
+		MaxSize        int64
+		ModifiedAfter  time.Time
+		ModifiedBefore time.Time
+		// Dir 搜索的目录，为空则搜索整个网盘
+		Dir string
+
+		// Limit 最多返回的结果数量
+		Limit int
+		// Marker 分页标记
+		Marker  string
+		OrderBy string
 	}
 )
 
@@ -73,8 +97,7 @@ func CmdLs() cli.Command {
 		After:    SaveConfigFunc,
 		Action: func(c *cli.Context) error {
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
 
 			var (
@@ -102,11 +125,9 @@ func CmdLs() cli.Command {
 				orderBy = aliyunpan.FileOrderByUpdatedAt
 			}
 
-			RunLs(parseDriveId(c), c.Args().Get(0), &LsOptions{
+			return reportError(RunLs(parseDriveId(c), c.Args().Get(0), &LsOptions{
 				Total: c.Bool("l") || c.Parent().Args().Get(0) == "ll",
-			}, orderBy, orderSort)
-
-			return nil
+			}, orderBy, orderSort))
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -139,7 +160,7 @@ func CmdLs() cli.Command {
 }
 
 func RunLs(driveId, targetPath string, lsOptions *LsOptions,
-	orderBy aliyunpan.FileOrderBy, orderDirection aliyunpan.FileOrderDirection) {
+	orderBy aliyunpan.FileOrderBy, orderDirection aliyunpan.FileOrderDirection) error {
 	activeUser := config.Config.ActiveUser()
 	targetPath = activeUser.PathJoin(driveId, targetPath)
 
@@ -147,11 +168,9 @@ func RunLs(driveId, targetPath string, lsOptions *LsOptions,
 	targetPathInfo, err := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, targetPath)
 	if err != nil {
 		if err.Code == apierror.ApiCodeFileNotFoundCode {
-			fmt.Println("指定目录不存在: " + targetPath)
-		} else {
-			fmt.Println(err)
+			return notFoundErrorf("指定目录不存在: %s", targetPath)
 		}
-		return
+		return apiOutputError(err, "")
 	}
 
 	// 适配通配符路径获取目标文件信息（弃用，容易触发风控）
@@ -173,8 +192,7 @@ func RunLs(driveId, targetPath string, lsOptions *LsOptions,
 	//}
 
 	if targetPathInfo == nil {
-		fmt.Println("目录路径不存在")
-		return
+		return notFoundErrorf("目录路径不存在")
 	}
 
 	fileList := aliyunpan.FileList{}
@@ -186,14 +204,17 @@ func RunLs(driveId, targetPath string, lsOptions *LsOptions,
 	if targetPathInfo.IsFolder() {
 		fileResult, err1 := activeUser.PanClient().OpenapiPanClient().FileListGetAll(fileListParam, 200)
 		if err1 != nil {
-			fmt.Println(err1)
-			return
+			return apiOutputError(err1, "")
 		}
 		fileList = fileResult
 	} else {
 		fileList = append(fileList, targetPathInfo)
 	}
+	if IsMachineOutput() {
+		return writeOutput(newFileOutputList(fileList, targetPathInfo.Path))
+	}
 	renderTable(opLs, lsOptions.Total, targetPathInfo.Path, fileList)
+	return nil
 }
 
 func renderTable(op int, isTotal bool, path string, files aliyunpan.FileList) {
@@ -215,7 +236,7 @@ func renderTable(op int, isTotal bool, path string, files aliyunpan.FileList) {
 		tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
 		for k, file := range files {
 			if file.IsFolder() {
-				tb.Append([]string{strconv.Itoa(k + 1), file.FileId, "-", "-", "-", file.CreatedAt, file.UpdatedAt, file.FileName + aliyunpan.PathSeparator})
+				tb.Append([]string{strconv.Itoa(k + 1), file.FileId, "-", "-", "-", file.CreatedAt, file.UpdatedAt, showFolderName(op, file)})
 				continue
 			}
 
@@ -233,7 +254,7 @@ func renderTable(op int, isTotal bool, path string, files aliyunpan.FileList) {
 		tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
 		for k, file := range files {
 			if file.IsFolder() {
-				tb.Append([]string{strconv.Itoa(k + 1), "-", file.UpdatedAt, file.FileName + aliyunpan.PathSeparator})
+				tb.Append([]string{strconv.Itoa(k + 1), "-", file.UpdatedAt, showFolderName(op, file)})
 				continue
 			}
 
@@ -247,8 +268,20 @@ func renderTable(op int, isTotal bool, path string, files aliyunpan.FileList) {
 		fN, dN = files.Count()
 		tb.Append([]string{"", "总: " + converter.ConvertFileSize(files.TotalSize(), 2), "", fmt.Sprintf("文件总数: %d, 目录总数: %d", fN, dN)})
 	}
-	fmt.Printf("\n当前目录: %s\n", path)
+	if op == opSearch {
+		fmt.Printf("\n搜索目录: %s\n", path)
+	} else {
+		fmt.Printf("\n当前目录: %s\n", path)
+	}
 	fmt.Printf("----\n")
 	tb.Render()
 	fmt.Printf("----\n")
 }
+
+// showFolderName 目录显示的名称，搜索结果显示完整路径
+func showFolderName(op int, file *aliyunpan.FileEntity) string {
+	if op == opSearch {
+		return file.Path + aliyunpan.PathSeparator
+	}
+	return file.FileName + aliyunpan.PathSeparator
+}
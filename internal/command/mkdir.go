@@ -35,11 +35,9 @@ func CmdMkdir() cli.Command {
 				return nil
 			}
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
-			RunMkdir(parseDriveId(c), c.Args().Get(0))
-			return nil
+			return reportError(RunMkdir(parseDriveId(c), c.Args().Get(0)))
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -51,7 +49,7 @@ func CmdMkdir() cli.Command {
 	}
 }
 
-func RunMkdir(driveId, name string) {
+func RunMkdir(driveId, name string) error {
 	activeUser := GetActiveUser()
 	fullpath := activeUser.PathJoin(driveId, name)
 	rs := &aliyunpan.MkdirResult{}
@@ -59,8 +57,7 @@ func RunMkdir(driveId, name string) {
 	rs, err = activeUser.PanClient().OpenapiPanClient().MkdirByFullPath(driveId, fullpath)
 
 	if err != nil {
-		fmt.Println("创建文件夹失败：" + err.Error())
-		return
+		return apiOutputError(err, "创建文件夹失败：")
 	}
 
 	if rs.FileId != "" {
@@ -69,6 +66,7 @@ func RunMkdir(driveId, name string) {
 		// cache
 		activeUser.DeleteCache(GetAllPathFolderByPath(fullpath))
 	} else {
-		fmt.Println("创建文件夹失败: ", fullpath)
+		return errorf("创建文件夹失败: %s", fullpath)
 	}
+	return nil
 }
@@ -49,11 +49,9 @@ func CmdMv() cli.Command {
 				return nil
 			}
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
-			RunMove(parseDriveId(c), c.Args()...)
-			return nil
+			return reportError(RunMove(parseDriveId(c), c.Args()...))
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -66,21 +64,18 @@ func CmdMv() cli.Command {
 }
 
 // RunMove 执行移动文件/目录
-func RunMove(driveId string, paths ...string) {
+func RunMove(driveId string, paths ...string) error {
 	activeUser := GetActiveUser()
 	cacheCleanPaths := []string{}
 	opFileList, targetFile, _, err := getFileInfo(driveId, paths...)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 	if targetFile == nil {
-		fmt.Println("目标文件不存在")
-		return
+		return notFoundErrorf("目标文件不存在")
 	}
 	if opFileList == nil || len(opFileList) == 0 {
-		fmt.Println("没有有效的文件可移动")
-		return
+		return notFoundErrorf("没有有效的文件可移动")
 	}
 	cacheCleanPaths = append(cacheCleanPaths, targetFile.Path)
 
@@ -119,15 +114,20 @@ func RunMove(driveId string, paths ...string) {
 		}
 		fmt.Println("操作成功, 以下文件已移动到目标目录: ", targetFile.Path)
 		pnt()
-	} else {
-		fmt.Println("无法移动文件，请稍后重试")
 	}
 	activeUser.DeleteCache(cacheCleanPaths)
+	if len(successMoveFiles) == 0 {
+		return errorf("无法移动文件，请稍后重试")
+	}
+	if len(failedMoveFiles) > 0 {
+		return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分文件移动失败")
+	}
+	return nil
 }
 
 func getFileInfo(driveId string, paths ...string) (opFileList []*aliyunpan.FileEntity, targetFile *aliyunpan.FileEntity, failedPaths []string, error error) {
 	if len(paths) <= 1 {
-		return nil, nil, nil, fmt.Errorf("请指定目标文件夹路径")
+		return nil, nil, nil, usageErrorf("请指定目标文件夹路径")
 	}
 	activeUser := GetActiveUser()
 	// the last one is the target file path
@@ -135,7 +135,7 @@ func getFileInfo(driveId string, paths ...string) (opFileList []*aliyunpan.FileE
 	absolutePath := activeUser.PathJoin(driveId, targetFilePath)
 	targetFile, err := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, absolutePath)
 	if err != nil || !targetFile.IsFolder() {
-		return nil, nil, nil, fmt.Errorf("指定目标文件夹不存在")
+		return nil, nil, nil, notFoundErrorf("指定目标文件夹不存在")
 	}
 
 	for idx := 0; idx < (len(paths) - 1); idx++ {
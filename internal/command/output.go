@@ -0,0 +1,487 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/functions/pandownload"
+	"github.com/tickstep/aliyunpan/internal/global"
+	"github.com/urfave/cli"
+)
+
+const (
+	// OutputFormatTable 默认的表格输出
+	OutputFormatTable = "table"
+	// OutputFormatJson JSON输出，列表输出为JSON数组
+	OutputFormatJson = "json"
+	// OutputFormatJsonl JSON Lines输出，每一行一个JSON对象
+	OutputFormatJsonl = "jsonl"
+	// OutputFormatCsv CSV输出，第一行为表头
+	OutputFormatCsv = "csv"
+)
+
+const (
+	// ExitCodeSuccess 成功
+	ExitCodeSuccess = 0
+	// ExitCodeError 一般错误
+	ExitCodeError = 1
+	// ExitCodeUsage 参数错误
+	ExitCodeUsage = 2
+	// ExitCodeNotLoggedIn 未登录或者登录失效
+	ExitCodeNotLoggedIn = 3
+	// ExitCodeNotFound 文件或者资源不存在
+	ExitCodeNotFound = 4
+	// ExitCodePartialFailure 部分文件处理失败
+	ExitCodePartialFailure = 5
+	// ExitCodeRateLimited 请求过于频繁被限流
+	ExitCodeRateLimited = 6
+	// ExitCodeChecksumMismatch 文件校验失败
+	ExitCodeChecksumMismatch = 7
+	// ExitCodeConfigError 配置文件错误
+	ExitCodeConfigError = 8
+)
+
+const (
+	errCodeError       = "error"
+	errCodeUsage       = "invalid_argument"
+	errCodeNotLoggedIn = "not_logged_in"
+	errCodeNotFound    = "not_found"
+	errCodeApi         = "api_error"
+
+	errCodePartialFailure   = "partial_failure"
+	errCodeRateLimited      = "rate_limited"
+	errCodeChecksumMismatch = "checksum_mismatch"
+	errCodeConfigError      = "config_error"
+)
+
+type (
+	// OutputError 命令执行错误，机器可读输出时以 {"error": {...}} 的格式输出
+	OutputError struct {
+		// Code 错误类型：error, invalid_argument, not_logged_in, not_found, api_error,
+		// partial_failure, rate_limited, checksum_mismatch, config_error
+		Code string `json:"code"`
+		// ApiCode 阿里云盘接口错误码，只有接口错误才有
+		ApiCode int `json:"apiCode,omitempty"`
+		// Message 错误信息
+		Message string `json:"message"`
+
+		exitCode int
+	}
+
+	// FileOutput 文件信息输出格式，ls, tree, recycle list, album list-file 命令使用
+	FileOutput struct {
+		DriveId      string `json:"driveId"`
+		FileId       string `json:"fileId"`
+		ParentFileId string `json:"parentFileId"`
+		// Name 文件名
+		Name string `json:"name"`
+		// Path 文件完整路径，回收站和相簿文件为空
+		Path string `json:"path"`
+		// Type 文件类型：file, folder
+		Type string `json:"type"`
+		// Size 文件大小，文件夹为0
+		Size int64 `json:"size"`
+		// ContentHash 文件SHA1，文件夹为空
+		ContentHash     string `json:"contentHash"`
+		ContentHashName string `json:"contentHashName"`
+		Crc64Hash       string `json:"crc64Hash"`
+		Category        string `json:"category"`
+		CreatedAt       string `json:"createdAt"`
+		UpdatedAt       string `json:"updatedAt"`
+	}
+
+	// TreeFileOutput 树形图文件信息输出格式，tree 命令使用
+	TreeFileOutput struct {
+		// Depth 相对指定目录的层级，指定目录下的文件为0
+		Depth int `json:"depth"`
+		FileOutput
+	}
+
+	// QuotaOutput 空间配额输出格式，quota 命令使用
+	QuotaOutput struct {
+		UserId   string `json:"userId"`
+		Nickname string `json:"nickname"`
+		// UsedSize 已使用空间大小
+		UsedSize int64 `json:"usedSize"`
+		// TotalSize 空间总大小
+		TotalSize int64 `json:"totalSize"`
+	}
+
+	// UserOutput 当前帐号输出格式，who 命令使用
+	UserOutput struct {
+		UserId      string `json:"userId"`
+		Nickname    string `json:"nickname"`
+		AccountName string `json:"accountName"`
+		// ThirdPartyVip 是否开通三方权益包
+		ThirdPartyVip       bool   `json:"thirdPartyVip"`
+		ThirdPartyVipExpire string `json:"thirdPartyVipExpire"`
+		// ActiveDriveId 当前使用的网盘ID
+		ActiveDriveId   string `json:"activeDriveId"`
+		ActiveDriveName string `json:"activeDriveName"`
+	}
+
+	// AccountOutput 帐号列表输出格式，loglist 命令使用
+	AccountOutput struct {
+		// Index 序号，从1开始，和 su 命令的 # 值一致
+		Index       int    `json:"index"`
+		UserId      string `json:"userId"`
+		AccountName string `json:"accountName"`
+		Nickname    string `json:"nickname"`
+		// Active 是否是当前帐号
+		Active bool `json:"active"`
+	}
+
+	// DriveOutput 网盘列表输出格式，drive 命令使用
+	DriveOutput struct {
+		// Index 序号，从1开始，和 drive 命令的 # 值一致
+		Index     int    `json:"index"`
+		DriveId   string `json:"driveId"`
+		DriveName string `json:"driveName"`
+		DriveTag  string `json:"driveTag"`
+		// Active 是否是当前网盘
+		Active bool `json:"active"`
+	}
+
+	// ShareOutput 分享链接输出格式，sharew list 命令使用
+	ShareOutput struct {
+		ShareId   string `json:"shareId"`
+		ShareName string `json:"shareName"`
+		ShareUrl  string `json:"shareUrl"`
+		SharePwd  string `json:"sharePwd"`
+		// Expiration 过期时间，永久有效为空
+		Expiration string `json:"expiration"`
+		// Status 状态：valid, expired, deleted, forbidden
+		Status    string `json:"status"`
+		SaveCount int    `json:"saveCount"`
+		CreatedAt string `json:"createdAt"`
+	}
+)
+
+var (
+	// outputFormat 当前的输出格式
+	outputFormat = OutputFormatTable
+
+	// outputWriter 输出目标
+	outputWriter io.Writer = os.Stdout
+
+	// lastExitCode 最近一次执行的命令的退出码，脚本执行时用于判断命令是否成功
+	lastExitCode = ExitCodeSuccess
+)
+
+// SetOutputFormat 设置输出格式
+func SetOutputFormat(format string) error {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "":
+		outputFormat = OutputFormatTable
+	case OutputFormatTable, OutputFormatJson, OutputFormatJsonl, OutputFormatCsv:
+		outputFormat = format
+	default:
+		outputFormat = OutputFormatTable
+		return fmt.Errorf("不支持的输出格式: %s，可选值：table, json, jsonl, csv", format)
+	}
+	return nil
+}
+
+// IsMachineOutput 是否是机器可读的输出格式
+func IsMachineOutput() bool {
+	return outputFormat != OutputFormatTable
+}
+
+func (e *OutputError) Error() string {
+	return e.Message
+}
+
+// ExitCode 进程退出码
+func (e *OutputError) ExitCode() int {
+	return e.exitCode
+}
+
+func newOutputError(code string, exitCode int, format string, a ...interface{}) *OutputError {
+	return &OutputError{
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		exitCode: exitCode,
+	}
+}
+
+// errorf 一般错误
+func errorf(format string, a ...interface{}) *OutputError {
+	return newOutputError(errCodeError, ExitCodeError, format, a...)
+}
+
+// usageErrorf 参数错误
+func usageErrorf(format string, a ...interface{}) *OutputError {
+	return newOutputError(errCodeUsage, ExitCodeUsage, format, a...)
+}
+
+// notFoundErrorf 文件或者资源不存在
+func notFoundErrorf(format string, a ...interface{}) *OutputError {
+	return newOutputError(errCodeNotFound, ExitCodeNotFound, format, a...)
+}
+
+// notLoggedInError 未登录账号
+func notLoggedInError() *OutputError {
+	return newOutputError(errCodeNotLoggedIn, ExitCodeNotLoggedIn, "未登录账号")
+}
+
+// webNotLoggedInError WEB客户端未登录
+func webNotLoggedInError() *OutputError {
+	return newOutputError(errCodeNotLoggedIn, ExitCodeNotLoggedIn, "WEB客户端未登录，请登录后再使用该命令")
+}
+
+// configErrorf 配置文件错误
+func configErrorf(format string, a ...interface{}) *OutputError {
+	return newOutputError(errCodeConfigError, ExitCodeConfigError, format, a...)
+}
+
+// apiOutputError 转换错误，保留错误链中的接口错误码，prefix 不为空则作为错误信息的前缀
+func apiOutputError(err error, prefix string) *OutputError {
+	if err == nil {
+		return nil
+	}
+	var oe *OutputError
+	if errors.As(err, &oe) && oe != nil {
+		return oe
+	}
+	msg := err.Error()
+	if prefix != "" {
+		msg = prefix + msg
+	}
+	var apiErr *apierror.ApiError
+	if !errors.As(err, &apiErr) || apiErr == nil {
+		if errors.Is(err, pandownload.ErrDownloadChecksumFailed) {
+			return newOutputError(errCodeChecksumMismatch, ExitCodeChecksumMismatch, "%s", msg)
+		}
+		return errorf("%s", msg)
+	}
+	oe = newOutputError(errCodeApi, ExitCodeError, "%s", msg)
+	oe.ApiCode = int(apiErr.Code)
+	switch apiErr.Code {
+	case apierror.ApiCodeFileNotFoundCode:
+		oe.Code, oe.exitCode = errCodeNotFound, ExitCodeNotFound
+	case apierror.ApiCodeTokenExpiredCode, apierror.ApiCodeRefreshTokenExpiredCode, apierror.ApiCodeNeedCaptchaCode:
+		oe.Code, oe.exitCode = errCodeNotLoggedIn, ExitCodeNotLoggedIn
+	case apierror.ApiCodeTooManyRequests:
+		oe.Code, oe.exitCode = errCodeRateLimited, ExitCodeRateLimited
+	}
+	return oe
+}
+
+// reportError 输出错误并返回命令的退出错误。表格输出直接打印错误信息，机器可读输出则输出JSON格式的错误，
+// CSV格式的错误输出到标准错误。交互模式下不退出程序
+func reportError(err error) error {
+	if err == nil {
+		return nil
+	}
+	oe := apiOutputError(err, "")
+	if IsMachineOutput() {
+		w := outputWriter
+		if outputFormat == OutputFormatCsv {
+			w = os.Stderr
+		}
+		data, _ := json.Marshal(map[string]*OutputError{"error": oe})
+		fmt.Fprintln(w, string(data))
+	} else {
+		fmt.Println(oe.Message)
+	}
+	return exitError(oe.exitCode)
+}
+
+// ReportError 输出错误并返回命令的退出错误，供 command 包以外的命令使用
+func ReportError(err error) error {
+	return reportError(err)
+}
+
+// ReportUsageError 输出参数错误并返回参数错误的退出错误
+func ReportUsageError(format string, a ...interface{}) error {
+	return reportError(usageErrorf(format, a...))
+}
+
+// ConfigError 输出配置文件错误并返回配置错误的退出错误
+func ConfigError(err error) error {
+	return reportError(configErrorf("FATAL ERROR: config file error: %s", err))
+}
+
+// exitError 返回指定退出码的退出错误，交互模式和执行脚本时不退出程序
+func exitError(exitCode int) error {
+	lastExitCode = exitCode
+	if exitCode == ExitCodeSuccess || global.IsAppInCliMode || scriptDepth > 0 {
+		return nil
+	}
+	return cli.NewExitError("", exitCode)
+}
+
+// writeOutput 按照当前的机器可读格式输出数据，data 为结构体（指针）或者结构体（指针）的切片
+func writeOutput(data interface{}) error {
+	return writeOutputTo(outputWriter, outputFormat, data)
+}
+
+func writeOutputTo(w io.Writer, format string, data interface{}) error {
+	v := reflect.ValueOf(data)
+	isList := v.Kind() == reflect.Slice
+	items := []interface{}{}
+	if isList {
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, v.Index(i).Interface())
+		}
+	} else {
+		items = append(items, data)
+	}
+
+	switch format {
+	case OutputFormatJson:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if isList {
+			return encoder.Encode(items)
+		}
+		return encoder.Encode(data)
+	case OutputFormatJsonl:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		for _, item := range items {
+			if e := encoder.Encode(item); e != nil {
+				return e
+			}
+		}
+		return nil
+	case OutputFormatCsv:
+		writer := csv.NewWriter(w)
+		if e := writer.Write(csvHeader(reflect.TypeOf(data))); e != nil {
+			return e
+		}
+		for _, item := range items {
+			if e := writer.Write(csvRow(reflect.ValueOf(item))); e != nil {
+				return e
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("不支持的输出格式: %s", format)
+}
+
+// csvHeader 使用json标签作为CSV的表头，内嵌的结构体字段展开
+func csvHeader(t reflect.Type) []string {
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	header := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			header = append(header, csvHeader(field.Type)...)
+			continue
+		}
+		if name := jsonFieldName(field); name != "" {
+			header = append(header, name)
+		}
+	}
+	return header
+}
+
+func csvRow(v reflect.Value) []string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	row := []string{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			row = append(row, csvRow(v.Field(i))...)
+			continue
+		}
+		if jsonFieldName(field) == "" {
+			continue
+		}
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.String:
+			row = append(row, fv.String())
+		case reflect.Bool:
+			row = append(row, strconv.FormatBool(fv.Bool()))
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			row = append(row, strconv.FormatInt(fv.Int(), 10))
+		default:
+			row = append(row, fmt.Sprint(fv.Interface()))
+		}
+	}
+	return row
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		// 未导出字段
+		return ""
+	}
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// newFileOutput 转换文件信息，parentPath 不为空并且文件没有完整路径时，使用 parentPath 拼接完整路径
+func newFileOutput(file *aliyunpan.FileEntity, parentPath string) *FileOutput {
+	filePath := file.Path
+	if filePath == "" && parentPath != "" {
+		filePath = path.Join(parentPath, file.FileName)
+	}
+	size := file.FileSize
+	if file.IsFolder() {
+		size = 0
+	}
+	return &FileOutput{
+		DriveId:         file.DriveId,
+		FileId:          file.FileId,
+		ParentFileId:    file.ParentFileId,
+		Name:            file.FileName,
+		Path:            filePath,
+		Type:            file.FileType,
+		Size:            size,
+		ContentHash:     file.ContentHash,
+		ContentHashName: file.ContentHashName,
+		Crc64Hash:       file.Crc64Hash,
+		Category:        file.Category,
+		CreatedAt:       file.CreatedAt,
+		UpdatedAt:       file.UpdatedAt,
+	}
+}
+
+// newFileOutputList 转换文件列表
+func newFileOutputList(files aliyunpan.FileList, parentPath string) []*FileOutput {
+	result := []*FileOutput{}
+	for _, f := range files {
+		result = append(result, newFileOutput(f, parentPath))
+	}
+	return result
+}
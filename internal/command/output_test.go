@@ -0,0 +1,103 @@
+package command
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+)
+
+func TestWriteOutput(t *testing.T) {
+	files := []*TreeFileOutput{
+		{Depth: 0, FileOutput: FileOutput{FileId: "f1", Name: "a.txt", Path: "/a.txt", Type: "file", Size: 10}},
+		{Depth: 1, FileOutput: FileOutput{FileId: "f2", Name: "b,c.txt", Path: "/d/b,c.txt", Type: "file", Size: 20}},
+	}
+
+	buf := &bytes.Buffer{}
+	if e := writeOutputTo(buf, OutputFormatJsonl, files); e != nil {
+		t.Fatal(e)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"depth":0,"driveId":"","fileId":"f1"`) {
+		t.Errorf("unexpected jsonl output: %s", buf.String())
+	}
+
+	buf.Reset()
+	if e := writeOutputTo(buf, OutputFormatCsv, files); e != nil {
+		t.Fatal(e)
+	}
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected csv output: %s", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "depth,driveId,fileId,parentFileId,name,path,type,size,") {
+		t.Errorf("unexpected csv header: %s", lines[0])
+	}
+	if lines[2] != `1,,f2,,"b,c.txt","/d/b,c.txt",file,20,,,,,,` {
+		t.Errorf("unexpected csv row: %s", lines[2])
+	}
+
+	// 空列表输出空数组
+	buf.Reset()
+	if e := writeOutputTo(buf, OutputFormatJson, []*FileOutput{}); e != nil {
+		t.Fatal(e)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("unexpected json output: %s", buf.String())
+	}
+
+	// 单个对象
+	buf.Reset()
+	if e := writeOutputTo(buf, OutputFormatCsv, &QuotaOutput{UserId: "u1", UsedSize: 1, TotalSize: 2}); e != nil {
+		t.Fatal(e)
+	}
+	if buf.String() != "userId,nickname,usedSize,totalSize\nu1,,1,2\n" {
+		t.Errorf("unexpected csv output: %s", buf.String())
+	}
+}
+
+func TestSetOutputFormat(t *testing.T) {
+	defer SetOutputFormat(OutputFormatTable)
+	if e := SetOutputFormat("JSON"); e != nil || !IsMachineOutput() {
+		t.Errorf("json output format should be accepted")
+	}
+	if e := SetOutputFormat("xml"); e == nil || IsMachineOutput() {
+		t.Errorf("xml output format should be rejected")
+	}
+}
+
+func TestApiOutputError(t *testing.T) {
+	e := apiOutputError(apierror.NewApiError(apierror.ApiCodeFileNotFoundCode, "file not found"), "获取文件失败: ")
+	if e.Code != errCodeNotFound || e.ExitCode() != ExitCodeNotFound || e.ApiCode != int(apierror.ApiCodeFileNotFoundCode) {
+		t.Errorf("unexpected error: %+v", e)
+	}
+	if e.Message != "获取文件失败: file not found" {
+		t.Errorf("unexpected message: %s", e.Message)
+	}
+	e = apiOutputError(apierror.NewApiError(apierror.ApiCodeTokenExpiredCode, "token expired"), "")
+	if e.Code != errCodeNotLoggedIn || e.ExitCode() != ExitCodeNotLoggedIn {
+		t.Errorf("unexpected error: %+v", e)
+	}
+	if apiOutputError(usageErrorf("bad"), "prefix").Message != "bad" {
+		t.Errorf("output error should be kept as it is")
+	}
+}
+
+func TestShareStatus(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	file := &aliyunpan.FileEntity{}
+	cases := map[string]*aliyunpan.ShareEntity{
+		"valid":     {Status: "enabled", FirstFile: file},
+		"expired":   {Status: "enabled", FirstFile: file, Expiration: "2026-10-19 11:00:00"},
+		"deleted":   {Status: "enabled"},
+		"forbidden": {Status: "forbidden", FirstFile: file},
+	}
+	for status, record := range cases {
+		if s := shareStatus(record, now); s != status {
+			t.Errorf("expected %s, got %s", status, s)
+		}
+	}
+}
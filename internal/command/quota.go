@@ -36,16 +36,24 @@ func CmdQuota() cli.Command {
 		Before:      ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
 			q, err := RunGetQuotaInfo()
-			if err == nil {
-				fmt.Printf("账号: %s, uid: %s, 个人空间总额: %s, 个人空间已使用: %s, 比率: %.2f%%\n",
-					config.Config.ActiveUser().Nickname, config.Config.ActiveUser().UserId,
-					converter.ConvertFileSize(q.Quota, 2), converter.ConvertFileSize(q.UsedSize, 2),
-					100*float64(q.UsedSize)/float64(q.Quota))
+			if err != nil {
+				return reportError(apiOutputError(err, "获取空间配额失败: "))
 			}
+			if IsMachineOutput() {
+				return reportError(writeOutput(&QuotaOutput{
+					UserId:    config.Config.ActiveUser().UserId,
+					Nickname:  config.Config.ActiveUser().Nickname,
+					UsedSize:  q.UsedSize,
+					TotalSize: q.Quota,
+				}))
+			}
+			fmt.Printf("账号: %s, uid: %s, 个人空间总额: %s, 个人空间已使用: %s, 比率: %.2f%%\n",
+				config.Config.ActiveUser().Nickname, config.Config.ActiveUser().UserId,
+				converter.ConvertFileSize(q.Quota, 2), converter.ConvertFileSize(q.UsedSize, 2),
+				100*float64(q.UsedSize)/float64(q.Quota))
 			return nil
 		},
 	}
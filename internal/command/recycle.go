@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"github.com/olekukonko/tablewriter"
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan-api/aliyunpan_web"
 	"github.com/tickstep/aliyunpan/cmder"
 	"github.com/tickstep/aliyunpan/cmder/cmdtable"
@@ -25,26 +26,131 @@ import (
 	"github.com/tickstep/library-go/logger"
 	"github.com/urfave/cli"
 	"os"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	// recycleBatchSize 每次批量还原或者删除的文件数量
+	recycleBatchSize = 100
+	// recycleTimeFormat 回收站文件时间格式
+	recycleTimeFormat = "2006-01-02 15:04:05"
+)
+
+type (
+	// RecycleFilter 回收站文件过滤条件，所有条件同时生效
+	RecycleFilter struct {
+		// Name 文件名通配符
+		Name string
+		// Path 原路径通配符，匹配文件原路径或者其所在的任意上级目录
+		Path string
+		// ModifiedAfter, ModifiedBefore 文件修改时间。回收站列表没有返回删除时间，只能按照修改时间过滤
+		ModifiedAfter  time.Time
+		ModifiedBefore time.Time
+		MinSize        int64
+		MaxSize        int64
+	}
+
+	// RecycleFileOutput 回收站文件输出格式，recycle list 命令使用
+	RecycleFileOutput struct {
+		// OriginalPath 删除前的完整路径，原目录已被彻底删除时为空
+		OriginalPath string `json:"originalPath"`
+		FileOutput
+	}
+
+	// RecycleResultOutput 回收站批量处理结果输出格式，recycle restore/purge 命令使用
+	RecycleResultOutput struct {
+		// Status 处理结果：restored-已还原，purged-已彻底删除，failed-失败，planned-待处理(-dry)
+		Status string `json:"status"`
+		// Reason 失败的原因
+		Reason string `json:"reason"`
+		RecycleFileOutput
+	}
+
+	// recyclePathResolver 获取回收站文件的原路径，相同目录只查询一次
+	recyclePathResolver struct {
+		client  *aliyunpan_web.WebPanClient
+		driveId string
+		dirs    map[string]string
+	}
+)
+
+func recycleFilterFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "driveId",
+			Usage: "网盘ID",
+			Value: "",
+		},
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "文件名，支持通配符(*, ?, [...])",
+		},
+		cli.StringFlag{
+			Name:  "path",
+			Usage: "原路径，支持通配符，匹配文件原路径或者其所在的上级目录，例如：/照片/2023*",
+		},
+		cli.StringFlag{
+			Name:  "modified-after",
+			Usage: "只处理该时间之后修改的文件，格式为 2006-01-02 或者 2006-01-02 15:04:05。注意回收站列表没有返回删除时间",
+		},
+		cli.StringFlag{
+			Name:  "modified-before",
+			Usage: "只处理该时间之前修改的文件",
+		},
+		cli.StringFlag{
+			Name:  "minSize",
+			Usage: "只处理大于等于指定大小的文件，例如：1mb",
+		},
+		cli.StringFlag{
+			Name:  "maxSize",
+			Usage: "只处理小于等于指定大小的文件，例如：1gb",
+		},
+	}
+}
+
+func recycleConfirmFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:  "dry",
+			Usage: "只显示将要处理的文件，不执行操作",
+		},
+		cli.BoolFlag{
+			Name:  "y",
+			Usage: "跳过人工确认",
+		},
+	}
+}
+
 func CmdRecycle() cli.Command {
 	return cli.Command{
 		Name:  "recycle",
 		Usage: "回收站",
 		Description: `
 	回收站操作.
+	回收站列表没有返回删除时间, 只能按照文件的修改时间过滤. 很久以前修改但刚刚删除的文件修改时间也很早, 请谨慎使用.
 
 	示例:
 
-	1. 从回收站还原两个文件, 其中的两个文件的 file_id 分别为 1013792297798440 和 643596340463870
+	1. 列出回收站中 2024-01-01 之后修改的 jpg 文件
+	aliyunpan recycle list -name "*.jpg" -modified-after 2024-01-01
+
+	2. 从回收站还原两个文件, 其中的两个文件的 file_id 分别为 1013792297798440 和 643596340463870
 	aliyunpan recycle restore 1013792297798440 643596340463870
 
-	2. 从回收站删除两个文件, 其中的两个文件的 file_id 分别为 1013792297798440 和 643596340463870
+	3. 还原原路径在 /照片 目录下, 并且在 2024-05-01 之后修改的文件
+	aliyunpan recycle restore -path "/照片" -modified-after 2024-05-01
+
+	4. 从回收站删除两个文件, 其中的两个文件的 file_id 分别为 1013792297798440 和 643596340463870
 	aliyunpan recycle delete 1013792297798440 643596340463870
 
-	3. 清空回收站, 程序不会进行二次确认, 谨慎操作!!!
+	5. 彻底删除回收站中修改时间在 30 天前的文件, 跳过确认
+	aliyunpan recycle purge -older-than 30d -by-mtime -y
+
+	6. 清空回收站, 程序不会进行二次确认, 谨慎操作!!!
 	aliyunpan recycle delete -all
 `,
 		Category: "阿里云盘",
@@ -60,56 +166,94 @@ func CmdRecycle() cli.Command {
 				Name:      "list",
 				Aliases:   []string{"ls", "l"},
 				Usage:     "列出回收站文件列表",
-				UsageText: cmder.App().Name + " recycle list",
+				UsageText: cmder.App().Name + " recycle list [选项]",
+				Description: `
+	列出回收站文件, 按照修改时间从新到旧排序, 支持按照文件名, 原路径, 修改时间和大小过滤.
+
+	示例:
+
+	列出第 2 页, 每页 50 个文件
+	aliyunpan recycle list -page 2 -limit 50
+
+	列出原路径在 /文档 目录下的文件
+	aliyunpan recycle list -path /文档
+
+	以 json 格式输出
+	aliyunpan --output json recycle list -modified-before 2024-01-01
+`,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
+					}
+					filter, err := newRecycleFilter(c)
+					if err != nil {
+						return reportError(err)
+					}
+					if c.Int("page") <= 0 || c.Int("limit") <= 0 {
+						return reportError(usageErrorf("页码和每页数量必须大于0"))
 					}
-					RunRecycleList(parseDriveId(c))
-					return nil
+					return reportError(RunRecycleList(parseDriveId(c), filter, c.Int("page"), c.Int("limit")))
 				},
-				Flags: []cli.Flag{
-					cli.StringFlag{
-						Name:  "driveId",
-						Usage: "网盘ID",
-						Value: "",
+				Flags: append(recycleFilterFlags(),
+					cli.IntFlag{
+						Name:  "page",
+						Usage: "页码，从1开始",
+						Value: 1,
 					},
-				},
+					cli.IntFlag{
+						Name:  "limit",
+						Usage: "每页显示的文件数量",
+						Value: 100,
+					},
+				),
 			},
 			{
-				Name:        "restore",
-				Aliases:     []string{"r"},
-				Usage:       "还原回收站文件或目录",
-				UsageText:   cmder.App().Name + " recycle restore <file_id 1> <file_id 2> <file_id 3> ...",
-				Description: `根据文件/目录的 fs_id, 还原回收站指定的文件或目录`,
+				Name:      "restore",
+				Aliases:   []string{"r"},
+				Usage:     "还原回收站文件或目录",
+				UsageText: cmder.App().Name + " recycle restore <file_id 1> <file_id 2> <file_id 3> ... | [-path <原路径>] [-modified-after <时间>] ...",
+				Description: `
+	根据文件/目录的 file_id, 还原回收站指定的文件或目录.
+	也可以不指定 file_id, 使用过滤条件批量还原, 还原前会列出匹配的文件并需要确认.
+
+	示例:
+
+	还原原路径在 /照片/2023 开头的目录下的文件, 只显示将要还原的文件
+	aliyunpan recycle restore -path "/照片/2023*" -dry
+
+	还原 2024-05-01 10:00 之后修改的所有文件, 跳过确认
+	aliyunpan recycle restore -modified-after "2024-05-01 10:00" -y
+`,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
+					}
+					filter, err := newRecycleFilter(c)
+					if err != nil {
+						return reportError(err)
+					}
+					if filter != nil {
+						if c.NArg() > 0 {
+							return reportError(usageErrorf("不能同时指定 file_id 和过滤条件"))
+						}
+						if IsMachineOutput() && !c.Bool("y") && !c.Bool("dry") {
+							return reportError(usageErrorf("机器可读输出时不能人工确认, 请指定 -y 或者 -dry"))
+						}
+						return reportError(RunRecycleBatch(parseDriveId(c), filter, recycleActionRestore, c.Bool("dry"), c.Bool("y")))
 					}
 					if c.NArg() <= 0 {
 						cli.ShowCommandHelp(c, c.Command.Name)
 						return nil
 					}
-					RunRecycleRestore(parseDriveId(c), c.Args()...)
-					return nil
-				},
-				Flags: []cli.Flag{
-					cli.StringFlag{
-						Name:  "driveId",
-						Usage: "网盘ID",
-						Value: "",
-					},
+					return reportError(RunRecycleRestore(parseDriveId(c), c.Args()...))
 				},
+				Flags: append(recycleFilterFlags(), recycleConfirmFlags()...),
 			},
 			{
 				Name:        "delete",
@@ -119,25 +263,21 @@ func CmdRecycle() cli.Command {
 				Description: `根据文件/目录的 file_id 或 -all 参数, 删除回收站指定的文件或目录或清空回收站`,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					if c.Bool("all") {
 						// 清空回收站
-						RunRecycleClear(parseDriveId(c))
-						return nil
+						return reportError(RunRecycleClear(parseDriveId(c)))
 					}
 
 					if c.NArg() <= 0 {
 						cli.ShowCommandHelp(c, c.Command.Name)
 						return nil
 					}
-					RunRecycleDelete(parseDriveId(c), c.Args()...)
-					return nil
+					return reportError(RunRecycleDelete(parseDriveId(c), c.Args()...))
 				},
 				Flags: []cli.Flag{
 					cli.BoolFlag{
@@ -151,40 +291,436 @@ func CmdRecycle() cli.Command {
 					},
 				},
 			},
+			{
+				Name:      "purge",
+				Usage:     "彻底删除回收站中符合条件的文件",
+				UsageText: cmder.App().Name + " recycle purge -older-than <时长> [选项]",
+				Description: `
+	彻底删除回收站中符合条件的文件, 删除后无法找回. 删除前会列出匹配的文件并需要确认.
+	时长格式: 30d(天), 12h(小时), 90m(分钟)
+
+	回收站列表没有返回删除时间, -older-than 等时间条件按照文件的修改时间过滤, 很久以前修改但刚刚删除的文件也会被匹配.
+	因此使用时间条件彻底删除时必须指定 -by-mtime 确认按照修改时间删除, 或者指定 -dry 只查看匹配的文件.
+
+	示例:
+
+	查看回收站中修改时间在 30 天前的文件, 不删除
+	aliyunpan recycle purge -older-than 30d -dry
+
+	彻底删除回收站中修改时间在 7 天前的 mp4 文件, 跳过确认
+	aliyunpan recycle purge -older-than 7d -by-mtime -name "*.mp4" -y
+`,
+				Action: func(c *cli.Context) error {
+					if config.Config.ActiveUser() == nil {
+						return reportError(notLoggedInError())
+					}
+					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+						return reportError(webNotLoggedInError())
+					}
+					filter, err := newRecycleFilter(c)
+					if err != nil {
+						return reportError(err)
+					}
+					if c.IsSet("older-than") {
+						age, err := parseRecycleAge(c.String("older-than"))
+						if err != nil {
+							return reportError(err)
+						}
+						if filter == nil {
+							filter = &RecycleFilter{}
+						}
+						before := time.Now().Add(-age)
+						if filter.ModifiedBefore.IsZero() || before.Before(filter.ModifiedBefore) {
+							filter.ModifiedBefore = before
+						}
+					}
+					if filter == nil {
+						return reportError(usageErrorf("请使用 -older-than 或者其他过滤条件指定要删除的文件, 清空回收站请使用 recycle delete -all"))
+					}
+					if (!filter.ModifiedAfter.IsZero() || !filter.ModifiedBefore.IsZero()) && !c.Bool("by-mtime") && !c.Bool("dry") {
+						return reportError(usageErrorf("回收站没有删除时间, 时间条件按照文件修改时间过滤, 可能误删刚删除的文件. 请指定 -by-mtime 确认按照修改时间删除, 或者使用 -dry 查看"))
+					}
+					if IsMachineOutput() && !c.Bool("y") && !c.Bool("dry") {
+						return reportError(usageErrorf("机器可读输出时不能人工确认, 请指定 -y 或者 -dry"))
+					}
+					return reportError(RunRecycleBatch(parseDriveId(c), filter, recycleActionPurge, c.Bool("dry"), c.Bool("y")))
+				},
+				Flags: append(append(recycleFilterFlags(),
+					cli.StringFlag{
+						Name:  "older-than",
+						Usage: "只删除修改时间在该时长之前的文件，例如：30d",
+					},
+					cli.BoolFlag{
+						Name:  "by-mtime",
+						Usage: "确认按照文件修改时间彻底删除，使用时间条件并且没有指定 -dry 时必须指定",
+					},
+				), recycleConfirmFlags()...),
+			},
 		},
 	}
 }
 
-// RunRecycleList 执行列出回收站文件列表
-func RunRecycleList(driveId string) {
+const (
+	recycleActionRestore = "restore"
+	recycleActionPurge   = "purge"
+)
+
+// newRecycleFilter 解析过滤条件，没有指定任何条件时返回nil
+func newRecycleFilter(c *cli.Context) (*RecycleFilter, error) {
+	filter := &RecycleFilter{
+		Name: c.String("name"),
+		Path: c.String("path"),
+	}
+	isSet := filter.Name != "" || filter.Path != ""
+	if filter.Name != "" {
+		if _, err := path.Match(filter.Name, ""); err != nil {
+			return nil, usageErrorf("文件名通配符格式错误: %s", filter.Name)
+		}
+	}
+	if filter.Path != "" {
+		filter.Path = path.Clean("/" + filter.Path)
+		if _, err := path.Match(filter.Path, ""); err != nil {
+			return nil, usageErrorf("路径通配符格式错误: %s", filter.Path)
+		}
+	}
+	var err error
+	if c.IsSet("modified-after") {
+		if filter.ModifiedAfter, err = parseSearchTime(c.String("modified-after")); err != nil {
+			return nil, err
+		}
+		isSet = true
+	}
+	if c.IsSet("modified-before") {
+		if filter.ModifiedBefore, err = parseSearchTime(c.String("modified-before")); err != nil {
+			return nil, err
+		}
+		isSet = true
+	}
+	if c.IsSet("minSize") {
+		if filter.MinSize, err = converter.ParseFileSizeStr(c.String("minSize")); err != nil {
+			return nil, usageErrorf("文件大小格式错误: %s", c.String("minSize"))
+		}
+		isSet = true
+	}
+	if c.IsSet("maxSize") {
+		if filter.MaxSize, err = converter.ParseFileSizeStr(c.String("maxSize")); err != nil {
+			return nil, usageErrorf("文件大小格式错误: %s", c.String("maxSize"))
+		}
+		isSet = true
+	}
+	if !isSet {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// parseRecycleAge 解析时长，支持 d(天), h(小时), m(分钟) 以及Go的时长格式
+func parseRecycleAge(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if strings.HasSuffix(s, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && days >= 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, usageErrorf("时长格式错误: %s, 例如：30d, 12h", s)
+}
+
+// recycleModifiedTime 回收站文件的修改时间，回收站列表没有返回删除时间
+func recycleModifiedTime(file *aliyunpan.FileEntity) (time.Time, bool) {
+	t, err := time.ParseInLocation(recycleTimeFormat, file.UpdatedAt, time.Local)
+	return t, err == nil
+}
+
+// matchRecyclePath 原路径或者其任意上级目录匹配通配符
+func matchRecyclePath(pattern, originalPath string) bool {
+	if originalPath == "" {
+		return false
+	}
+	for p := originalPath; p != "/" && p != "."; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRecycleFile 检查文件是否满足过滤条件，原路径条件需要已经获取原路径
+func matchRecycleFile(file *aliyunpan.FileEntity, originalPath string, filter *RecycleFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.Name != "" {
+		if ok, _ := path.Match(strings.ToLower(filter.Name), strings.ToLower(file.FileName)); !ok {
+			return false
+		}
+	}
+	if (filter.MinSize > 0 || filter.MaxSize > 0) && file.IsFolder() {
+		return false
+	}
+	if filter.MinSize > 0 && file.FileSize < filter.MinSize {
+		return false
+	}
+	if filter.MaxSize > 0 && file.FileSize > filter.MaxSize {
+		return false
+	}
+	if !filter.ModifiedAfter.IsZero() || !filter.ModifiedBefore.IsZero() {
+		t, ok := recycleModifiedTime(file)
+		if !ok {
+			return false
+		}
+		if !filter.ModifiedAfter.IsZero() && t.Before(filter.ModifiedAfter) {
+			return false
+		}
+		if !filter.ModifiedBefore.IsZero() && !t.Before(filter.ModifiedBefore) {
+			return false
+		}
+	}
+	if filter.Path != "" && !matchRecyclePath(filter.Path, originalPath) {
+		return false
+	}
+	return true
+}
+
+// Resolve 获取文件删除前的完整路径，原目录无法访问时返回空
+func (r *recyclePathResolver) Resolve(file *aliyunpan.FileEntity) string {
+	dir, ok := r.dirs[file.ParentFileId]
+	if !ok {
+		dir = r.resolveDir(file.ParentFileId)
+		r.dirs[file.ParentFileId] = dir
+	}
+	if dir == "" {
+		return ""
+	}
+	return path.Join(dir, file.FileName)
+}
+
+func (r *recyclePathResolver) resolveDir(dirId string) string {
+	if dirId == "" || dirId == aliyunpan.DefaultRootParentFileId {
+		return "/"
+	}
+	result, err := r.client.FileGetPath(r.driveId, dirId)
+	if err != nil || result == nil || len(result.Items) == 0 {
+		logger.Verboseln("get recycle file parent path error: ", dirId, err)
+		return ""
+	}
+	// items 从当前目录到根目录排列
+	names := []string{}
+	for i := len(result.Items) - 1; i >= 0; i-- {
+		if result.Items[i].FileId == aliyunpan.DefaultRootParentFileId {
+			continue
+		}
+		names = append(names, result.Items[i].Name)
+	}
+	return "/" + path.Join(names...)
+}
+
+// listRecycleFiles 获取回收站中符合条件的文件，按照修改时间从新到旧排序
+func listRecycleFiles(driveId string, filter *RecycleFilter) ([]*RecycleFileOutput, error) {
 	panClient := GetActivePanClient()
 	fdl, err := panClient.WebapiPanClient().RecycleBinFileListGetAll(&aliyunpan_web.RecycleBinFileListParam{
 		DriveId: driveId,
 		Limit:   100,
 	})
 	if err != nil {
-		fmt.Println(err)
-		return
+		return nil, apiOutputError(err, "")
+	}
+	resolver := &recyclePathResolver{
+		client:  panClient.WebapiPanClient(),
+		driveId: driveId,
+		dirs:    map[string]string{},
+	}
+	// 先使用不需要原路径的条件过滤，减少获取原路径的请求
+	basicFilter := &RecycleFilter{}
+	if filter != nil {
+		*basicFilter = *filter
+		basicFilter.Path = ""
+	}
+	files := []*RecycleFileOutput{}
+	for _, file := range fdl {
+		if !matchRecycleFile(file, "", basicFilter) {
+			continue
+		}
+		originalPath := resolver.Resolve(file)
+		if !matchRecycleFile(file, originalPath, filter) {
+			continue
+		}
+		files = append(files, &RecycleFileOutput{
+			OriginalPath: originalPath,
+			FileOutput:   *newFileOutput(file, ""),
+		})
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].UpdatedAt > files[j].UpdatedAt
+	})
+	return files, nil
+}
+
+// RunRecycleList 执行列出回收站文件列表，page 从1开始
+func RunRecycleList(driveId string, filter *RecycleFilter, page, limit int) error {
+	files, err := listRecycleFiles(driveId, filter)
+	if err != nil {
+		return err
+	}
+	total := len(files)
+	start, end := (page-1)*limit, page*limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	files = files[start:end]
+	if IsMachineOutput() {
+		return writeOutput(files)
 	}
 
 	tb := cmdtable.NewTable(os.Stdout)
-	tb.SetHeader([]string{"#", "file_id", "文件/目录名", "文件大小", "创建日期", "修改日期"})
-	tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
-	for k, file := range fdl {
-		fn := file.FileName
-		fs := converter.ConvertFileSize(file.FileSize, 2)
-		if file.IsFolder() {
+	tb.SetHeader([]string{"#", "file_id", "文件/目录名", "原路径", "文件大小", "修改日期"})
+	tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT})
+	for k, file := range files {
+		fn := file.Name
+		fs := converter.ConvertFileSize(file.Size, 2)
+		if file.Type == "folder" {
 			fn = fn + "/"
 			fs = "-"
 		}
-		tb.Append([]string{strconv.Itoa(k + 1), file.FileId, fn, fs, file.CreatedAt, file.UpdatedAt})
+		tb.Append([]string{strconv.Itoa(start + k + 1), file.FileId, fn, file.OriginalPath, fs, file.UpdatedAt})
 	}
-
 	tb.Render()
+	pages := (total + limit - 1) / limit
+	if pages == 0 {
+		pages = 1
+	}
+	fmt.Printf("第 %d/%d 页, 共 %d 个文件\n", page, pages, total)
+	return nil
+}
+
+// RunRecycleBatch 按照过滤条件批量还原或者彻底删除回收站文件
+func RunRecycleBatch(driveId string, filter *RecycleFilter, action string, dryRun, skipConfirm bool) error {
+	files, err := listRecycleFiles(driveId, filter)
+	if err != nil {
+		return err
+	}
+	actionName, doneStatus := "还原", "restored"
+	if action == recycleActionPurge {
+		actionName, doneStatus = "彻底删除", "purged"
+	}
+	results := []*RecycleResultOutput{}
+	if len(files) == 0 {
+		if IsMachineOutput() {
+			return writeOutput(results)
+		}
+		fmt.Printf("回收站中没有符合条件的文件\n")
+		return nil
+	}
+
+	if !IsMachineOutput() {
+		fmt.Printf("以下文件将会被%s\n\n", actionName)
+		tb := cmdtable.NewTable(os.Stdout)
+		tb.SetHeader([]string{"#", "file_id", "原路径", "修改日期"})
+		for k, file := range files {
+			p := file.OriginalPath
+			if p == "" {
+				p = file.Name
+			}
+			tb.Append([]string{strconv.Itoa(k + 1), file.FileId, p, file.UpdatedAt})
+		}
+		tb.Render()
+		fmt.Printf("\n共 %d 个文件\n", len(files))
+	}
+	if dryRun {
+		if IsMachineOutput() {
+			for _, file := range files {
+				results = append(results, &RecycleResultOutput{Status: "planned", RecycleFileOutput: *file})
+			}
+			return writeOutput(results)
+		}
+		return nil
+	}
+	if !skipConfirm {
+		if action == recycleActionPurge {
+			fmt.Printf("彻底删除的文件无法找回，是否继续(y/n): ")
+		} else {
+			fmt.Printf("是否还原以上文件(y/n): ")
+		}
+		confirm := ""
+		_, err := fmt.Scanln(&confirm)
+		if err != nil || (confirm != "y" && confirm != "Y") {
+			fmt.Println("用户取消了操作")
+			return nil
+		}
+	}
+
+	webClient := GetActivePanClient().WebapiPanClient()
+	done, failed := 0, 0
+	for start := 0; start < len(files); start += recycleBatchSize {
+		end := start + recycleBatchSize
+		if end > len(files) {
+			end = len(files)
+		}
+		batch := files[start:end]
+		param := []*aliyunpan.FileBatchActionParam{}
+		for _, file := range batch {
+			param = append(param, &aliyunpan.FileBatchActionParam{
+				DriveId: file.DriveId,
+				FileId:  file.FileId,
+			})
+		}
+		var (
+			r      []*aliyunpan.FileBatchActionResult
+			apierr *apierror.ApiError
+		)
+		if action == recycleActionPurge {
+			r, apierr = webClient.RecycleBinFileDelete(param)
+		} else {
+			r, apierr = webClient.RecycleBinFileRestore(param)
+		}
+		succeed := map[string]bool{}
+		for _, item := range r {
+			if item != nil && item.Success {
+				succeed[item.FileId] = true
+			}
+		}
+		for _, file := range batch {
+			if succeed[file.FileId] {
+				done++
+				results = append(results, &RecycleResultOutput{Status: doneStatus, RecycleFileOutput: *file})
+				continue
+			}
+			reason := actionName + "失败"
+			if apierr != nil {
+				reason = apierr.Error()
+			}
+			failed++
+			results = append(results, &RecycleResultOutput{Status: "failed", Reason: reason, RecycleFileOutput: *file})
+		}
+	}
+
+	if IsMachineOutput() {
+		if e := writeOutput(results); e != nil {
+			return e
+		}
+	} else {
+		for _, r := range results {
+			if r.Status == "failed" {
+				fmt.Printf("%s失败 %s: %s\n", actionName, r.FileId, r.Reason)
+			}
+		}
+		fmt.Printf("%s完成, 成功 %d 个, 失败 %d 个\n", actionName, done, failed)
+	}
+	if failed > 0 {
+		if done > 0 {
+			return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分文件%s失败", actionName)
+		}
+		return errorf("%s文件失败", actionName)
+	}
+	return nil
 }
 
 // RunRecycleRestore 执行还原回收站文件或目录
-func RunRecycleRestore(driveId string, fidStrList ...string) {
+func RunRecycleRestore(driveId string, fidStrList ...string) error {
 	panClient := GetActivePanClient()
 	restoreFileList := []*aliyunpan.FileBatchActionParam{}
 
@@ -196,24 +732,22 @@ func RunRecycleRestore(driveId string, fidStrList ...string) {
 	}
 
 	if len(restoreFileList) == 0 {
-		fmt.Printf("没有需要还原的文件")
-		return
+		return usageErrorf("没有需要还原的文件")
 	}
 
 	rbfr, err := panClient.WebapiPanClient().RecycleBinFileRestore(restoreFileList)
 	if rbfr != nil && len(rbfr) > 0 {
 		fmt.Printf("还原文件成功\n")
-		return
+		return nil
 	}
-
-	if len(rbfr) == 0 && err != nil {
-		fmt.Printf("还原文件失败：%s\n", err)
-		return
+	if err != nil {
+		return apiOutputError(err, "还原文件失败：")
 	}
+	return errorf("还原文件失败")
 }
 
 // RunRecycleDelete 执行删除回收站文件或目录
-func RunRecycleDelete(driveId string, fidStrList ...string) {
+func RunRecycleDelete(driveId string, fidStrList ...string) error {
 	panClient := GetActivePanClient()
 	deleteFileList := []*aliyunpan.FileBatchActionParam{}
 
@@ -225,24 +759,22 @@ func RunRecycleDelete(driveId string, fidStrList ...string) {
 	}
 
 	if len(deleteFileList) == 0 {
-		fmt.Printf("没有需要删除的文件")
-		return
+		return usageErrorf("没有需要删除的文件")
 	}
 
 	rbfr, err := panClient.WebapiPanClient().RecycleBinFileDelete(deleteFileList)
 	if rbfr != nil && len(rbfr) > 0 {
 		fmt.Printf("彻底删除文件成功\n")
-		return
+		return nil
 	}
-
-	if len(rbfr) == 0 && err != nil {
-		fmt.Printf("彻底删除文件失败：%s\n", err)
-		return
+	if err != nil {
+		return apiOutputError(err, "彻底删除文件失败：")
 	}
+	return errorf("彻底删除文件失败")
 }
 
 // RunRecycleClear 清空回收站
-func RunRecycleClear(driveId string) {
+func RunRecycleClear(driveId string) error {
 	panClient := GetActivePanClient()
 
 	// 提交清空回收站异步任务
@@ -251,7 +783,7 @@ func RunRecycleClear(driveId string) {
 	})
 	if err != nil {
 		logger.Verboseln(err)
-		fmt.Printf("当前无法清空回收站，请稍后重试\n")
+		return apiOutputError(err, "当前无法清空回收站，请稍后重试: ")
 	}
 
 	for i := 0; i < 10; i++ {
@@ -265,10 +797,10 @@ func RunRecycleClear(driveId string) {
 		}
 		if ar.Status == "Succeed" {
 			fmt.Printf("清空回收站成功\n")
-			return
+			return nil
 		} else {
 			time.Sleep(1 * time.Second)
 		}
 	}
-	fmt.Printf("清空回收站失败，请稍后重试\n")
+	return errorf("清空回收站失败，请稍后重试")
 }
@@ -0,0 +1,66 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestParseRecycleAge(t *testing.T) {
+	cases := map[string]time.Duration{
+		"30d":  30 * 24 * time.Hour,
+		"12h":  12 * time.Hour,
+		"90m":  90 * time.Minute,
+		" 1D ": 24 * time.Hour,
+	}
+	for s, expect := range cases {
+		if d, err := parseRecycleAge(s); err != nil || d != expect {
+			t.Errorf("parse %q: %v, %v", s, d, err)
+		}
+	}
+	for _, s := range []string{"", "abc", "-1d", "d"} {
+		if _, err := parseRecycleAge(s); err == nil {
+			t.Errorf("parse %q should fail", s)
+		}
+	}
+}
+
+func TestMatchRecycleFile(t *testing.T) {
+	after, _ := parseSearchTime("2024-05-01")
+	before, _ := parseSearchTime("2024-06-01")
+	file := &aliyunpan.FileEntity{
+		FileName:  "IMG_0001.JPG",
+		FileType:  "file",
+		FileSize:  1500,
+		UpdatedAt: "2024-05-10 10:00:00",
+	}
+	folder := &aliyunpan.FileEntity{FileName: "2023", FileType: "folder", UpdatedAt: "2024-05-10 10:00:00"}
+	originalPath := "/照片/2023/IMG_0001.JPG"
+
+	cases := []struct {
+		filter *RecycleFilter
+		file   *aliyunpan.FileEntity
+		path   string
+		expect bool
+	}{
+		{nil, file, "", true},
+		{&RecycleFilter{Name: "img_*.jpg"}, file, originalPath, true},
+		{&RecycleFilter{Name: "*.png"}, file, originalPath, false},
+		{&RecycleFilter{ModifiedAfter: after, ModifiedBefore: before}, file, originalPath, true},
+		{&RecycleFilter{ModifiedBefore: after}, file, originalPath, false},
+		{&RecycleFilter{MinSize: 1000, MaxSize: 2000}, file, originalPath, true},
+		{&RecycleFilter{MinSize: 2000}, file, originalPath, false},
+		{&RecycleFilter{MinSize: 1}, folder, "/照片/2023", false},
+		{&RecycleFilter{Path: "/照片"}, file, originalPath, true},
+		{&RecycleFilter{Path: "/照片/202*"}, file, originalPath, true},
+		{&RecycleFilter{Path: "/照片/2023/*.JPG"}, file, originalPath, true},
+		{&RecycleFilter{Path: "/文档"}, file, originalPath, false},
+		{&RecycleFilter{Path: "/照片"}, file, "", false},
+	}
+	for i, c := range cases {
+		if r := matchRecycleFile(c.file, c.path, c.filter); r != c.expect {
+			t.Errorf("case %d: expect %v, got %v", i, c.expect, r)
+		}
+	}
+}
@@ -89,16 +89,13 @@ func CmdRename() cli.Command {
 				return nil
 			}
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
 			if c.NArg() == 2 {
-				RunRename(parseDriveId(c), c.Args().Get(0), c.Args().Get(1))
-			} else if c.NArg() == 3 {
-				// 批量重命名
-				RunRenameBatch(c.Bool("y"), parseDriveId(c), c.Args().Get(0), c.Args().Get(1), c.Args().Get(2))
+				return reportError(RunRename(parseDriveId(c), c.Args().Get(0), c.Args().Get(1)))
 			}
-			return nil
+			// 批量重命名
+			return reportError(RunRenameBatch(c.Bool("y"), parseDriveId(c), c.Args().Get(0), c.Args().Get(1), c.Args().Get(2)))
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -114,82 +111,69 @@ func CmdRename() cli.Command {
 	}
 }
 
-func RunRename(driveId string, oldName string, newName string) {
+func RunRename(driveId string, oldName string, newName string) error {
 	if oldName == "" {
-		fmt.Println("请指定命名文件")
-		return
+		return usageErrorf("请指定命名文件")
 	}
 	if newName == "" {
-		fmt.Println("请指定文件新名称")
-		return
+		return usageErrorf("请指定文件新名称")
 	}
 	activeUser := GetActiveUser()
 	oldName = activeUser.PathJoin(driveId, strings.TrimSpace(oldName))
 	newName = activeUser.PathJoin(driveId, strings.TrimSpace(newName))
 	if path.Dir(oldName) != path.Dir(newName) {
-		fmt.Println("只能命名同一个目录的文件")
-		return
+		return usageErrorf("只能命名同一个目录的文件")
 	}
 	if !apiutil.CheckFileNameValid(path.Base(newName)) {
-		fmt.Println("文件名不能包含特殊字符：" + apiutil.FileNameSpecialChars)
-		return
+		return usageErrorf("文件名不能包含特殊字符：%s", apiutil.FileNameSpecialChars)
 	}
 
 	fileId := ""
 	r, err := GetActivePanClient().OpenapiPanClient().FileInfoByPath(driveId, activeUser.PathJoin(driveId, oldName))
 	if err != nil {
-		fmt.Printf("原文件不存在： %s, %s\n", oldName, err)
-		return
+		return apiOutputError(err, fmt.Sprintf("原文件不存在： %s, ", oldName))
 	}
 	fileId = r.FileId
 
 	b, e := activeUser.PanClient().OpenapiPanClient().FileRename(driveId, fileId, path.Base(newName))
 	if e != nil {
-		fmt.Println(e.Err)
-		return
+		return apiOutputError(e, "")
 	}
 	if !b {
-		fmt.Println("重命名文件失败")
-		return
+		return errorf("重命名文件失败")
 	}
 	fmt.Printf("重命名文件成功：%s -> %s\n", path.Base(oldName), path.Base(newName))
 	activeUser.DeleteOneCache(path.Dir(newName))
+	return nil
 }
 
 // RunRenameBatch 批量重命名文件
-func RunRenameBatch(skipConfirm bool, driveId string, expression, replacement, filePattern string) {
+func RunRenameBatch(skipConfirm bool, driveId string, expression, replacement, filePattern string) error {
 	if len(expression) == 0 {
-		fmt.Println("旧文件名不能为空")
-		return
+		return usageErrorf("旧文件名不能为空")
 	}
 	if !apiutil.CheckFileNameValid(replacement) {
-		fmt.Println("新文件名不能包含特殊字符：" + apiutil.FileNameSpecialChars)
-		return
+		return usageErrorf("新文件名不能包含特殊字符：%s", apiutil.FileNameSpecialChars)
 	}
 
 	if len(filePattern) == 0 {
-		fmt.Println("文件匹配模式不能为空")
-		return
+		return usageErrorf("文件匹配模式不能为空")
 	}
 	if strings.ContainsAny(filePattern, "/") {
-		fmt.Println("文件匹配模式不能包含路径分隔符")
-		return
+		return usageErrorf("文件匹配模式不能包含路径分隔符")
 	}
 	if strings.ContainsAny(filePattern, "\\") {
-		fmt.Println("文件匹配模式不能包含路径分隔符")
-		return
+		return usageErrorf("文件匹配模式不能包含路径分隔符")
 	}
 
 	activeUser := GetActiveUser()
 	absolutePath := path.Clean(activeUser.PathJoin(driveId, filePattern))
 	fileList, err1 := matchPathByShellPattern(driveId, absolutePath)
 	if err1 != nil {
-		fmt.Println("查询文件出错：" + err1.Error())
-		return
+		return apiOutputError(err1, "查询文件出错：")
 	}
 	if fileList == nil || len(fileList) == 0 {
-		fmt.Println("没有找到符合的文件")
-		return
+		return notFoundErrorf("没有找到符合的文件")
 	}
 
 	// 文件列表按照名字排序
@@ -228,24 +212,30 @@ func RunRenameBatch(skipConfirm bool, driveId string, expression, replacement, f
 		_, err := fmt.Scanln(&confirm)
 		if err != nil || (confirm != "y" && confirm != "Y") {
 			fmt.Println("用户取消了操作")
-			return
+			return nil
 		}
 	}
 
 	// 重命名
-	for _, file := range files {
+	for idx, file := range files {
 		b, e := activeUser.PanClient().OpenapiPanClient().FileRename(driveId, file.file.FileId, file.newFileName)
+		var err error
 		if e != nil {
-			fmt.Println(e.Err)
-			return
+			err = apiOutputError(e, "")
+		} else if !b {
+			err = errorf("重命名文件失败")
 		}
-		if !b {
-			fmt.Println("重命名文件失败")
-			return
+		if err != nil {
+			if idx > 0 {
+				// 已经有文件重命名成功
+				return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分文件重命名失败：%s -> %s, %s", file.file.FileName, file.newFileName, err)
+			}
+			return err
 		}
 		fmt.Printf("重命名文件成功：%s -> %s\n", file.file.FileName, file.newFileName)
 		activeUser.DeleteOneCache(path.Dir(file.file.Path))
 	}
+	return nil
 }
 
 // replaceNumStr 将#替换成数字编号
@@ -58,11 +58,9 @@ func CmdRm() cli.Command {
 				return nil
 			}
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
-			RunRemove(parseDriveId(c), c.Args()...)
-			return nil
+			return reportError(RunRemove(parseDriveId(c), c.Args()...))
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -90,7 +88,7 @@ func queryFileListByPath(activeUser *config.PanUser, driveId, filePathPattern st
 }
 
 // RunRemove 执行 批量删除文件/目录
-func RunRemove(driveId string, paths ...string) {
+func RunRemove(driveId string, paths ...string) error {
 	activeUser := GetActiveUser()
 	pluginManger := plugins.NewPluginManager(config.GetPluginDir())
 	plugin, _ := pluginManger.GetPlugin()
@@ -114,46 +112,11 @@ func RunRemove(driveId string, paths ...string) {
 			continue
 		}
 		// 调用插件
-		approvedToRemoveFiles := []*aliyunpan.FileEntity{}
-		pluginParam := &plugins.RemoveFilePrepareParams{
-			Count: len(fileList),
-			Items: make([]*plugins.RemoveFilePrepareItem, 0),
-		}
+		approvedToRemoveFiles := approveRemoveFiles(plugin, fileList)
 		for _, f := range fileList {
-			pluginParam.Items = append(pluginParam.Items, &plugins.RemoveFilePrepareItem{
-				DriveId:            f.DriveId,
-				DriveFileId:        f.FileId,
-				DriveFileName:      f.FileName,
-				DriveFilePath:      f.Path,
-				DriveFileSize:      f.FileSize,
-				DriveFileType:      f.FileType,
-				DriveFileUpdatedAt: f.UpdatedAt,
-				DriveFileCreatedAt: f.CreatedAt,
-			})
-		}
-		if removeFilePrepareResult, er := plugin.RemoveFilePrepareCallback(plugins.GetContext(config.Config.ActiveUser()), pluginParam); er == nil && removeFilePrepareResult != nil {
-			for _, f := range fileList {
-				matchResult := false
-				for _, r := range removeFilePrepareResult.Result {
-					if strings.Compare(f.FileId, r.DriveFileId) == 0 {
-						matchResult = true
-						if strings.Compare("yes", r.RemoveApproved) != 0 {
-							// skip this file
-							fmt.Printf("插件不允许删除该文件: %s\n", f.Path)
-						} else {
-							approvedToRemoveFiles = append(approvedToRemoveFiles, f)
-						}
-						break
-					}
-				}
-				if !matchResult {
-					// 该文件没有确认结果，则默认删除
-					approvedToRemoveFiles = append(approvedToRemoveFiles, f)
-				}
+			if findFileById(approvedToRemoveFiles, f.FileId) == nil {
+				fmt.Printf("插件不允许删除该文件: %s\n", f.Path)
 			}
-		} else {
-			// 默认删除全部文件
-			approvedToRemoveFiles = fileList
 		}
 
 		for _, f := range approvedToRemoveFiles {
@@ -191,7 +154,57 @@ func RunRemove(driveId string, paths ...string) {
 		fmt.Println("操作成功, 以下文件/目录已删除, 可在云盘文件回收站找回: ")
 		pnt()
 		activeUser.DeleteCache(cacheCleanDirs)
+	} else if len(failedRmPaths) > 0 {
+		return errorf("本次操作没有删除任何文件")
 	} else {
 		fmt.Println("本次操作没有删除任何文件")
 	}
+	if len(failedRmPaths) > 0 {
+		return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分文件删除失败")
+	}
+	return nil
+}
+
+// approveRemoveFiles 调用插件的 RemoveFilePrepareCallback 确认文件是否可以删除，返回允许删除的文件。
+// 不输出任何信息，由调用方决定如何展示被插件拒绝的文件
+func approveRemoveFiles(plugin plugins.Plugin, fileList []*aliyunpan.FileEntity) []*aliyunpan.FileEntity {
+	approvedToRemoveFiles := []*aliyunpan.FileEntity{}
+	pluginParam := &plugins.RemoveFilePrepareParams{
+		Count: len(fileList),
+		Items: make([]*plugins.RemoveFilePrepareItem, 0),
+	}
+	for _, f := range fileList {
+		pluginParam.Items = append(pluginParam.Items, &plugins.RemoveFilePrepareItem{
+			DriveId:            f.DriveId,
+			DriveFileId:        f.FileId,
+			DriveFileName:      f.FileName,
+			DriveFilePath:      f.Path,
+			DriveFileSize:      f.FileSize,
+			DriveFileType:      f.FileType,
+			DriveFileUpdatedAt: f.UpdatedAt,
+			DriveFileCreatedAt: f.CreatedAt,
+		})
+	}
+	if removeFilePrepareResult, er := plugin.RemoveFilePrepareCallback(plugins.GetContext(config.Config.ActiveUser()), pluginParam); er == nil && removeFilePrepareResult != nil {
+		for _, f := range fileList {
+			matchResult := false
+			for _, r := range removeFilePrepareResult.Result {
+				if strings.Compare(f.FileId, r.DriveFileId) == 0 {
+					matchResult = true
+					if strings.Compare("yes", r.RemoveApproved) == 0 {
+						approvedToRemoveFiles = append(approvedToRemoveFiles, f)
+					}
+					break
+				}
+			}
+			if !matchResult {
+				// 该文件没有确认结果，则默认删除
+				approvedToRemoveFiles = append(approvedToRemoveFiles, f)
+			}
+		}
+	} else {
+		// 默认删除全部文件
+		approvedToRemoveFiles = fileList
+	}
+	return approvedToRemoveFiles
 }
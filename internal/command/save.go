@@ -50,12 +50,10 @@ func CmdSave() cli.Command {
 				return nil
 			}
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
 			if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-				fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-				return nil
+				return reportError(webNotLoggedInError())
 			}
 			RunSave(parseDriveId(c), c.Args()...)
 			return nil
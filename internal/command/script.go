@@ -0,0 +1,538 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdliner/args"
+	"github.com/urfave/cli"
+)
+
+const (
+	// maxScriptDepth 脚本嵌套执行的最大层数
+	maxScriptDepth = 16
+)
+
+type (
+	// scriptStatement 脚本语句，for 循环语句包含循环体
+	scriptStatement struct {
+		lineNo int
+		line   string
+
+		// loopVar 循环变量，不为空表示 for 循环语句
+		loopVar string
+		// loopSource 循环的列表，可以是命令或者以空格分隔的列表
+		loopSource string
+		body       []*scriptStatement
+	}
+
+	// scriptRunner 脚本执行器
+	scriptRunner struct {
+		app  *cli.App
+		vars map[string]string
+		// stopOnError 命令执行失败时停止执行脚本，即 set -e
+		stopOnError bool
+		// outputFormat 脚本命令默认的输出格式，和执行脚本时指定的输出格式一致
+		outputFormat string
+	}
+)
+
+var (
+	// scriptDepth 当前脚本嵌套执行的层数，大于0表示正在执行脚本
+	scriptDepth = 0
+
+	scriptForPattern     = regexp.MustCompile(`^for\s+(\S+)\s+in\s+(.*)$`)
+	scriptAssignPattern  = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+	scriptVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+func CmdRunScript() cli.Command {
+	return cli.Command{
+		Name:      "run-script",
+		Aliases:   []string{"source"},
+		Usage:     "批量执行脚本文件中的命令",
+		UsageText: cmder.App().Name + " run-script <脚本文件> [参数...]",
+		Description: `
+	按顺序执行脚本文件中的命令，每行一条命令，命令和交互模式下输入的一致。
+
+	脚本语法:
+	# 开头的行为注释
+	NAME=value            设置变量，使用 $NAME 或者 ${NAME} 引用变量，$1 $2 ... 为脚本参数，$? 为上一条命令的退出码，单引号内的 $ 不替换
+	set -e                命令执行失败(退出码不为0)时停止执行脚本，set +e 取消
+	echo 文本             输出文本
+	for NAME in 列表       循环执行到 done 之间的命令，列表可以是以空格分隔的值，也可以是命令，例如 ls /photos，此时循环命令输出的文件路径
+	done
+	命令1 | 命令2          管道，命令1输出的文件路径作为命令2的参数，替换命令2中的 - 参数，没有 - 参数则追加到最后
+
+	示例:
+
+	执行脚本，参数 /photos 在脚本中使用 $1 引用
+	aliyunpan run-script backup.ap /photos
+
+	交互模式下执行脚本
+	source backup.ap
+
+	脚本内容:
+	# 下载相册目录
+	set -e
+	SAVE=/home/tickstep/photos
+	ls --output jsonl $1 | download -saveto $SAVE -
+	for f in ls /文档
+	    echo 正在下载 $f
+	    download -saveto $SAVE "$f"
+	done
+`,
+		Category:        "其他",
+		SkipFlagParsing: true,
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			return RunScript(c.App, c.Args().First(), c.Args().Tail())
+		},
+	}
+}
+
+// RunScript 执行脚本文件
+func RunScript(app *cli.App, scriptFile string, scriptArgs []string) error {
+	if scriptDepth >= maxScriptDepth {
+		return reportError(usageErrorf("脚本嵌套执行层数超过 %d", maxScriptDepth))
+	}
+	data, err := os.ReadFile(scriptFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return reportError(notFoundErrorf("脚本文件不存在: %s", scriptFile))
+		}
+		return reportError(errorf("读取脚本文件失败: %s", err))
+	}
+	statements, err := parseScript(string(data))
+	if err != nil {
+		return reportError(usageErrorf("脚本语法错误: %s", err))
+	}
+
+	runner := newScriptRunner(app)
+	runner.vars["0"] = scriptFile
+	runner.vars["#"] = strconv.Itoa(len(scriptArgs))
+	runner.vars["@"] = strings.Join(scriptArgs, " ")
+	for k, a := range scriptArgs {
+		runner.vars[strconv.Itoa(k+1)] = a
+	}
+
+	scriptDepth++
+	code, _ := runner.run(statements)
+	scriptDepth--
+	// 子命令会修改输出格式，恢复为执行脚本时的格式
+	outputFormat = runner.outputFormat
+	return exitError(code)
+}
+
+// IsPipeline 命令行是否包含管道
+func IsPipeline(line string) bool {
+	return len(splitPipeline(line)) > 1
+}
+
+// RunPipeline 交互模式下执行管道命令
+func RunPipeline(app *cli.App, line string) {
+	runner := newScriptRunner(app)
+	scriptDepth++
+	runner.runStatement(&scriptStatement{lineNo: 1, line: line})
+	scriptDepth--
+	outputFormat = runner.outputFormat
+}
+
+func newScriptRunner(app *cli.App) *scriptRunner {
+	return &scriptRunner{
+		app:          app,
+		vars:         map[string]string{},
+		outputFormat: outputFormat,
+	}
+}
+
+// parseScript 解析脚本内容
+func parseScript(content string) ([]*scriptStatement, error) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	statements, _, err := parseScriptBlock(lines, 0, 0)
+	return statements, err
+}
+
+// parseScriptBlock 解析语句块，loopLineNo 不为0表示解析的是 for 循环的循环体，返回值为语句列表和语句块结束的行
+func parseScriptBlock(lines []string, start, loopLineNo int) ([]*scriptStatement, int, error) {
+	statements := []*scriptStatement{}
+	for i := start; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lineNo := i + 1
+		switch strings.Fields(line)[0] {
+		case "done":
+			if loopLineNo == 0 {
+				return nil, i, fmt.Errorf("第%d行: done 没有对应的 for", lineNo)
+			}
+			return statements, i, nil
+		case "for":
+			m := scriptForPattern.FindStringSubmatch(line)
+			if m == nil || !scriptVarNamePattern.MatchString(m[1]) {
+				return nil, i, fmt.Errorf("第%d行: for 语法错误，格式为: for 变量名 in 列表", lineNo)
+			}
+			body, end, err := parseScriptBlock(lines, i+1, lineNo)
+			if err != nil {
+				return nil, end, err
+			}
+			statements = append(statements, &scriptStatement{
+				lineNo:     lineNo,
+				line:       line,
+				loopVar:    m[1],
+				loopSource: strings.TrimSpace(m[2]),
+				body:       body,
+			})
+			i = end
+		default:
+			statements = append(statements, &scriptStatement{lineNo: lineNo, line: line})
+		}
+	}
+	if loopLineNo != 0 {
+		return nil, len(lines), fmt.Errorf("第%d行: for 缺少对应的 done", loopLineNo)
+	}
+	return statements, len(lines), nil
+}
+
+// run 执行语句列表，返回最后一条命令的退出码，以及是否因为 set -e 停止执行
+func (r *scriptRunner) run(statements []*scriptStatement) (int, bool) {
+	code := ExitCodeSuccess
+	for _, st := range statements {
+		if st.loopVar != "" {
+			var stopped bool
+			if code, stopped = r.runLoop(st); stopped {
+				return code, true
+			}
+		} else {
+			code = r.runStatement(st)
+		}
+		r.vars["?"] = strconv.Itoa(code)
+		if code != ExitCodeSuccess && r.stopOnError {
+			fmt.Printf("脚本第%d行执行失败，退出码: %d，停止执行脚本\n", st.lineNo, code)
+			return code, true
+		}
+	}
+	return code, false
+}
+
+func (r *scriptRunner) runLoop(st *scriptStatement) (int, bool) {
+	items := r.parseArgs(st.loopSource)
+	if len(items) > 0 && findCommand(r.app.Commands, items[0]) != nil {
+		// 循环命令输出的文件
+		code, out := r.runCommand(items, true)
+		if code != ExitCodeSuccess {
+			return code, false
+		}
+		items = parsePipeInput(out)
+	}
+	code := ExitCodeSuccess
+	for _, item := range items {
+		r.vars[st.loopVar] = item
+		var stopped bool
+		if code, stopped = r.run(st.body); stopped {
+			return code, true
+		}
+	}
+	return code, false
+}
+
+func (r *scriptRunner) runStatement(st *scriptStatement) int {
+	// 变量赋值
+	if m := scriptAssignPattern.FindStringSubmatch(st.line); m != nil {
+		r.vars[m[1]] = strings.Join(r.parseArgs(m[2]), " ")
+		return ExitCodeSuccess
+	}
+
+	// 管道
+	var (
+		input []string
+		piped bool
+	)
+	stages := splitPipeline(st.line)
+	for k, stage := range stages {
+		cmdArgs := r.parseArgs(stage)
+		if len(cmdArgs) == 0 {
+			fmt.Printf("脚本第%d行: 管道命令为空\n", st.lineNo)
+			return ExitCodeUsage
+		}
+		if piped {
+			if len(input) == 0 {
+				// 没有输入则不执行后续命令
+				return ExitCodeSuccess
+			}
+			cmdArgs = replacePipeInput(cmdArgs, input)
+		}
+		capture := k < len(stages)-1
+		code, out := r.runCommand(cmdArgs, capture)
+		if code != ExitCodeSuccess {
+			return code
+		}
+		if capture {
+			input = parsePipeInput(out)
+			piped = true
+		}
+	}
+	return ExitCodeSuccess
+}
+
+// runCommand 执行一条命令，capture 为 true 则以 jsonl 格式（未指定输出格式时）获取命令的输出
+func (r *scriptRunner) runCommand(cmdArgs []string, capture bool) (int, string) {
+	buf := &bytes.Buffer{}
+	var w io.Writer = os.Stdout
+	if capture {
+		w = buf
+	}
+
+	// 内置命令
+	switch cmdArgs[0] {
+	case "set":
+		for _, a := range cmdArgs[1:] {
+			switch a {
+			case "-e":
+				r.stopOnError = true
+			case "+e":
+				r.stopOnError = false
+			default:
+				fmt.Printf("不支持的选项: set %s\n", a)
+				return ExitCodeUsage, ""
+			}
+		}
+		return ExitCodeSuccess, ""
+	case "echo":
+		fmt.Fprintln(w, strings.Join(cmdArgs[1:], " "))
+		return ExitCodeSuccess, buf.String()
+	}
+
+	cmdArgs, format := extractOutputFlag(cmdArgs)
+	if format == "" {
+		format = r.outputFormat
+		if capture {
+			format = OutputFormatJsonl
+		}
+	}
+	if findCommand(r.app.Commands, cmdArgs[0]) == nil {
+		fmt.Printf("未找到命令: %s\n", cmdArgs[0])
+		return ExitCodeUsage, ""
+	}
+
+	if capture {
+		oldWriter := outputWriter
+		outputWriter = buf
+		defer func() {
+			outputWriter = oldWriter
+		}()
+	}
+	s := append([]string{os.Args[0], "--output", format}, cmdArgs...)
+	lastExitCode = ExitCodeSuccess
+	err := r.app.Run(s)
+	code := lastExitCode
+	if err != nil && code == ExitCodeSuccess {
+		code = ExitCodeError
+	}
+	return code, buf.String()
+}
+
+// parseArgs 替换变量并解析命令行参数，单引号内的变量不替换
+func (r *scriptRunner) parseArgs(line string) []string {
+	return args.Parse(expandScriptVars(line, func(name string) string {
+		if v, ok := r.vars[name]; ok {
+			return v
+		}
+		return os.Getenv(name)
+	}))
+}
+
+// expandScriptVars 替换引号外和双引号内的变量，单引号内的内容原样保留。
+// 变量值中的空格、引号和反斜杠会被转义，解析参数时作为普通字符，不会拆分成多个参数
+func expandScriptVars(line string, mapping func(name string) string) string {
+	var (
+		rl        = []rune(line)
+		out       = strings.Builder{}
+		seg       = strings.Builder{} // 需要替换变量的片段
+		quoteChar rune
+	)
+	flush := func() {
+		out.WriteString(os.Expand(seg.String(), func(name string) string {
+			return escapeScriptArg(mapping(name))
+		}))
+		seg.Reset()
+	}
+	write := func(runes ...rune) {
+		for _, c := range runes {
+			if quoteChar == args.CharSingleQuote {
+				out.WriteRune(c)
+			} else {
+				seg.WriteRune(c)
+			}
+		}
+	}
+	for k := 0; k < len(rl); k++ {
+		c := rl[k]
+		switch {
+		case c == args.CharEscape && k+1 < len(rl) && isScriptEscapable(rl[k+1]):
+			write(c, rl[k+1])
+			k++
+			continue
+		case args.IsQuote(c) && quoteChar == 0:
+			if c == args.CharSingleQuote {
+				flush()
+			}
+			quoteChar = c
+		case c == quoteChar:
+			write(c)
+			quoteChar = 0
+			continue
+		}
+		write(c)
+	}
+	flush()
+	return out.String()
+}
+
+// escapeScriptArg 转义 args.Parse 会特殊处理的字符
+func escapeScriptArg(s string) string {
+	b := strings.Builder{}
+	for _, c := range s {
+		if isScriptEscapable(c) {
+			b.WriteRune(args.CharEscape)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// isScriptEscapable 和 args.Parse 一致，只有空格、引号和反斜杠可以被转义
+func isScriptEscapable(c rune) bool {
+	return unicode.IsSpace(c) || args.IsQuote(c) || c == args.CharEscape
+}
+
+// splitPipeline 按照引号外的 | 拆分管道命令
+func splitPipeline(line string) []string {
+	var (
+		stages    []string
+		buf       = strings.Builder{}
+		quoteChar rune
+		escaped   bool
+	)
+	for _, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case c == args.CharEscape:
+			escaped = true
+		case args.IsQuote(c):
+			if quoteChar == 0 {
+				quoteChar = c
+			} else if quoteChar == c {
+				quoteChar = 0
+			}
+		case c == '|' && quoteChar == 0:
+			stages = append(stages, strings.TrimSpace(buf.String()))
+			buf.Reset()
+			continue
+		}
+		buf.WriteRune(c)
+	}
+	return append(stages, strings.TrimSpace(buf.String()))
+}
+
+// extractOutputFlag 提取命令中的 --output 选项，该选项是全局选项，需要放到命令名称之前
+func extractOutputFlag(cmdArgs []string) ([]string, string) {
+	var (
+		r      = []string{cmdArgs[0]}
+		format string
+	)
+	for i := 1; i < len(cmdArgs); i++ {
+		a := cmdArgs[i]
+		switch {
+		case (a == "--output" || a == "-output") && i+1 < len(cmdArgs):
+			format = cmdArgs[i+1]
+			i++
+		case strings.HasPrefix(a, "--output="):
+			format = strings.TrimPrefix(a, "--output=")
+		case strings.HasPrefix(a, "-output="):
+			format = strings.TrimPrefix(a, "-output=")
+		default:
+			r = append(r, a)
+		}
+	}
+	return r, format
+}
+
+// replacePipeInput 使用管道输入替换命令中的 - 参数，没有 - 参数则追加到最后
+func replacePipeInput(cmdArgs, input []string) []string {
+	r := []string{}
+	replaced := false
+	for _, a := range cmdArgs {
+		if a == "-" {
+			r = append(r, input...)
+			replaced = true
+			continue
+		}
+		r = append(r, a)
+	}
+	if !replaced {
+		r = append(r, input...)
+	}
+	return r
+}
+
+// parsePipeInput 解析命令的输出，JSON格式的输出取 path 字段，其他的输出每行作为一个值
+func parsePipeInput(out string) []string {
+	r := []string{}
+	out = strings.TrimSpace(out)
+	if strings.HasPrefix(out, "[") {
+		var items []map[string]interface{}
+		if json.Unmarshal([]byte(out), &items) == nil {
+			for _, item := range items {
+				if p, ok := item["path"].(string); ok && p != "" {
+					r = append(r, p)
+				}
+			}
+			return r
+		}
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			// 没有 path 字段的是错误信息或者执行结果汇总
+			item := map[string]interface{}{}
+			if json.Unmarshal([]byte(line), &item) == nil {
+				if p, ok := item["path"].(string); ok && p != "" {
+					r = append(r, p)
+				}
+				continue
+			}
+		}
+		r = append(r, line)
+	}
+	return r
+}
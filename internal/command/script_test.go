@@ -0,0 +1,152 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tickstep/aliyunpan/cmder/cmdliner/args"
+	"github.com/urfave/cli"
+)
+
+func TestParseScript(t *testing.T) {
+	statements, err := parseScript(`
+# 注释
+set -e
+for d in a b
+    for f in ls $d
+        download "$f"
+    done
+done
+echo ok | download -
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 3 || statements[1].loopVar != "d" || statements[1].loopSource != "a b" {
+		t.Fatalf("unexpected statements: %+v", statements)
+	}
+	inner := statements[1].body
+	if len(inner) != 1 || inner[0].loopVar != "f" || len(inner[0].body) != 1 || inner[0].body[0].lineNo != 6 {
+		t.Errorf("unexpected loop body: %+v", inner)
+	}
+
+	if _, err = parseScript("for f in a\necho $f\n"); err == nil || !strings.Contains(err.Error(), "第1行") {
+		t.Errorf("missing done should be reported, got %v", err)
+	}
+	if _, err = parseScript("echo a\ndone\n"); err == nil || !strings.Contains(err.Error(), "第2行") {
+		t.Errorf("extra done should be reported, got %v", err)
+	}
+}
+
+func TestPipeHelpers(t *testing.T) {
+	if r := splitPipeline(`ls "/a|b" | download -saveto /tmp -`); !reflect.DeepEqual(r, []string{`ls "/a|b"`, "download -saveto /tmp -"}) {
+		t.Errorf("unexpected stages: %v", r)
+	}
+	if IsPipeline(`ls '/a|b'`) {
+		t.Errorf("quoted pipe should be ignored")
+	}
+
+	r, format := extractOutputFlag([]string{"ls", "--output", "jsonl", "/photos"})
+	if format != "jsonl" || !reflect.DeepEqual(r, []string{"ls", "/photos"}) {
+		t.Errorf("unexpected result: %v %s", r, format)
+	}
+
+	if r = replacePipeInput([]string{"download", "-", "-saveto", "/tmp"}, []string{"/a", "/b"}); !reflect.DeepEqual(r, []string{"download", "/a", "/b", "-saveto", "/tmp"}) {
+		t.Errorf("unexpected args: %v", r)
+	}
+	vars := map[string]string{"A": "x y", "B": `C:\dir "1"`}
+	r = args.Parse(expandScriptVars(`echo $A "$A/b" '$A' 'it''s $B' $B`, func(name string) string { return vars[name] }))
+	if !reflect.DeepEqual(r, []string{"echo", "x y", "x y/b", "$A", "its $B", `C:\dir "1"`}) {
+		t.Errorf("unexpected expanded args: %q", r)
+	}
+
+	if r = replacePipeInput([]string{"rm"}, []string{"/a"}); !reflect.DeepEqual(r, []string{"rm", "/a"}) {
+		t.Errorf("unexpected args: %v", r)
+	}
+
+	out := `{"path":"/a","type":"file"}
+{"error":{"code":"not_found","message":"文件不存在"}}
+/b
+`
+	if r = parsePipeInput(out); !reflect.DeepEqual(r, []string{"/a", "/b"}) {
+		t.Errorf("unexpected input: %v", r)
+	}
+	if r = parsePipeInput("[\n  {\"path\": \"/c\"}\n]\n"); !reflect.DeepEqual(r, []string{"/c"}) {
+		t.Errorf("unexpected input: %v", r)
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	defer SetOutputFormat(OutputFormatTable)
+
+	var calls []string
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{cli.StringFlag{Name: "output", Value: OutputFormatTable}}
+	app.Before = func(c *cli.Context) error {
+		return SetOutputFormat(c.GlobalString("output"))
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "ls",
+			Action: func(c *cli.Context) error {
+				calls = append(calls, "ls "+outputFormat+" "+strings.Join(c.Args(), " "))
+				return writeOutput([]*FileOutput{{Path: c.Args().First() + "/1.jpg"}, {Path: c.Args().First() + "/2.jpg"}})
+			},
+		},
+		{
+			Name:            "download",
+			SkipFlagParsing: true,
+			Action: func(c *cli.Context) error {
+				calls = append(calls, "download "+strings.Join(c.Args(), " "))
+				return nil
+			},
+		},
+		{
+			Name: "fail",
+			Action: func(c *cli.Context) error {
+				return reportError(notFoundErrorf("文件不存在"))
+			},
+		},
+	}
+
+	script := filepath.Join(t.TempDir(), "test.ap")
+	os.WriteFile(script, []byte(`
+SAVE=/tmp/save
+ls $1 | download -saveto $SAVE -
+for f in ls /b
+    download "$f"
+done
+for n in x y
+    download $n
+done
+fail
+download $?
+set -e
+fail
+download never
+`), 0644)
+
+	err := RunScript(app, script, []string{"/a"})
+	if ec, ok := err.(cli.ExitCoder); !ok || ec.ExitCode() != ExitCodeNotFound {
+		t.Errorf("expected not found exit code, got %v", err)
+	}
+	expect := []string{
+		"ls jsonl /a",
+		"download -saveto /tmp/save /a/1.jpg /a/2.jpg",
+		"ls jsonl /b",
+		"download /b/1.jpg",
+		"download /b/2.jpg",
+		"download x",
+		"download y",
+		"download 4",
+	}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("unexpected calls:\n%s", strings.Join(calls, "\n"))
+	}
+	if scriptDepth != 0 || outputWriter != os.Stdout {
+		t.Errorf("script state should be restored")
+	}
+}
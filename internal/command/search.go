@@ -0,0 +1,537 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open/openapi"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/library-go/converter"
+	"github.com/urfave/cli"
+)
+
+const (
+	// searchMaxQueryConditions 搜索接口 query 最多支持的条件数量
+	searchMaxQueryConditions = 5
+	// searchMaxPageSize 搜索接口单页最多返回的文件数量
+	searchMaxPageSize = 100
+	// searchTimeQueryFormat 搜索接口 query 使用的时间格式(UTC)
+	searchTimeQueryFormat = "2006-01-02T15:04:05"
+)
+
+// searchTimeFormats 支持的时间参数格式
+var searchTimeFormats = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+func CmdSearch() cli.Command {
+	return cli.Command{
+		Name:      "search",
+		Usage:     "搜索网盘文件",
+		UsageText: cmder.App().Name + " search [选项] [文件名]",
+		Description: `
+	使用网盘的搜索接口查找文件, 无需逐级遍历目录, 适合在文件很多的网盘中快速定位文件.
+	文件名支持通配符(*, ?, [...]), 不包含通配符时按包含关键字匹配. 也可以使用 -regex 指定正则表达式.
+	所有过滤条件同时生效; 搜索接口最多支持 5 个条件(不带 -r 的 -dir 也算一个条件), 超出时需要减少过滤条件.
+
+	分类 category 可选值: video, image, audio, doc, zip, others. 多个值使用逗号分隔
+	时间格式: 2006-01-02 或者 2006-01-02 15:04:05
+
+	示例:
+
+	搜索文件名包含 合同 的文件和目录
+	aliyunpan search 合同
+
+	搜索所有 mp4 和 mkv 视频, 并显示详细信息
+	aliyunpan search -ext mp4,mkv -l
+
+	搜索大于 1GB 并且 2023 年以后修改的视频
+	aliyunpan search -category video -minSize 1gb -modifiedAfter 2023-01-01
+
+	使用通配符搜索 /我的资源 目录及其子目录下的 pdf 文件
+	aliyunpan search -dir /我的资源 -r "*.pdf"
+
+	使用正则表达式搜索
+	aliyunpan search -regex "^IMG_\d{4}\.jpg$"
+
+	获取前 20 个结果, 然后使用返回的分页标记获取下一页
+	aliyunpan search -limit 20 报告
+	aliyunpan search -limit 20 -marker <分页标记> 报告
+
+	以 json 格式输出, 方便脚本处理
+	aliyunpan --output json search -ext pdf
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		After:    SaveConfigFunc,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			if c.NArg() > 1 {
+				return reportError(usageErrorf("只能指定一个文件名, 包含空格的文件名请使用引号"))
+			}
+
+			opt, err := newSearchOptions(c)
+			if err != nil {
+				return reportError(err)
+			}
+			return reportError(RunSearch(parseDriveId(c), opt))
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "driveId",
+				Usage: "网盘ID",
+				Value: "",
+			},
+			cli.StringFlag{
+				Name:  "regex",
+				Usage: "使用正则表达式匹配文件名",
+			},
+			cli.StringFlag{
+				Name:  "category",
+				Usage: "文件分类，多个使用逗号分隔，例如：video,image,doc",
+			},
+			cli.StringFlag{
+				Name:  "ext",
+				Usage: "文件扩展名，多个使用逗号分隔，例如：mp4,mkv",
+			},
+			cli.StringFlag{
+				Name:  "type",
+				Usage: "文件类型，file-文件，folder-目录",
+			},
+			cli.StringFlag{
+				Name:  "minSize",
+				Usage: "min size， 过滤大于等于指定大小的文件，例如：100mb",
+			},
+			cli.StringFlag{
+				Name:  "maxSize",
+				Usage: "max size， 过滤小于等于指定大小的文件，例如：1gb",
+			},
+			cli.StringFlag{
+				Name:  "modifiedAfter",
+				Usage: "过滤在指定时间及之后修改的文件，例如：2023-01-01",
+			},
+			cli.StringFlag{
+				Name:  "modifiedBefore",
+				Usage: "过滤在指定时间之前修改的文件，例如：2023-12-31 12:00:00",
+			},
+			cli.StringFlag{
+				Name:  "dir",
+				Usage: "只搜索指定目录下的文件，默认只搜索目录的直接下级",
+			},
+			cli.BoolFlag{
+				Name:  "r",
+				Usage: "配合 -dir 使用，搜索目录下所有层级的文件",
+			},
+			cli.IntFlag{
+				Name:  "limit",
+				Usage: "最多返回的结果数量",
+				Value: 100,
+			},
+			cli.StringFlag{
+				Name:  "marker",
+				Usage: "分页标记，从上一次搜索结果的末尾继续",
+			},
+			cli.BoolFlag{
+				Name:  "l",
+				Usage: "显示详细信息",
+			},
+			cli.BoolFlag{
+				Name:  "asc",
+				Usage: "升序排序",
+			},
+			cli.BoolFlag{
+				Name:  "time",
+				Usage: "根据修改时间排序，默认",
+			},
+			cli.BoolFlag{
+				Name:  "name",
+				Usage: "根据文件名排序",
+			},
+			cli.BoolFlag{
+				Name:  "size",
+				Usage: "根据大小排序",
+			},
+		},
+	}
+}
+
+// newSearchOptions 解析命令行参数
+func newSearchOptions(c *cli.Context) (*SearchOptions, error) {
+	opt := &SearchOptions{
+		Total:   c.Bool("l"),
+		Recurse: c.Bool("r"),
+		Name:    c.Args().Get(0),
+		Dir:     c.String("dir"),
+		Type:    c.String("type"),
+		Limit:   c.Int("limit"),
+		Marker:  c.String("marker"),
+		OrderBy: "updated_at DESC",
+	}
+	if opt.Name != "" {
+		if _, err := path.Match(opt.Name, ""); err != nil {
+			return nil, usageErrorf("文件名通配符格式错误: %s", opt.Name)
+		}
+	}
+	if c.IsSet("regex") {
+		re, err := regexp.Compile(c.String("regex"))
+		if err != nil {
+			return nil, usageErrorf("正则表达式格式错误: %s", err)
+		}
+		opt.Regex = re
+	}
+	if opt.Type != "" && opt.Type != "file" && opt.Type != "folder" {
+		return nil, usageErrorf("文件类型只能是 file 或者 folder")
+	}
+	if opt.Limit <= 0 {
+		return nil, usageErrorf("结果数量必须大于0")
+	}
+	opt.Categories = splitSearchValues(c.String("category"), "")
+	opt.Exts = splitSearchValues(c.String("ext"), ".")
+
+	var err error
+	if c.IsSet("minSize") {
+		if opt.MinSize, err = converter.ParseFileSizeStr(c.String("minSize")); err != nil {
+			return nil, usageErrorf("文件大小格式错误: %s", c.String("minSize"))
+		}
+	}
+	if c.IsSet("maxSize") {
+		if opt.MaxSize, err = converter.ParseFileSizeStr(c.String("maxSize")); err != nil {
+			return nil, usageErrorf("文件大小格式错误: %s", c.String("maxSize"))
+		}
+	}
+	if c.IsSet("modifiedAfter") {
+		if opt.ModifiedAfter, err = parseSearchTime(c.String("modifiedAfter")); err != nil {
+			return nil, err
+		}
+	}
+	if c.IsSet("modifiedBefore") {
+		if opt.ModifiedBefore, err = parseSearchTime(c.String("modifiedBefore")); err != nil {
+			return nil, err
+		}
+	}
+
+	direction := "DESC"
+	if c.Bool("asc") {
+		direction = "ASC"
+	}
+	switch {
+	case c.Bool("name"):
+		opt.OrderBy = "name " + direction
+	case c.Bool("size"):
+		opt.OrderBy = "size " + direction
+	default:
+		opt.OrderBy = "updated_at " + direction
+	}
+	return opt, nil
+}
+
+// splitSearchValues 拆分逗号分隔的参数值，并统一为小写
+func splitSearchValues(s, trimPrefix string) []string {
+	var r []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(v), trimPrefix))
+		if v != "" {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+// parseSearchTime 解析本地时间
+func parseSearchTime(s string) (time.Time, error) {
+	for _, layout := range searchTimeFormats {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(s), time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, usageErrorf("时间格式错误: %s, 正确格式为 2006-01-02 或者 2006-01-02 15:04:05", s)
+}
+
+// searchNameKeyword 提取文件名中最长的非通配符片段，作为搜索接口的模糊匹配关键字
+func searchNameKeyword(name string) string {
+	keyword := ""
+	for _, part := range regexp.MustCompile(`\[[^\]]*\]|[*?\\]`).Split(name, -1) {
+		if len([]rune(part)) > len([]rune(keyword)) {
+			keyword = part
+		}
+	}
+	return keyword
+}
+
+// hasSearchWildcard 文件名是否包含通配符
+func hasSearchWildcard(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// quoteSearchValue 转义 query 中的字符串值
+func quoteSearchValue(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func quoteSearchValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quoteSearchValue(v)
+	}
+	return "[" + strings.Join(quoted, ",") + "]"
+}
+
+// buildSearchQuery 生成搜索接口的 query 语句。接口最多支持 5 个条件，超出时返回参数错误
+func buildSearchQuery(opt *SearchOptions, parentFileId string) (string, error) {
+	var conditions []string
+	if parentFileId != "" {
+		conditions = append(conditions, "parent_file_id = "+quoteSearchValue(parentFileId))
+	}
+	if keyword := searchNameKeyword(opt.Name); keyword != "" {
+		conditions = append(conditions, "name match "+quoteSearchValue(keyword))
+	}
+	if len(opt.Exts) == 1 {
+		conditions = append(conditions, "file_extension = "+quoteSearchValue(opt.Exts[0]))
+	} else if len(opt.Exts) > 1 {
+		conditions = append(conditions, "file_extension in "+quoteSearchValues(opt.Exts))
+	}
+	if len(opt.Categories) == 1 {
+		conditions = append(conditions, "category = "+quoteSearchValue(opt.Categories[0]))
+	} else if len(opt.Categories) > 1 {
+		conditions = append(conditions, "category in "+quoteSearchValues(opt.Categories))
+	}
+	if opt.Type != "" {
+		conditions = append(conditions, "type = "+quoteSearchValue(opt.Type))
+	}
+	if opt.MinSize > 0 {
+		conditions = append(conditions, fmt.Sprintf("size >= %d", opt.MinSize))
+	}
+	if opt.MaxSize > 0 {
+		conditions = append(conditions, fmt.Sprintf("size <= %d", opt.MaxSize))
+	}
+	if !opt.ModifiedAfter.IsZero() {
+		conditions = append(conditions, "updated_at >= "+quoteSearchValue(opt.ModifiedAfter.UTC().Format(searchTimeQueryFormat)))
+	}
+	if !opt.ModifiedBefore.IsZero() {
+		conditions = append(conditions, "updated_at < "+quoteSearchValue(opt.ModifiedBefore.UTC().Format(searchTimeQueryFormat)))
+	}
+	if len(conditions) > searchMaxQueryConditions {
+		return "", usageErrorf("过滤条件过多: 搜索接口最多支持 %d 个条件, 当前有 %d 个, 请减少过滤条件",
+			searchMaxQueryConditions, len(conditions))
+	}
+	return strings.Join(conditions, " and "), nil
+}
+
+// matchSearchFile 在本地检查文件是否满足路径以外的过滤条件
+func matchSearchFile(file *aliyunpan.FileEntity, opt *SearchOptions) bool {
+	if opt.Name != "" {
+		name := strings.ToLower(file.FileName)
+		pattern := strings.ToLower(opt.Name)
+		if hasSearchWildcard(pattern) {
+			if ok, _ := path.Match(pattern, name); !ok {
+				return false
+			}
+		} else if !strings.Contains(name, pattern) {
+			return false
+		}
+	}
+	if opt.Regex != nil && !opt.Regex.MatchString(file.FileName) {
+		return false
+	}
+	if opt.Type != "" && file.FileType != opt.Type {
+		return false
+	}
+	if len(opt.Exts) > 0 {
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(file.FileName), "."))
+		if file.IsFolder() || !containsString(opt.Exts, ext) {
+			return false
+		}
+	}
+	if len(opt.Categories) > 0 && !containsString(opt.Categories, strings.ToLower(file.Category)) {
+		return false
+	}
+	if (opt.MinSize > 0 || opt.MaxSize > 0) && file.IsFolder() {
+		return false
+	}
+	if opt.MinSize > 0 && file.FileSize < opt.MinSize {
+		return false
+	}
+	if opt.MaxSize > 0 && file.FileSize > opt.MaxSize {
+		return false
+	}
+	if !opt.ModifiedAfter.IsZero() || !opt.ModifiedBefore.IsZero() {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", file.UpdatedAt, time.Local)
+		if err != nil {
+			return false
+		}
+		if !opt.ModifiedAfter.IsZero() && t.Before(opt.ModifiedAfter) {
+			return false
+		}
+		if !opt.ModifiedBefore.IsZero() && !t.Before(opt.ModifiedBefore) {
+			return false
+		}
+	}
+	return true
+}
+
+// inSearchDir 文件路径是否在搜索目录下
+func inSearchDir(filePath, dir string) bool {
+	return dir == "" || dir == "/" || strings.HasPrefix(filePath, dir+"/")
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// searchPathResolver 根据文件的 ParentFileId 逐级向上查询，解析搜索结果的完整路径。查询过的目录会缓存起来
+type searchPathResolver struct {
+	fileInfoById func(fileId string) (*aliyunpan.FileEntity, *apierror.ApiError)
+	dirPaths     map[string]string
+}
+
+func newSearchPathResolver(fileInfoById func(fileId string) (*aliyunpan.FileEntity, *apierror.ApiError)) *searchPathResolver {
+	return &searchPathResolver{
+		fileInfoById: fileInfoById,
+		dirPaths:     map[string]string{aliyunpan.DefaultRootParentFileId: "/"},
+	}
+}
+
+// dirPath 获取目录的完整路径
+func (r *searchPathResolver) dirPath(fileId string) (string, *apierror.ApiError) {
+	if p, ok := r.dirPaths[fileId]; ok {
+		return p, nil
+	}
+	info, err := r.fileInfoById(fileId)
+	if err != nil {
+		return "", err
+	}
+	parent, err := r.dirPath(info.ParentFileId)
+	if err != nil {
+		return "", err
+	}
+	p := path.Join(parent, info.FileName)
+	r.dirPaths[fileId] = p
+	return p, nil
+}
+
+// resolve 设置文件的完整路径
+func (r *searchPathResolver) resolve(file *aliyunpan.FileEntity) *apierror.ApiError {
+	parent, err := r.dirPath(file.ParentFileId)
+	if err != nil {
+		return err
+	}
+	file.Path = path.Join(parent, file.FileName)
+	if file.IsFolder() {
+		r.dirPaths[file.FileId] = file.Path
+	}
+	return nil
+}
+
+// RunSearch 执行搜索
+func RunSearch(driveId string, opt *SearchOptions) error {
+	activeUser := config.Config.ActiveUser()
+	panClient := activeUser.PanClient()
+
+	// 搜索目录
+	dir, dirFileId, parentFileId := "", "", ""
+	if opt.Dir != "" {
+		dir = path.Clean(activeUser.PathJoin(driveId, opt.Dir))
+		dirInfo, err := panClient.OpenapiPanClient().FileInfoByPath(driveId, dir)
+		if err != nil {
+			if err.Code == apierror.ApiCodeFileNotFoundCode {
+				return notFoundErrorf("指定目录不存在: %s", dir)
+			}
+			return apiOutputError(err, "")
+		}
+		if !dirInfo.IsFolder() {
+			return usageErrorf("%s 不是目录", dir)
+		}
+		dirFileId = dirInfo.FileId
+		if !opt.Recurse {
+			parentFileId = dirInfo.FileId
+		}
+	}
+
+	query, err := buildSearchQuery(opt, parentFileId)
+	if err != nil {
+		return err
+	}
+
+	// 解析过的目录路径缓存在 resolver 中，搜索目录已知，不需要再向上查询
+	resolver := newSearchPathResolver(func(fileId string) (*aliyunpan.FileEntity, *apierror.ApiError) {
+		return panClient.OpenapiPanClient().FileInfoById(driveId, fileId)
+	})
+	if dirFileId != "" {
+		resolver.dirPaths[dirFileId] = dir
+	}
+
+	param := &openapi.FileSearchParam{
+		DriveId: driveId,
+		Query:   query,
+		Marker:  opt.Marker,
+		OrderBy: opt.OrderBy,
+	}
+	fileList := aliyunpan.FileList{}
+	for len(fileList) < opt.Limit {
+		// 每次只请求剩余需要的数量，保证分页标记不会跳过未返回的文件
+		param.Limit = opt.Limit - len(fileList)
+		if param.Limit > searchMaxPageSize {
+			param.Limit = searchMaxPageSize
+		}
+		result, err := panClient.FileSearch(param)
+		if err != nil {
+			return apiOutputError(err, "搜索文件失败: ")
+		}
+		for _, file := range result.FileList {
+			// 先按照文件属性过滤，只为符合条件的文件查询路径
+			if !matchSearchFile(file, opt) {
+				continue
+			}
+			if e := resolver.resolve(file); e != nil {
+				return apiOutputError(e, "获取文件路径失败: ")
+			}
+			if inSearchDir(file.Path, dir) {
+				fileList = append(fileList, file)
+			}
+		}
+		param.Marker = result.NextMarker
+		if param.Marker == "" {
+			break
+		}
+	}
+
+	if IsMachineOutput() {
+		if param.Marker != "" {
+			fmt.Fprintf(os.Stderr, "next_marker: %s\n", param.Marker)
+		}
+		return writeOutput(newFileOutputList(fileList, ""))
+	}
+	if dir == "" {
+		dir = "/"
+	}
+	renderTable(opSearch, opt.Total, dir, fileList)
+	if param.Marker != "" {
+		fmt.Printf("还有更多结果, 使用 -marker %s 获取下一页\n", param.Marker)
+	}
+	return nil
+}
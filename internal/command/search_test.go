@@ -0,0 +1,113 @@
+package command
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+)
+
+func TestBuildSearchQuery(t *testing.T) {
+	after, _ := parseSearchTime("2023-01-01")
+	opt := &SearchOptions{
+		Name:          "IMG_*.jpg",
+		Exts:          []string{"jpg"},
+		Categories:    []string{"image", "video"},
+		MinSize:       1024,
+		MaxSize:       2048,
+		ModifiedAfter: after,
+	}
+	if _, err := buildSearchQuery(opt, "abc"); err == nil {
+		t.Errorf("too many conditions should fail")
+	}
+
+	opt.MaxSize, opt.ModifiedAfter = 0, time.Time{}
+	expect := "parent_file_id = 'abc' and name match 'IMG_' and file_extension = 'jpg' and category in ['image','video'] and size >= 1024"
+	if q, err := buildSearchQuery(opt, "abc"); err != nil || q != expect {
+		t.Errorf("unexpected query: %s, %v", q, err)
+	}
+
+	opt = &SearchOptions{Name: "it's", ModifiedAfter: after}
+	expect = "name match 'it\\'s' and updated_at >= '" + after.UTC().Format(searchTimeQueryFormat) + "'"
+	if q, err := buildSearchQuery(opt, ""); err != nil || q != expect {
+		t.Errorf("unexpected query: %s, %v", q, err)
+	}
+
+	if k := searchNameKeyword("*年度报告[0-9]?23*"); k != "年度报告" {
+		t.Errorf("unexpected keyword: %s", k)
+	}
+	if _, err := parseSearchTime("2023/01/01"); err == nil {
+		t.Errorf("invalid time should fail")
+	}
+}
+
+func TestMatchSearchFile(t *testing.T) {
+	before, _ := parseSearchTime("2023-06-01")
+	file := &aliyunpan.FileEntity{
+		FileName:  "IMG_0001.JPG",
+		FileType:  "file",
+		FileSize:  1500,
+		Category:  "image",
+		UpdatedAt: "2023-05-01 10:00:00",
+		Path:      "/相册/2023/IMG_0001.JPG",
+	}
+	folder := &aliyunpan.FileEntity{FileName: "img", FileType: "folder", UpdatedAt: "2023-05-01 10:00:00", Path: "/img"}
+
+	cases := []struct {
+		opt    *SearchOptions
+		file   *aliyunpan.FileEntity
+		expect bool
+	}{
+		{&SearchOptions{Name: "img"}, file, true},
+		{&SearchOptions{Name: "img"}, folder, true},
+		{&SearchOptions{Name: "img_*.jpg"}, file, true},
+		{&SearchOptions{Name: "*.png"}, file, false},
+		{&SearchOptions{Regex: regexp.MustCompile(`^IMG_\d{4}\.JPG$`)}, file, true},
+		{&SearchOptions{Exts: []string{"jpg"}}, file, true},
+		{&SearchOptions{Exts: []string{"jpg"}}, folder, false},
+		{&SearchOptions{Categories: []string{"video"}}, file, false},
+		{&SearchOptions{Type: "folder"}, file, false},
+		{&SearchOptions{MinSize: 1000, MaxSize: 2000}, file, true},
+		{&SearchOptions{MinSize: 2000}, file, false},
+		{&SearchOptions{MinSize: 1}, folder, false},
+		{&SearchOptions{ModifiedBefore: before}, file, true},
+		{&SearchOptions{ModifiedAfter: before}, file, false},
+	}
+	for i, c := range cases {
+		if r := matchSearchFile(c.file, c.opt); r != c.expect {
+			t.Errorf("case %d: expected %v, got %v", i, c.expect, r)
+		}
+	}
+	if !inSearchDir(file.Path, "/相册") || inSearchDir(file.Path, "/相") || !inSearchDir(file.Path, "") {
+		t.Errorf("unexpected dir match")
+	}
+}
+
+func TestSearchPathResolver(t *testing.T) {
+	dirs := map[string]*aliyunpan.FileEntity{
+		"a": {FileId: "a", FileName: "相册", ParentFileId: "root", FileType: "folder"},
+		"b": {FileId: "b", FileName: "2023", ParentFileId: "a", FileType: "folder"},
+	}
+	calls := 0
+	resolver := newSearchPathResolver(func(fileId string) (*aliyunpan.FileEntity, *apierror.ApiError) {
+		calls++
+		if f, ok := dirs[fileId]; ok {
+			return f, nil
+		}
+		return nil, apierror.NewFailedApiError("not found")
+	})
+
+	f1 := &aliyunpan.FileEntity{FileName: "1.jpg", ParentFileId: "b", FileType: "file"}
+	f2 := &aliyunpan.FileEntity{FileName: "2.jpg", ParentFileId: "b", FileType: "file"}
+	if resolver.resolve(f1) != nil || resolver.resolve(f2) != nil {
+		t.Fatal("resolve failed")
+	}
+	if f1.Path != "/相册/2023/1.jpg" || f2.Path != "/相册/2023/2.jpg" || calls != 2 {
+		t.Errorf("unexpected paths: %s %s, calls: %d", f1.Path, f2.Path, calls)
+	}
+	if resolver.resolve(&aliyunpan.FileEntity{FileName: "x", ParentFileId: "missing"}) == nil {
+		t.Errorf("missing parent should fail")
+	}
+}
@@ -66,8 +66,7 @@ func CmdShare() cli.Command {
 						return nil
 					}
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 
 					// 有效期
@@ -102,8 +101,7 @@ func CmdShare() cli.Command {
 					if modeFlag == "1" || modeFlag == "2" {
 						if config.Config.ActiveUser().ActiveDriveId != config.Config.ActiveUser().DriveList.GetResourceDriveId() {
 							// 只有资源库才支持私有、公开分享
-							fmt.Println("只有资源库才支持分享链接，其他请使用快传链接")
-							return nil
+							return reportError(usageErrorf("只有资源库才支持分享链接，其他请使用快传链接"))
 						}
 					}
 					if modeFlag == "1" {
@@ -114,8 +112,7 @@ func CmdShare() cli.Command {
 						sharePwd = ""
 					}
 
-					RunOpenShareSet(modeFlag, parseDriveId(c), c.Args(), et, sharePwd)
-					return nil
+					return reportError(RunOpenShareSet(modeFlag, parseDriveId(c), c.Args(), et, sharePwd))
 				},
 				Flags: []cli.Flag{
 					cli.StringFlag{
@@ -145,25 +142,22 @@ func CmdShare() cli.Command {
 }
 
 // RunOpenShareSet 执行分享
-func RunOpenShareSet(modeFlag, driveId string, paths []string, expiredTime string, sharePwd string) {
+func RunOpenShareSet(modeFlag, driveId string, paths []string, expiredTime string, sharePwd string) error {
 	if len(paths) <= 0 {
-		fmt.Println("请指定文件路径")
-		return
+		return usageErrorf("请指定文件路径")
 	}
 	activeUser := GetActiveUser()
 	panClient := activeUser.PanClient()
 
 	allFileList := []*aliyunpan.FileEntity{}
+	notFoundCount := 0
 	for idx := 0; idx < len(paths); idx++ {
 		absolutePath := path.Clean(activeUser.PathJoin(driveId, paths[idx]))
 		fileList, err1 := matchPathByShellPattern(driveId, absolutePath)
-		if err1 != nil {
-			fmt.Println("文件不存在: " + absolutePath)
-			continue
-		}
-		if fileList == nil || len(fileList) == 0 {
+		if err1 != nil || len(fileList) == 0 {
 			// 文件不存在
 			fmt.Println("文件不存在: " + absolutePath)
+			notFoundCount++
 			continue
 		}
 		// 匹配的文件
@@ -176,8 +170,7 @@ func RunOpenShareSet(modeFlag, driveId string, paths []string, expiredTime strin
 	}
 
 	if len(fidList) == 0 {
-		fmt.Printf("没有指定有效的文件\n")
-		return
+		return notFoundErrorf("没有指定有效的文件")
 	}
 
 	// 创建分享类型
@@ -187,13 +180,14 @@ func RunOpenShareSet(modeFlag, driveId string, paths []string, expiredTime strin
 			DriveId:    driveId,
 			FileIdList: fidList,
 		})
-		if err1 != nil || r == nil {
+		if err1 != nil {
 			if err1.Code == apierror.ApiCodeFileShareNotAllowed {
-				fmt.Printf("创建快传链接失败: 该文件类型不允许分享\n")
-			} else {
-				fmt.Printf("创建快传链接失败: %s\n", err1)
+				return apiOutputError(err1, "创建快传链接失败: 该文件类型不允许分享, ")
 			}
-			return
+			return apiOutputError(err1, "创建快传链接失败: ")
+		}
+		if r == nil {
+			return errorf("创建快传链接失败")
 		}
 
 		fmt.Printf("创建快传链接成功\n")
@@ -206,13 +200,14 @@ func RunOpenShareSet(modeFlag, driveId string, paths []string, expiredTime strin
 			Expiration: expiredTime,
 			FileIdList: fidList,
 		})
-		if err1 != nil || r == nil {
+		if err1 != nil {
 			if err1.Code == apierror.ApiCodeFileShareNotAllowed {
-				fmt.Printf("创建分享链接失败: 该文件类型不允许分享\n")
-			} else {
-				fmt.Printf("创建分享链接失败: %s\n", err1)
+				return apiOutputError(err1, "创建分享链接失败: 该文件类型不允许分享, ")
 			}
-			return
+			return apiOutputError(err1, "创建分享链接失败: ")
+		}
+		if r == nil {
+			return errorf("创建分享链接失败")
 		}
 
 		if modeFlag == "1" {
@@ -227,4 +222,8 @@ func RunOpenShareSet(modeFlag, driveId string, paths []string, expiredTime strin
 			fmt.Printf("链接：%s\n", shareUrl)
 		}
 	}
+	if notFoundCount > 0 {
+		return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分文件不存在，没有加入分享")
+	}
+	return nil
 }
@@ -71,12 +71,10 @@ func CmdShareWeb() cli.Command {
 						return nil
 					}
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					et := ""
 					timeFlag := "0"
@@ -104,8 +102,7 @@ func CmdShareWeb() cli.Command {
 					if modeFlag == "1" || modeFlag == "2" {
 						if config.Config.ActiveUser().ActiveDriveId != config.Config.ActiveUser().DriveList.GetResourceDriveId() {
 							// 只有资源库才支持私有、公开分享
-							fmt.Println("只有资源库才支持分享链接，其他请使用快传链接")
-							return nil
+							return reportError(usageErrorf("只有资源库才支持分享链接，其他请使用快传链接"))
 						}
 					}
 
@@ -149,15 +146,12 @@ func CmdShareWeb() cli.Command {
 				UsageText: cmder.App().Name + " share list",
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
-					RunShareList()
-					return nil
+					return reportError(RunShareList())
 				},
 				Flags: []cli.Flag{},
 			},
@@ -169,12 +163,10 @@ func CmdShareWeb() cli.Command {
 				Description: `目前只支持通过分享id (shareid) 来取消分享.`,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					if c.NArg() < 1 {
 						cli.ShowCommandHelp(c, c.Command.Name)
@@ -200,12 +192,10 @@ func CmdShareWeb() cli.Command {
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-						return nil
+						return reportError(webNotLoggedInError())
 					}
 					if c.NArg() < 1 {
 						cli.ShowCommandHelp(c, c.Command.Name)
@@ -311,12 +301,28 @@ func RunShareSet(modeFlag, driveId string, paths []string, expiredTime string, s
 }
 
 // RunShareList 执行列出分享列表
-func RunShareList() {
+func RunShareList() error {
 	activeUser := GetActiveUser()
 	records, err := activeUser.PanClient().WebapiPanClient().ShareLinkList(activeUser.UserId)
 	if err != nil {
-		fmt.Printf("获取分享列表失败: %s\n", err)
-		return
+		return apiOutputError(err, "获取分享列表失败: ")
+	}
+	if IsMachineOutput() {
+		now := time.Now()
+		shares := []*ShareOutput{}
+		for _, record := range records {
+			shares = append(shares, &ShareOutput{
+				ShareId:    record.ShareId,
+				ShareName:  record.ShareName,
+				ShareUrl:   record.ShareUrl,
+				SharePwd:   record.SharePwd,
+				Expiration: record.Expiration,
+				Status:     shareStatus(record, now),
+				SaveCount:  record.SaveCount,
+				CreatedAt:  record.CreatedAt,
+			})
+		}
+		return writeOutput(shares)
 	}
 
 	tb := cmdtable.NewTable(os.Stdout)
@@ -327,22 +333,7 @@ func RunShareList() {
 		if len(record.Expiration) > 0 {
 			et = record.Expiration
 		}
-		status := "有效"
-		if record.Status == "enabled" {
-			if record.FirstFile == nil {
-				status = "已删除"
-			} else {
-				cz := time.FixedZone("CST", 8*3600)
-				if len(record.Expiration) > 0 {
-					expiredTime, _ := time.ParseInLocation("2006-01-02 15:04:05", record.Expiration, cz)
-					if expiredTime.Unix() < now.Unix() {
-						status = "已过期"
-					}
-				}
-			}
-		} else if record.Status == "forbidden" {
-			status = "违规"
-		}
+		status := shareStatusNames[shareStatus(record, now)]
 
 		tb.Append([]string{strconv.Itoa(k + 1), record.ShareId, record.ShareUrl, record.SharePwd,
 			record.ShareName,
@@ -351,6 +342,35 @@ func RunShareList() {
 			status})
 	}
 	tb.Render()
+	return nil
+}
+
+var shareStatusNames = map[string]string{
+	"valid":     "有效",
+	"expired":   "已过期",
+	"deleted":   "已删除",
+	"forbidden": "违规",
+}
+
+// shareStatus 分享链接状态：valid, expired, deleted, forbidden
+func shareStatus(record *aliyunpan.ShareEntity, now time.Time) string {
+	if record.Status == "forbidden" {
+		return "forbidden"
+	}
+	if record.Status != "enabled" {
+		return "valid"
+	}
+	if record.FirstFile == nil {
+		return "deleted"
+	}
+	if len(record.Expiration) > 0 {
+		cz := time.FixedZone("CST", 8*3600)
+		expiredTime, _ := time.ParseInLocation("2006-01-02 15:04:05", record.Expiration, cz)
+		if expiredTime.Unix() < now.Unix() {
+			return "expired"
+		}
+	}
+	return "valid"
 }
 
 // RunShareCancel 执行取消分享
@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
 	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/tickstep/aliyunpan/internal/global"
 	"github.com/tickstep/aliyunpan/internal/log"
@@ -27,6 +28,7 @@ import (
 	"github.com/urfave/cli"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -48,6 +50,10 @@ func CmdSync() cli.Command {
 
 	请输入以下命令查看如何配置和启动：
     aliyunpan sync start -h
+
+	请输入以下命令查看如何管理备份任务：
+    aliyunpan sync list -h
+    aliyunpan sync add -h
 `,
 		Category: "阿里云盘",
 		Before:   ReloadConfigFunc,
@@ -73,7 +79,25 @@ func CmdSync() cli.Command {
    "panFolderPath": "/sync_drive/我的文档",
    "mode": "upload",
    "policy"： "increment"，
-   "driveName": "backup"
+   "driveName": "backup",
+   "versionPolicy": {
+    "keepLast": 5,
+    "keepDailyDays": 7
+   },
+   "schedule": {
+    "windows": ["01:00-06:00", "Sat,Sun 00:00-24:00"],
+    "bandwidth": [
+     {"window": "Mon-Fri 09:00-18:00", "maxUploadRate": "1MB", "maxDownloadRate": "1MB"}
+    ]
+   },
+   "filterRule": {
+    "include": ["*.docx", "*.pdf"],
+    "exclude": ["*.tmp", "~$*", "/归档/"],
+    "minSize": "1KB",
+    "maxSize": "2GB",
+    "maxAge": "30d",
+    "skipHidden": true
+   }
   }
  ]
 }
@@ -84,6 +108,27 @@ panFolderPath - 网盘目录
 mode - 备份模式，支持两种: upload(备份本地文件到云盘),download(备份云盘文件到本地)
 policy - 备份策略, 支持两种: exclusive(排他备份文件，目标目录多余的文件会被删除),increment(增量备份文件，目标目录多余的文件不会被删除)
 driveName - 网盘名称，backup(备份盘)，resource(资源盘)
+filterRule - 文件过滤规则，可选。被过滤的文件既不会同步，也不会被当作多余文件删除
+    include - 包含规则，gitignore语法。配置后只同步匹配的文件
+    exclude - 排除规则，gitignore语法，支持 ! 取反，以 / 结尾只匹配文件夹
+    minSize - 文件最小大小，例如：1KB
+    maxSize - 文件最大大小，例如：2GB
+    maxAge - 只同步最近修改过的文件，例如：12h, 30d, 2w
+    skipHidden - 是否跳过隐藏文件和系统文件
+    另外本地目录下的 .aliyunpanignore 文件也会作为排除规则生效，语法和 .gitignore 一致，规则相对所在目录
+versionPolicy - 历史版本保留策略，可选，只对upload模式有效。配置后云盘文件被覆盖前会先移动到网盘目录下的 .versions 文件夹
+    keepLast - 保留最近的N个版本
+    keepDailyDays - 最近D天内每天保留一个版本
+    两者都不配置则保留全部版本。可以使用 sync versions 命令查看和恢复历史版本。
+    注意：恢复只作用于云盘文件，upload模式下本地文件始终是备份源，如本地文件未同步恢复，下一轮备份会重新覆盖云盘文件
+schedule - 同步计划，可选
+    windows - 允许同步的时间窗口，格式：[星期] HH:MM-HH:MM，星期支持 Mon-Fri，Sat,Sun，1-5 等写法，支持跨越午夜，例如 22:00-06:00
+        不在时间窗口内不会开始新的扫描和文件传输，正在传输的文件会继续完成。不配置则全天同步
+    bandwidth - 分时段限速，按顺序匹配第一个符合的时间段，修改的速度会立即作用于正在传输的文件
+        window - 时间段，格式和 windows 一致
+        maxDownloadRate - 最大下载速度，例如：1MB，0代表不限速
+        maxUploadRate - 最大上传速度，例如：1MB，0代表不限速
+        不在任何时间段内则使用全局限速配置（config set -max_download_rate / -max_upload_rate）
     
 	例子:
 	1. 查看帮助
@@ -108,8 +153,7 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 `,
 				Action: func(c *cli.Context) error {
 					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
-						return nil
+						return reportError(notLoggedInError())
 					}
 					activeUser := GetActiveUser()
 
@@ -172,12 +216,10 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 						}
 						panDir = activeUser.PathJoin(activeUser.ActiveDriveId, panDir)
 						if !utils.IsLocalAbsPath(localDir) {
-							fmt.Println("本地目录请指定绝对路径")
-							return nil
+							return reportError(usageErrorf("本地目录请指定绝对路径"))
 						}
 						if !utils.IsPanAbsPath(panDir) {
-							fmt.Println("网盘目录请指定绝对路径")
-							return nil
+							return reportError(usageErrorf("网盘目录请指定绝对路径"))
 						}
 						//if b, e := utils.PathExists(localDir); e == nil {
 						//	if !b {
@@ -235,8 +277,7 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 						// 默认1分钟
 						scanIntervalTime = 60
 					}
-					RunSync(task, cycleMode, dp, up, downloadBlockSize, uploadBlockSize, syncOpt, c.Int("ldt"), scanIntervalTime)
-					return nil
+					return RunSync(task, cycleMode, dp, up, downloadBlockSize, uploadBlockSize, syncOpt, c.Int("ldt"), scanIntervalTime).report()
 				},
 				Flags: []cli.Flag{
 					cli.StringFlag{
@@ -309,12 +350,161 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 					},
 				},
 			},
+			syncCmdList(),
+			syncCmdStatus(),
+			syncCmdAdd(),
+			syncCmdEdit(),
+			syncCmdRemove(),
+			syncCmdPause(true),
+			syncCmdPause(false),
+			syncCmdReset(),
+			syncCmdRetryFailed(),
+			{
+				Name:      "versions",
+				Usage:     "查看和恢复云盘文件的历史版本",
+				UsageText: cmder.App().Name + " sync versions",
+				Description: `
+查看和恢复备份任务在云盘保存的历史版本。需要在备份配置文件中为任务配置 versionPolicy。
+
+	例子:
+	1. 查看云盘文件 /sync_drive/我的文档/设计.docx 的历史版本
+	aliyunpan sync versions list /sync_drive/我的文档/设计.docx
+
+	2. 将云盘文件 /sync_drive/我的文档/设计.docx 恢复到指定的历史版本，当前文件会保存为一个新的历史版本
+	aliyunpan sync versions restore /sync_drive/我的文档/设计.docx 2024-05-01T10-30-00
+`,
+				Action: func(c *cli.Context) error {
+					cli.ShowCommandHelp(c, c.Command.Name)
+					return nil
+				},
+				Subcommands: []cli.Command{
+					{
+						Name:      "list",
+						Usage:     "列出云盘文件的历史版本",
+						UsageText: cmder.App().Name + " sync versions list <云盘文件路径>",
+						Action: func(c *cli.Context) error {
+							if config.Config.ActiveUser() == nil {
+								return reportError(notLoggedInError())
+							}
+							if c.NArg() != 1 {
+								cli.ShowCommandHelp(c, c.Command.Name)
+								return nil
+							}
+							RunSyncVersionsList(c.Args().Get(0))
+							return nil
+						},
+					},
+					{
+						Name:      "restore",
+						Usage:     "恢复云盘文件到指定的历史版本",
+						UsageText: cmder.App().Name + " sync versions restore <云盘文件路径> <版本>",
+						Action: func(c *cli.Context) error {
+							if config.Config.ActiveUser() == nil {
+								return reportError(notLoggedInError())
+							}
+							if c.NArg() != 2 {
+								cli.ShowCommandHelp(c, c.Command.Name)
+								return nil
+							}
+							RunSyncVersionsRestore(c.Args().Get(0), c.Args().Get(1))
+							return nil
+						},
+					},
+				},
+			},
 		},
 	}
 }
 
+// getSyncTaskDriveId 获取同步任务对应的网盘ID
+func getSyncTaskDriveId(activeUser *config.PanUser, task *syncdrive.SyncTask) string {
+	if strings.ToLower(task.DriveName) == "resource" && activeUser.DriveList.GetResourceDriveId() != "" {
+		return activeUser.DriveList.GetResourceDriveId()
+	}
+	return activeUser.DriveList.GetFileDriveId()
+}
+
+// findSyncTaskByPanPath 查找云盘文件所属的同步任务，返回任务以及文件的绝对路径
+func findSyncTaskByPanPath(activeUser *config.PanUser, panFilePath string) (*syncdrive.SyncTask, string, error) {
+	syncMgr := syncdrive.NewSyncTaskManager(activeUser, activeUser.PanClient(), config.GetSyncDriveDir(), syncdrive.SyncOption{})
+	tasks, e := syncMgr.LoadSyncTaskList()
+	if e != nil {
+		return nil, "", e
+	}
+	var target *syncdrive.SyncTask
+	targetPath := ""
+	for _, task := range tasks {
+		if task.UserId != "" && task.UserId != activeUser.UserId {
+			continue
+		}
+		driveId := getSyncTaskDriveId(activeUser, task)
+		absPath := path.Clean(activeUser.PathJoin(driveId, panFilePath))
+		panRoot := path.Clean("/" + strings.ReplaceAll(task.PanFolderPath, "\\", "/"))
+		if !strings.HasPrefix(absPath, panRoot+"/") {
+			continue
+		}
+		// 匹配最深的同步目录
+		if target == nil || len(panRoot) > len(path.Clean("/"+target.PanFolderPath)) {
+			target = task
+			target.DriveId = driveId
+			target.PanFolderPath = panRoot
+			targetPath = absPath
+		}
+	}
+	if target == nil {
+		return nil, "", fmt.Errorf("文件不属于任何备份任务: %s", panFilePath)
+	}
+	return target, targetPath, nil
+}
+
+// RunSyncVersionsList 列出云盘文件的历史版本
+func RunSyncVersionsList(panFilePath string) {
+	activeUser := GetActiveUser()
+	task, absPath, e := findSyncTaskByPanPath(activeUser, panFilePath)
+	if e != nil {
+		fmt.Println(e)
+		return
+	}
+	versions, e := syncdrive.ListPanFileVersions(activeUser.PanClient(), task.DriveId, task.PanFolderPath, absPath)
+	if e != nil {
+		fmt.Printf("获取历史版本失败: %s\n", e)
+		return
+	}
+	if len(versions) == 0 {
+		fmt.Println("没有历史版本")
+		return
+	}
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "版本", "文件大小", "版本时间"})
+	for k, v := range versions {
+		tb.Append([]string{strconv.Itoa(k + 1), strings.TrimSuffix(v.Name, path.Ext(v.Name)), converter.ConvertFileSize(v.File.FileSize, 2), v.VersionTime.Format("2006-01-02 15:04:05")})
+	}
+	tb.Render()
+}
+
+// RunSyncVersionsRestore 恢复云盘文件到指定的历史版本
+func RunSyncVersionsRestore(panFilePath, versionName string) {
+	activeUser := GetActiveUser()
+	task, absPath, e := findSyncTaskByPanPath(activeUser, panFilePath)
+	if e != nil {
+		fmt.Println(e)
+		return
+	}
+	panClient := activeUser.PanClient()
+	panClient.OpenapiPanClient().ClearCache()
+	panClient.OpenapiPanClient().DisableCache()
+	defer panClient.OpenapiPanClient().EnableCache()
+	if e = syncdrive.RestorePanFileVersion(panClient, task.DriveId, task.PanFolderPath, absPath, versionName, task.VersionPolicy); e != nil {
+		fmt.Printf("恢复历史版本失败: %s\n", e)
+		return
+	}
+	activeUser.DeleteCache([]string{path.Dir(absPath)})
+	fmt.Printf("成功恢复文件 %s 到版本 %s\n", absPath, versionName)
+}
+
 func RunSync(defaultTask *syncdrive.SyncTask, cycleMode syncdrive.CycleMode, fileDownloadParallel, fileUploadParallel int, downloadBlockSize, uploadBlockSize int64,
-	flag syncdrive.SyncPriorityOption, localDelayTime int, scanTimeInterval int64) {
+	flag syncdrive.SyncPriorityOption, localDelayTime int, scanTimeInterval int64) *TransferSummary {
+	summary := newTransferSummary(transferActionSync)
 	maxDownloadRate := config.Config.MaxDownloadRate
 	maxUploadRate := config.Config.MaxUploadRate
 	activeUser := GetActiveUser()
@@ -377,8 +567,7 @@ func RunSync(defaultTask *syncdrive.SyncTask, cycleMode syncdrive.CycleMode, fil
 		syncConfigFile, fileDownloadParallel, fileUploadParallel, converter.ConvertFileSize(downloadBlockSize, 2),
 		converter.ConvertFileSize(uploadBlockSize, 2))
 	if _, e := syncMgr.Start(tasks, cycleMode, scanTimeInterval); e != nil {
-		fmt.Println("启动任务失败：", e)
-		return
+		return summary.setError(errorf("启动任务失败：%s", e))
 	}
 
 	_, ok := os.LookupEnv("ALIYUNPAN_DOCKER")
@@ -432,4 +621,33 @@ func RunSync(defaultTask *syncdrive.SyncTask, cycleMode syncdrive.CycleMode, fil
 
 	// stop task
 	syncMgr.Stop()
+
+	// 统计本次同步的结果
+	results, e := syncMgr.GetSyncTaskResults(summary.startTime)
+	if e != nil {
+		return summary.setError(errorf("读取同步数据库失败: %s", e))
+	}
+	var totalSize int64
+	for _, result := range results {
+		for _, file := range result.Succeeded {
+			if file.Action == syncdrive.SyncFileActionUpload && file.LocalFile != nil {
+				totalSize += file.LocalFile.FileSize
+			} else if file.Action == syncdrive.SyncFileActionDownload && file.PanFile != nil {
+				totalSize += file.PanFile.FileSize
+			}
+		}
+		for _, file := range result.Failed {
+			filePath := ""
+			if file.Action == syncdrive.SyncFileActionUpload && file.LocalFile != nil {
+				filePath = file.LocalFile.Path
+			} else if file.PanFile != nil {
+				filePath = file.PanFile.Path
+			}
+			summary.addFailure(result.Task.Id, filePath, fmt.Errorf("%s %s", file.Action, file.Status))
+		}
+		summary.Succeeded += len(result.Succeeded)
+	}
+	summary.Total = summary.Succeeded + summary.Failed
+	summary.TotalSize = totalSize
+	return summary
 }
@@ -0,0 +1,557 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/syncdrive"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/urfave/cli"
+)
+
+// syncTaskStatusList 同步状态统计顺序
+var syncTaskStatusList = []struct {
+	status syncdrive.SyncFileStatus
+	label  string
+}{
+	{syncdrive.SyncFileStatusCreate, "等待同步"},
+	{syncdrive.SyncFileStatusUploading, "正在上传"},
+	{syncdrive.SyncFileStatusDownloading, "正在下载"},
+	{syncdrive.SyncFileStatusFailed, "同步失败"},
+	{syncdrive.SyncFileStatusSuccess, "同步成功"},
+	{syncdrive.SyncFileStatusIllegal, "非法文件"},
+	{syncdrive.SyncFileStatusNotExisted, "文件不存在"},
+}
+
+var syncTaskConfigFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "name",
+		Usage: "任务名称",
+	},
+	cli.StringFlag{
+		Name:  "drive",
+		Usage: "drive name, 网盘名称，backup(备份盘)，resource(资源盘)",
+	},
+	cli.StringFlag{
+		Name:  "ldir",
+		Usage: "local dir, 本地文件夹完整路径",
+	},
+	cli.StringFlag{
+		Name:  "pdir",
+		Usage: "pan dir, 云盘文件夹完整路径",
+	},
+	cli.StringFlag{
+		Name:  "mode",
+		Usage: "备份模式, 支持两种: upload(备份本地文件到云盘),download(备份云盘文件到本地)",
+	},
+	cli.StringFlag{
+		Name:  "policy",
+		Usage: "备份策略, 支持两种: exclusive(排他备份文件，目标目录多余的文件会被删除),increment(增量备份文件，目标目录多余的文件不会被删除)",
+	},
+	cli.StringFlag{
+		Name:  "filter",
+		Usage: "文件过滤规则，JSON格式，字段和配置文件的 filterRule 一致。设置为空字符串则清除过滤规则",
+	},
+	cli.StringFlag{
+		Name:  "version",
+		Usage: "历史版本保留策略，JSON格式，字段和配置文件的 versionPolicy 一致。设置为空字符串则不保留历史版本",
+	},
+	cli.StringFlag{
+		Name:  "schedule",
+		Usage: "同步计划，JSON格式，字段和配置文件的 schedule 一致。设置为空字符串则清除同步计划",
+	},
+}
+
+// syncTaskContext 同步任务管理上下文
+type syncTaskContext struct {
+	mgr       *syncdrive.SyncTaskManager
+	allTasks  []*syncdrive.SyncTask
+	userTasks []*syncdrive.SyncTask
+}
+
+// loadSyncTaskContext 读取同步任务配置，只有当前账号的任务可以被管理
+func loadSyncTaskContext(createIfNotExist bool) (*syncTaskContext, error) {
+	activeUser := GetActiveUser()
+	mgr := syncdrive.NewSyncTaskManager(activeUser, activeUser.PanClient(), config.GetSyncDriveDir(), syncdrive.SyncOption{})
+	var tasks []*syncdrive.SyncTask
+	var e error
+	if createIfNotExist {
+		tasks, e = mgr.LoadOrCreateSyncTaskList()
+	} else {
+		tasks, e = mgr.LoadSyncTaskList()
+	}
+	if e != nil {
+		return nil, e
+	}
+	ctx := &syncTaskContext{
+		mgr:       mgr,
+		allTasks:  tasks,
+		userTasks: []*syncdrive.SyncTask{},
+	}
+	for _, task := range tasks {
+		if task.UserId == "" || task.UserId == activeUser.UserId {
+			ctx.userTasks = append(ctx.userTasks, task)
+		}
+	}
+	return ctx, nil
+}
+
+// findTask 查找当前账号的同步任务
+func (sc *syncTaskContext) findTask(key string) (*syncdrive.SyncTask, error) {
+	if _, task := syncdrive.FindSyncTask(sc.userTasks, key); task != nil {
+		return task, nil
+	}
+	return nil, notFoundErrorf("备份任务不存在: %s", key)
+}
+
+// save 保存配置文件
+func (sc *syncTaskContext) save() error {
+	return sc.mgr.SaveSyncTaskList(sc.allTasks)
+}
+
+// applySyncTaskFlags 使用命令行参数修改任务配置，只修改设置了的参数
+func applySyncTaskFlags(c *cli.Context, task *syncdrive.SyncTask) error {
+	if c.IsSet("name") {
+		task.Name = c.String("name")
+	}
+	if c.IsSet("drive") {
+		task.DriveName = strings.ToLower(c.String("drive"))
+	}
+	if c.IsSet("ldir") {
+		task.LocalFolderPath = path.Clean(strings.ReplaceAll(c.String("ldir"), "\\", "/"))
+	}
+	if c.IsSet("pdir") {
+		task.PanFolderPath = c.String("pdir")
+	}
+	if c.IsSet("mode") {
+		task.Mode = syncdrive.SyncMode(strings.ToLower(c.String("mode")))
+	}
+	if c.IsSet("policy") {
+		task.Policy = syncdrive.SyncPolicy(strings.ToLower(c.String("policy")))
+	}
+	if c.IsSet("filter") {
+		task.FilterRule = nil
+		if c.String("filter") != "" {
+			rule := &syncdrive.SyncFilterRule{}
+			if e := json.Unmarshal([]byte(c.String("filter")), rule); e != nil {
+				return usageErrorf("过滤规则格式错误: %s", e)
+			}
+			task.FilterRule = rule
+		}
+	}
+	if c.IsSet("version") {
+		task.VersionPolicy = nil
+		if c.String("version") != "" {
+			policy := &syncdrive.SyncVersionPolicy{}
+			if e := json.Unmarshal([]byte(c.String("version")), policy); e != nil {
+				return usageErrorf("历史版本保留策略格式错误: %s", e)
+			}
+			task.VersionPolicy = policy
+		}
+	}
+	if c.IsSet("schedule") {
+		task.Schedule = nil
+		if c.String("schedule") != "" {
+			schedule := &syncdrive.SyncSchedule{}
+			if e := json.Unmarshal([]byte(c.String("schedule")), schedule); e != nil {
+				return usageErrorf("同步计划格式错误: %s", e)
+			}
+			task.Schedule = schedule
+		}
+	}
+	if e := syncdrive.CheckSyncTask(task); e != nil {
+		return usageErrorf("%s", e)
+	}
+	return nil
+}
+
+func syncCmdList() cli.Command {
+	return cli.Command{
+		Name:      "list",
+		Aliases:   []string{"ls"},
+		Usage:     "列出备份任务",
+		UsageText: cmder.App().Name + " sync list",
+		Description: `
+列出备份配置文件中当前账号的所有备份任务。任务序号、任务ID或者任务名称都可以作为其他任务管理命令的 <任务> 参数。
+`,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			return reportError(RunSyncTaskList())
+		},
+	}
+}
+
+func syncCmdStatus() cli.Command {
+	return cli.Command{
+		Name:      "status",
+		Usage:     "查看备份任务的同步状态",
+		UsageText: cmder.App().Name + " sync status <任务>",
+		Description: `
+查看备份任务各个状态的文件数量，并列出同步失败的文件。
+
+	例子:
+	1. 查看第1个备份任务的同步状态
+	aliyunpan sync status 1
+
+	2. 查看名称为"设计文档备份"的备份任务的同步状态
+	aliyunpan sync status 设计文档备份
+`,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			return reportError(RunSyncTaskStatus(c.Args().Get(0)))
+		},
+	}
+}
+
+func syncCmdAdd() cli.Command {
+	return cli.Command{
+		Name:      "add",
+		Usage:     "增加备份任务到配置文件",
+		UsageText: cmder.App().Name + " sync add [arguments...]",
+		Description: `
+增加一个备份任务到备份配置文件，使用 aliyunpan sync start 启动配置文件中的备份任务。
+
+	例子:
+	1. 增加备份任务，将本地目录 D:\tickstep\Documents\设计文档 备份上传到云盘目录 /sync_drive/我的文档
+	aliyunpan sync add -name "设计文档备份" -ldir "D:\tickstep\Documents\设计文档" -pdir "/sync_drive/我的文档" -mode "upload"
+
+	2. 增加备份任务，只备份pdf文件，并保留最近5个历史版本
+	aliyunpan sync add -name "设计文档备份" -ldir "D:\tickstep\Documents\设计文档" -pdir "/sync_drive/我的文档" -filter "{\"include\":[\"*.pdf\"]}" -version "{\"keepLast\":5}"
+`,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			sc, e := loadSyncTaskContext(true)
+			if e != nil {
+				return reportError(e)
+			}
+			task := &syncdrive.SyncTask{
+				Id:        utils.UuidStr(),
+				UserId:    GetActiveUser().UserId,
+				DriveName: "backup",
+				Mode:      syncdrive.Upload,
+				Policy:    syncdrive.SyncPolicyIncrement,
+			}
+			if e = applySyncTaskFlags(c, task); e != nil {
+				return reportError(e)
+			}
+			if _, existed := syncdrive.FindSyncTask(sc.userTasks, task.Name); existed != nil && existed.Name == task.Name {
+				return reportError(usageErrorf("备份任务名称已存在: %s", task.Name))
+			}
+			sc.allTasks = append(sc.allTasks, task)
+			if e = sc.save(); e != nil {
+				return reportError(errorf("保存备份配置文件失败: %s", e))
+			}
+			fmt.Println("成功增加备份任务")
+			fmt.Println(task)
+			return nil
+		},
+		Flags: syncTaskConfigFlags,
+	}
+}
+
+func syncCmdEdit() cli.Command {
+	return cli.Command{
+		Name:      "edit",
+		Usage:     "修改备份任务配置",
+		UsageText: cmder.App().Name + " sync edit [arguments...] <任务>",
+		Description: `
+修改备份任务的配置，只会修改指定了的参数。修改本地目录或者云盘目录后建议使用 aliyunpan sync reset 重建同步数据库。
+
+	例子:
+	1. 修改第1个备份任务的备份策略为排他备份
+	aliyunpan sync edit -policy exclusive 1
+
+	2. 清除第1个备份任务的过滤规则
+	aliyunpan sync edit -filter "" 1
+`,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			sc, e := loadSyncTaskContext(false)
+			if e != nil {
+				return reportError(e)
+			}
+			task, e := sc.findTask(c.Args().Get(0))
+			if e != nil {
+				return reportError(e)
+			}
+			if e = applySyncTaskFlags(c, task); e != nil {
+				return reportError(e)
+			}
+			if e = sc.save(); e != nil {
+				return reportError(errorf("保存备份配置文件失败: %s", e))
+			}
+			fmt.Println("成功修改备份任务")
+			fmt.Println(task)
+			return nil
+		},
+		Flags: syncTaskConfigFlags,
+	}
+}
+
+func syncCmdRemove() cli.Command {
+	return cli.Command{
+		Name:      "remove",
+		Aliases:   []string{"rm"},
+		Usage:     "从配置文件删除备份任务",
+		UsageText: cmder.App().Name + " sync remove <任务>",
+		Description: `
+从备份配置文件删除备份任务，并删除该任务的同步数据库。本地文件和云盘文件不会被删除。
+`,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			sc, e := loadSyncTaskContext(false)
+			if e != nil {
+				return reportError(e)
+			}
+			task, e := sc.findTask(c.Args().Get(0))
+			if e != nil {
+				return reportError(e)
+			}
+			tasks := []*syncdrive.SyncTask{}
+			for _, t := range sc.allTasks {
+				if t != task {
+					tasks = append(tasks, t)
+				}
+			}
+			sc.allTasks = tasks
+			if e = sc.save(); e != nil {
+				return reportError(errorf("保存备份配置文件失败: %s", e))
+			}
+			if e = sc.mgr.ResetSyncTaskDb(task); e != nil {
+				fmt.Printf("删除同步数据库失败: %s\n", e)
+			}
+			fmt.Printf("成功删除备份任务: %s\n", task.NameLabel())
+			return nil
+		},
+	}
+}
+
+func syncCmdPause(pause bool) cli.Command {
+	name, usage := "pause", "暂停备份任务，暂停的任务不会被 sync start 启动"
+	if !pause {
+		name, usage = "resume", "恢复已暂停的备份任务"
+	}
+	return cli.Command{
+		Name:      name,
+		Usage:     usage,
+		UsageText: cmder.App().Name + " sync " + name + " <任务>",
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			sc, e := loadSyncTaskContext(false)
+			if e != nil {
+				return reportError(e)
+			}
+			task, e := sc.findTask(c.Args().Get(0))
+			if e != nil {
+				return reportError(e)
+			}
+			task.Paused = pause
+			if e = sc.save(); e != nil {
+				return reportError(errorf("保存备份配置文件失败: %s", e))
+			}
+			if pause {
+				fmt.Printf("成功暂停备份任务: %s，正在运行的同步进程需要重启后生效\n", task.NameLabel())
+			} else {
+				fmt.Printf("成功恢复备份任务: %s\n", task.NameLabel())
+			}
+			return nil
+		},
+	}
+}
+
+func syncCmdReset() cli.Command {
+	return cli.Command{
+		Name:      "reset",
+		Usage:     "重建备份任务的同步数据库",
+		UsageText: cmder.App().Name + " sync reset <任务>",
+		Description: `
+删除备份任务的同步数据库，下次启动任务时会重新扫描本地和云盘文件并重建数据库。请先停止正在运行的同步进程再执行该命令。
+`,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			sc, e := loadSyncTaskContext(false)
+			if e != nil {
+				return reportError(e)
+			}
+			task, e := sc.findTask(c.Args().Get(0))
+			if e != nil {
+				return reportError(e)
+			}
+			if e = sc.mgr.ResetSyncTaskDb(task); e != nil {
+				return reportError(errorf("删除同步数据库失败: %s", e))
+			}
+			fmt.Printf("成功重置备份任务: %s，下次启动时会重建同步数据库\n", task.NameLabel())
+			return nil
+		},
+	}
+}
+
+func syncCmdRetryFailed() cli.Command {
+	return cli.Command{
+		Name:      "retry-failed",
+		Usage:     "重新同步失败的文件",
+		UsageText: cmder.App().Name + " sync retry-failed [<任务>]",
+		Description: `
+将同步失败的文件重新加入同步队列，不指定任务则处理当前账号的所有备份任务。
+`,
+		Action: func(c *cli.Context) error {
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			sc, e := loadSyncTaskContext(false)
+			if e != nil {
+				return reportError(e)
+			}
+			tasks := sc.userTasks
+			if c.NArg() > 0 {
+				task, e := sc.findTask(c.Args().Get(0))
+				if e != nil {
+					return reportError(e)
+				}
+				tasks = []*syncdrive.SyncTask{task}
+			}
+			failedCount := 0
+			for _, task := range tasks {
+				count, e := sc.mgr.RetryFailedSyncFiles(task)
+				if e != nil {
+					failedCount++
+					fmt.Printf("备份任务 %s 重试失败: %s\n", task.NameLabel(), e)
+					continue
+				}
+				fmt.Printf("备份任务 %s 重新加入同步队列的文件数量: %d\n", task.NameLabel(), count)
+			}
+			if failedCount > 0 {
+				if failedCount < len(tasks) {
+					return reportError(newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分备份任务重试失败"))
+				}
+				return reportError(errorf("备份任务重试失败"))
+			}
+			return nil
+		},
+	}
+}
+
+// RunSyncTaskList 列出备份任务
+func RunSyncTaskList() error {
+	sc, e := loadSyncTaskContext(false)
+	if e != nil {
+		return e
+	}
+	if len(sc.userTasks) == 0 {
+		fmt.Println("没有备份任务")
+		return nil
+	}
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "任务ID", "名称", "模式", "策略", "本地目录", "云盘目录", "状态", "上次同步时间"})
+	for k, task := range sc.userTasks {
+		state := "正常"
+		if task.Paused {
+			state = "暂停"
+		}
+		tb.Append([]string{strconv.Itoa(k + 1), task.Id, task.Name, string(task.Mode), string(task.Policy),
+			task.LocalFolderPath, task.PanFolderPath, state, task.LastSyncTime})
+	}
+	tb.Render()
+	return nil
+}
+
+// RunSyncTaskStatus 查看备份任务的同步状态
+func RunSyncTaskStatus(key string) error {
+	sc, e := loadSyncTaskContext(false)
+	if e != nil {
+		return e
+	}
+	task, e := sc.findTask(key)
+	if e != nil {
+		return e
+	}
+	fmt.Print(task)
+	fmt.Printf("上次同步时间: %s\n", task.LastSyncTime)
+
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"状态", "文件数量"})
+	var failedFiles syncdrive.SyncFileList
+	for _, s := range syncTaskStatusList {
+		files, e := sc.mgr.GetSyncFileList(task, s.status)
+		if e != nil {
+			return errorf("读取同步数据库失败: %s", e)
+		}
+		if s.status == syncdrive.SyncFileStatusFailed {
+			failedFiles = files
+		}
+		tb.Append([]string{s.label, strconv.Itoa(len(files))})
+	}
+	tb.Render()
+
+	if len(failedFiles) > 0 {
+		fmt.Println("同步失败的文件: ")
+		ftb := cmdtable.NewTable(os.Stdout)
+		ftb.SetHeader([]string{"#", "动作", "文件", "时间"})
+		for k, file := range failedFiles {
+			filePath := ""
+			if file.Action == syncdrive.SyncFileActionUpload && file.LocalFile != nil {
+				filePath = file.LocalFile.Path
+			} else if file.PanFile != nil {
+				filePath = file.PanFile.Path
+			}
+			ftb.Append([]string{strconv.Itoa(k + 1), string(file.Action), filePath, file.StatusUpdateTime})
+		}
+		ftb.Render()
+		fmt.Println("可以使用 aliyunpan sync retry-failed 重新同步失败的文件")
+	}
+	return nil
+}
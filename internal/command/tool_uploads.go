@@ -0,0 +1,169 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/functions/panupload"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/converter"
+	"github.com/urfave/cli"
+)
+
+type (
+	// UploadingOutput 未完成上传的记录输出格式，tool uploads list 命令使用
+	UploadingOutput struct {
+		Path      string `json:"path"`
+		Size      int64  `json:"size"`
+		ModTime   string `json:"modTime"`
+		Uploaded  int64  `json:"uploaded"`
+		DriveId   string `json:"driveId"`
+		FileId    string `json:"fileId"`
+		UpdatedAt string `json:"updatedAt"`
+	}
+
+	// UploadsCleanOutput 清理结果输出格式，tool uploads clean 命令使用
+	UploadsCleanOutput struct {
+		Count int `json:"count"`
+	}
+)
+
+// cmdToolUploads tool uploads 子命令，管理未完成上传的断点续传记录
+func cmdToolUploads() cli.Command {
+	return cli.Command{
+		Name:      "uploads",
+		Usage:     "管理未完成上传的记录",
+		UsageText: cmder.App().Name + " tool uploads <list|clean>",
+		Description: `
+	上传文件中断后, 断点续传的记录保存在配置目录下的上传数据库中, 再次上传相同的文件时从中断的位置继续上传.
+	超过7天没有更新, 本地文件已经删除或者修改的记录会在上传时自动清理, 也可以使用 clean 手动清理.
+
+	示例:
+
+	列出所有未完成上传的记录
+	aliyunpan tool uploads list
+
+	清理无效的记录
+	aliyunpan tool uploads clean
+
+	清理全部记录, 所有文件都需要重新上传
+	aliyunpan tool uploads clean -all
+`,
+		Action: func(c *cli.Context) error {
+			cli.ShowCommandHelp(c, c.Command.Name)
+			return nil
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "list",
+				Usage:     "列出未完成上传的记录",
+				UsageText: cmder.App().Name + " tool uploads list",
+				Action: func(c *cli.Context) error {
+					return reportError(RunUploadsList())
+				},
+			},
+			{
+				Name:      "clean",
+				Usage:     "清理未完成上传的记录",
+				UsageText: cmder.App().Name + " tool uploads clean [-all]",
+				Action: func(c *cli.Context) error {
+					return reportError(RunUploadsClean(c.Bool("all")))
+				},
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "all",
+						Usage: "清理全部记录, 默认只清理过期以及本地文件已经删除或者修改的记录",
+					},
+				},
+			},
+		},
+	}
+}
+
+// newUploadingOutput 转换未完成上传的记录
+func newUploadingOutput(uploading *panupload.Uploading) *UploadingOutput {
+	o := &UploadingOutput{
+		Path:      uploading.Path.LogicPath,
+		Size:      uploading.Length,
+		ModTime:   utils.UnixTime2LocalFormatStr(uploading.ModTime),
+		UpdatedAt: utils.UnixTime2LocalFormatStr(uploading.UpdatedAt),
+	}
+	if uploading.UploadOpEntity != nil {
+		o.DriveId = uploading.UploadOpEntity.DriveId
+		o.FileId = uploading.UploadOpEntity.FileId
+	}
+	if uploading.State != nil {
+		for _, block := range uploading.State.BlockList {
+			if block.UploadDone {
+				o.Uploaded += block.Range.End - block.Range.Begin
+			}
+		}
+	}
+	return o
+}
+
+// RunUploadsList 列出未完成上传的记录
+func RunUploadsList() error {
+	uploadDatabase, err := panupload.NewUploadingDatabase()
+	if err != nil {
+		return errorf("打开上传未完成数据库错误: %s", err)
+	}
+	defer uploadDatabase.Close()
+
+	list, err := uploadDatabase.List()
+	if err != nil {
+		return errorf("读取上传未完成数据库错误: %s", err)
+	}
+	items := []*UploadingOutput{}
+	for _, uploading := range list {
+		items = append(items, newUploadingOutput(uploading))
+	}
+	if IsMachineOutput() {
+		return writeOutput(items)
+	}
+
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "已上传", "文件大小", "更新时间", "文件路径"})
+	for k, item := range items {
+		tb.Append([]string{strconv.Itoa(k + 1), converter.ConvertFileSize(item.Uploaded, 2),
+			converter.ConvertFileSize(item.Size, 2), item.UpdatedAt, item.Path})
+	}
+	tb.Render()
+	fmt.Printf("\n未完成上传的文件: %d\n", len(items))
+	return nil
+}
+
+// RunUploadsClean 清理未完成上传的记录
+func RunUploadsClean(all bool) error {
+	uploadDatabase, err := panupload.NewUploadingDatabase()
+	if err != nil {
+		return errorf("打开上传未完成数据库错误: %s", err)
+	}
+	defer uploadDatabase.Close()
+
+	count, err := uploadDatabase.Clean(all)
+	if err != nil {
+		return errorf("清理上传未完成数据库错误: %s", err)
+	}
+	if IsMachineOutput() {
+		return writeOutput(&UploadsCleanOutput{Count: count})
+	}
+	fmt.Printf("已清理 %d 条记录\n", count)
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+const (
+	transferActionUpload   = "upload"
+	transferActionDownload = "download"
+	transferActionSync     = "sync"
+)
+
+type (
+	// TransferFailure 处理失败的文件
+	TransferFailure struct {
+		// TaskId 任务ID，和命令输出日志中的 [ID] 一致
+		TaskId string `json:"taskId,omitempty"`
+		// Path 文件路径
+		Path string `json:"path"`
+		// Code 错误类型，和 OutputError 的 Code 一致
+		Code    string `json:"code"`
+		ApiCode int    `json:"apiCode,omitempty"`
+		Message string `json:"message"`
+	}
+
+	// TransferSummary 上传、下载、同步的执行结果汇总，机器可读输出时在最后以一行JSON输出
+	TransferSummary struct {
+		// Action 操作：upload, download, sync
+		Action string `json:"action"`
+		// Total 文件总数
+		Total     int `json:"total"`
+		Succeeded int `json:"succeeded"`
+		Failed    int `json:"failed"`
+		// TotalSize 传输的数据总量
+		TotalSize int64 `json:"totalSize"`
+		// ElapsedMs 耗时，毫秒
+		ElapsedMs int64 `json:"elapsedMs"`
+		// ExitCode 进程退出码
+		ExitCode int                `json:"exitCode"`
+		Failures []*TransferFailure `json:"failures"`
+		// Error 任务无法执行的错误，例如参数错误
+		Error *OutputError `json:"error,omitempty"`
+
+		startTime   time.Time
+		failedTasks int
+	}
+)
+
+func newTransferSummary(action string) *TransferSummary {
+	return &TransferSummary{
+		Action:    action,
+		Failures:  []*TransferFailure{},
+		startTime: time.Now(),
+	}
+}
+
+// setError 设置任务无法执行的错误
+func (s *TransferSummary) setError(err error) *TransferSummary {
+	s.Error = apiOutputError(err, "")
+	return s
+}
+
+// addFailure 记录处理失败的文件
+func (s *TransferSummary) addFailure(taskId, filePath string, err error) {
+	f := &TransferFailure{
+		TaskId: taskId,
+		Path:   filePath,
+		Code:   errCodeError,
+	}
+	if err != nil {
+		oe := apiOutputError(err, "")
+		f.Code, f.ApiCode, f.Message = oe.Code, oe.ApiCode, oe.Message
+	}
+	s.Failures = append(s.Failures, f)
+	s.Failed++
+}
+
+// addFailedTask 记录执行失败的任务
+func (s *TransferSummary) addFailedTask(item *taskframework.TaskInfoItem, filePath string) {
+	var err error
+	if item.Result != nil {
+		switch {
+		case item.Result.Err != nil && item.Result.ResultMessage != "":
+			err = fmt.Errorf("%s, %w", item.Result.ResultMessage, item.Result.Err)
+		case item.Result.Err != nil:
+			err = item.Result.Err
+		case item.Result.ResultMessage != "":
+			err = fmt.Errorf("%s", item.Result.ResultMessage)
+		}
+	}
+	s.addFailure(item.Info.Id(), filePath, err)
+	s.failedTasks++
+}
+
+// finish 统计执行结果，taskCount 为执行的任务总数
+func (s *TransferSummary) finish(taskCount int, totalSize int64) {
+	s.Succeeded = taskCount - s.failedTasks
+	if s.Succeeded < 0 {
+		s.Succeeded = 0
+	}
+	s.Total = s.Succeeded + s.Failed
+	s.TotalSize = totalSize
+}
+
+// exitCode 计算进程退出码：全部成功为0，部分失败为 ExitCodePartialFailure，
+// 全部失败时如果失败原因相同则使用对应错误的退出码
+func (s *TransferSummary) exitCode() int {
+	if s.Error != nil {
+		return s.Error.exitCode
+	}
+	if s.Failed == 0 {
+		return ExitCodeSuccess
+	}
+	if s.Succeeded > 0 {
+		return ExitCodePartialFailure
+	}
+	code := ""
+	for _, f := range s.Failures {
+		if code != "" && code != f.Code {
+			return ExitCodeError
+		}
+		code = f.Code
+	}
+	switch code {
+	case errCodeNotFound:
+		return ExitCodeNotFound
+	case errCodeNotLoggedIn:
+		return ExitCodeNotLoggedIn
+	case errCodeRateLimited:
+		return ExitCodeRateLimited
+	case errCodeChecksumMismatch:
+		return ExitCodeChecksumMismatch
+	}
+	return ExitCodeError
+}
+
+// report 输出执行结果汇总并返回命令的退出错误。机器可读输出时汇总以一行JSON输出在最后，表格输出只打印任务无法执行的错误
+func (s *TransferSummary) report() error {
+	s.ElapsedMs = time.Since(s.startTime).Milliseconds()
+	s.ExitCode = s.exitCode()
+	if IsMachineOutput() {
+		data, _ := json.Marshal(s)
+		fmt.Fprintln(outputWriter, string(data))
+	} else if s.Error != nil {
+		fmt.Println(s.Error.Message)
+	}
+	return exitError(s.ExitCode)
+}
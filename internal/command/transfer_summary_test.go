@@ -0,0 +1,80 @@
+package command
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/functions/pandownload"
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+func TestTransferSummaryExitCode(t *testing.T) {
+	s := newTransferSummary(transferActionDownload)
+	s.finish(3, 100)
+	if s.exitCode() != ExitCodeSuccess || s.Total != 3 || s.Succeeded != 3 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+
+	// 部分失败
+	s = newTransferSummary(transferActionDownload)
+	s.addFailure("", "/a.txt", notFoundErrorf("文件不存在: /a.txt"))
+	s.finish(2, 0)
+	if s.exitCode() != ExitCodePartialFailure || s.Total != 3 || s.Failed != 1 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+
+	// 全部失败，原因相同
+	s = newTransferSummary(transferActionUpload)
+	s.addFailure("", "/a.txt", notFoundErrorf("文件不存在: /a.txt"))
+	s.addFailure("", "/b.txt", apierror.NewApiError(apierror.ApiCodeFileNotFoundCode, "file not found"))
+	s.finish(0, 0)
+	if s.exitCode() != ExitCodeNotFound {
+		t.Errorf("expected not found exit code, got %d", s.exitCode())
+	}
+
+	// 全部失败，原因不同
+	s.addFailure("", "/c.txt", fmt.Errorf("network error"))
+	if s.exitCode() != ExitCodeError {
+		t.Errorf("expected error exit code, got %d", s.exitCode())
+	}
+
+	// 无法执行
+	s = newTransferSummary(transferActionUpload).setError(usageErrorf("本地路径为空"))
+	if s.exitCode() != ExitCodeUsage {
+		t.Errorf("expected usage exit code, got %d", s.exitCode())
+	}
+}
+
+func TestTransferSummaryFailedTask(t *testing.T) {
+	info := &taskframework.TaskInfo{}
+	s := newTransferSummary(transferActionDownload)
+	s.addFailedTask(&taskframework.TaskInfoItem{
+		Info: info,
+		Result: &taskframework.TaskUnitRunResult{
+			ResultMessage: pandownload.StrDownloadChecksumFailed,
+			Err:           pandownload.ErrDownloadChecksumFailed,
+		},
+	}, "/a.mp4")
+	s.addFailedTask(&taskframework.TaskInfoItem{
+		Info: info,
+		Result: &taskframework.TaskUnitRunResult{
+			ResultMessage: "获取下载路径信息错误",
+			Err:           apierror.NewApiError(apierror.ApiCodeTooManyRequests, "too many requests"),
+		},
+	}, "/b.mp4")
+	s.finish(2, 0)
+	if s.Succeeded != 0 || s.Failed != 2 {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+	if f := s.Failures[0]; f.Code != errCodeChecksumMismatch || f.Path != "/a.mp4" {
+		t.Errorf("unexpected failure: %+v", f)
+	}
+	// 包装后的接口错误码需要保留
+	if f := s.Failures[1]; f.Code != errCodeRateLimited || f.ApiCode != int(apierror.ApiCodeTooManyRequests) {
+		t.Errorf("unexpected failure: %+v", f)
+	}
+	if s.exitCode() != ExitCodeError {
+		t.Errorf("expected error exit code, got %d", s.exitCode())
+	}
+}
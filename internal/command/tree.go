@@ -43,8 +43,7 @@ func CmdTree() cli.Command {
 		Before:   ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
 			minSize := int64(0)
 			if c.IsSet("minSize") {
@@ -58,8 +57,7 @@ func CmdTree() cli.Command {
 					maxSize = s
 				}
 			}
-			RunTree(parseDriveId(c), c.Args().Get(0), c.Bool("fp"), c.Bool("fs"), minSize, maxSize)
-			return nil
+			return reportError(RunTree(parseDriveId(c), c.Args().Get(0), c.Bool("fp"), c.Bool("fs"), minSize, maxSize))
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -105,10 +103,12 @@ type (
 		showFileSize bool
 		minFileSize  int64
 		maxFileSize  int64
+		// outputFiles 机器可读输出时收集文件列表，不打印树形图
+		outputFiles *[]*TreeFileOutput
 	}
 )
 
-func getTree(driveId, pathStr string, depth int, statistic *treeStatistic, setting *treeConfig) {
+func getTree(driveId, pathStr string, depth int, statistic *treeStatistic, setting *treeConfig) error {
 	activeUser := config.Config.ActiveUser()
 	pathStr = activeUser.PathJoin(driveId, pathStr)
 	pathStr = path.Clean(pathStr)
@@ -116,8 +116,7 @@ func getTree(driveId, pathStr string, depth int, statistic *treeStatistic, setti
 	// 获取目标路径文件信息
 	targetPathInfo, err := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, pathStr)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return apiOutputError(err, "")
 	}
 
 	// 适配通配符路径获取目标文件信息（弃用，容易触发风控）
@@ -139,11 +138,10 @@ func getTree(driveId, pathStr string, depth int, statistic *treeStatistic, setti
 	//}
 
 	if targetPathInfo == nil {
-		fmt.Println("路径不存在")
-		return
+		return notFoundErrorf("路径不存在")
 	}
 
-	if depth == 0 {
+	if depth == 0 && setting.outputFiles == nil {
 		fmt.Printf("%s\n", targetPathInfo.Path)
 	}
 
@@ -156,8 +154,7 @@ func getTree(driveId, pathStr string, depth int, statistic *treeStatistic, setti
 	if targetPathInfo.IsFolder() {
 		fileResult, err := activeUser.PanClient().OpenapiPanClient().FileListGetAll(fileListParam, 500)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return apiOutputError(err, "")
 		}
 		fileList = append(fileList, fileResult...)
 	} else {
@@ -172,12 +169,22 @@ func getTree(driveId, pathStr string, depth int, statistic *treeStatistic, setti
 	for i, file := range fileList {
 		if file.IsFolder() {
 			statistic.CountOfDir += 1
-			if setting.showFullPath {
+			if setting.outputFiles != nil {
+				*setting.outputFiles = append(*setting.outputFiles, &TreeFileOutput{
+					Depth:      depth,
+					FileOutput: *newFileOutput(file, targetPathInfo.Path),
+				})
+			} else if setting.showFullPath {
 				fmt.Printf("%v%v %v/ -> %s\n", indentPrefixStr, pathPrefix, file.FileName, targetPathInfo.Path+"/"+file.FileName)
 			} else {
 				fmt.Printf("%v%v %v/\n", indentPrefixStr, pathPrefix, file.FileName)
 			}
-			getTree(driveId, targetPathInfo.Path+"/"+file.FileName, depth+1, statistic, setting)
+			if e := getTree(driveId, targetPathInfo.Path+"/"+file.FileName, depth+1, statistic, setting); e != nil {
+				if setting.outputFiles != nil {
+					return e
+				}
+				fmt.Println(e)
+			}
 			continue
 		}
 
@@ -196,6 +203,14 @@ func getTree(driveId, pathStr string, depth int, statistic *treeStatistic, setti
 		statistic.CountOfFile += 1
 		statistic.SizeOfFile += file.FileSize
 
+		if setting.outputFiles != nil {
+			*setting.outputFiles = append(*setting.outputFiles, &TreeFileOutput{
+				Depth:      depth,
+				FileOutput: *newFileOutput(file, targetPathInfo.Path),
+			})
+			continue
+		}
+
 		if i+1 == fN {
 			prefix = lastFilePrefix
 		}
@@ -216,11 +231,11 @@ func getTree(driveId, pathStr string, depth int, statistic *treeStatistic, setti
 		}
 	}
 
-	return
+	return nil
 }
 
 // RunTree 列出树形图
-func RunTree(driveId, pathStr string, showFullPath, showFileSize bool, minSize, maxSize int64) {
+func RunTree(driveId, pathStr string, showFullPath, showFileSize bool, minSize, maxSize int64) error {
 	activeUser := config.Config.ActiveUser()
 	activeUser.PanClient().OpenapiPanClient().ClearCache()
 	activeUser.PanClient().OpenapiPanClient().EnableCache()
@@ -237,6 +252,17 @@ func RunTree(driveId, pathStr string, showFullPath, showFileSize bool, minSize,
 		minFileSize:  minSize,
 		maxFileSize:  maxSize,
 	}
-	getTree(driveId, pathStr, 0, statistic, setting)
+	if IsMachineOutput() {
+		files := []*TreeFileOutput{}
+		setting.outputFiles = &files
+		if e := getTree(driveId, pathStr, 0, statistic, setting); e != nil {
+			return e
+		}
+		return writeOutput(files)
+	}
+	if e := getTree(driveId, pathStr, 0, statistic, setting); e != nil {
+		return e
+	}
 	fmt.Printf("\n%d 个文件夹, %d 个文件, %s 总大小\n", statistic.CountOfDir, statistic.CountOfFile, converter.ConvertFileSize(statistic.SizeOfFile, 2))
+	return nil
 }
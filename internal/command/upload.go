@@ -49,6 +49,10 @@ import (
 const (
 	// DefaultUploadMaxAllParallel 默认所有文件并发上传数量，即可以同时并发上传多少个文件
 	DefaultUploadMaxAllParallel = 1
+
+	// MaxUploadSliceParallel 单个文件最多同时上传的分片数量
+	MaxUploadSliceParallel = 5
+
 	// DefaultUploadMaxRetry 默认上传失败最大重试次数
 	DefaultUploadMaxRetry = 3
 )
@@ -77,6 +81,11 @@ var UploadFlags = []cli.Flag{
 		Usage: "本次操作文件上传并发数量，即可以同时并发上传多少个文件。0代表跟从配置文件设置（取值范围:1 ~ 20）",
 		Value: 0,
 	},
+	cli.IntFlag{
+		Name:  "sp",
+		Usage: "slice parallel，指定单个文件同时上传的分片数量，服务器不支持乱序上传分片时自动退回按顺序逐个上传（取值范围:1 ~ 5）",
+		Value: 1,
+	},
 	cli.IntFlag{
 		Name:  "retry",
 		Usage: "上传失败最大重试次数",
@@ -198,9 +207,9 @@ func CmdUpload() cli.Command {
 			//	return nil
 			//}
 
-			RunUpload(subArgs[:c.NArg()-1], subArgs[c.NArg()-1], &UploadOptions{
-				AllParallel:      c.Int("p"), // 多文件上传的时候，允许同时并行上传的文件数量
-				Parallel:         1,          // 一个文件同时多少个线程并发上传的数量。阿里云盘只支持单线程按顺序进行文件part数据上传，所以只能是1
+			summary := RunUpload(subArgs[:c.NArg()-1], subArgs[c.NArg()-1], &UploadOptions{
+				AllParallel:      c.Int("p"),  // 多文件上传的时候，允许同时并行上传的文件数量
+				Parallel:         c.Int("sp"), // 一个文件同时多少个分片并发上传的数量
 				MaxRetry:         c.Int("retry"),
 				MaxTimeoutSec:    timeout,
 				NoRapidUpload:    c.Bool("norapid"),
@@ -217,14 +226,15 @@ func CmdUpload() cli.Command {
 			//if locker != nil {
 			//	filelocker.UnlockFile(locker)
 			//}
-			return nil
+			return summary.report()
 		},
 		Flags: UploadFlags,
 	}
 }
 
 // RunUpload 执行文件上传
-func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
+func RunUpload(localPaths []string, savePath string, opt *UploadOptions) *TransferSummary {
+	summary := newTransferSummary(transferActionUpload)
 	activeUser := GetActiveUser()
 	activeUser.PanClient().OpenapiPanClient().EnableCache()
 	activeUser.PanClient().OpenapiPanClient().ClearCache()
@@ -248,6 +258,9 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 	if opt.Parallel <= 0 {
 		opt.Parallel = 1
 	}
+	if opt.Parallel > MaxUploadSliceParallel {
+		opt.Parallel = MaxUploadSliceParallel
+	}
 	if opt.MaxRetry < 0 {
 		opt.MaxRetry = DefaultUploadMaxRetry
 	}
@@ -258,7 +271,7 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 	}
 
 	targetDriveName := config.Config.ActiveUser().DriveList.GetDriveNameById(opt.DriveId)
-	fmt.Printf("\n[0] 当前文件上传最大并发量为: %d, 上传分片大小为: %s, 目标网盘: %s\n", opt.AllParallel, converter.ConvertFileSize(opt.BlockSize, 2), targetDriveName)
+	fmt.Printf("\n[0] 当前文件上传最大并发量为: %d, 单文件分片并发量为: %d, 上传分片大小为: %s, 目标网盘: %s\n", opt.AllParallel, opt.Parallel, converter.ConvertFileSize(opt.BlockSize, 2), targetDriveName)
 
 	savePath = activeUser.PathJoin(opt.DriveId, savePath)
 	_, err1 := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(opt.DriveId, savePath)
@@ -268,17 +281,19 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 
 	switch len(localPaths) {
 	case 0:
-		fmt.Printf("本地路径为空\n")
-		return
+		return summary.setError(usageErrorf("本地路径为空"))
 	}
 
 	// 打开上传状态数据库
 	uploadDatabase, err := panupload.NewUploadingDatabase()
 	if err != nil {
-		fmt.Printf("打开上传未完成数据库错误: %s\n", err)
-		return
+		return summary.setError(errorf("打开上传未完成数据库错误: %s", err))
 	}
 	defer uploadDatabase.Close()
+	// 清理过期以及本地文件已经修改的记录
+	if _, err = uploadDatabase.Clean(false); err != nil {
+		return summary.setError(errorf("清理上传未完成数据库错误: %s", err))
+	}
 
 	var (
 		// 使用 task framework
@@ -340,8 +355,18 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 
 		walkFunc = func(file localfile.SymlinkFile, fi os.FileInfo, err error) error {
 			if err != nil {
-				// skip this error file and continue recurse
+				// 记录失败的文件，继续处理其他文件
 				logger.Verboseln("upload process file: ", file, " error: ", err)
+				failedPath := file.LogicPath
+				if failedPath == "" {
+					failedPath = curPath
+				}
+				if os.IsNotExist(err) {
+					summary.addFailure("", failedPath, notFoundErrorf("本地文件不存在: %s", failedPath))
+				} else {
+					summary.addFailure("", failedPath, errorf("读取本地文件失败: %s, %s", failedPath, err))
+				}
+				logf("读取本地文件失败: %s, %s\n", failedPath, err)
 				return nil
 			}
 			if os.PathSeparator == '\\' {
@@ -453,6 +478,7 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 		dashboard.Start()
 	}
 
+	taskCount := executor.Count()
 	executor.Execute()
 	failed := executor.FailedDeque()
 	if failed.Size() > 0 {
@@ -475,9 +501,12 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 			for e := failed.Shift(); e != nil; e = failed.Shift() {
 				item := e.(*taskframework.TaskInfoItem)
 				tb.Append([]string{item.Info.Id(), item.Unit.(*panupload.UploadTaskUnit).LocalFileChecksum.Path.LogicPath})
+				summary.addFailedTask(item, item.Unit.(*panupload.UploadTaskUnit).LocalFileChecksum.Path.LogicPath)
 			}
 			tb.Render()
 		}
 	}
 	activeUser.DeleteCache(GetAllPathFolderByPath(savePath))
+	summary.finish(taskCount, statistic.TotalSize())
+	return summary
 }
@@ -18,7 +18,6 @@ import (
 	"github.com/tickstep/aliyunpan/cmder"
 	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/urfave/cli"
-	"os"
 	"strconv"
 )
 
@@ -30,6 +29,20 @@ func CmdLoglist() cli.Command {
 		Category:    "阿里云盘账号",
 		Before:      ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
+			if IsMachineOutput() {
+				activeUser := config.Config.ActiveUser()
+				accounts := []*AccountOutput{}
+				for k, u := range config.Config.UserList {
+					accounts = append(accounts, &AccountOutput{
+						Index:       k + 1,
+						UserId:      u.UserId,
+						AccountName: u.AccountName,
+						Nickname:    u.Nickname,
+						Active:      activeUser != nil && activeUser.UserId == u.UserId,
+					})
+				}
+				return reportError(writeOutput(accounts))
+			}
 			fmt.Println(config.Config.UserList.String())
 			return nil
 		},
@@ -124,12 +137,25 @@ func CmdWho() cli.Command {
 		Before:      ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				os.Exit(1)
+				return reportError(notLoggedInError())
 			}
 			activeUser := config.Config.ActiveUser()
 			cloudName := activeUser.GetDriveById(activeUser.ActiveDriveId).DriveName
-			user, _ := GetActivePanClient().OpenapiPanClient().GetUserInfo()
+			user, err := GetActivePanClient().OpenapiPanClient().GetUserInfo()
+			if err != nil {
+				return reportError(apiOutputError(err, "获取帐号信息失败: "))
+			}
+			if IsMachineOutput() {
+				return reportError(writeOutput(&UserOutput{
+					UserId:              activeUser.UserId,
+					Nickname:            activeUser.Nickname,
+					AccountName:         activeUser.AccountName,
+					ThirdPartyVip:       user.ThirdPartyVip,
+					ThirdPartyVipExpire: user.ThirdPartyVipExpire,
+					ActiveDriveId:       activeUser.ActiveDriveId,
+					ActiveDriveName:     cloudName,
+				}))
+			}
 			thirdParty := "未开通"
 			if user.ThirdPartyVip {
 				thirdParty = "已开通(" + user.ThirdPartyVipExpire + ")"
@@ -0,0 +1,565 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions/pandownload"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/requester"
+	"github.com/urfave/cli"
+)
+
+const (
+	verifyStatusOk          = "ok"
+	verifyStatusMismatch    = "mismatch"
+	verifyStatusMissing     = "missing"
+	verifyStatusUnsupported = "unsupported"
+	verifyStatusError       = "error"
+
+	verifyReasonSize = "size"
+	verifyReasonHash = "hash"
+
+	// verifyStateFilePrefix 校验进度文件名称前缀，位于配置目录下
+	verifyStateFilePrefix = "verify_state_"
+	// defaultVerifySample 只校验云盘文件时默认抽样的文件数量
+	defaultVerifySample = 20
+)
+
+type (
+	// VerifyOptions 校验选项
+	VerifyOptions struct {
+		// PanOnly 只校验云盘文件，重新读取云盘文件内容并和云盘记录的哈希值对比
+		PanOnly bool
+		// Sample 只校验云盘文件时抽样的文件数量，0表示全部
+		Sample int
+		// Parallel 同时校验的文件数量
+		Parallel int
+		// ReportFile 校验失败的云盘文件路径列表保存的文件，每行一个
+		ReportFile string
+		// Restart 忽略上次未完成的校验进度，重新开始
+		Restart bool
+		// ShowAll 输出全部文件的校验结果，默认只输出校验失败的文件
+		ShowAll bool
+	}
+
+	// VerifyOutput 文件校验结果输出格式，verify 命令使用
+	VerifyOutput struct {
+		// Status 校验结果：ok-一致，mismatch-不一致，missing-本地文件不存在，unsupported-云盘没有记录哈希值，error-读取文件失败
+		Status string `json:"status"`
+		// Path 云盘文件路径
+		Path      string `json:"path"`
+		LocalPath string `json:"localPath"`
+		Size      int64  `json:"size"`
+		// Reason 不一致的原因：size, hash。读取失败时为错误信息
+		Reason string `json:"reason"`
+	}
+
+	// verifyFunc 校验单个云盘文件
+	verifyFunc func(file *aliyunpan.FileEntity) *VerifyOutput
+
+	// verifyState 校验进度，每校验完一个文件追加一行JSON，中断后再次执行相同的校验会跳过已经校验过的文件
+	verifyState struct {
+		filePath string
+		mutex    *sync.Mutex
+		items    map[string]*verifyStateItem
+		file     *os.File
+	}
+
+	verifyStateItem struct {
+		Path      string `json:"path"`
+		UpdatedAt string `json:"updatedAt"`
+		LocalPath string `json:"localPath"`
+		Status    string `json:"status"`
+		Reason    string `json:"reason"`
+	}
+)
+
+func CmdVerify() cli.Command {
+	return cli.Command{
+		Name:      "verify",
+		Usage:     "校验已下载或者已上传的文件",
+		UsageText: cmder.App().Name + " verify [选项] <云盘目录> <本地目录>\n   " + cmder.App().Name + " verify -pan-only [选项] <云盘目录>",
+		Description: `
+	重新计算本地文件的SHA1和CRC64, 并和云盘记录的哈希值对比, 用于检查下载或者上传之后本地或者云盘的文件是否损坏.
+	本地文件路径为本地目录加上文件相对云盘目录的路径. 指定 -pan-only 时不对比本地文件, 而是重新读取云盘文件的内容并和云盘记录的哈希值对比,
+	用于检测云盘文件是否损坏, 由于需要下载文件内容, 默认只随机抽样校验 20 个文件.
+
+	校验进度保存在配置目录下, 中断后再次执行相同的校验会跳过已经校验过的文件, 全部校验完成后自动删除进度. 指定 -restart 可以重新开始校验.
+	存在不一致或者缺失的文件时退出码为7, 只有读取失败的文件时退出码为5. 指定 -report 可以把校验失败的云盘文件路径保存到文件中, 每行一个, 用于重新下载.
+
+	示例:
+
+	校验本地目录 D:\照片 下载的云盘目录 /照片
+	aliyunpan verify /照片 D:\照片
+
+	使用4个线程校验, 并把校验失败的文件保存到 failed.txt
+	aliyunpan verify -p 4 -report failed.txt /照片 D:\照片
+
+	使用校验失败的文件列表重新下载, 注意保存目录为本地目录的上一级目录
+	xargs -d '\n' aliyunpan download -ow -saveto D:\ < failed.txt
+
+	随机抽样 100 个云盘文件, 重新读取内容校验
+	aliyunpan verify -pan-only -sample 100 /照片
+
+	以 json 格式输出全部文件的校验结果
+	aliyunpan --output json verify -all /照片 D:\照片
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			panOnly := c.Bool("pan-only")
+			if (panOnly && c.NArg() != 1) || (!panOnly && c.NArg() != 2) {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return reportError(usageErrorf("请指定云盘目录和本地目录, 只校验云盘文件时只需要指定云盘目录"))
+			}
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			if c.Int("sample") < 0 {
+				return reportError(usageErrorf("抽样数量不能小于0"))
+			}
+			opt := &VerifyOptions{
+				PanOnly:    panOnly,
+				Sample:     c.Int("sample"),
+				Parallel:   c.Int("p"),
+				ReportFile: c.String("report"),
+				Restart:    c.Bool("restart"),
+				ShowAll:    c.Bool("all"),
+			}
+			if opt.Parallel < 1 {
+				opt.Parallel = 1
+			}
+			return reportError(RunVerify(parseDriveId(c), c.Args().Get(0), c.Args().Get(1), opt))
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "driveId",
+				Usage: "网盘ID",
+				Value: "",
+			},
+			cli.BoolFlag{
+				Name:  "pan-only",
+				Usage: "只校验云盘文件, 重新读取云盘文件内容并对比哈希值",
+			},
+			cli.IntFlag{
+				Name:  "sample",
+				Usage: "只校验云盘文件时随机抽样的文件数量, 0表示全部",
+				Value: defaultVerifySample,
+			},
+			cli.IntFlag{
+				Name:  "p",
+				Usage: "同时校验的文件数量",
+				Value: 1,
+			},
+			cli.StringFlag{
+				Name:  "report",
+				Usage: "保存校验失败的云盘文件路径列表的文件",
+			},
+			cli.BoolFlag{
+				Name:  "restart",
+				Usage: "忽略上次未完成的校验进度, 重新开始校验",
+			},
+			cli.BoolFlag{
+				Name:  "all",
+				Usage: "输出全部文件的校验结果, 默认只输出校验失败的文件",
+			},
+		},
+	}
+}
+
+// verifyStateFilePath 校验进度文件路径，相同的网盘、目录和校验方式使用同一个进度文件
+func verifyStateFilePath(driveId, panDir, localDir string, panOnly bool) string {
+	key := utils.Md5Str(strings.Join([]string{driveId, panDir, localDir, strconv.FormatBool(panOnly)}, "|"))
+	return filepath.Join(config.GetConfigDir(), verifyStateFilePrefix+key+".json")
+}
+
+// openVerifyState 加载校验进度并打开进度文件用于追加，restart 为 true 时清空之前的进度
+func openVerifyState(filePath string, restart bool) (*verifyState, error) {
+	s := &verifyState{
+		filePath: filePath,
+		mutex:    &sync.Mutex{},
+		items:    map[string]*verifyStateItem{},
+	}
+	flag := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if restart {
+		flag |= os.O_TRUNC
+	} else if f, err := os.Open(filePath); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			item := &verifyStateItem{}
+			// 中断时最后一行可能不完整，忽略无法解析的行
+			if json.Unmarshal(scanner.Bytes(), item) == nil && item.Path != "" {
+				s.items[item.Path] = item
+			}
+		}
+		f.Close()
+	}
+	f, err := os.OpenFile(filePath, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+// get 获取文件上次的校验结果，文件在云盘上修改过或者上次读取失败则需要重新校验
+func (s *verifyState) get(file *aliyunpan.FileEntity) *verifyStateItem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if item, ok := s.items[file.Path]; ok && item.UpdatedAt == file.UpdatedAt && item.Status != verifyStatusError {
+		return item
+	}
+	return nil
+}
+
+// add 记录文件的校验结果
+func (s *verifyState) add(file *aliyunpan.FileEntity, result *VerifyOutput) error {
+	item := &verifyStateItem{
+		Path:      file.Path,
+		UpdatedAt: file.UpdatedAt,
+		LocalPath: result.LocalPath,
+		Status:    result.Status,
+		Reason:    result.Reason,
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.items[item.Path] = item
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *verifyState) close() error {
+	return s.file.Close()
+}
+
+// remove 全部校验完成后删除进度文件
+func (s *verifyState) remove() error {
+	s.close()
+	return os.Remove(s.filePath)
+}
+
+// selectVerifyFiles 选择需要校验的文件，sample 大于0时随机抽样，上次已经校验过的文件优先计入抽样
+func selectVerifyFiles(files aliyunpan.FileList, state *verifyState, sample int, r *rand.Rand) aliyunpan.FileList {
+	if sample <= 0 || sample >= len(files) {
+		return files
+	}
+	selected := aliyunpan.FileList{}
+	others := aliyunpan.FileList{}
+	for _, f := range files {
+		if state != nil && state.get(f) != nil {
+			selected = append(selected, f)
+		} else {
+			others = append(others, f)
+		}
+	}
+	r.Shuffle(len(others), func(i, j int) { others[i], others[j] = others[j], others[i] })
+	for _, f := range others {
+		if len(selected) >= sample {
+			break
+		}
+		selected = append(selected, f)
+	}
+	if len(selected) > sample {
+		selected = selected[:sample]
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Path < selected[j].Path })
+	return selected
+}
+
+// verifyChecksum 根据计算出的校验值生成校验结果
+func verifyChecksum(file *aliyunpan.FileEntity, sum *pandownload.FileChecksum, err error) *VerifyOutput {
+	result := &VerifyOutput{Status: verifyStatusOk, Path: file.Path, Size: file.FileSize}
+	if err != nil {
+		result.Status, result.Reason = verifyStatusError, err.Error()
+		return result
+	}
+	switch pandownload.CompareChecksum(sum, file) {
+	case pandownload.ErrDownloadChecksumFailed:
+		result.Status, result.Reason = verifyStatusMismatch, verifyReasonHash
+		if sum.Size != file.FileSize {
+			result.Reason = verifyReasonSize
+		}
+	case pandownload.ErrDownloadNotSupportChecksum:
+		result.Status = verifyStatusUnsupported
+	}
+	return result
+}
+
+// newLocalVerifyFunc 校验本地文件，本地文件路径为本地目录加上文件相对云盘目录的路径
+func newLocalVerifyFunc(panDir, localDir string) verifyFunc {
+	return func(file *aliyunpan.FileEntity) *VerifyOutput {
+		relativePath := strings.TrimPrefix(strings.TrimPrefix(file.Path, panDir), "/")
+		localPath := filepath.Join(localDir, filepath.FromSlash(relativePath))
+		var result *VerifyOutput
+		if info, err := os.Stat(localPath); err != nil || info.IsDir() {
+			result = &VerifyOutput{Status: verifyStatusMissing, Path: file.Path, Size: file.FileSize}
+		} else {
+			sum, e := pandownload.SumFile(localPath)
+			result = verifyChecksum(file, sum, e)
+		}
+		result.LocalPath = localPath
+		return result
+	}
+}
+
+// newPanVerifyFunc 重新读取云盘文件的内容进行校验
+func newPanVerifyFunc(panClient *config.PanClient) verifyFunc {
+	client := requester.NewHTTPClient()
+	// 读取大文件需要较长时间，不限制超时时间
+	client.SetTimeout(0)
+	return func(file *aliyunpan.FileEntity) *VerifyOutput {
+		urlResult, apiErr := panClient.OpenapiPanClient().GetFileDownloadUrl(&aliyunpan.GetFileDownloadUrlParam{
+			DriveId:   file.DriveId,
+			FileId:    file.FileId,
+			ExpireSec: 14400,
+		})
+		if apiErr != nil {
+			return verifyChecksum(file, nil, apiErr)
+		}
+		var (
+			resp *http.Response
+			err  error
+		)
+		apiErr = panClient.OpenapiPanClient().DownloadFileData(urlResult.Url, aliyunpan.FileDownloadRange{}, func(httpMethod, fullUrl string, headers map[string]string) (*http.Response, error) {
+			resp, err = client.Req(httpMethod, fullUrl, nil, headers)
+			return resp, err
+		})
+		if resp != nil {
+			defer resp.Body.Close()
+		}
+		if apiErr != nil {
+			return verifyChecksum(file, nil, apiErr)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return verifyChecksum(file, nil, fmt.Errorf("下载文件内容失败: %s", resp.Status))
+		}
+		sum, err := pandownload.SumReader(resp.Body)
+		return verifyChecksum(file, sum, err)
+	}
+}
+
+// runVerifyTasks 使用 parallel 个协程校验文件，上次已经校验过的文件直接使用记录的结果。
+// progress 在每个文件校验完成后调用
+func runVerifyTasks(files aliyunpan.FileList, verify verifyFunc, parallel int, state *verifyState, progress func(done int, doneSize int64)) []*VerifyOutput {
+	results := make([]*VerifyOutput, len(files))
+	var (
+		mutex    sync.Mutex
+		wg       sync.WaitGroup
+		done     int
+		doneSize int64
+	)
+	finish := func(k int, result *VerifyOutput) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[k] = result
+		done++
+		doneSize += files[k].FileSize
+		if progress != nil {
+			progress(done, doneSize)
+		}
+	}
+
+	jobs := make(chan int)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				result := verify(files[k])
+				if state != nil {
+					state.add(files[k], result)
+				}
+				finish(k, result)
+			}
+		}()
+	}
+	for k, f := range files {
+		if state != nil {
+			if item := state.get(f); item != nil {
+				finish(k, &VerifyOutput{Status: item.Status, Path: f.Path, LocalPath: item.LocalPath, Size: f.FileSize, Reason: item.Reason})
+				continue
+			}
+		}
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// writeVerifyReport 保存校验失败的云盘文件路径，每行一个
+func writeVerifyReport(reportFile string, results []*VerifyOutput) error {
+	sb := &strings.Builder{}
+	for _, r := range results {
+		if r.Status == verifyStatusMismatch || r.Status == verifyStatusMissing || r.Status == verifyStatusError {
+			sb.WriteString(r.Path + "\n")
+		}
+	}
+	return os.WriteFile(reportFile, []byte(sb.String()), 0644)
+}
+
+// RunVerify 执行文件校验
+func RunVerify(driveId, panDir, localDir string, opt *VerifyOptions) error {
+	activeUser := config.Config.ActiveUser()
+	if !opt.PanOnly {
+		var err error
+		if localDir, err = filepath.Abs(localDir); err != nil {
+			return usageErrorf("本地目录路径错误: %s", err)
+		}
+		if info, e := os.Stat(localDir); e != nil || !info.IsDir() {
+			return notFoundErrorf("本地目录不存在: %s", localDir)
+		}
+	}
+	panDir = path.Clean(activeUser.PathJoin(driveId, panDir))
+	panDirInfo, apiErr := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, panDir)
+	if apiErr != nil {
+		if apiErr.Code == apierror.ApiCodeFileNotFoundCode {
+			return notFoundErrorf("云盘目录不存在: %s", panDir)
+		}
+		return apiOutputError(apiErr, "")
+	}
+	if !panDirInfo.IsFolder() {
+		return usageErrorf("%s 不是目录", panDir)
+	}
+
+	files := aliyunpan.FileList{}
+	activeUser.PanClient().OpenapiPanClient().FilesDirectoriesRecurseList(driveId, panDir, func(depth int, _ string, fd *aliyunpan.FileEntity, apierr *apierror.ApiError) bool {
+		if apierr != nil {
+			apiErr = apierr
+			return false
+		}
+		if fd.IsFile() {
+			files = append(files, fd)
+		}
+		return true
+	})
+	if apiErr != nil {
+		return apiOutputError(apiErr, "扫描云盘目录失败: ")
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	state, err := openVerifyState(verifyStateFilePath(driveId, panDir, localDir, opt.PanOnly), opt.Restart)
+	if err != nil {
+		return errorf("打开校验进度文件失败: %s", err)
+	}
+	var verify verifyFunc
+	if opt.PanOnly {
+		files = selectVerifyFiles(files, state, opt.Sample, rand.New(rand.NewSource(time.Now().UnixNano())))
+		verify = newPanVerifyFunc(activeUser.PanClient())
+	} else {
+		verify = newLocalVerifyFunc(panDir, localDir)
+	}
+
+	var (
+		progress  func(int, int64)
+		totalSize int64
+	)
+	for _, f := range files {
+		totalSize += f.FileSize
+	}
+	if !IsMachineOutput() {
+		progress = func(done int, doneSize int64) {
+			fmt.Fprintf(os.Stderr, "\r正在校验 %d/%d, %s/%s", done, len(files),
+				converter.ConvertFileSize(doneSize, 2), converter.ConvertFileSize(totalSize, 2))
+		}
+	}
+	results := runVerifyTasks(files, verify, opt.Parallel, state, progress)
+	if progress != nil && len(files) > 0 {
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+	// 全部校验完成，不再需要进度文件
+	state.remove()
+
+	counts := map[string]int{}
+	items := []*VerifyOutput{}
+	for _, r := range results {
+		counts[r.Status]++
+		if opt.ShowAll || r.Status != verifyStatusOk {
+			items = append(items, r)
+		}
+	}
+	if opt.ReportFile != "" {
+		if e := writeVerifyReport(opt.ReportFile, results); e != nil {
+			return errorf("保存校验报告失败: %s", e)
+		}
+	}
+
+	if IsMachineOutput() {
+		if e := writeOutput(items); e != nil {
+			return e
+		}
+	} else {
+		renderVerifyTable(items, counts)
+	}
+	if counts[verifyStatusMismatch] > 0 || counts[verifyStatusMissing] > 0 {
+		return exitError(ExitCodeChecksumMismatch)
+	}
+	if counts[verifyStatusError] > 0 {
+		return exitError(ExitCodePartialFailure)
+	}
+	return nil
+}
+
+func renderVerifyTable(items []*VerifyOutput, counts map[string]int) {
+	statuses := map[string]string{
+		verifyStatusOk:          "一致",
+		verifyStatusMismatch:    "不一致",
+		verifyStatusMissing:     "本地不存在",
+		verifyStatusUnsupported: "不支持校验",
+		verifyStatusError:       "读取失败",
+	}
+	reasons := map[string]string{
+		verifyReasonSize: "大小不同",
+		verifyReasonHash: "哈希值不同",
+	}
+	if len(items) > 0 {
+		tb := cmdtable.NewTable(os.Stdout)
+		tb.SetHeader([]string{"#", "结果", "大小", "原因", "路径"})
+		for k, item := range items {
+			reason := item.Reason
+			if r, ok := reasons[reason]; ok {
+				reason = r
+			}
+			tb.Append([]string{strconv.Itoa(k + 1), statuses[item.Status], converter.ConvertFileSize(item.Size, 2), reason, item.Path})
+		}
+		tb.Render()
+	}
+	fmt.Printf("\n一致: %d, 不一致: %d, 本地不存在: %d, 不支持校验: %d, 读取失败: %d\n",
+		counts[verifyStatusOk], counts[verifyStatusMismatch], counts[verifyStatusMissing],
+		counts[verifyStatusUnsupported], counts[verifyStatusError])
+}
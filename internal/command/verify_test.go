@@ -0,0 +1,99 @@
+package command
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/functions/pandownload"
+)
+
+func TestRunVerifyTasks(t *testing.T) {
+	localDir := t.TempDir()
+	os.MkdirAll(filepath.Join(localDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(localDir, "ok.txt"), []byte("ok"), 0644)
+	os.WriteFile(filepath.Join(localDir, "sub", "hash.txt"), []byte("abcd"), 0644)
+	os.WriteFile(filepath.Join(localDir, "size.txt"), []byte("size"), 0644)
+	os.WriteFile(filepath.Join(localDir, "nohash.txt"), []byte("no"), 0644)
+
+	sum, _ := pandownload.SumFile(filepath.Join(localDir, "ok.txt"))
+	files := aliyunpan.FileList{
+		{Path: "/pan/missing.txt", FileType: "file", FileSize: 1, ContentHash: sum.Sha1},
+		{Path: "/pan/nohash.txt", FileType: "file", FileSize: 2},
+		{Path: "/pan/ok.txt", FileType: "file", FileSize: 2, ContentHash: sum.Sha1, UpdatedAt: "t1"},
+		{Path: "/pan/size.txt", FileType: "file", FileSize: 5, ContentHash: sum.Sha1},
+		{Path: "/pan/sub/hash.txt", FileType: "file", FileSize: 4, ContentHash: sum.Sha1},
+	}
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	state, err := openVerifyState(stateFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doneCount := 0
+	results := runVerifyTasks(files, newLocalVerifyFunc("/pan", localDir), 2, state, func(done int, doneSize int64) {
+		doneCount = done
+	})
+	state.close()
+	expected := []string{verifyStatusMissing, verifyStatusUnsupported, verifyStatusOk, verifyStatusMismatch, verifyStatusMismatch}
+	for k, r := range results {
+		if r.Status != expected[k] {
+			t.Errorf("%s: unexpected status %s", r.Path, r.Status)
+		}
+	}
+	if doneCount != 5 || results[3].Reason != verifyReasonSize || results[4].Reason != verifyReasonHash ||
+		results[4].LocalPath != filepath.Join(localDir, "sub", "hash.txt") {
+		t.Errorf("unexpected results: %d %+v %+v", doneCount, results[3], results[4])
+	}
+
+	// 继续上次的校验，只有修改过的文件重新校验
+	files[2].UpdatedAt = "t2"
+	state, err = openVerifyState(stateFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified := []string{}
+	verify := newLocalVerifyFunc("/pan", localDir)
+	results = runVerifyTasks(files, func(file *aliyunpan.FileEntity) *VerifyOutput {
+		verified = append(verified, file.Path)
+		return verify(file)
+	}, 1, state, nil)
+	if len(verified) != 1 || verified[0] != "/pan/ok.txt" || results[4].Status != verifyStatusMismatch || results[4].LocalPath == "" {
+		t.Errorf("unexpected verified files: %v", verified)
+	}
+	if err = state.remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	reportFile := filepath.Join(t.TempDir(), "report.txt")
+	if err = writeVerifyReport(reportFile, results); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(reportFile); string(data) != "/pan/missing.txt\n/pan/size.txt\n/pan/sub/hash.txt\n" {
+		t.Errorf("unexpected report: %q", data)
+	}
+}
+
+func TestSelectVerifyFiles(t *testing.T) {
+	files := aliyunpan.FileList{}
+	for _, p := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		files = append(files, &aliyunpan.FileEntity{Path: p, FileType: "file"})
+	}
+	state, err := openVerifyState(filepath.Join(t.TempDir(), "state.json"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.close()
+	state.add(files[3], &VerifyOutput{Status: verifyStatusOk})
+
+	r := rand.New(rand.NewSource(1))
+	if len(selectVerifyFiles(files, state, 0, r)) != 5 || len(selectVerifyFiles(files, state, 10, r)) != 5 {
+		t.Errorf("all files should be selected")
+	}
+	selected := selectVerifyFiles(files, state, 2, r)
+	if len(selected) != 2 || (selected[0].Path != "/d" && selected[1].Path != "/d") {
+		t.Errorf("verified file should be selected first: %s %s", selected[0].Path, selected[1].Path)
+	}
+}
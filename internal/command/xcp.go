@@ -53,12 +53,10 @@ func CmdXcp() cli.Command {
 				return nil
 			}
 			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
+				return reportError(notLoggedInError())
 			}
 			if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-				fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-				return nil
+				return reportError(webNotLoggedInError())
 			}
 			srcDriveId := parseDriveId(c)
 			dstDriveId := ""
@@ -68,8 +66,7 @@ func CmdXcp() cli.Command {
 			} else if driveList.GetResourceDriveId() == srcDriveId {
 				dstDriveId = driveList.GetFileDriveId()
 			} else {
-				fmt.Println("不支持该操作")
-				return nil
+				return reportError(usageErrorf("不支持该操作"))
 			}
 			RunXCopy(srcDriveId, dstDriveId, c.Args()...)
 			return nil
@@ -0,0 +1,690 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/uploader"
+	"github.com/tickstep/aliyunpan/internal/functions/panupload"
+	"github.com/tickstep/aliyunpan/internal/functions/panxfer"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+	"github.com/tickstep/library-go/requester/rio"
+	"github.com/urfave/cli"
+)
+
+type (
+	// XferOptions 跨账号复制可选项
+	XferOptions struct {
+		SrcDriveId  string // 源网盘ID，为空则使用源账号当前的网盘
+		DstDriveId  string // 目标网盘ID，为空则使用目标账号当前的网盘
+		BlockSize   int64  // 上传分片大小
+		MaxRetry    int    // 单个文件失败重试次数
+		IsOverwrite bool   // 目标文件已存在并且内容不同时覆盖
+		DryRun      bool   // 只显示需要复制的文件
+	}
+
+	// XferResultOutput 跨账号复制结果输出格式，xfer 命令使用
+	XferResultOutput struct {
+		// Status 复制结果：rapid-秒传，uploaded-上传，skipped-已复制过，failed-失败，planned-待复制(-dry)
+		Status string `json:"status"`
+		// Reason 失败的原因
+		Reason  string `json:"reason"`
+		SrcPath string `json:"srcPath"`
+		DstPath string `json:"dstPath"`
+		Size    int64  `json:"size"`
+	}
+
+	// xferLocation 命令行的 <用户>:<路径> 参数
+	xferLocation struct {
+		UserSpec string
+		Path     string
+	}
+
+	// xferEndpoint 复制的源或者目标
+	xferEndpoint struct {
+		user    *config.PanUser // 配置中的账号，用于获取工作目录
+		client  *aliyunpan_open.OpenPanClient
+		driveId string
+		path    string
+	}
+
+	xferFile struct {
+		file    *aliyunpan.FileEntity
+		srcPath string
+		dstPath string
+	}
+
+	// xferTask 一次跨账号复制任务
+	xferTask struct {
+		src    *xferEndpoint
+		dst    *xferEndpoint
+		dstPan *config.PanClient
+		opt    *XferOptions
+		state  *panxfer.TransferState
+		jobKey string
+		dirs   map[string]string // 目标账号已创建的目录, path => fileId
+	}
+)
+
+const (
+	// xferStateSaveInterval 分片和文件完成的进度保存间隔
+	xferStateSaveInterval = 5 * time.Second
+)
+
+var (
+	errXferTargetExisted  = errors.New("目标文件已存在并且内容不同，使用 -ow 覆盖")
+	errXferTargetIsFolder = errors.New("目标位置存在同名的文件夹")
+)
+
+func CmdXfer() cli.Command {
+	return cli.Command{
+		Name:  "xfer",
+		Usage: "在已登录的账号之间复制文件/目录",
+		UsageText: `
+	aliyunpan xfer <源账号>:<文件/目录> <目标账号>:<目标目录>`,
+		Description: `
+	在两个已登录的账号之间复制文件或者目录，源文件复制到目标目录下面。
+	账号可以是 loglist 列出的 # 值、UID、昵称或者账号名称。
+	能秒传的文件直接秒传，不能秒传的文件从源账号下载数据后直接上传到目标账号，不会保存到本地磁盘。
+	复制进度保存在配置目录下，中断后重新运行相同的命令可以继续复制，已经复制过的文件会跳过。
+
+	示例:
+
+	将账号1的 /团队资料 目录复制到账号2的 /迁移 目录下面
+	aliyunpan xfer 1:/团队资料 2:/迁移
+
+	使用昵称指定账号，将源账号资源库中的文件复制到目标账号
+	aliyunpan xfer -srcDriveId <资源库ID> 张三:/视频/1.mp4 李四:/视频
+
+	只显示需要复制的文件，不进行复制
+	aliyunpan xfer -dry 1:/团队资料 2:/迁移
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 2 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if config.Config.ActiveUser() == nil {
+				return reportError(notLoggedInError())
+			}
+			opt := &XferOptions{
+				SrcDriveId:  c.String("srcDriveId"),
+				DstDriveId:  c.String("dstDriveId"),
+				BlockSize:   int64(c.Int("bs") * 1024),
+				MaxRetry:    c.Int("retry"),
+				IsOverwrite: c.Bool("ow"),
+				DryRun:      c.Bool("dry"),
+			}
+			return reportError(RunXfer(c.Args().Get(0), c.Args().Get(1), opt))
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "srcDriveId",
+				Usage: "源网盘ID，默认为源账号当前使用的网盘",
+			},
+			cli.StringFlag{
+				Name:  "dstDriveId",
+				Usage: "目标网盘ID，默认为目标账号当前使用的网盘",
+			},
+			cli.IntFlag{
+				Name:  "bs",
+				Usage: "block size，上传分片大小，单位KB。推荐值：1024 ~ 10240",
+				Value: 10240,
+			},
+			cli.IntFlag{
+				Name:  "retry",
+				Usage: "单个文件复制失败最大重试次数",
+				Value: DefaultUploadMaxRetry,
+			},
+			cli.BoolFlag{
+				Name:  "ow",
+				Usage: "overwrite, 覆盖已存在并且内容不同的目标文件，旧文件会放入回收站。同名的文件夹不会被覆盖",
+			},
+			cli.BoolFlag{
+				Name:  "dry",
+				Usage: "只显示需要复制的文件，不进行复制",
+			},
+		},
+	}
+}
+
+// parseXferLocation 解析 <用户>:<路径> 参数
+func parseXferLocation(arg string) (*xferLocation, error) {
+	userSpec, p, ok := strings.Cut(arg, ":")
+	userSpec = strings.TrimSpace(userSpec)
+	if !ok || userSpec == "" || p == "" {
+		return nil, usageErrorf("参数格式错误，应为 <账号>:<路径>: %s", arg)
+	}
+	return &xferLocation{UserSpec: userSpec, Path: p}, nil
+}
+
+// findXferUser 按照 UID、loglist 的 # 值、昵称或者账号名称查找已登录的账号
+func findXferUser(userList config.PanUserList, spec string) (*config.PanUser, error) {
+	for _, u := range userList {
+		if u.UserId == spec {
+			return u, nil
+		}
+	}
+	if n, e := strconv.Atoi(strings.TrimPrefix(spec, "#")); e == nil {
+		if n >= 1 && n <= len(userList) {
+			return userList[n-1], nil
+		}
+	}
+	var found *config.PanUser
+	for _, u := range userList {
+		if u.Nickname == spec || u.AccountName == spec {
+			if found != nil {
+				return nil, usageErrorf("有多个账号匹配 %s, 请使用 UID 或者 # 值指定账号", spec)
+			}
+			found = u
+		}
+	}
+	if found == nil {
+		return nil, usageErrorf("未找到已登录的账号: %s, 请使用 loglist 查看已登录的账号", spec)
+	}
+	return found, nil
+}
+
+// setupXferEndpoint 初始化账号的客户端，当前登录用户直接使用已有的客户端
+func setupXferEndpoint(loc *xferLocation, driveId string) (*xferEndpoint, *config.PanClient, error) {
+	u, err := findXferUser(config.Config.UserList, loc.UserSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	var panClient *config.PanClient
+	if activeUser := GetActiveUser(); activeUser != nil && activeUser.UserId == u.UserId {
+		panClient = activeUser.PanClient()
+	} else {
+		c := config.Config
+		user, apierr := config.SetupUserByCookie(u.OpenapiToken, u.WebapiToken,
+			u.TicketId, u.UserId,
+			c.DeviceId, c.DeviceName,
+			c.ClientId, c.ClientSecret)
+		if apierr != nil {
+			return nil, nil, errorf("账号 %s 登录失败: %s", u.Nickname, apierr)
+		}
+		panClient = user.PanClient()
+	}
+	if driveId == "" {
+		driveId = u.ActiveDriveId
+	}
+	return &xferEndpoint{
+		user:    u,
+		client:  panClient.OpenapiPanClient(),
+		driveId: driveId,
+		path:    u.PathJoin(driveId, loc.Path),
+	}, panClient, nil
+}
+
+// listXferFiles 递归获取源目录下的所有文件，dirs 返回需要在目标账号创建的目录
+func listXferFiles(client *aliyunpan_open.OpenPanClient, driveId string, dir *aliyunpan.FileEntity, srcDir, dstDir string) (files []*xferFile, dirs []string, err error) {
+	dirs = []string{dstDir}
+	fileList, apierr := client.FileListGetAll(&aliyunpan.FileListParam{
+		DriveId:      driveId,
+		ParentFileId: dir.FileId,
+	}, 500)
+	if apierr != nil {
+		return nil, nil, apierr
+	}
+	for _, f := range fileList {
+		srcPath := path.Join(srcDir, f.FileName)
+		dstPath := path.Join(dstDir, f.FileName)
+		if f.IsFolder() {
+			subFiles, subDirs, e := listXferFiles(client, driveId, f, srcPath, dstPath)
+			if e != nil {
+				return nil, nil, e
+			}
+			files = append(files, subFiles...)
+			dirs = append(dirs, subDirs...)
+			continue
+		}
+		files = append(files, &xferFile{file: f, srcPath: srcPath, dstPath: dstPath})
+	}
+	return files, dirs, nil
+}
+
+// RunXfer 在已登录的账号之间复制文件/目录
+func RunXfer(srcArg, dstArg string, opt *XferOptions) error {
+	if opt == nil {
+		opt = &XferOptions{}
+	}
+	if opt.BlockSize <= 0 {
+		opt.BlockSize = 10240 * 1024
+	}
+	if opt.MaxRetry < 0 {
+		opt.MaxRetry = DefaultUploadMaxRetry
+	}
+	srcLoc, err := parseXferLocation(srcArg)
+	if err != nil {
+		return err
+	}
+	dstLoc, err := parseXferLocation(dstArg)
+	if err != nil {
+		return err
+	}
+	src, _, err := setupXferEndpoint(srcLoc, opt.SrcDriveId)
+	if err != nil {
+		return err
+	}
+	dst, dstPan, err := setupXferEndpoint(dstLoc, opt.DstDriveId)
+	if err != nil {
+		return err
+	}
+	if src.user.UserId == dst.user.UserId && src.driveId == dst.driveId {
+		return usageErrorf("源和目标是同一个网盘，请使用 cp 命令复制文件")
+	}
+
+	srcInfo, apierr := src.client.FileInfoByPath(src.driveId, src.path)
+	if apierr != nil {
+		return apiOutputError(apierr, "获取源文件信息失败: "+src.path+", ")
+	}
+	dstRoot := dst.path
+	if src.path != "/" {
+		dstRoot = path.Join(dst.path, srcInfo.FileName)
+	}
+	var (
+		files []*xferFile
+		dirs  []string
+	)
+	if srcInfo.IsFolder() {
+		if !IsMachineOutput() {
+			fmt.Printf("正在获取源目录文件列表: %s\n", src.path)
+		}
+		files, dirs, err = listXferFiles(src.client, src.driveId, srcInfo, src.path, dstRoot)
+		if err != nil {
+			return apiOutputError(err, "获取源目录文件列表失败: "+src.path+", ")
+		}
+	} else {
+		files = []*xferFile{{file: srcInfo, srcPath: src.path, dstPath: dstRoot}}
+	}
+
+	statePath := filepath.Join(config.GetConfigDir(), panxfer.StateFileName)
+	state, e := panxfer.LoadTransferState(statePath)
+	if e != nil {
+		// 记录损坏则重新记录，目标账号已存在的相同文件依然会跳过
+		logger.Verboseln("load xfer state error: ", e)
+		state = panxfer.NewTransferState(statePath)
+	}
+	state.PruneExpired(time.Now().Add(-panxfer.StateExpiration).Unix())
+	xt := &xferTask{
+		src:    src,
+		dst:    dst,
+		dstPan: dstPan,
+		opt:    opt,
+		state:  state,
+		jobKey: panxfer.JobKey(src.user.UserId, src.driveId, src.path, dst.user.UserId, dst.driveId, dst.path),
+		dirs:   map[string]string{},
+	}
+
+	results := []*XferResultOutput{}
+	if opt.DryRun {
+		tb := cmdtable.NewTable(os.Stdout)
+		tb.SetHeader([]string{"#", "源文件", "目标文件", "大小", "状态"})
+		for k, xf := range files {
+			status, statusName := "planned", "待复制"
+			if state.IsDone(xt.jobKey, xf.file, xf.dstPath) {
+				status, statusName = "skipped", "已复制"
+			}
+			results = append(results, xf.output(status, ""))
+			tb.Append([]string{strconv.Itoa(k + 1), xf.srcPath, xf.dstPath, converter.ConvertFileSize(xf.file.FileSize, 2), statusName})
+		}
+		if IsMachineOutput() {
+			return writeOutput(results)
+		}
+		tb.Render()
+		fmt.Printf("\n%s(%s) => %s(%s), 共 %d 个文件\n", src.path, src.user.Nickname, dstRoot, dst.user.Nickname, len(files))
+		return nil
+	}
+
+	if !IsMachineOutput() {
+		fmt.Printf("%s(%s) => %s(%s), 共 %d 个文件\n", src.path, src.user.Nickname, dstRoot, dst.user.Nickname, len(files))
+	}
+	for _, dir := range dirs {
+		if _, e := xt.mkdir(dir); e != nil {
+			return apiOutputError(e, "创建目标目录失败: "+dir+", ")
+		}
+	}
+	counts := map[string]int{}
+	for k, xf := range files {
+		status, e := xt.transferWithRetry(xf)
+		if e != nil {
+			status = "failed"
+			results = append(results, xf.output(status, e.Error()))
+		} else {
+			results = append(results, xf.output(status, ""))
+		}
+		counts[status]++
+		if !IsMachineOutput() {
+			switch status {
+			case "rapid":
+				fmt.Printf("[%d/%d] 秒传成功: %s\n", k+1, len(files), xf.dstPath)
+			case "uploaded":
+				fmt.Printf("[%d/%d] 上传成功: %s\n", k+1, len(files), xf.dstPath)
+			case "skipped":
+				fmt.Printf("[%d/%d] 已复制过, 跳过: %s\n", k+1, len(files), xf.dstPath)
+			default:
+				fmt.Printf("[%d/%d] 复制失败: %s, %s\n", k+1, len(files), xf.srcPath, e)
+			}
+		}
+	}
+	if counts["failed"] == 0 {
+		// 全部复制完成，不再需要进度记录
+		state.RemoveJob(xt.jobKey)
+	}
+	xt.saveState(true)
+
+	if IsMachineOutput() {
+		if e := writeOutput(results); e != nil {
+			return e
+		}
+	} else {
+		fmt.Printf("\n复制结束, 秒传: %d, 上传: %d, 跳过: %d, 失败: %d\n",
+			counts["rapid"], counts["uploaded"], counts["skipped"], counts["failed"])
+	}
+	if counts["failed"] > 0 {
+		if counts["failed"] < len(files) {
+			return newOutputError(errCodePartialFailure, ExitCodePartialFailure, "部分文件复制失败")
+		}
+		return errorf("复制文件失败")
+	}
+	return nil
+}
+
+func (xf *xferFile) output(status, reason string) *XferResultOutput {
+	return &XferResultOutput{
+		Status:  status,
+		Reason:  reason,
+		SrcPath: xf.srcPath,
+		DstPath: xf.dstPath,
+		Size:    xf.file.FileSize,
+	}
+}
+
+// mkdir 在目标账号创建目录，返回目录的ID
+func (xt *xferTask) mkdir(dir string) (string, error) {
+	if fileId, ok := xt.dirs[dir]; ok {
+		return fileId, nil
+	}
+	if dir == "/" {
+		xt.dirs[dir] = aliyunpan.DefaultRootParentFileId
+		return aliyunpan.DefaultRootParentFileId, nil
+	}
+	rs, apierr := xt.dst.client.MkdirByFullPath(xt.dst.driveId, dir)
+	if apierr != nil {
+		return "", apierr
+	}
+	if rs == nil || rs.FileId == "" {
+		return "", fmt.Errorf("创建目录失败: %s", dir)
+	}
+	xt.dirs[dir] = rs.FileId
+	return rs.FileId, nil
+}
+
+// transferWithRetry 复制文件，失败后重试
+func (xt *xferTask) transferWithRetry(xf *xferFile) (status string, err error) {
+	for retry := 0; ; retry++ {
+		status, err = xt.transfer(xf)
+		if err == nil || retry >= xt.opt.MaxRetry || !xferErrorNeedRetry(err) {
+			return status, err
+		}
+		logger.Verbosef("复制文件失败, %d秒后重试: %s, %s\n", retry+1, xf.srcPath, err)
+		time.Sleep(time.Duration(retry+1) * time.Second)
+	}
+}
+
+// xferErrorNeedRetry 复制出错后是否需要重试，目标文件已存在等错误重试也无法成功
+func xferErrorNeedRetry(err error) bool {
+	var apierr *apierror.ApiError
+	if errors.As(err, &apierr) && apierr.Code == apierror.ApiCodeFileAlreadyExisted {
+		return false
+	}
+	var merr *uploader.MultiError
+	if errors.As(err, &merr) && merr.Terminated {
+		return false
+	}
+	return !errors.Is(err, errXferTargetExisted) && !errors.Is(err, errXferTargetIsFolder)
+}
+
+// transfer 复制一个文件，能秒传的直接秒传，否则按照分片从源账号下载数据并上传到目标账号
+func (xt *xferTask) transfer(xf *xferFile) (string, error) {
+	f := xf.file
+	if xt.state.IsDone(xt.jobKey, f, xf.dstPath) {
+		return "skipped", nil
+	}
+	parentId, err := xt.mkdir(path.Dir(xf.dstPath))
+	if err != nil {
+		return "", err
+	}
+
+	// 上次中断的上传任务，继续上传
+	fr := xt.state.GetFile(xt.jobKey, f, xf.dstPath)
+	source := panxfer.NewSourceFile(xt.src.client, xt.src.driveId, f.FileId, f.FileSize)
+	if fr != nil && fr.Status == panxfer.FileStatusUploading && fr.UploadEntity != nil {
+		e := xt.uploadParts(xf, fr, source, true)
+		if e == nil {
+			return "uploaded", nil
+		}
+		logger.Verbosef("继续上传失败, 重新上传: %s, %s\n", xf.dstPath, e)
+	}
+
+	// 目标文件已存在
+	efi, apierr := xt.dst.client.FileInfoByPath(xt.dst.driveId, xf.dstPath)
+	if apierr != nil && apierr.Code != apierror.ApiCodeFileNotFoundCode {
+		return "", apierr
+	}
+	if efi != nil && efi.FileId != "" {
+		// 同名的文件夹不能被覆盖
+		if !efi.IsFile() {
+			return "", errXferTargetIsFolder
+		}
+		if f.ContentHash != "" && strings.EqualFold(efi.ContentHash, f.ContentHash) {
+			xt.markDone(xf, false)
+			return "skipped", nil
+		}
+		if !xt.opt.IsOverwrite {
+			return "", errXferTargetExisted
+		}
+		if _, apierr := xt.dst.client.FileDelete(&aliyunpan.FileBatchActionParam{
+			DriveId: xt.dst.driveId,
+			FileId:  efi.FileId,
+		}); apierr != nil {
+			return "", apierr
+		}
+	}
+
+	// 秒传需要文件的SHA1和防伪码，大文件先检测 PreHash
+	contentHash := f.ContentHash
+	proofCode := ""
+	if f.FileSize == 0 {
+		contentHash = aliyunpan.DefaultZeroSizeFileContentHash
+	} else if contentHash != "" {
+		preHashMatch := true
+		if f.FileSize >= panupload.DefaultCheckPreHashFileSize {
+			if preHash, e := panxfer.CalcPreHash(source, f.FileSize); e == nil {
+				if b, er := xt.dst.client.CheckUploadFilePreHash(&aliyunpan.FileUploadCheckPreHashParam{
+					DriveId:      xt.dst.driveId,
+					Name:         f.FileName,
+					Size:         f.FileSize,
+					ParentFileId: parentId,
+					PreHash:      preHash,
+				}); er == nil {
+					preHashMatch = b
+				}
+			}
+		}
+		if preHashMatch {
+			if proofCode, err = panxfer.CalcProofCode(xt.dst.client.GetAccessToken(), source); err != nil {
+				return "", err
+			}
+		} else {
+			logger.Verboseln("PreHash not match, upload file directly")
+			contentHash = ""
+		}
+	}
+	contentHashName := ""
+	if contentHash != "" {
+		contentHashName = "sha1"
+	}
+
+	blockSize := utils.ResizeUploadBlockSize(f.FileSize, xt.opt.BlockSize)
+	uploadEntity, apierr := xt.dst.client.CreateUploadFile(&aliyunpan.CreateFileUploadParam{
+		DriveId:         xt.dst.driveId,
+		Name:            path.Base(xf.dstPath),
+		Size:            f.FileSize,
+		ContentHash:     contentHash,
+		ContentHashName: contentHashName,
+		CheckNameMode:   "refuse",
+		ParentFileId:    parentId,
+		BlockSize:       blockSize,
+		ProofCode:       proofCode,
+		ProofVersion:    "v1",
+	})
+	if apierr != nil {
+		return "", apierr
+	}
+	if uploadEntity.RapidUpload {
+		xt.markDone(xf, true)
+		return "rapid", nil
+	}
+
+	fr = &panxfer.FileRecord{
+		SrcPath:      xf.srcPath,
+		DstPath:      xf.dstPath,
+		ContentHash:  f.ContentHash,
+		Size:         f.FileSize,
+		Status:       panxfer.FileStatusUploading,
+		UploadEntity: uploadEntity,
+		BlockSize:    blockSize,
+		UpdatedAt:    time.Now().Unix(),
+	}
+	// 上传任务立即保存，中断后才能继续上传
+	xt.state.PutFile(xt.jobKey, f.FileId, fr)
+	xt.saveState(true)
+	if err = xt.uploadParts(xf, fr, source, false); err != nil {
+		return "", err
+	}
+	return "uploaded", nil
+}
+
+// uploadParts 逐个分片从源账号下载数据并上传，resume 为 true 时跳过服务器已经收到的分片
+func (xt *xferTask) uploadParts(xf *xferFile, fr *panxfer.FileRecord, source *panxfer.SourceFile, resume bool) error {
+	entity := fr.UploadEntity
+	uploadedPartSize := map[int]int64{}
+	if resume {
+		uploadedParts, apierr := xt.dst.client.GetUploadedPartInfoAllItem(&aliyunpan.GetUploadedPartsParam{
+			DriveId:  entity.DriveId,
+			FileId:   entity.FileId,
+			UploadId: entity.UploadId,
+		})
+		if apierr != nil {
+			return apierr
+		}
+		for _, part := range uploadedParts.UploadedParts {
+			uploadedPartSize[part.PartNumber] = part.PartSize
+		}
+	}
+
+	worker := panupload.NewPanUpload(xt.dstPan, xf.dstPath, xt.dst.driveId, entity)
+	if err := worker.Precreate(); err != nil {
+		return err
+	}
+	partCount := len(entity.PartInfoList)
+	for partseq := 0; partseq < partCount; partseq++ {
+		begin := int64(partseq) * fr.BlockSize
+		end := begin + fr.BlockSize
+		if end > fr.Size {
+			end = fr.Size
+		}
+		if size, ok := uploadedPartSize[partseq+1]; ok && (size <= 0 || size == end-begin) {
+			continue
+		}
+		if !IsMachineOutput() {
+			fmt.Printf("\r上传到目标账号: %s, 分片 %d/%d, %s/%s", xf.dstPath, partseq+1, partCount,
+				converter.ConvertFileSize(end, 2), converter.ConvertFileSize(fr.Size, 2))
+		}
+		var r rio.ReaderLen64 = panupload.EmptyReaderLen64{}
+		var body *panxfer.RangeBody
+		if end > begin {
+			var err error
+			if body, err = source.OpenRange(begin, end); err != nil {
+				return err
+			}
+			r = body
+		}
+		ok, err := worker.UploadFile(context.Background(), partseq, begin, end, r, nil)
+		if body != nil {
+			body.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("上传分片失败: %d", partseq+1)
+		}
+		fr.UpdatedAt = time.Now().Unix()
+		xt.saveState(false)
+	}
+	if !IsMachineOutput() && partCount > 0 {
+		fmt.Println()
+	}
+	if err := worker.CommitFile(); err != nil {
+		return err
+	}
+	xt.markDone(xf, false)
+	return nil
+}
+
+// saveState 保存复制进度，用于中断后继续复制。force 为 false 时按照 xferStateSaveInterval 间隔保存
+func (xt *xferTask) saveState(force bool) {
+	var e error
+	if force {
+		e = xt.state.Save()
+	} else {
+		e = xt.state.SaveIfDue(xferStateSaveInterval)
+	}
+	if e != nil {
+		logger.Verboseln("save xfer state error: ", e)
+	}
+}
+
+func (xt *xferTask) markDone(xf *xferFile, rapid bool) {
+	xt.state.PutFile(xt.jobKey, xf.file.FileId, &panxfer.FileRecord{
+		SrcPath:     xf.srcPath,
+		DstPath:     xf.dstPath,
+		ContentHash: xf.file.ContentHash,
+		Size:        xf.file.FileSize,
+		Status:      panxfer.FileStatusDone,
+		Rapid:       rapid,
+		UpdatedAt:   time.Now().Unix(),
+	})
+	xt.saveState(false)
+}
@@ -0,0 +1,55 @@
+package command
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+)
+
+func TestParseXferLocation(t *testing.T) {
+	loc, err := parseXferLocation("张三:/团队资料/a:b.txt")
+	if err != nil || loc.UserSpec != "张三" || loc.Path != "/团队资料/a:b.txt" {
+		t.Fatalf("parse location: %+v, %v", loc, err)
+	}
+	for _, s := range []string{"", "/团队资料", ":/团队资料", "1:"} {
+		if _, err := parseXferLocation(s); err == nil {
+			t.Errorf("parse %q should fail", s)
+		}
+	}
+}
+
+func TestFindXferUser(t *testing.T) {
+	userList := config.PanUserList{
+		{UserId: "u1", Nickname: "张三", AccountName: "zhangsan"},
+		{UserId: "u2", Nickname: "李四", AccountName: "lisi"},
+		{UserId: "u3", Nickname: "李四", AccountName: "lisi2"},
+	}
+	cases := map[string]string{
+		"u2":       "u2",
+		"1":        "u1",
+		"#3":       "u3",
+		"张三":       "u1",
+		"zhangsan": "u1",
+		"lisi2":    "u3",
+	}
+	for spec, expect := range cases {
+		if u, err := findXferUser(userList, spec); err != nil || u.UserId != expect {
+			t.Errorf("find %q: %v, %v", spec, u, err)
+		}
+	}
+	for _, spec := range []string{"李四", "4", "#0", "wangwu"} {
+		if _, err := findXferUser(userList, spec); err == nil {
+			t.Errorf("find %q should fail", spec)
+		}
+	}
+}
+
+func TestXferErrorNeedRetry(t *testing.T) {
+	if xferErrorNeedRetry(errXferTargetExisted) || xferErrorNeedRetry(errXferTargetIsFolder) {
+		t.Errorf("target conflict should not be retried")
+	}
+	if !xferErrorNeedRetry(errors.New("connection reset")) {
+		t.Errorf("network error should be retried")
+	}
+}
@@ -10,7 +10,12 @@ import (
 
 // DeleteCache 删除含有 dirs 的缓存
 func (pu *PanUser) DeleteCache(dirs []string) {
-	cache := pu.cacheOpMap.LazyInitCachePoolOp(pu.ActiveDriveId)
+	pu.DeleteDriveCache(pu.ActiveDriveId, dirs)
+}
+
+// DeleteDriveCache 删除指定网盘含有 dirs 的缓存
+func (pu *PanUser) DeleteDriveCache(driveId string, dirs []string) {
+	cache := pu.cacheOpMap.LazyInitCachePoolOp(driveId)
 	for _, v := range dirs {
 		key := v + "_" + "OrderByName"
 		_, ok := cache.Load(key)
@@ -28,14 +33,19 @@ func (pu *PanUser) DeleteOneCache(dirPath string) {
 
 // CacheFilesDirectoriesList 缓存获取
 func (pu *PanUser) CacheFilesDirectoriesList(pathStr string) (fdl aliyunpan.FileList, apiError *apierror.ApiError) {
-	data := pu.cacheOpMap.CacheOperation(pu.ActiveDriveId, pathStr+"_OrderByName", func() expires.DataExpires {
+	return pu.CacheDriveFilesDirectoriesList(pu.ActiveDriveId, pathStr)
+}
+
+// CacheDriveFilesDirectoriesList 缓存获取指定网盘的目录列表
+func (pu *PanUser) CacheDriveFilesDirectoriesList(driveId, pathStr string) (fdl aliyunpan.FileList, apiError *apierror.ApiError) {
+	data := pu.cacheOpMap.CacheOperation(driveId, pathStr+"_OrderByName", func() expires.DataExpires {
 		var fi *aliyunpan.FileEntity
-		fi, apiError = pu.panClient.OpenapiPanClient().FileInfoByPath(pu.ActiveDriveId, pathStr)
+		fi, apiError = pu.panClient.OpenapiPanClient().FileInfoByPath(driveId, pathStr)
 		if apiError != nil {
 			return nil
 		}
 		fileListParam := &aliyunpan.FileListParam{
-			DriveId:      pu.ActiveDriveId,
+			DriveId:      driveId,
 			ParentFileId: fi.FileId,
 		}
 		fdl, apiError = pu.panClient.OpenapiPanClient().FileListGetAll(fileListParam, 200)
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apiutil"
 	"github.com/tickstep/aliyunpan-api/aliyunpan_open"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open/openapi"
 	"github.com/tickstep/aliyunpan-api/aliyunpan_web"
 )
 
@@ -13,6 +17,13 @@ type (
 		// 阿里openapi接口客户端
 		openapiPanClient *aliyunpan_open.OpenPanClient
 	}
+
+	// FileSearchResult 文件搜索结果
+	FileSearchResult struct {
+		FileList   aliyunpan.FileList
+		NextMarker string
+		TotalCount int64
+	}
 )
 
 func NewPanClient(webClient *aliyunpan_web.WebPanClient, openClient *aliyunpan_open.OpenPanClient) *PanClient {
@@ -29,3 +40,35 @@ func (p *PanClient) WebapiPanClient() *aliyunpan_web.WebPanClient {
 func (p *PanClient) OpenapiPanClient() *aliyunpan_open.OpenPanClient {
 	return p.openapiPanClient
 }
+
+// FileSearch 调用openapi的文件搜索接口。aliyunpan_open 没有封装该接口，这里使用当前的 AccessToken 直接请求
+func (p *PanClient) FileSearch(param *openapi.FileSearchParam) (*FileSearchResult, *apierror.ApiError) {
+	apiClient := openapi.NewAliPanClient(openapi.ApiToken{AccessToken: p.openapiPanClient.GetAccessToken()}, openapi.ApiConfig{})
+	r, err := apiClient.FileSearch(param)
+	if err != nil {
+		return nil, p.openapiPanClient.ParseAliApiError(err)
+	}
+	result := &FileSearchResult{
+		FileList:   aliyunpan.FileList{},
+		NextMarker: r.NextMarker,
+		TotalCount: r.TotalCount,
+	}
+	for _, f := range r.Items {
+		result.FileList = append(result.FileList, &aliyunpan.FileEntity{
+			DriveId:         f.DriveId,
+			DomainId:        f.DomainId,
+			FileId:          f.FileId,
+			FileName:        f.Name,
+			FileSize:        f.Size,
+			FileType:        f.Type,
+			CreatedAt:       apiutil.UtcTime2LocalFormat(f.CreatedAt),
+			UpdatedAt:       apiutil.UtcTime2LocalFormat(f.UpdatedAt),
+			FileExtension:   f.FileExtension,
+			ParentFileId:    f.ParentFileId,
+			ContentHash:     f.ContentHash,
+			ContentHashName: f.ContentHashName,
+			Category:        f.Category,
+		})
+	}
+	return result, nil
+}
@@ -39,6 +39,8 @@ const (
 	EnvVerbose = "ALIYUNPAN_VERBOSE"
 	// EnvConfigDir 配置路径环境变量
 	EnvConfigDir = "ALIYUNPAN_CONFIG_DIR"
+	// EnvOutput 输出格式环境变量
+	EnvOutput = "ALIYUNPAN_OUTPUT"
 	// ConfigName 配置文件名
 	ConfigName = "aliyunpan_config.json"
 	// ConfigVersion 配置文件版本
@@ -0,0 +1,133 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package downloader
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	// MinBlockSize 自动调整的Range区块的最小值
+	MinBlockSize int64 = 4 * 1024 * 1024 // 4MB
+
+	// BlocksPerWorker 每个线程预计分配的Range区块数量, 保证后续增加的线程也能分配到区块
+	BlocksPerWorker int64 = 4
+
+	// MaxRangeCount 单个文件最多的Range区块数量, 超大文件按照这个数量调大区块, 减少重新建立连接的次数
+	MaxRangeCount int64 = 512
+
+	// ParallelScaleInterval 每次调整并发数后, 至少间隔这么长时间才会再次调整
+	ParallelScaleInterval = 5 * time.Second
+
+	// ParallelHoldDuration 遇到限流或者增加并发没有提升速度后, 在这段时间内不再增加并发
+	ParallelHoldDuration = 30 * time.Second
+
+	// ParallelScaleMinGain 增加并发后速度至少提升的比例, 否则撤回增加的并发
+	ParallelScaleMinGain = 0.1
+)
+
+type (
+	// ParallelController 单个文件下载并发数的控制器.
+	// 下载速度随着并发数提升时逐个增加并发, 直到上限; 遇到限流(429, 403 ExceedMaxConcurrency)时减半
+	ParallelController struct {
+		mu         sync.Mutex
+		max        int
+		limit      int
+		throttled  int64     // 已经处理过的限流次数
+		lastChange time.Time // 上次调整并发数的时间
+		holdUntil  time.Time // 在此时间之前不增加并发
+		probing    bool      // 刚增加了并发, 正在评估速度是否提升
+		baseSpeed  int64     // 增加并发前的下载速度
+	}
+)
+
+// AdaptiveBlockSize 计算Range区块大小: 按照每个线程 BlocksPerWorker 个区块平均切分, 最小为 MinBlockSize, 最大为 maxBlockSize,
+// 超大文件的区块数量超过 MaxRangeCount 时继续调大区块
+func AdaptiveBlockSize(totalSize int64, parallel int, maxBlockSize int64) int64 {
+	if parallel < 1 {
+		parallel = 1
+	}
+	blockSize := totalSize/(int64(parallel)*BlocksPerWorker) + 1
+	if maxBlockSize > 0 && blockSize > maxBlockSize {
+		blockSize = maxBlockSize
+	}
+	if blockSize < MinBlockSize {
+		blockSize = MinBlockSize
+	}
+	if totalSize/blockSize >= MaxRangeCount {
+		blockSize = totalSize/MaxRangeCount + 1
+	}
+	return blockSize
+}
+
+// NewParallelController 初始化并发数控制器, 并发数从上限的一半开始
+func NewParallelController(max int) *ParallelController {
+	if max < 1 {
+		max = 1
+	}
+	return &ParallelController{
+		max:        max,
+		limit:      (max + 1) / 2,
+		lastChange: time.Now(),
+	}
+}
+
+// Limit 当前允许的并发数
+func (pc *ParallelController) Limit() int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.limit
+}
+
+// Max 并发数上限
+func (pc *ParallelController) Max() int {
+	return pc.max
+}
+
+// Update 根据正在下载的线程数, 当前的下载速度和累计的限流次数调整并发数, 返回调整后的并发数
+func (pc *ParallelController) Update(now time.Time, running int, speed int64, throttled int64) int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	switch {
+	case throttled > pc.throttled:
+		// 遇到限流, 并发数减半
+		pc.throttled = throttled
+		pc.limit = (pc.limit + 1) / 2
+		pc.probing = false
+		pc.lastChange = now
+		pc.holdUntil = now.Add(ParallelHoldDuration)
+	case now.Sub(pc.lastChange) < ParallelScaleInterval:
+		// 等待上次调整的效果
+	case pc.probing:
+		// 评估上次增加并发的效果, 速度没有提升则撤回
+		pc.probing = false
+		pc.lastChange = now
+		if float64(speed) < float64(pc.baseSpeed)*(1+ParallelScaleMinGain) {
+			pc.limit--
+			pc.holdUntil = now.Add(ParallelHoldDuration)
+		}
+	case pc.limit < pc.max && running >= pc.limit && !now.Before(pc.holdUntil):
+		// 所有的线程都在下载, 尝试增加并发
+		pc.baseSpeed = speed
+		pc.limit++
+		pc.probing = true
+		pc.lastChange = now
+	}
+	if pc.limit < 1 {
+		pc.limit = 1
+	}
+	return pc.limit
+}
@@ -0,0 +1,195 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open/openapi"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/library/requester/transfer"
+	"github.com/tickstep/library-go/requester"
+)
+
+func TestAdaptiveBlockSize(t *testing.T) {
+	const mb = 1024 * 1024
+	cases := []struct {
+		total    int64
+		parallel int
+		want     int64
+	}{
+		{6 * mb, 3, MinBlockSize},        // 小文件使用最小的区块
+		{240 * mb, 3, 20*mb + 1},         // 按照每个线程4个区块切分
+		{1024 * mb, 3, 55 * mb},          // 不超过最大值
+		{100 * 1024 * mb, 3, 200*mb + 1}, // 超大文件调大区块, 最多512个区块
+		{1024 * mb, 0, 55 * mb},          // 并发数不合法
+		{mb, 1, MinBlockSize},            // 比最小区块还小的文件只有一个区块
+		{10 * 1024 * mb, 9, 55 * mb},     // 多用户下载
+		{200 * mb, 1, 50*mb + 1},         // 单线程
+		{100 * 1024 * mb, 1, 200*mb + 1}, // 单线程超大文件
+		{512 * 55 * mb, 3, 55*mb + 1},    // 刚好达到最大区块数量
+		{512*55*mb - 1, 3, 55 * mb},      // 未达到最大区块数量
+	}
+	for _, c := range cases {
+		if got := AdaptiveBlockSize(c.total, c.parallel, 55*mb); got != c.want {
+			t.Errorf("AdaptiveBlockSize(%d, %d) = %d, want %d", c.total, c.parallel, got, c.want)
+		}
+	}
+}
+
+func TestParallelController(t *testing.T) {
+	pc := NewParallelController(3)
+	start := pc.lastChange
+	at := func(sec int) time.Time { return start.Add(time.Duration(sec) * time.Second) }
+	steps := []struct {
+		sec       int
+		running   int
+		speed     int64
+		throttled int64
+		want      int
+	}{
+		{1, 2, 100, 0, 2},  // 等待调整间隔
+		{5, 2, 100, 0, 3},  // 所有线程都在下载, 增加并发
+		{10, 3, 105, 0, 2}, // 速度没有明显提升, 撤回
+		{20, 2, 100, 0, 2}, // 暂停增加并发
+		{41, 1, 100, 0, 2}, // 并发没有用满, 不增加
+		{42, 2, 100, 0, 3},
+		{47, 3, 200, 0, 3}, // 速度提升, 保留
+		{52, 3, 200, 0, 3}, // 已经达到上限
+		{53, 2, 200, 1, 2}, // 遇到限流, 减半
+		{54, 2, 200, 3, 1},
+		{55, 1, 200, 3, 1},
+		{90, 1, 200, 3, 2}, // 限流暂停结束后重新增加
+	}
+	for _, s := range steps {
+		if got := pc.Update(at(s.sec), s.running, s.speed, s.throttled); got != s.want {
+			t.Fatalf("at %ds: limit = %d, want %d", s.sec, got, s.want)
+		}
+	}
+	if NewParallelController(1).Limit() != 1 || NewParallelController(9).Limit() != 5 || NewParallelController(0).Max() != 1 {
+		t.Errorf("unexpected initial limit")
+	}
+}
+
+// rangeServer 本地的HTTP Range下载服务器, 同时下载的连接数超过 maxConcurrency 时返回429
+type rangeServer struct {
+	data           []byte
+	maxConcurrency int32
+	active         int32
+	maxActive      int32
+	throttled      int32
+}
+
+func (rs *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	active := atomic.AddInt32(&rs.active, 1)
+	defer atomic.AddInt32(&rs.active, -1)
+	for {
+		maxActive := atomic.LoadInt32(&rs.maxActive)
+		if active <= maxActive || atomic.CompareAndSwapInt32(&rs.maxActive, maxActive, active) {
+			break
+		}
+	}
+	if active > rs.maxConcurrency {
+		atomic.AddInt32(&rs.throttled, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	var begin, end int64
+	if _, err := fmt.Sscanf(r.Header.Get("range"), "bytes=%d-%d", &begin, &end); err != nil || end >= int64(len(rs.data)) {
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", begin, end, len(rs.data)))
+	w.Header().Set("Content-Length", fmt.Sprint(end-begin+1))
+	w.WriteHeader(http.StatusPartialContent)
+	// 每个连接的速度约为 1.6MB/s
+	for p := begin; p <= end; p += 16 * 1024 {
+		e := p + 16*1024
+		if e > end+1 {
+			e = end + 1
+		}
+		if _, err := w.Write(rs.data[p:e]); err != nil {
+			return
+		}
+		w.(http.Flusher).Flush()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMonitorAdaptiveParallel(t *testing.T) {
+	defer func(tick, interval, hold time.Duration) {
+		monitorTickInterval, ParallelScaleInterval, ParallelHoldDuration = tick, interval, hold
+	}(monitorTickInterval, ParallelScaleInterval, ParallelHoldDuration)
+	monitorTickInterval, ParallelScaleInterval, ParallelHoldDuration = 100*time.Millisecond, 300*time.Millisecond, time.Second
+
+	data := make([]byte, 6*1024*1024+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	rs := &rangeServer{data: data, maxConcurrency: 2}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "download"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	total := int64(len(data))
+	status := transfer.NewDownloadStatus()
+	status.SetTotalSize(total)
+	status.SetRangeListGen(transfer.NewRangeListGenBlockSize(total, 0, 256*1024))
+
+	// 镜像地址不检查链接是否过期
+	panClient := config.NewPanClient(nil, aliyunpan_open.NewOpenPanClient(openapi.ApiConfig{}, openapi.ApiToken{}, nil))
+	lbrl := NewLoadBalancerResponseList([]*LoadBalancerResponse{{URL: server.URL}})
+	monitor := NewMonitor()
+	writeMu := &sync.Mutex{}
+	for k := 0; k < 3; k++ {
+		_, r := status.RangeListGen().GenRange()
+		worker := NewWorker(k, "", "", server.URL, file, nil)
+		worker.SetClient(requester.NewHTTPClient())
+		worker.SetPanClient(panClient)
+		worker.SetLoadBalancer(lbrl, lbrl.HealthyGet())
+		worker.SetWriteMutex(writeMu)
+		worker.SetTotalSize(total)
+		worker.SetAcceptRange("bytes")
+		worker.SetRange(r)
+		monitor.Append(worker)
+	}
+	monitor.SetStatus(status)
+	monitor.SetReloadWorker(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	monitor.Execute(ctx)
+	if err = monitor.Err(); err != nil || ctx.Err() != nil {
+		t.Fatalf("download failed: %v %v", err, ctx.Err())
+	}
+
+	downloaded, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) || status.Downloaded() != total {
+		t.Fatalf("downloaded data mismatch, downloaded: %d", status.Downloaded())
+	}
+	// 从2个并发开始, 增加到3个后遇到限流, 退回后不会持续触发限流
+	throttled := atomic.LoadInt32(&rs.throttled)
+	if rs.maxActive != 3 || throttled == 0 || throttled > 6 {
+		t.Errorf("unexpected concurrency: max active %d, throttled %d", rs.maxActive, throttled)
+	}
+	if monitor.parallel.throttled != int64(throttled) {
+		t.Errorf("throttled count mismatch: %d", monitor.parallel.throttled)
+	}
+}
@@ -35,9 +35,9 @@ var (
 type Config struct {
 	Mode                       transfer.RangeGenMode      // 下载Range分配模式
 	MaxParallel                int                        // 最大下载并发量
-	SliceParallel              int                        // 单文件下载线程数，为0代表程序自动调度
+	SliceParallel              int                        // 单文件下载最大线程数，为0代表程序自动调度。下载时会在上限内根据速度和限流情况自动调整
 	CacheSize                  int                        // 下载缓冲
-	BlockSize                  int64                      // 每个Range区块的大小, RangeGenMode 为 RangeGenMode2 时才有效
+	BlockSize                  int64                      // 每个Range区块的最大值, 超大文件会自动调大, RangeGenMode 为 RangeGenMode_BlockSize 时才有效
 	MaxRate                    int64                      // 限制最大下载速度
 	InstanceStateStorageFormat InstanceStateStorageFormat // 断点续传储存类型
 	InstanceStatePath          string                     // 断点续传信息路径
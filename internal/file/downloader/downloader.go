@@ -63,6 +63,7 @@ type (
 		statusCodeBodyCheckFunc StatusCodeBodyCheckFunc
 		executeTime             time.Time
 		loadBalansers           []string
+		loadBalancerList        *LoadBalancerResponseList // 下载地址列表
 		writer                  io.WriterAt
 		client                  *requester.HTTPClient
 		panClient               *config.PanClient
@@ -177,12 +178,8 @@ func (der *Downloader) SelectBlockSizeAndInitRangeGen(status *transfer.DownloadS
 			gen = transfer.NewRangeListGenDefault(status.TotalSize(), 0, 0, parallel)
 			blockSize = gen.LoadBlockSize()
 		case transfer.RangeGenMode_BlockSize:
-			b2 := status.TotalSize()/int64(parallel) + 1
-			if b2 > der.config.BlockSize { // 选小的BlockSize, 以更高并发
-				blockSize = der.config.BlockSize
-			} else {
-				blockSize = b2
-			}
+			// 小文件切分成更多的区块, 以便动态增加的线程分配到数据; 超大文件调大区块, 减少重新建立连接的次数
+			blockSize = AdaptiveBlockSize(status.TotalSize(), parallel, der.config.BlockSize)
 
 			gen = transfer.NewRangeListGenBlockSize(status.TotalSize(), 0, blockSize)
 		default:
@@ -219,31 +216,17 @@ func DefaultDURLCheckFunc(client *requester.HTTPClient, durl string) (contentLen
 	return resp.ContentLength, resp, nil
 }
 
-func (der *Downloader) checkLoadBalancers() *LoadBalancerResponseList {
-	var (
-		loadBalancerResponses = make([]*LoadBalancerResponse, 0, len(der.loadBalansers)+1)
-		handleLoadBalancer    = func(req *http.Request) {
-			if req == nil {
-				return
-			}
-
-			if der.config.TryHTTP {
-				req.URL.Scheme = "http"
-			}
-
-			loadBalancer := &LoadBalancerResponse{
-				URL: req.URL.String(),
-			}
-
-			loadBalancerResponses = append(loadBalancerResponses, loadBalancer)
-			logger.Verbosef("DEBUG: load balance task: URL: %s", loadBalancer.URL)
-		}
-	)
-
-	// 加入第一个
-	loadBalancerResponses = append(loadBalancerResponses, &LoadBalancerResponse{
-		URL: "der.durl",
-	})
+// checkLoadBalancers 初始化下载地址列表, 包含各个账号的下载链接, 以及检测可用的手动添加的镜像地址
+func (der *Downloader) checkLoadBalancers(sources []*panClientDownloadUrlEntity) *LoadBalancerResponseList {
+	loadBalancerResponseList := NewLoadBalancerResponseList(make([]*LoadBalancerResponse, 0, len(sources)+len(der.loadBalansers)))
+	for _, source := range sources {
+		loadBalancerResponseList.Add(&LoadBalancerResponse{
+			URL:       source.FileUrl,
+			PanClient: source.PanClient,
+			DriveId:   source.DriveId,
+			FileId:    source.FileId,
+		})
+	}
 
 	// 负载均衡
 	wg := waitgroup.NewWaitGroup(10)
@@ -254,6 +237,7 @@ func (der *Downloader) checkLoadBalancers() *LoadBalancerResponseList {
 		go func(loadBalanser string) {
 			defer wg.Done()
 
+			startTime := time.Now()
 			subContentLength, subResp, subErr := der.durlCheckFunc(der.client, loadBalanser)
 			if subResp != nil {
 				subResp.Body.Close() // 不读Body, 马上关闭连接
@@ -283,18 +267,24 @@ func (der *Downloader) checkLoadBalancers() *LoadBalancerResponseList {
 				return
 			}
 
-			//if !der.loadBalancerCompareFunc(der.firstInfo.ToMap(), subResp) {
-			//	logger.Verbosef("DEBUG: loadBalanser not equal to main server\n")
-			//	return
-			//}
-
-			handleLoadBalancer(subResp.Request)
+			req := subResp.Request
+			if req == nil {
+				return
+			}
+			if der.config.TryHTTP {
+				req.URL.Scheme = "http"
+			}
+			loadBalancer := &LoadBalancerResponse{
+				URL: req.URL.String(),
+			}
+			loadBalancer.RecordResponse(subResp.StatusCode, time.Since(startTime))
+			loadBalancerResponseList.Add(loadBalancer)
+			logger.Verbosef("DEBUG: load balance task: URL: %s", loadBalancer.URL)
 		}(loadBalanser)
 	}
 	wg.Wait()
 	der.client.SetTimeout(privTimeout)
 
-	loadBalancerResponseList := NewLoadBalancerResponseList(loadBalancerResponses)
 	return loadBalancerResponseList
 }
 
@@ -309,8 +299,7 @@ func (der *Downloader) Execute() error {
 	}
 
 	var (
-		loadBalancerResponseList = der.checkLoadBalancers()
-		bii                      *transfer.DownloadInstanceInfo
+		bii *transfer.DownloadInstanceInfo
 	)
 
 	err := der.initInstanceState(der.config.InstanceStateStorageFormat)
@@ -330,6 +319,12 @@ func (der *Downloader) Execute() error {
 	if bii.DownloadStatus != nil {
 		// 使用断点信息的状态
 		status = bii.DownloadStatus
+		// 校验上次正在下载的分片已写入的数据
+		if ra, ok := der.writer.(io.ReaderAt); ok {
+			if reverted := verifyRanges(ra, bii.Ranges); reverted > 0 {
+				status.AddDownloaded(-reverted)
+			}
+		}
 	} else {
 		// 新建状态
 		status = transfer.NewDownloadStatus()
@@ -399,24 +394,25 @@ func (der *Downloader) Execute() error {
 		return err
 	}
 
-	// 初始化下载worker
-	factorNum := len(bii.Ranges) / len(panClientFileUrl)
+	// 初始化下载地址列表
+	der.loadBalancerList = der.checkLoadBalancers(panClientFileUrl)
+
+	// 初始化下载worker, 各个分片优先分配给最健康的下载地址
 	for k, r := range bii.Ranges {
-		panClientUrl := panClientFileUrl[int(k/factorNum)]
-		loadBalancer := loadBalancerResponseList.SequentialGet()
+		loadBalancer := der.loadBalancerList.HealthyGet()
 		if loadBalancer == nil {
 			continue
 		}
 
-		logger.Verbosef("work id: %d, download url: %v\n", k, panClientUrl.FileUrl)
+		logger.Verbosef("work id: %d, download url: %v\n", k, loadBalancer.URL)
 		client := requester.NewHTTPClient()
 		client.SetKeepAlive(true)
 		client.SetTimeout(10 * time.Minute)
 
-		realUrl := panClientUrl.FileUrl
-		worker := NewWorker(k, panClientUrl.DriveId, panClientUrl.FileInfo.FileId, realUrl, writer, der.globalSpeedsStat)
+		worker := NewWorker(k, der.driveId, der.fileInfo.FileId, loadBalancer.URL, writer, der.globalSpeedsStat)
 		worker.SetClient(client)
-		worker.SetPanClient(panClientUrl.PanClient)
+		worker.SetPanClient(der.panClient)
+		worker.SetLoadBalancer(der.loadBalancerList, loadBalancer)
 		worker.SetWriteMutex(writeMu)
 		worker.SetTotalSize(der.fileInfo.FileSize)
 
@@ -675,6 +671,14 @@ func (der *Downloader) Failed() {
 	cmdutil.Trigger(der.monitorCancelFunc)
 }
 
+// ParallelLimit 当前允许的并发数和并发数上限
+func (der *Downloader) ParallelLimit() (limit, max int) {
+	if der.monitor == nil || der.monitor.parallel == nil {
+		return 0, 0
+	}
+	return der.monitor.parallel.Limit(), der.monitor.parallel.Max()
+}
+
 // OnExecute 设置开始下载事件
 func (der *Downloader) OnExecute(onExecuteEvent requester.Event) {
 	der.onExecuteEvent = onExecuteEvent
@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//     http://www.apache.org/licenses/LICENSE-2.0
+//	http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -14,12 +14,16 @@
 package downloader
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"github.com/json-iterator/go"
-	"github.com/tickstep/library-go/cachepool"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/aliyunpan/library/requester/transfer"
 	"github.com/tickstep/library-go/crypto"
 	"github.com/tickstep/library-go/logger"
-	"github.com/tickstep/aliyunpan/library/requester/transfer"
+	"hash/crc64"
+	"io"
 	"os"
 	"sync"
 )
@@ -27,9 +31,10 @@ import (
 type (
 	//InstanceState 状态, 断点续传信息
 	InstanceState struct {
-		saveFile *os.File
+		savePath string
 		format   InstanceStateStorageFormat
 		ii       *transfer.DownloadInstanceInfoExport
+		lastData []byte
 		mu       sync.Mutex
 	}
 
@@ -44,41 +49,30 @@ const (
 	InstanceStateStorageFormatProto3
 )
 
-//NewInstanceState 初始化InstanceState
-func NewInstanceState(saveFile *os.File, format InstanceStateStorageFormat) *InstanceState {
+var (
+	// instanceStateMagic protobuf 格式断点续传文件的文件头
+	instanceStateMagic = []byte("ADIS")
+
+	// crc64Table 断点续传使用的CRC64表, 和阿里云盘的 crc64Hash 一致
+	crc64Table = crc64.MakeTable(crc64.ECMA)
+
+	// ErrInstanceStateCorrupted 断点续传文件已损坏
+	ErrInstanceStateCorrupted = errors.New("instance state corrupted")
+)
+
+// NewInstanceState 初始化InstanceState, savePath 为空时不保存断点续传信息
+func NewInstanceState(savePath string, format InstanceStateStorageFormat) *InstanceState {
 	return &InstanceState{
-		saveFile: saveFile,
+		savePath: savePath,
 		format:   format,
 	}
 }
 
 func (is *InstanceState) checkSaveFile() bool {
-	return is.saveFile != nil
-}
-
-func (is *InstanceState) getSaveFileContents() []byte {
-	if !is.checkSaveFile() {
-		return nil
-	}
-
-	finfo, err := is.saveFile.Stat()
-	if err != nil {
-		panic(err)
-	}
-
-	size := finfo.Size()
-	if size > 0xffffffff {
-		panic("savePath too large")
-	}
-	intSize := int(size)
-
-	buf := cachepool.RawMallocByteSlice(intSize)
-
-	n, _ := is.saveFile.ReadAt(buf, 0)
-	return crypto.Base64Decode(buf[:n])
+	return is.savePath != ""
 }
 
-//Get 获取断点续传信息
+// Get 获取断点续传信息, 兼容旧版本的 json 格式
 func (is *InstanceState) Get() (eii *transfer.DownloadInstanceInfo) {
 	if !is.checkSaveFile() {
 		return nil
@@ -87,25 +81,28 @@ func (is *InstanceState) Get() (eii *transfer.DownloadInstanceInfo) {
 	is.mu.Lock()
 	defer is.mu.Unlock()
 
-	contents := is.getSaveFileContents()
-	if len(contents) <= 0 {
+	contents, err := os.ReadFile(is.savePath)
+	if err != nil || len(contents) <= 0 {
 		return
 	}
 
-	is.ii = &transfer.DownloadInstanceInfoExport{}
-	var err error
-	err = jsoniter.Unmarshal(contents, is.ii)
-
+	ii := &transfer.DownloadInstanceInfoExport{}
+	if bytes.HasPrefix(contents, instanceStateMagic) {
+		err = unmarshalInstanceInfo(contents, ii)
+	} else {
+		err = jsoniter.Unmarshal(crypto.Base64Decode(contents), ii)
+	}
 	if err != nil {
 		logger.Verbosef("DEBUG: InstanceInfo unmarshal error: %s\n", err)
 		return
 	}
 
+	is.ii = ii
 	eii = is.ii.GetInstanceInfo()
 	return
 }
 
-//Put 提交断点续传信息
+// Put 提交断点续传信息, 先写入临时文件再重命名, 写入过程中程序退出也不会损坏已有的断点续传文件
 func (is *InstanceState) Put(eii *transfer.DownloadInstanceInfo) {
 	if !is.checkSaveFile() {
 		return
@@ -122,29 +119,76 @@ func (is *InstanceState) Put(eii *transfer.DownloadInstanceInfo) {
 		data []byte
 		err  error
 	)
-	data, err = jsoniter.Marshal(is.ii)
-	if err != nil {
-		panic(err)
+	switch is.format {
+	case InstanceStateStorageFormatProto3:
+		data = marshalInstanceInfo(is.ii)
+	default:
+		data, err = jsoniter.Marshal(is.ii)
+		if err != nil {
+			panic(err)
+		}
+		data = crypto.Base64Encode(data)
 	}
-
-	err = is.saveFile.Truncate(int64(len(data)))
-	if err != nil {
-		logger.Verbosef("DEBUG: truncate file error: %s\n", err)
+	if bytes.Equal(data, is.lastData) {
+		// 没有变化
+		return
 	}
 
-	_, err = is.saveFile.WriteAt(crypto.Base64Encode(data), 0)
+	err = utils.WriteFileAtomic(is.savePath, data, 0666)
 	if err != nil {
 		logger.Verbosef("DEBUG: write instance state error: %s\n", err)
+		return
 	}
+	is.lastData = data
 }
 
-//Close 关闭
+// Close 关闭
 func (is *InstanceState) Close() error {
-	if !is.checkSaveFile() {
-		return nil
-	}
+	return nil
+}
+
+// verifyRanges 校验断点续传时各个分片已写入的数据, 校验失败的分片从 SumBegin 开始重新下载, 返回需要重新下载的数据量。
+// 没有校验信息的分片(旧版本的断点续传文件)不校验
+func verifyRanges(r io.ReaderAt, ranges transfer.RangeList) (reverted int64) {
+	buf := make([]byte, 64*1024)
+	for _, wrange := range ranges {
+		if wrange == nil {
+			continue
+		}
+		begin, sumBegin := wrange.LoadBegin(), wrange.SumBegin
+		if begin <= sumBegin || sumBegin < 0 || wrange.Crc64 == 0 {
+			wrange.SumBegin, wrange.Crc64 = begin, 0
+			continue
+		}
 
-	return is.saveFile.Close()
+		var (
+			crc    uint64
+			offset = sumBegin
+			err    error
+		)
+		for offset < begin && err == nil {
+			n := int64(len(buf))
+			if begin-offset < n {
+				n = begin - offset
+			}
+			var nn int
+			nn, err = r.ReadAt(buf[:n], offset)
+			crc = crc64.Update(crc, crc64Table, buf[:nn])
+			offset += int64(nn)
+			if err == io.EOF && offset >= begin {
+				err = nil
+			}
+		}
+		if err == nil && crc == wrange.Crc64 {
+			continue
+		}
+
+		logger.Verbosef("DEBUG: range %s checksum mismatch, download from %d again, err: %v\n", wrange.ShowDetails(), sumBegin, err)
+		wrange.StoreBegin(sumBegin)
+		wrange.Crc64 = 0
+		reverted += begin - sumBegin
+	}
+	return
 }
 
 func (der *Downloader) initInstanceState(format InstanceStateStorageFormat) (err error) {
@@ -152,22 +196,175 @@ func (der *Downloader) initInstanceState(format InstanceStateStorageFormat) (err
 		return errors.New("already initInstanceState")
 	}
 
-	var saveFile *os.File
-	if der.config.InstanceStatePath != "" {
-		saveFile, err = os.OpenFile(der.config.InstanceStatePath, os.O_RDWR|os.O_CREATE, 0777)
-		if err != nil {
-			return err
-		}
-	}
-
-	der.instanceState = NewInstanceState(saveFile, format)
+	der.instanceState = NewInstanceState(der.config.InstanceStatePath, format)
 	return nil
 }
 
 func (der *Downloader) removeInstanceState() error {
 	der.instanceState.Close()
 	if der.config.InstanceStatePath != "" {
+		os.Remove(der.config.InstanceStatePath + ".tmp")
 		return os.Remove(der.config.InstanceStatePath)
 	}
 	return nil
 }
+
+// instance state 的 protobuf(proto3) 编码, 对应的定义如下, 文件格式为: "ADIS" + InstanceInfo + 8字节大端序的 InstanceInfo 的 CRC64
+//
+//	message InstanceInfo {
+//	  int32 range_gen_mode = 1;
+//	  int64 total_size = 2;
+//	  int64 gen_begin = 3;
+//	  int64 block_size = 4;
+//	  repeated Range ranges = 5;
+//	}
+//
+//	message Range {
+//	  int64 begin = 1;
+//	  int64 end = 2;
+//	  int64 sum_begin = 3;
+//	  fixed64 crc64 = 4;
+//	}
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		// proto3 不编码默认值
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|protoWireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoFixed64(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|protoWireFixed64)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+func appendProtoBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|protoWireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// marshalInstanceInfo 编码断点续传信息
+func marshalInstanceInfo(ii *transfer.DownloadInstanceInfoExport) []byte {
+	msg := []byte{}
+	msg = appendProtoVarint(msg, 1, uint64(ii.RangeGenMode))
+	msg = appendProtoVarint(msg, 2, uint64(ii.TotalSize))
+	msg = appendProtoVarint(msg, 3, uint64(ii.GenBegin))
+	msg = appendProtoVarint(msg, 4, uint64(ii.BlockSize))
+	for _, r := range ii.Ranges {
+		if r == nil {
+			continue
+		}
+		rmsg := []byte{}
+		rmsg = appendProtoVarint(rmsg, 1, uint64(r.LoadBegin()))
+		rmsg = appendProtoVarint(rmsg, 2, uint64(r.LoadEnd()))
+		rmsg = appendProtoVarint(rmsg, 3, uint64(r.SumBegin))
+		rmsg = appendProtoFixed64(rmsg, 4, r.Crc64)
+		msg = appendProtoBytes(msg, 5, rmsg)
+	}
+
+	data := make([]byte, 0, len(instanceStateMagic)+len(msg)+8)
+	data = append(data, instanceStateMagic...)
+	data = append(data, msg...)
+	return binary.BigEndian.AppendUint64(data, crc64.Checksum(msg, crc64Table))
+}
+
+// unmarshalInstanceInfo 解码断点续传信息, 文件不完整或者校验失败返回 ErrInstanceStateCorrupted
+func unmarshalInstanceInfo(data []byte, ii *transfer.DownloadInstanceInfoExport) error {
+	if len(data) < len(instanceStateMagic)+8 || !bytes.HasPrefix(data, instanceStateMagic) {
+		return ErrInstanceStateCorrupted
+	}
+	msg := data[len(instanceStateMagic) : len(data)-8]
+	if crc64.Checksum(msg, crc64Table) != binary.BigEndian.Uint64(data[len(data)-8:]) {
+		return ErrInstanceStateCorrupted
+	}
+
+	return rangeProtoFields(msg, func(field int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			ii.RangeGenMode = transfer.RangeGenMode(v)
+		case 2:
+			ii.TotalSize = int64(v)
+		case 3:
+			ii.GenBegin = int64(v)
+		case 4:
+			ii.BlockSize = int64(v)
+		case 5:
+			r := &transfer.Range{}
+			err := rangeProtoFields(b, func(field int, v uint64, _ []byte) error {
+				switch field {
+				case 1:
+					r.Begin = int64(v)
+				case 2:
+					r.End = int64(v)
+				case 3:
+					r.SumBegin = int64(v)
+				case 4:
+					r.Crc64 = v
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ii.Ranges = append(ii.Ranges, r)
+		}
+		return nil
+	})
+}
+
+// rangeProtoFields 遍历消息的字段, 数值类型的字段值为 v, 长度类型的字段值为 b, 忽略未知的字段
+func rangeProtoFields(msg []byte, f func(field int, v uint64, b []byte) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return ErrInstanceStateCorrupted
+		}
+		msg = msg[n:]
+
+		var (
+			v uint64
+			b []byte
+		)
+		switch key & 7 {
+		case protoWireVarint:
+			if v, n = binary.Uvarint(msg); n <= 0 {
+				return ErrInstanceStateCorrupted
+			}
+			msg = msg[n:]
+		case protoWireFixed64:
+			if len(msg) < 8 {
+				return ErrInstanceStateCorrupted
+			}
+			v, msg = binary.LittleEndian.Uint64(msg), msg[8:]
+		case protoWireFixed32:
+			if len(msg) < 4 {
+				return ErrInstanceStateCorrupted
+			}
+			v, msg = uint64(binary.LittleEndian.Uint32(msg)), msg[4:]
+		case protoWireBytes:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return ErrInstanceStateCorrupted
+			}
+			b, msg = msg[n:n+int(l)], msg[n+int(l):]
+		default:
+			return ErrInstanceStateCorrupted
+		}
+		if err := f(int(key>>3), v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
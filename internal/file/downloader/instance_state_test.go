@@ -0,0 +1,97 @@
+package downloader
+
+import (
+	"hash/crc64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/json-iterator/go"
+	"github.com/tickstep/aliyunpan/library/requester/transfer"
+	"github.com/tickstep/library-go/crypto"
+)
+
+func TestInstanceState(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "a.txt.downloading")
+	status := transfer.NewDownloadStatus()
+	status.SetTotalSize(300)
+	status.SetRangeListGen(transfer.NewRangeListGenBlockSize(300, 200, 100))
+	ranges := transfer.RangeList{
+		{Begin: 50, End: 100, SumBegin: 0, Crc64: 12345},
+		{Begin: 150, End: 200, SumBegin: 100, Crc64: 67890},
+		{Begin: 0, End: -2},
+	}
+
+	is := NewInstanceState(savePath, InstanceStateStorageFormatProto3)
+	is.Put(&transfer.DownloadInstanceInfo{DownloadStatus: status, Ranges: ranges})
+	if _, err := os.Stat(savePath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file should be renamed")
+	}
+
+	eii := NewInstanceState(savePath, InstanceStateStorageFormatProto3).Get()
+	if eii == nil || len(eii.Ranges) != 3 {
+		t.Fatalf("unexpected instance info: %+v", eii)
+	}
+	if *eii.Ranges[1] != *ranges[1] || *eii.Ranges[2] != *ranges[2] || eii.DownloadStatus.TotalSize() != 300 ||
+		eii.DownloadStatus.Downloaded() != 102 || eii.DownloadStatus.RangeListGen().LoadBegin() != 200 {
+		t.Errorf("unexpected instance info: %+v %+v %d", eii.Ranges[1], eii.Ranges[2], eii.DownloadStatus.Downloaded())
+	}
+
+	// 文件不完整
+	data, _ := os.ReadFile(savePath)
+	os.WriteFile(savePath, data[:len(data)-3], 0666)
+	if eii = NewInstanceState(savePath, InstanceStateStorageFormatProto3).Get(); eii != nil {
+		t.Errorf("truncated state should be ignored")
+	}
+
+	// 旧版本的 json 格式
+	jsonData, _ := jsoniter.Marshal(&transfer.DownloadInstanceInfoExport{TotalSize: 300, Ranges: []*transfer.Range{{Begin: 10, End: 300}}})
+	os.WriteFile(savePath, crypto.Base64Encode(jsonData), 0666)
+	if eii = NewInstanceState(savePath, InstanceStateStorageFormatProto3).Get(); eii == nil || eii.Ranges[0].Begin != 10 {
+		t.Errorf("legacy json state should be loaded: %+v", eii)
+	}
+}
+
+func TestVerifyRanges(t *testing.T) {
+	data := make([]byte, 200*1024)
+	for k := range data {
+		data[k] = byte(k % 251)
+	}
+	filePath := filepath.Join(t.TempDir(), "a.bin")
+	os.WriteFile(filePath, data, 0666)
+	f, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	table := crc64.MakeTable(crc64.ECMA)
+	ranges := transfer.RangeList{
+		{Begin: 150 * 1024, End: 180 * 1024, SumBegin: 100, Crc64: crc64.Checksum(data[100:150*1024], table)},
+		{Begin: 190 * 1024, End: 200 * 1024, SumBegin: 180 * 1024, Crc64: 1},
+		{Begin: 30, End: 100},
+		{Begin: 250 * 1024, End: 260 * 1024, SumBegin: 240 * 1024, Crc64: 1},
+	}
+	reverted := verifyRanges(f, ranges)
+	if reverted != 20*1024 {
+		t.Errorf("unexpected reverted size: %d", reverted)
+	}
+	if ranges[0].Begin != 150*1024 || ranges[1].Begin != 180*1024 || ranges[1].Crc64 != 0 || ranges[2].Begin != 30 || ranges[2].SumBegin != 30 {
+		t.Errorf("unexpected ranges: %s %s %s", ranges[0].ShowDetails(), ranges[1].ShowDetails(), ranges[2].ShowDetails())
+	}
+	if ranges[3].Begin != 240*1024 {
+		t.Errorf("range out of file should be reverted: %s", ranges[3].ShowDetails())
+	}
+}
+
+func TestWorkerRangeState(t *testing.T) {
+	wer := NewWorker(0, "", "", "", nil, nil)
+	wer.SetRange(&transfer.Range{Begin: 100, End: 200, SumBegin: 50, Crc64: 99})
+	if r := wer.GetRangeState(); r.SumBegin != 50 || r.Crc64 != 99 {
+		t.Errorf("checksum should be restored: %+v", r)
+	}
+	wer.SetRange(&transfer.Range{Begin: 300, End: 400})
+	if r := wer.GetRangeState(); r.Begin != 300 || r.SumBegin != 300 || r.Crc64 != 0 {
+		t.Errorf("checksum should start from begin: %+v", r)
+	}
+}
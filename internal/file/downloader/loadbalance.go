@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//     http://www.apache.org/licenses/LICENSE-2.0
+//	http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -15,19 +15,68 @@ package downloader
 
 import (
 	"net/http"
-	"sync/atomic"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+)
+
+const (
+	// MaxLoadBalancerNetErrors 下载地址连续出现网络错误的最大次数, 超过后移除该下载地址
+	MaxLoadBalancerNetErrors = 3
+
+	// loadBalancerEWMAWeight 延迟和速度统计的平滑系数
+	loadBalancerEWMAWeight = 0.3
+
+	// EvictReasonExpired 下载链接已过期
+	EvictReasonExpired = "expired"
+	// EvictReasonNetError 连续出现网络错误
+	EvictReasonNetError = "net error"
 )
 
 type (
-	// LoadBalancerResponse 负载均衡响应状态
+	// LoadBalancerResponse 负载均衡的下载地址, 记录该地址的延迟, 速度和错误统计
 	LoadBalancerResponse struct {
-		URL     string
+		URL string
+
+		// 下载地址所属的网盘账号和文件, 为空表示手动添加的镜像地址, 镜像地址无法刷新
+		PanClient *config.PanClient
+		DriveId   string
+		FileId    string
+
+		mu             sync.Mutex
+		requests       int64
+		errors         int64
+		netErrors      int   // 连续的网络错误次数
+		downloaded     int64 // 已下载的数据量
+		latency        time.Duration
+		throughput     float64 // 下载速度, 单位 bytes/s
+		lastStatusCode int
+		active         int // 正在使用该地址的worker数量
+		evicted        bool
+		evictReason    string
+	}
+
+	// LoadBalancerStats 下载地址的统计信息快照
+	LoadBalancerStats struct {
+		URL            string
+		Requests       int64
+		Errors         int64
+		Downloaded     int64
+		Latency        time.Duration
+		Throughput     int64
+		LastStatusCode int
+		Active         int
+		Evicted        bool
+		EvictReason    string
 	}
 
 	// LoadBalancerResponseList 负载均衡列表
 	LoadBalancerResponseList struct {
+		mu     sync.Mutex
 		lbr    []*LoadBalancerResponse
-		cursor int32
+		cursor int
 	}
 
 	LoadBalancerCompareFunc func(info map[string]string, subResp *http.Response) bool
@@ -40,24 +89,246 @@ func NewLoadBalancerResponseList(lbr []*LoadBalancerResponse) *LoadBalancerRespo
 	}
 }
 
-// SequentialGet 顺序获取
+// Add 增加下载地址
+func (lbrl *LoadBalancerResponseList) Add(lbr ...*LoadBalancerResponse) {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
+	lbrl.lbr = append(lbrl.lbr, lbr...)
+}
+
+// Len 下载地址数量, 包含已移除的
+func (lbrl *LoadBalancerResponseList) Len() int {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
+	return len(lbrl.lbr)
+}
+
+// SequentialGet 顺序获取, 跳过已移除的下载地址
 func (lbrl *LoadBalancerResponseList) SequentialGet() *LoadBalancerResponse {
-	if len(lbrl.lbr) == 0 {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
+	for i := 0; i < len(lbrl.lbr); i++ {
+		if lbrl.cursor >= len(lbrl.lbr) {
+			lbrl.cursor = 0
+		}
+		lbr := lbrl.lbr[lbrl.cursor]
+		lbrl.cursor++
+		if !lbr.Evicted() {
+			return lbr
+		}
+	}
+	return nil
+}
+
+// RandomGet 随机获取, 跳过已移除的下载地址
+func (lbrl *LoadBalancerResponseList) RandomGet() *LoadBalancerResponse {
+	healthy := lbrl.healthyList()
+	if len(healthy) == 0 {
 		return nil
 	}
+	return healthy[RandomNumber(0, len(healthy))]
+}
+
+// HealthyGet 获取最健康的下载地址: 按照速度和错误率计算得分, 并按照正在使用的worker数量分摊.
+// 没有速度统计的地址按照当前最快的速度计算, 保证新的地址也会被使用
+func (lbrl *LoadBalancerResponseList) HealthyGet() *LoadBalancerResponse {
+	healthy := lbrl.healthyList()
+	if len(healthy) == 0 {
+		return nil
+	}
+	maxThroughput := 1.0
+	for _, lbr := range healthy {
+		if tp := lbr.Stats().Throughput; float64(tp) > maxThroughput {
+			maxThroughput = float64(tp)
+		}
+	}
+	var (
+		best      *LoadBalancerResponse
+		bestScore float64
+	)
+	for _, lbr := range healthy {
+		if score := lbr.score(maxThroughput); best == nil || score > bestScore {
+			best, bestScore = lbr, score
+		}
+	}
+	return best
+}
 
-	if int(lbrl.cursor) >= len(lbrl.lbr) {
-		lbrl.cursor = 0
+// Evict 移除下载地址, 已经没有其他可用的下载地址时不移除, 返回是否已移除
+func (lbrl *LoadBalancerResponseList) Evict(lbr *LoadBalancerResponse, reason string) bool {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
+	if lbr.Evicted() {
+		return true
 	}
+	for _, item := range lbrl.lbr {
+		if item != lbr && !item.Evicted() {
+			lbr.evict(reason)
+			return true
+		}
+	}
+	return false
+}
 
-	lbr := lbrl.lbr[int(lbrl.cursor)]
-	atomic.AddInt32(&lbrl.cursor, 1)
-	return lbr
+// Replace 使用新的下载地址替换旧的下载地址, 新的地址占用旧地址在列表中的位置, 旧的地址标记为已移除.
+// 旧的地址已经不在列表中时, 新的地址加入列表末尾
+func (lbrl *LoadBalancerResponseList) Replace(old, lbr *LoadBalancerResponse, reason string) {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
+	if old != nil {
+		old.evict(reason)
+		for i, item := range lbrl.lbr {
+			if item == old {
+				lbrl.lbr[i] = lbr
+				return
+			}
+		}
+	}
+	lbrl.lbr = append(lbrl.lbr, lbr)
 }
 
-// RandomGet 随机获取
-func (lbrl *LoadBalancerResponseList) RandomGet() *LoadBalancerResponse {
-	return lbrl.lbr[RandomNumber(0, len(lbrl.lbr))]
+// Stats 获取所有下载地址的统计信息
+func (lbrl *LoadBalancerResponseList) Stats() []*LoadBalancerStats {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
+	stats := make([]*LoadBalancerStats, 0, len(lbrl.lbr))
+	for _, lbr := range lbrl.lbr {
+		stats = append(stats, lbr.Stats())
+	}
+	return stats
+}
+
+func (lbrl *LoadBalancerResponseList) healthyList() []*LoadBalancerResponse {
+	lbrl.mu.Lock()
+	defer lbrl.mu.Unlock()
+	healthy := make([]*LoadBalancerResponse, 0, len(lbrl.lbr))
+	for _, lbr := range lbrl.lbr {
+		if !lbr.Evicted() {
+			healthy = append(healthy, lbr)
+		}
+	}
+	return healthy
+}
+
+// Renew 使用新的链接创建同一个网盘文件的下载地址
+func (lbr *LoadBalancerResponse) Renew(newUrl string) *LoadBalancerResponse {
+	return &LoadBalancerResponse{
+		URL:       newUrl,
+		PanClient: lbr.PanClient,
+		DriveId:   lbr.DriveId,
+		FileId:    lbr.FileId,
+	}
+}
+
+// IsMirror 是否为手动添加的镜像地址
+func (lbr *LoadBalancerResponse) IsMirror() bool {
+	return lbr.PanClient == nil
+}
+
+// Evicted 是否已移除
+func (lbr *LoadBalancerResponse) Evicted() bool {
+	lbr.mu.Lock()
+	defer lbr.mu.Unlock()
+	return lbr.evicted
+}
+
+// RecordResponse 记录请求的响应状态码和首字节延迟
+func (lbr *LoadBalancerResponse) RecordResponse(statusCode int, latency time.Duration) {
+	lbr.mu.Lock()
+	defer lbr.mu.Unlock()
+	lbr.requests++
+	lbr.lastStatusCode = statusCode
+	if statusCode/100 != 2 {
+		lbr.errors++
+		return
+	}
+	lbr.netErrors = 0
+	if lbr.latency == 0 {
+		lbr.latency = latency
+	} else {
+		lbr.latency = time.Duration(loadBalancerEWMAWeight*float64(latency) + (1-loadBalancerEWMAWeight)*float64(lbr.latency))
+	}
+}
+
+// RecordNetError 记录网络错误, 返回连续的网络错误次数
+func (lbr *LoadBalancerResponse) RecordNetError() int {
+	lbr.mu.Lock()
+	defer lbr.mu.Unlock()
+	lbr.requests++
+	lbr.errors++
+	lbr.netErrors++
+	return lbr.netErrors
+}
+
+// RecordDownloaded 记录下载的数据量和耗时, 用于计算下载速度
+func (lbr *LoadBalancerResponse) RecordDownloaded(n int64, elapsed time.Duration) {
+	if n <= 0 || elapsed <= 0 {
+		return
+	}
+	lbr.mu.Lock()
+	defer lbr.mu.Unlock()
+	lbr.downloaded += n
+	tp := float64(n) / elapsed.Seconds()
+	if lbr.throughput == 0 {
+		lbr.throughput = tp
+	} else {
+		lbr.throughput = loadBalancerEWMAWeight*tp + (1-loadBalancerEWMAWeight)*lbr.throughput
+	}
+}
+
+// Stats 获取统计信息快照
+func (lbr *LoadBalancerResponse) Stats() *LoadBalancerStats {
+	lbr.mu.Lock()
+	defer lbr.mu.Unlock()
+	return &LoadBalancerStats{
+		URL:            lbr.URL,
+		Requests:       lbr.requests,
+		Errors:         lbr.errors,
+		Downloaded:     lbr.downloaded,
+		Latency:        lbr.latency,
+		Throughput:     int64(lbr.throughput),
+		LastStatusCode: lbr.lastStatusCode,
+		Active:         lbr.active,
+		Evicted:        lbr.evicted,
+		EvictReason:    lbr.evictReason,
+	}
+}
+
+// Host 下载地址的域名, 用于展示
+func (s *LoadBalancerStats) Host() string {
+	u, err := url.Parse(s.URL)
+	if err != nil || u.Host == "" {
+		return s.URL
+	}
+	return u.Host
+}
+
+func (lbr *LoadBalancerResponse) evict(reason string) {
+	lbr.mu.Lock()
+	defer lbr.mu.Unlock()
+	lbr.evicted = true
+	lbr.evictReason = reason
+}
+
+func (lbr *LoadBalancerResponse) addActive(delta int) {
+	lbr.mu.Lock()
+	defer lbr.mu.Unlock()
+	lbr.active += delta
+}
+
+// score 下载地址的得分, 越大越优先使用
+func (lbr *LoadBalancerResponse) score(maxThroughput float64) float64 {
+	lbr.mu.Lock()
+	defer lbr.mu.Unlock()
+	tp := lbr.throughput
+	if tp == 0 {
+		tp = maxThroughput
+	}
+	successRate := 1.0
+	if lbr.requests > 0 {
+		successRate = float64(lbr.requests-lbr.errors+1) / float64(lbr.requests+1)
+	}
+	return tp * successRate / float64(lbr.active+1)
 }
 
 // AddLoadBalanceServer 增加负载均衡服务器
@@ -65,6 +336,14 @@ func (der *Downloader) AddLoadBalanceServer(urls ...string) {
 	der.loadBalansers = append(der.loadBalansers, urls...)
 }
 
+// LoadBalancerStats 获取所有下载地址的统计信息, 下载未开始时返回nil
+func (der *Downloader) LoadBalancerStats() []*LoadBalancerStats {
+	if der.loadBalancerList == nil {
+		return nil
+	}
+	return der.loadBalancerList.Stats()
+}
+
 // DefaultLoadBalancerCompareFunc 检测负载均衡的服务器是否一致
 func DefaultLoadBalancerCompareFunc(info map[string]string, subResp *http.Response) bool {
 	if info == nil || subResp == nil {
@@ -0,0 +1,89 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+)
+
+func TestLoadBalancerResponseList(t *testing.T) {
+	panClient := &config.PanClient{}
+	main := &LoadBalancerResponse{URL: "https://main.example.com/file", PanClient: panClient, FileId: "main"}
+	sub := &LoadBalancerResponse{URL: "https://sub.example.com/file", PanClient: panClient, FileId: "sub"}
+	mirror := &LoadBalancerResponse{URL: "http://mirror.example.com/file"}
+	lbrl := NewLoadBalancerResponseList([]*LoadBalancerResponse{main, sub})
+	lbrl.Add(mirror)
+
+	// 没有统计信息时按照worker数量平均分配
+	workers := make([]*Worker, 6)
+	for i := range workers {
+		workers[i] = NewWorker(i, "", "", "", nil, nil)
+		workers[i].SetLoadBalancer(lbrl, lbrl.HealthyGet())
+	}
+	for _, s := range lbrl.Stats() {
+		if s.Active != 2 {
+			t.Fatalf("unexpected active workers: %s %d", s.Host(), s.Active)
+		}
+	}
+	if workers[0].url != main.URL || workers[1].fileId != "sub" || workers[2].url != mirror.URL || workers[2].fileId != "" {
+		t.Errorf("unexpected worker source: %s %s %s", workers[0].url, workers[1].fileId, workers[2].fileId)
+	}
+
+	// 优先使用速度快的下载地址
+	main.RecordResponse(206, 100*time.Millisecond)
+	main.RecordDownloaded(10<<20, time.Second)
+	sub.RecordResponse(206, 300*time.Millisecond)
+	sub.RecordDownloaded(1<<20, time.Second)
+	workers[1].selectSource()
+	if workers[1].source != main || sub.Stats().Active != 1 || main.Stats().Active != 3 {
+		t.Errorf("worker should switch to faster source: %s", workers[1].url)
+	}
+
+	// 连续网络错误后移除, 使用该地址的worker换用其他地址
+	for i := 0; i < MaxLoadBalancerNetErrors; i++ {
+		if sub.RecordNetError() >= MaxLoadBalancerNetErrors {
+			workers[4].evictSource(EvictReasonNetError)
+		}
+	}
+	if s := sub.Stats(); !s.Evicted || s.EvictReason != EvictReasonNetError || s.Errors != 3 || s.Requests != 4 {
+		t.Fatalf("unexpected sub stats: %+v", s)
+	}
+	workers[4].selectSource()
+	if workers[4].source == sub || sub.Stats().Active != 0 {
+		t.Errorf("worker should leave evicted source")
+	}
+	if lbrl.SequentialGet() == sub || lbrl.SequentialGet() == sub || lbrl.SequentialGet() == sub {
+		t.Errorf("evicted source should be skipped")
+	}
+
+	// 镜像地址过期无法刷新, 直接移除
+	workers[2].RefreshDownloadUrl()
+	if !mirror.Evicted() || workers[2].source != main {
+		t.Errorf("mirror should be evicted")
+	}
+
+	// 最后一个可用的下载地址不移除
+	if lbrl.Evict(main, "404 Not Found") || main.Evicted() {
+		t.Errorf("last source should not be evicted")
+	}
+
+	// 刷新链接后替换
+	renewed := main.Renew("https://main.example.com/file?renew")
+	lbrl.Replace(main, renewed, EvictReasonExpired)
+	if lbrl.Len() != 3 || !main.Evicted() || lbrl.HealthyGet() != renewed || renewed.FileId != "main" {
+		t.Errorf("source should be replaced")
+	}
+	for _, s := range lbrl.Stats() {
+		if s.URL == main.URL {
+			t.Errorf("replaced source should be removed from the list")
+		}
+	}
+	workers[0].RefreshDownloadUrl()
+	if workers[0].url != renewed.URL || renewed.Stats().Active != 1 {
+		t.Errorf("worker should use renewed source: %s", workers[0].url)
+	}
+	if s := main.Stats(); s.Latency != 100*time.Millisecond || s.Throughput != 10<<20 || s.Downloaded != 10<<20 {
+		t.Errorf("unexpected main stats: %+v", s)
+	}
+}
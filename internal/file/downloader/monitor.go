@@ -25,6 +25,9 @@ import (
 var (
 	//ErrNoWokers no workers
 	ErrNoWokers = errors.New("no workers")
+
+	// monitorTickInterval 监控worker的时间间隔
+	monitorTickInterval = 990 * time.Millisecond
 )
 
 type (
@@ -36,7 +39,8 @@ type (
 		completed       chan struct{}
 		err             error
 		resetController *ResetController
-		isReloadWorker  bool //是否重载worker
+		parallel        *ParallelController // 并发数控制器
+		isReloadWorker  bool                //是否重载worker
 
 		// 临时变量
 		lastAvaliableIndex int
@@ -62,6 +66,9 @@ func (mt *Monitor) lazyInit() {
 	if mt.resetController == nil {
 		mt.resetController = NewResetController(1000)
 	}
+	if mt.parallel == nil {
+		mt.parallel = NewParallelController(len(mt.workers))
+	}
 }
 
 // InitMonitorCapacity 初始化workers, 用于Append
@@ -92,6 +99,19 @@ func (mt *Monitor) SetInstanceState(instanceState *InstanceState) {
 	mt.instanceState = instanceState
 }
 
+// SetParallelController 设置并发数控制器
+func (mt *Monitor) SetParallelController(pc *ParallelController) {
+	mt.parallel = pc
+}
+
+// ParallelLimit 当前允许的并发数
+func (mt *Monitor) ParallelLimit() int {
+	if mt.parallel == nil {
+		return len(mt.workers)
+	}
+	return mt.parallel.Limit()
+}
+
 // Status 返回DownloadStatus
 func (mt *Monitor) Status() *transfer.DownloadStatus {
 	return mt.status
@@ -130,6 +150,30 @@ func (mt *Monitor) GetAllWorkersRange() transfer.RangeList {
 	return allWorkerRanges
 }
 
+// GetAllWorkersRangeState 获取所有worker的范围和校验信息的快照
+func (mt *Monitor) GetAllWorkersRangeState() transfer.RangeList {
+	allWorkerRanges := make(transfer.RangeList, 0, len(mt.workers))
+	for _, worker := range mt.workers {
+		allWorkerRanges = append(allWorkerRanges, worker.GetRangeState())
+	}
+	return allWorkerRanges
+}
+
+// NumRunningWorkers 正在下载的worker数量
+func (mt *Monitor) NumRunningWorkers() (num int) {
+	for _, worker := range mt.workers {
+		if worker.Running() {
+			num++
+		}
+	}
+	return
+}
+
+// canStartWorker 正在下载的worker数量是否小于当前允许的并发数
+func (mt *Monitor) canStartWorker() bool {
+	return mt.NumRunningWorkers() < mt.ParallelLimit()
+}
+
 // NumLeftWorkers 剩余的worker数量
 func (mt *Monitor) NumLeftWorkers() (num int) {
 	for _, worker := range mt.workers {
@@ -200,7 +244,7 @@ func (mt *Monitor) registerAllCompleted() {
 // ResetFailedAndNetErrorWorkers 重设部分网络错误的worker
 func (mt *Monitor) ResetFailedAndNetErrorWorkers() {
 	for k := range mt.workers {
-		if !mt.resetController.CanReset() {
+		if !mt.resetController.CanReset() || !mt.canStartWorker() {
 			continue
 		}
 
@@ -244,43 +288,74 @@ func (mt *Monitor) Resume() {
 	}
 }
 
-// TryAddNewWork 尝试加入新range
-func (mt *Monitor) TryAddNewWork() {
+// TryAddNewWork 尝试加入新range, 返回是否已加入
+func (mt *Monitor) TryAddNewWork() bool {
 	if mt.status == nil {
-		return
+		return false
 	}
 	gen := mt.status.RangeListGen()
 	if gen == nil || gen.IsDone() {
-		return
+		return false
 	}
 
 	if !mt.resetController.CanReset() { //能否建立新连接
-		return
+		return false
 	}
 
 	availableWorker := mt.GetAvailableWorker()
 	if availableWorker == nil {
-		return
+		return false
 	}
 
 	// 有空闲的range, 执行
 	_, r := gen.GenRange()
 	if r == nil {
 		// 没有range了
-		return
+		return false
 	}
 
 	availableWorker.SetRange(r)
+	availableWorker.selectSource()
 	availableWorker.ClearStatus()
 
 	mt.resetController.AddResetNum()
 	logger.Verbosef("MONITER: worker[%d] add new range: %s\n", availableWorker.ID(), r.ShowDetails())
 	go availableWorker.Execute()
+	return true
+}
+
+// tryResumeWaitingWork 尝试恢复排队中或者遇到限流的worker, 返回是否已恢复
+func (mt *Monitor) tryResumeWaitingWork() bool {
+	for _, worker := range mt.workers {
+		if !worker.Waiting() {
+			continue
+		}
+		worker.ClearStatus()
+		logger.Verbosef("MONITER: worker[%d] resume: %s\n", worker.ID(), worker.GetRange().ShowDetails())
+		go worker.Execute()
+		return true
+	}
+	return false
+}
+
+// schedule 根据下载速度和限流情况调整并发数, 在并发数空闲时优先恢复等待中的worker, 然后分配新的range
+func (mt *Monitor) schedule() {
+	var throttled int64
+	for _, worker := range mt.workers {
+		throttled += worker.ThrottledCount()
+	}
+	running := mt.NumRunningWorkers()
+	limit := mt.parallel.Update(time.Now(), running, mt.status.SpeedsPerSecond(), throttled)
+	for ; running < limit; running++ {
+		if !mt.tryResumeWaitingWork() && !mt.TryAddNewWork() {
+			return
+		}
+	}
 }
 
 // DynamicSplitWorker 动态分配线程
 func (mt *Monitor) DynamicSplitWorker(worker *Worker) {
-	if !mt.resetController.CanReset() {
+	if !mt.resetController.CanReset() || !mt.canStartWorker() {
 		return
 	}
 
@@ -310,6 +385,8 @@ func (mt *Monitor) DynamicSplitWorker(worker *Worker) {
 	availableWorkerRange := availableWorker.GetRange()
 	availableWorkerRange.StoreBegin(middle) // middle不能加1
 	availableWorkerRange.StoreEnd(end)
+	availableWorker.resetChecksum()
+	availableWorker.selectSource()
 	availableWorker.ClearStatus()
 
 	workerRange.StoreEnd(middle)
@@ -343,14 +420,14 @@ func (mt *Monitor) ResetWorker(worker *Worker) {
 	case StatusCodeWaitToWrite: // 正在写入数据
 		fallthrough
 	case StatusCodePaused: // 已暂停
+		fallthrough
+	case StatusCodeQueued, StatusCodeTooManyConnections, StatusCodeDownloadUrlExceedMaxConcurrency: // 排队中或者遇到限流, 由 schedule 按照并发数恢复
 		// 忽略, 返回
 		return
 	case StatusCodeDownloadUrlExpired: // 下载链接已经过期
 		logger.Verbosef("download url expired, reset worker: %d\n", worker.ID())
 		worker.RefreshDownloadUrl()
 		break
-	case StatusCodeDownloadUrlExceedMaxConcurrency: // 下载遇到限流报错
-		break
 	}
 
 	mt.resetController.AddResetNum()
@@ -368,13 +445,22 @@ func (mt *Monitor) Execute(cancelCtx context.Context) {
 	}
 
 	mt.lazyInit()
+	started, limit := 0, mt.parallel.Limit()
 	for _, worker := range mt.workers {
 		worker.SetDownloadStatus(mt.status)
+		if worker.GetRange() != nil && worker.GetRange().Len() > 0 {
+			// 超过当前允许的并发数, 排队等待
+			if started >= limit {
+				worker.status.SetStatusCode(StatusCodeQueued)
+				continue
+			}
+			started++
+		}
 		go worker.Execute()
 	}
 
 	mt.registerAllCompleted() // 注册completed
-	ticker := time.NewTicker(990 * time.Millisecond)
+	ticker := time.NewTicker(monitorTickInterval)
 	defer ticker.Stop()
 
 	//开始监控
@@ -400,16 +486,16 @@ func (mt *Monitor) Execute(cancelCtx context.Context) {
 			if mt.instanceState != nil {
 				mt.instanceState.Put(&transfer.DownloadInstanceInfo{
 					DownloadStatus: mt.status,
-					Ranges:         mt.GetAllWorkersRange(),
+					Ranges:         mt.GetAllWorkersRangeState(),
 				})
 			}
 
-			// 加入新range
-			mt.TryAddNewWork()
+			// 调整并发数, 恢复等待中的worker, 加入新range
+			mt.schedule()
 
-			// 是否有失败的worker
+			// 是否有链接过期的worker
 			for _, w := range mt.workers {
-				if w.status.statusCode == StatusCodeDownloadUrlExpired || w.status.statusCode == StatusCodeDownloadUrlExceedMaxConcurrency {
+				if w.status.statusCode == StatusCodeDownloadUrlExpired {
 					mt.ResetWorker(w)
 				}
 			}
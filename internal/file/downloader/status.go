@@ -67,6 +67,8 @@ const (
 	StatusCodeDownloadUrlExceedMaxConcurrency
 	//StatusCodeIllegalDownloadFile 文件非法，不允许下载
 	StatusCodeIllegalDownloadFile
+	//StatusCodeQueued 排队中, 等待并发数空闲后继续下载
+	StatusCodeQueued
 )
 
 // GetStatusText 根据状态码获取状态信息
@@ -100,6 +102,8 @@ func GetStatusText(sc StatusCode) string {
 		return "链接已过期"
 	case StatusCodeDownloadUrlExceedMaxConcurrency:
 		return "遇到限流报错"
+	case StatusCodeQueued:
+		return "排队中"
 	default:
 		return "未知状态码"
 	}
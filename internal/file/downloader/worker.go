@@ -25,11 +25,13 @@ import (
 	"github.com/tickstep/library-go/logger"
 	"github.com/tickstep/library-go/requester"
 	"github.com/tickstep/library-go/requester/rio/speeds"
+	"hash/crc64"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -43,7 +45,9 @@ type (
 		id               int            // work id
 		fileId           string         // 文件ID
 		driveId          string
-		url              string // 下载地址
+		url              string                    // 下载地址
+		loadBalancer     *LoadBalancerResponseList // 下载地址列表
+		source           *LoadBalancerResponse     // 当前使用的下载地址
 		acceptRanges     string
 		panClient        *config.PanClient
 		client           *requester.HTTPClient
@@ -58,6 +62,15 @@ type (
 		err                    error // 错误信息
 		status                 WorkerStatus
 		downloadStatus         *transfer.DownloadStatus // 总的下载状态
+		checksum               rangeChecksum            // 已写入数据的校验信息
+		throttled              int64                    // 遇到限流的次数
+	}
+
+	// rangeChecksum 分片已写入数据的校验信息, [begin, wrange.Begin) 的数据的CRC64为 crc64
+	rangeChecksum struct {
+		mu    sync.Mutex
+		begin int64
+		crc64 uint64
 	}
 
 	// WorkerList worker列表
@@ -131,10 +144,78 @@ func (wer *Worker) SetAcceptRange(acceptRanges string) {
 func (wer *Worker) SetRange(r *transfer.Range) {
 	if wer.wrange == nil {
 		wer.wrange = r
+	} else {
+		wer.wrange.StoreBegin(r.LoadBegin())
+		wer.wrange.StoreEnd(r.LoadEnd())
+	}
+	wer.setChecksum(r.SumBegin, r.Crc64)
+}
+
+// setChecksum 设置已写入数据的校验信息, 校验信息无效时从当前的 Begin 开始计算
+func (wer *Worker) setChecksum(sumBegin int64, crc uint64) {
+	wer.checksum.mu.Lock()
+	defer wer.checksum.mu.Unlock()
+	begin := wer.wrange.LoadBegin()
+	if sumBegin > begin || (crc == 0 && sumBegin != begin) {
+		sumBegin, crc = begin, 0
+	}
+	wer.checksum.begin, wer.checksum.crc64 = sumBegin, crc
+}
+
+// resetChecksum 分片的 Begin 被修改后重新计算校验信息
+func (wer *Worker) resetChecksum() {
+	wer.setChecksum(wer.wrange.LoadBegin(), 0)
+}
+
+// SetLoadBalancer 设置下载地址列表和当前使用的下载地址
+func (wer *Worker) SetLoadBalancer(lbrl *LoadBalancerResponseList, source *LoadBalancerResponse) {
+	wer.loadBalancer = lbrl
+	wer.setSource(source)
+}
+
+// setSource 切换使用的下载地址
+func (wer *Worker) setSource(source *LoadBalancerResponse) {
+	if source == wer.source {
+		return
+	}
+	if wer.source != nil {
+		wer.source.addActive(-1)
+	}
+	wer.source = source
+	if source == nil {
 		return
 	}
-	wer.wrange.StoreBegin(r.LoadBegin())
-	wer.wrange.StoreEnd(r.LoadEnd())
+	source.addActive(1)
+	wer.url = source.URL
+	if !source.IsMirror() {
+		wer.panClient = source.PanClient
+		wer.driveId = source.DriveId
+		wer.fileId = source.FileId
+	}
+}
+
+// selectSource 重新选择最健康的下载地址
+func (wer *Worker) selectSource() {
+	if wer.loadBalancer == nil {
+		return
+	}
+	current := wer.source
+	wer.setSource(nil) // 不计算自身的占用
+	best := wer.loadBalancer.HealthyGet()
+	if best == nil {
+		best = current
+	}
+	wer.setSource(best)
+}
+
+// evictSource 移除当前使用的下载地址, 下次执行时换用其他下载地址
+func (wer *Worker) evictSource(reason string) {
+	if wer.loadBalancer == nil || wer.source == nil {
+		return
+	}
+	if wer.loadBalancer.Evict(wer.source, reason) {
+		logger.Verbosef("worker[%d] evict download url, reason: %s, url: %s\n", wer.ID(), reason, wer.source.URL)
+	}
 }
 
 // SetWriteMutex 设置数据写锁
@@ -163,6 +244,18 @@ func (wer *Worker) GetRange() *transfer.Range {
 	return wer.wrange
 }
 
+// GetRangeState 返回worker范围和已写入数据的校验信息的快照, 用于保存断点续传信息
+func (wer *Worker) GetRangeState() *transfer.Range {
+	wer.checksum.mu.Lock()
+	defer wer.checksum.mu.Unlock()
+	return &transfer.Range{
+		Begin:    wer.wrange.LoadBegin(),
+		End:      wer.wrange.LoadEnd(),
+		SumBegin: wer.checksum.begin,
+		Crc64:    wer.checksum.crc64,
+	}
+}
+
 // GetSpeedsPerSecond 获取每秒的速度
 func (wer *Worker) GetSpeedsPerSecond() int64 {
 	return wer.speedsStat.GetSpeeds()
@@ -220,6 +313,15 @@ func (wer *Worker) Reset() {
 
 // RefreshDownloadUrl 重新刷新下载链接
 func (wer *Worker) RefreshDownloadUrl() {
+	if wer.source != nil && wer.loadBalancer != nil {
+		if wer.source.Evicted() || wer.source.IsMirror() {
+			// 已经被其他worker刷新, 或者镜像地址无法刷新, 直接换用其他下载地址
+			wer.evictSource(EvictReasonExpired)
+			wer.selectSource()
+			return
+		}
+	}
+
 	var apierr *apierror.ApiError
 	logger.Verbosef("get new download url for worker: %d\n", wer.ID())
 	durl, apierr := wer.panClient.OpenapiPanClient().GetFileDownloadUrl(&aliyunpan.GetFileDownloadUrlParam{DriveId: wer.driveId, FileId: wer.fileId})
@@ -228,7 +330,13 @@ func (wer *Worker) RefreshDownloadUrl() {
 		wer.status.statusCode = StatusCodeTooManyConnections
 		return
 	}
-	wer.url = durl.Url
+	if wer.source != nil && wer.loadBalancer != nil {
+		source := wer.source.Renew(durl.Url)
+		wer.loadBalancer.Replace(wer.source, source, EvictReasonExpired)
+		wer.setSource(source)
+	} else {
+		wer.url = durl.Url
+	}
 	logger.Verbosef("get new download url for worker: %d, new url: %s\n", wer.ID(), wer.url)
 }
 
@@ -262,6 +370,31 @@ func (wer *Worker) ClearStatus() {
 	wer.status.statusCode = StatusCodeInit
 }
 
+// Running 是否正在下载, 包括等待响应和写入数据
+func (wer *Worker) Running() bool {
+	switch wer.status.statusCode {
+	case StatusCodeInit, StatusCodePending, StatusCodeDownloading, StatusCodeWaitToWrite, StatusCodeReseted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Waiting 是否在等待并发数空闲后继续下载, 包括排队中和遇到限流的worker
+func (wer *Worker) Waiting() bool {
+	switch wer.status.statusCode {
+	case StatusCodeQueued, StatusCodeTooManyConnections, StatusCodeDownloadUrlExceedMaxConcurrency:
+		return wer.wrange != nil && wer.wrange.Len() > 0
+	default:
+		return false
+	}
+}
+
+// ThrottledCount 遇到限流的次数
+func (wer *Worker) ThrottledCount() int64 {
+	return atomic.LoadInt64(&wer.throttled)
+}
+
 // Err 返回worker错误
 func (wer *Worker) Err() error {
 	return wer.err
@@ -275,6 +408,11 @@ func (wer *Worker) Execute() {
 	wer.execMu.Lock()
 	defer wer.execMu.Unlock()
 
+	// 当前的下载地址已被移除, 换用其他下载地址
+	if wer.source != nil && wer.source.Evicted() {
+		wer.selectSource()
+	}
+
 	wer.status.statusCode = StatusCodeInit
 	single := wer.acceptRanges == ""
 
@@ -307,8 +445,8 @@ func (wer *Worker) Execute() {
 
 	wer.status.statusCode = StatusCodePending
 
-	// check url expired or not
-	if IsUrlExpired(wer.url) {
+	// check url expired or not, 镜像地址不检查
+	if (wer.source == nil || !wer.source.IsMirror()) && IsUrlExpired(wer.url) {
 		logger.Verbosef("download url expired, renew url and reset worker: %d\n", wer.ID())
 		wer.status.statusCode = StatusCodeDownloadUrlExpired
 		wer.err = errors.New("403")
@@ -317,6 +455,7 @@ func (wer *Worker) Execute() {
 
 	// do download data
 	var resp *http.Response
+	requestTime := time.Now()
 	apierr := wer.panClient.OpenapiPanClient().DownloadFileData(wer.url, aliyunpan.FileDownloadRange{
 		Offset: wer.wrange.Begin,
 		End:    wer.wrange.End - 1,
@@ -338,8 +477,14 @@ func (wer *Worker) Execute() {
 	}
 	if wer.err != nil || apierr != nil {
 		wer.status.statusCode = StatusCodeNetError
+		if wer.source != nil && wer.source.RecordNetError() >= MaxLoadBalancerNetErrors {
+			wer.evictSource(EvictReasonNetError)
+		}
 		return
 	}
+	if wer.source != nil {
+		wer.source.RecordResponse(resp.StatusCode, time.Since(requestTime))
+	}
 
 	// 判断响应状态
 	switch resp.StatusCode {
@@ -369,28 +514,40 @@ func (wer *Worker) Execute() {
 				//  <RecommendDoc>https://api.aliyun.com/troubleshoot?q=0007-00000209</RecommendDoc>
 				//</Error>
 				logger.Verboseln("download url return 403 error and exceed max concurrency response")
+				atomic.AddInt64(&wer.throttled, 1)
 				wer.status.statusCode = StatusCodeDownloadUrlExceedMaxConcurrency
 				wer.err = errors.New(resp.Status)
 
 				// 遇到限流，本线程延迟后，再重试
 				time.Sleep(10 * time.Second)
+			} else {
+				// 其他错误, 换用其他下载地址
+				wer.status.statusCode = StatusCodeNetError
+				wer.err = errors.New(resp.Status)
+				wer.evictSource(resp.Status)
 			}
 		}
 		return
 	case 406: // Not Acceptable
 		wer.status.statusCode = StatusCodeNetError
 		wer.err = errors.New(resp.Status)
+		wer.evictSource(resp.Status)
 		return
 	case 404:
 		logger.Verboseln("request download url 404 error")
+		wer.evictSource(resp.Status)
 		fallthrough
 	case 429, 509: // Too Many Requests
+		if resp.StatusCode != 404 {
+			atomic.AddInt64(&wer.throttled, 1)
+		}
 		wer.status.SetStatusCode(StatusCodeTooManyConnections)
 		wer.err = errors.New(resp.Status)
 		return
 	default:
 		wer.status.statusCode = StatusCodeNetError
 		wer.err = fmt.Errorf("unexpected http status code, %d, %s", resp.StatusCode, resp.Status)
+		wer.evictSource(resp.Status)
 		return
 	}
 
@@ -423,8 +580,17 @@ func (wer *Worker) Execute() {
 		buf       = cachepool.SyncPool.Get().([]byte)
 		n, nn     int
 		n64, nn64 int64
+
+		// 下载地址的速度统计
+		sampleTime  = time.Now()
+		sampleBytes int64
 	)
 	defer cachepool.SyncPool.Put(buf)
+	defer func() {
+		if wer.source != nil {
+			wer.source.RecordDownloaded(sampleBytes, time.Since(sampleTime))
+		}
+	}()
 
 	for {
 		select {
@@ -505,8 +671,16 @@ func (wer *Worker) Execute() {
 				wer.status.statusCode = StatusCodeDownloading
 			}
 
-			// 更新下载统计数据
+			// 更新下载统计数据和校验信息
+			wer.checksum.mu.Lock()
+			wer.checksum.crc64 = crc64.Update(wer.checksum.crc64, crc64Table, buf[:n])
 			wer.wrange.AddBegin(n64)
+			wer.checksum.mu.Unlock()
+			sampleBytes += n64
+			if elapsed := time.Since(sampleTime); wer.source != nil && elapsed >= time.Second {
+				wer.source.RecordDownloaded(sampleBytes, elapsed)
+				sampleTime, sampleBytes = time.Now(), 0
+			}
 			if wer.downloadStatus != nil {
 				wer.downloadStatus.AddDownloaded(n64)
 				if single {
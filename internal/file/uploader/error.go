@@ -22,6 +22,8 @@ var (
 	UploadTerminate                   = fmt.Errorf("UploadErrorTerminate")
 	UploadPartAlreadyExist            = fmt.Errorf("PartAlreadyExist")
 	UploadHttpError                   = fmt.Errorf("HttpError")
+	UploadNetError                    = fmt.Errorf("NetError")
+	UploadPartsIncomplete             = fmt.Errorf("PartsIncomplete")
 	UploadLocalFileAlreadyClosedError = fmt.Errorf("LocalFileAlreadyClosedError")
 )
 
@@ -39,7 +39,6 @@ func (muer *MultiUploader) getWorkerListByInstanceState(is *InstanceState) worke
 				id:         blockState.ID,
 				partOffset: blockState.Range.Begin,
 				splitUnit:  NewBufioSplitUnit(muer.file, blockState.Range, muer.speedsStat, muer.rateLimit, muer.globalSpeedsStat),
-				uploadDone: false,
 			})
 		} else {
 			// 已经完成的, 也要加入
@@ -47,7 +46,7 @@ func (muer *MultiUploader) getWorkerListByInstanceState(is *InstanceState) worke
 				id:         blockState.ID,
 				partOffset: blockState.Range.Begin,
 				splitUnit:  NewBufioSplitUnit(muer.file, blockState.Range, muer.speedsStat, muer.rateLimit, muer.globalSpeedsStat),
-				uploadDone: true,
+				uploadDone: 1,
 			})
 		}
 	}
@@ -58,6 +58,7 @@ type (
 		finished                chan struct{}
 		canceled                chan struct{}
 		closeCanceledOnce       sync.Once
+		sequential              bool // 服务器拒绝乱序上传的分片，已经退回单线程按顺序上传
 		updateInstanceStateChan chan struct{}
 
 		// 网盘上传参数
@@ -67,7 +68,7 @@ type (
 
 	// MultiUploaderConfig 多线程上传配置
 	MultiUploaderConfig struct {
-		Parallel  int   // 上传并发量
+		Parallel  int   // 单个文件同时上传的分片数量, 服务器不支持乱序上传时自动退回1
 		BlockSize int64 // 上传分块
 		MaxRate   int64 // 限制最大上传速度
 	}
@@ -185,7 +186,7 @@ func (muer *MultiUploader) InstanceState() *InstanceState {
 		blockStates = append(blockStates, &BlockState{
 			ID:         wer.id,
 			Range:      wer.splitUnit.Range(),
-			UploadDone: wer.uploadDone,
+			UploadDone: wer.isUploadDone(),
 		})
 	}
 	return &InstanceState{
@@ -193,9 +194,16 @@ func (muer *MultiUploader) InstanceState() *InstanceState {
 	}
 }
 
+// Sequential 是否已经退回单线程按顺序上传分片
+func (muer *MultiUploader) Sequential() bool {
+	return muer.sequential
+}
+
 // Cancel 取消上传
 func (muer *MultiUploader) Cancel() {
-	close(muer.canceled)
+	muer.closeCanceledOnce.Do(func() {
+		close(muer.canceled)
+	})
 }
 
 // OnExecute 设置开始上传事件
@@ -22,6 +22,8 @@ import (
 	"github.com/tickstep/library-go/requester"
 	"io"
 	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 type (
@@ -29,17 +31,31 @@ type (
 		id         int // ID从0开始计数
 		partOffset int64
 		splitUnit  SplitUnit
-		uploadDone bool
+		uploadDone int32 // 1 表示分片已上传完成，上传线程和保存断点续传信息的线程同时读写，使用原子操作
 	}
 
 	workerList []*worker
 )
 
+// isUploadDone 分片是否已上传完成
+func (wer *worker) isUploadDone() bool {
+	return atomic.LoadInt32(&wer.uploadDone) == 1
+}
+
+// setUploadDone 设置分片是否已上传完成
+func (wer *worker) setUploadDone(done bool) {
+	var v int32
+	if done {
+		v = 1
+	}
+	atomic.StoreInt32(&wer.uploadDone, v)
+}
+
 // Readed 获取已上传大小
 func (werl *workerList) Readed() int64 {
 	var readed int64
 	for _, wer := range *werl {
-		if wer.uploadDone {
+		if wer.isUploadDone() {
 			// 已经上传完成的分片
 			readed += wer.splitUnit.Range().End - wer.splitUnit.Range().Begin
 		} else {
@@ -56,111 +72,39 @@ func (muer *MultiUploader) upload() (uperr error) {
 		return err
 	}
 
-	var (
-		uploadDeque = lane.NewDeque()
-	)
-
 	// 加入队列
 	// 一个worker对应一个分片
 	// 这里跳过已经上传成功的分片
-	for _, wer := range muer.workers {
-		if !wer.uploadDone {
-			uploadDeque.Append(wer)
-		}
-	}
+	uploadDeque := muer.pendingDeque()
 
-	// 上传客户端
+	// 上传客户端, 所有分片共用
 	uploadClient := requester.NewHTTPClient()
 	uploadClient.SetTimeout(0)
 	uploadClient.SetKeepAlive(true)
 
-	for {
-		// 阿里云盘只支持分片按顺序上传，这里必须是parallel = 1
-		wg := waitgroup.NewWaitGroup(muer.config.Parallel)
-		wg.AddDelta()
-
-		uperr = nil
-		e := uploadDeque.Shift()
-		if e == nil { // 任务为空
-			break
-		}
-
-		wer := e.(*worker)
-		go func() { // 异步上传
-			defer wg.Done()
-
-			var (
-				ctx, cancel = context.WithCancel(context.Background())
-				doneChan    = make(chan struct{})
-				uploadDone  bool
-				terr        error
-			)
-			go func() {
-				if !wer.uploadDone {
-					logger.Verboseln("begin to upload part num: " + strconv.Itoa(wer.id+1))
-					uploadDone, terr = muer.multiUpload.UploadFile(ctx, int(wer.id), wer.partOffset, wer.splitUnit.Range().End, wer.splitUnit, uploadClient)
-				} else {
-					uploadDone = true
-				}
-				close(doneChan)
-			}()
-			select { // 监听上传进程，循环阻塞
-			case <-muer.canceled:
-				cancel()
-				return
-			case <-doneChan:
-				// continue
-				logger.Verboseln("multiUpload worker upload file http action done")
+	// 多个分片同时上传，分片可以乱序完成。服务器不支持乱序上传时退回单线程按顺序上传
+	parallel := muer.config.Parallel
+	for uploadDeque.Size() > 0 {
+		var stopErr error
+		uperr, stopErr = muer.uploadRound(uploadDeque, parallel, uploadClient)
+		if stopErr != nil {
+			if errors.Is(stopErr, UploadPartNotSeq) && parallel > 1 {
+				// 服务器拒绝乱序的分片，等待正在上传的分片完成后，剩余的分片按顺序逐个上传
+				logger.Verbosef("upload part not sequential, fallback to sequential upload: %s\n", muer.UploadOpEntity.FileId)
+				parallel = 1
+				muer.sequential = true
+				uploadDeque = muer.pendingDeque()
+				uperr = nil
+				continue
 			}
-			cancel()
-			if terr != nil {
-				logger.Verbosef("upload file part err: %+v\n", terr)
-				if me, ok := terr.(*MultiError); ok {
-					if me.Terminated { // 终止
-						muer.closeCanceledOnce.Do(func() { // 只关闭一次
-							close(muer.canceled)
-						})
-						uperr = me.Err
-						return
-					} else if me.NeedStartOver {
-						logger.Verbosef("upload start over: %d\n", wer.id)
-						// 从头开始上传
-						muer.closeCanceledOnce.Do(func() { // 只关闭一次
-							close(muer.canceled)
-						})
-						uperr = me.Err
-						return
-					} else {
-						uperr = me.Err
-						return
-					}
-				}
-
-				logger.Verbosef("upload worker err: %s, id: %d\n", terr, wer.id)
-				wer.splitUnit.Seek(0, io.SeekStart)
-				uploadDeque.Prepend(wer) // 放回上传队列首位
-				return
-			}
-			wer.uploadDone = uploadDone
-
-			// 通知更新
-			if muer.updateInstanceStateChan != nil && len(muer.updateInstanceStateChan) < cap(muer.updateInstanceStateChan) {
-				muer.updateInstanceStateChan <- struct{}{}
-			}
-		}()
-		wg.Wait()
-		if uperr != nil {
-			if errors.Is(uperr, UploadPartNotSeq) ||
-				errors.Is(uperr, UploadNoSuchUpload) ||
-				errors.Is(uperr, UploadLocalFileAlreadyClosedError) {
-				// 清空数据，停止上传
-				uploadDeque = lane.NewDeque() // 清空待上传列表
-			}
-		}
-		// 没有任务了
-		if uploadDeque.Size() == 0 {
+			uperr = stopErr
 			break
 		}
+		select {
+		case <-muer.canceled:
+			uploadDeque = lane.NewDeque() // 清空待上传列表
+		default:
+		}
 	}
 
 	// 释放链路
@@ -186,7 +130,7 @@ func (muer *MultiUploader) upload() (uperr error) {
 	// 检测是否全部分片上传成功
 	allSuccess := true
 	for _, wer := range muer.workers {
-		allSuccess = allSuccess && wer.uploadDone
+		allSuccess = allSuccess && wer.isUploadDone()
 	}
 	if allSuccess {
 		e := muer.multiUpload.CommitFile()
@@ -196,7 +140,119 @@ func (muer *MultiUploader) upload() (uperr error) {
 		}
 	} else {
 		logger.Verboseln("upload file not all success: " + muer.UploadOpEntity.FileId)
+		if uperr == nil {
+			uperr = UploadPartsIncomplete
+		}
+	}
+
+	return
+}
+
+// pendingDeque 按照分片顺序返回未上传完成的分片队列
+func (muer *MultiUploader) pendingDeque() *lane.Deque {
+	uploadDeque := lane.NewDeque()
+	for _, wer := range muer.workers {
+		if !wer.isUploadDone() {
+			uploadDeque.Append(wer)
+		}
 	}
+	return uploadDeque
+}
+
+// uploadRound 最多 parallel 个分片同时上传，直到队列为空或者遇到需要停止上传的错误.
+// 返回最后一个分片错误，以及需要停止上传的错误(分片乱序，上传任务不存在，本地文件已关闭，不可恢复的错误)
+func (muer *MultiUploader) uploadRound(uploadDeque *lane.Deque, parallel int, uploadClient *requester.HTTPClient) (uperr, stopErr error) {
+	var (
+		wg      = waitgroup.NewWaitGroup(parallel)
+		errLock sync.Mutex
+		stopped bool
+	)
+	for {
+		wg.AddDelta()
+		errLock.Lock()
+		isStopped := stopped
+		errLock.Unlock()
+		e := uploadDeque.Shift()
+		if isStopped || e == nil { // 任务为空
+			if e != nil {
+				uploadDeque.Prepend(e)
+			}
+			wg.Done()
+			break
+		}
 
+		wer := e.(*worker)
+		go func() { // 异步上传
+			defer wg.Done()
+			err, stop := muer.uploadWorker(wer, uploadDeque, uploadClient)
+			if err == nil {
+				return
+			}
+			errLock.Lock()
+			defer errLock.Unlock()
+			uperr = err
+			if stop && !stopped {
+				stopped = true
+				stopErr = err
+			}
+		}()
+	}
+	wg.Wait()
 	return
 }
+
+// uploadWorker 上传一个分片，返回上传错误和是否需要停止上传
+func (muer *MultiUploader) uploadWorker(wer *worker, uploadDeque *lane.Deque, uploadClient *requester.HTTPClient) (uperr error, stop bool) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		doneChan    = make(chan struct{})
+		uploadDone  bool
+		terr        error
+	)
+	defer cancel()
+	go func() {
+		if !wer.isUploadDone() {
+			logger.Verboseln("begin to upload part num: " + strconv.Itoa(wer.id+1))
+			uploadDone, terr = muer.multiUpload.UploadFile(ctx, int(wer.id), wer.partOffset, wer.splitUnit.Range().End, wer.splitUnit, uploadClient)
+		} else {
+			uploadDone = true
+		}
+		close(doneChan)
+	}()
+	select { // 监听上传进程，循环阻塞
+	case <-muer.canceled:
+		return nil, false
+	case <-doneChan:
+		// continue
+		logger.Verboseln("multiUpload worker upload file http action done")
+	}
+	if terr != nil {
+		logger.Verbosef("upload file part err: %+v\n", terr)
+		wer.splitUnit.Seek(0, io.SeekStart) // 分片重新上传时从头读取
+		if me, ok := terr.(*MultiError); ok {
+			if me.Terminated || me.NeedStartOver { // 终止或者从头开始上传
+				if me.NeedStartOver {
+					logger.Verbosef("upload start over: %d\n", wer.id)
+				}
+				muer.closeCanceledOnce.Do(func() { // 只关闭一次
+					close(muer.canceled)
+				})
+				return me.Err, true
+			}
+			return me.Err, errors.Is(me.Err, UploadPartNotSeq) ||
+				errors.Is(me.Err, UploadNoSuchUpload) ||
+				errors.Is(me.Err, UploadLocalFileAlreadyClosedError)
+		}
+
+		logger.Verbosef("upload worker err: %s, id: %d\n", terr, wer.id)
+		uploadDeque.Prepend(wer) // 放回上传队列首位
+		return nil, false
+	}
+	wer.setUploadDone(uploadDone)
+
+	// 通知更新
+	if muer.updateInstanceStateChan != nil && len(muer.updateInstanceStateChan) < cap(muer.updateInstanceStateChan) {
+		muer.updateInstanceStateChan <- struct{}{}
+	}
+	return nil, false
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panalbum
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// BackupFile 待备份的本地文件
+	BackupFile struct {
+		LocalPath string
+		Size      int64
+		ModTime   time.Time
+		Sha1      string
+		// Folder 按照拍摄时间归档的目录，格式为 YYYY/MM
+		Folder string
+	}
+
+	// BackupFailure 无法备份的本地文件
+	BackupFailure struct {
+		File *BackupFile
+		Err  error
+	}
+
+	// BackupPlan 相册备份计划
+	BackupPlan struct {
+		// Upload 需要上传的文件，按照归档目录分组
+		Upload map[string][]*BackupFile
+		// Skipped 已经备份过并且没有修改的文件
+		Skipped []*BackupFile
+		// Duplicates 和已备份或者本次上传的文件内容相同的文件，不再上传
+		Duplicates []*BackupFile
+		Failed     []*BackupFailure
+	}
+)
+
+// NewBackupPlan 根据备份记录生成备份计划。sha1Sum 用于计算本地文件的SHA1，只有没有备份记录的文件才需要计算
+func NewBackupPlan(db *BackupDatabase, albumId string, files []*BackupFile, sha1Sum func(localPath string) (string, error)) *BackupPlan {
+	plan := &BackupPlan{
+		Upload: map[string][]*BackupFile{},
+	}
+	uploading := map[string]bool{}
+	for _, f := range files {
+		if db.GetFile(albumId, f.LocalPath, f.Size, f.ModTime.Unix()) != nil {
+			plan.Skipped = append(plan.Skipped, f)
+			continue
+		}
+		sha1, err := sha1Sum(f.LocalPath)
+		if err != nil {
+			plan.Failed = append(plan.Failed, &BackupFailure{File: f, Err: err})
+			continue
+		}
+		f.Sha1 = strings.ToUpper(sha1)
+		if uploading[f.Sha1] || db.GetHash(albumId, f.Sha1) != nil {
+			plan.Duplicates = append(plan.Duplicates, f)
+			continue
+		}
+		uploading[f.Sha1] = true
+		f.Folder = DateFolder(CaptureTime(f.LocalPath, f.ModTime))
+		plan.Upload[f.Folder] = append(plan.Upload[f.Folder], f)
+	}
+	return plan
+}
+
+// Folders 需要上传文件的归档目录，按照时间排序
+func (bp *BackupPlan) Folders() []string {
+	folders := make([]string, 0, len(bp.Upload))
+	for folder := range bp.Upload {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+	return folders
+}
+
+// UploadCount 需要上传的文件数量
+func (bp *BackupPlan) UploadCount() int {
+	count := 0
+	for _, files := range bp.Upload {
+		count += len(files)
+	}
+	return count
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panalbum
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/tickstep/bolt"
+)
+
+const (
+	// BackupDatabaseFileName 相册备份记录的数据库文件名，保存在配置目录下
+	BackupDatabaseFileName = "aliyunpan_album_backup.db"
+)
+
+type (
+	// BackupRecord 已备份文件的记录
+	BackupRecord struct {
+		LocalPath string `json:"local_path"`
+		Sha1      string `json:"sha1"`
+		DriveId   string `json:"drive_id"`
+		FileId    string `json:"file_id"`
+		PanPath   string `json:"pan_path"`
+		BackupAt  int64  `json:"backup_at"`
+	}
+
+	// BackupDatabase 相册备份记录，用于增量备份. 记录分为两类:
+	// 本地文件记录，key 为相簿ID、本地路径、文件大小和修改时间，未修改的文件无需重新计算SHA1;
+	// 内容记录，key 为相簿ID和SHA1，相同内容的文件只备份一次
+	BackupDatabase struct {
+		db *bolt.DB
+	}
+)
+
+var (
+	backupFilesBucket  = []byte("files")
+	backupHashesBucket = []byte("hashes")
+)
+
+// OpenBackupDatabase 打开相册备份记录数据库，使用完需要关闭
+func OpenBackupDatabase(dbPath string) (*BackupDatabase, error) {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{backupFilesBucket, backupHashesBucket} {
+			if _, e := tx.CreateBucketIfNotExists(name); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BackupDatabase{db: db}, nil
+}
+
+// Close 关闭数据库
+func (bd *BackupDatabase) Close() error {
+	return bd.db.Close()
+}
+
+func backupFileKey(albumId, localPath string, size, modTime int64) []byte {
+	return []byte(albumId + "\x00" + localPath + "\x00" + strconv.FormatInt(size, 10) + "\x00" + strconv.FormatInt(modTime, 10))
+}
+
+func backupHashKey(albumId, sha1 string) []byte {
+	return []byte(albumId + "\x00" + strings.ToUpper(sha1))
+}
+
+func (bd *BackupDatabase) get(bucket, key []byte) *BackupRecord {
+	var record *BackupRecord
+	bd.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get(key)
+		if data == nil {
+			return nil
+		}
+		r := &BackupRecord{}
+		if jsoniter.Unmarshal(data, r) == nil {
+			record = r
+		}
+		return nil
+	})
+	return record
+}
+
+// GetFile 获取本地文件的备份记录，文件修改过则返回nil
+func (bd *BackupDatabase) GetFile(albumId, localPath string, size, modTime int64) *BackupRecord {
+	return bd.get(backupFilesBucket, backupFileKey(albumId, localPath, size, modTime))
+}
+
+// GetHash 获取相同内容文件的备份记录
+func (bd *BackupDatabase) GetHash(albumId, sha1 string) *BackupRecord {
+	return bd.get(backupHashesBucket, backupHashKey(albumId, sha1))
+}
+
+// PutFile 记录本地文件已备份. 内容相同的文件已经备份过时，record 指向已经备份的云盘文件
+func (bd *BackupDatabase) PutFile(albumId string, size, modTime int64, record *BackupRecord) error {
+	data, err := jsoniter.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return bd.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(backupFilesBucket).Put(backupFileKey(albumId, record.LocalPath, size, modTime), data)
+	})
+}
+
+// Put 记录文件已上传并加入相簿，同时记录本地文件和文件内容
+func (bd *BackupDatabase) Put(albumId string, size, modTime int64, record *BackupRecord) error {
+	data, err := jsoniter.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return bd.db.Update(func(tx *bolt.Tx) error {
+		if e := tx.Bucket(backupFilesBucket).Put(backupFileKey(albumId, record.LocalPath, size, modTime), data); e != nil {
+			return e
+		}
+		return tx.Bucket(backupHashesBucket).Put(backupHashKey(albumId, record.Sha1), data)
+	})
+}
@@ -0,0 +1,89 @@
+package panalbum
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupDatabase(t *testing.T) {
+	db, err := OpenBackupDatabase(filepath.Join(t.TempDir(), BackupDatabaseFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	record := &BackupRecord{LocalPath: "/photos/a.jpg", Sha1: "abcd", DriveId: "1", FileId: "f1"}
+	if err := db.Put("album1", 10, 100, record); err != nil {
+		t.Fatal(err)
+	}
+	if r := db.GetFile("album1", "/photos/a.jpg", 10, 100); r == nil || r.FileId != "f1" {
+		t.Errorf("unexpected file record %v", r)
+	}
+	if db.GetFile("album1", "/photos/a.jpg", 10, 101) != nil {
+		t.Errorf("modified file should not have record")
+	}
+	if db.GetFile("album2", "/photos/a.jpg", 10, 100) != nil {
+		t.Errorf("other album should not have record")
+	}
+	if r := db.GetHash("album1", "ABCD"); r == nil || r.FileId != "f1" {
+		t.Errorf("unexpected hash record %v", r)
+	}
+
+	dup := *record
+	dup.LocalPath = "/photos/b.jpg"
+	db.PutFile("album1", 10, 200, &dup)
+	if r := db.GetFile("album1", "/photos/b.jpg", 10, 200); r == nil || r.FileId != "f1" {
+		t.Errorf("unexpected duplicate record %v", r)
+	}
+}
+
+func TestNewBackupPlan(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenBackupDatabase(filepath.Join(dir, BackupDatabaseFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	modTime := time.Date(2022, 5, 1, 0, 0, 0, 0, time.Local)
+	newFile := func(name string) *BackupFile {
+		p := filepath.Join(dir, name)
+		os.WriteFile(p, []byte(name), 0644)
+		return &BackupFile{LocalPath: p, Size: int64(len(name)), ModTime: modTime}
+	}
+	backed := newFile("backed.mp4")
+	db.Put("album1", backed.Size, modTime.Unix(), &BackupRecord{LocalPath: backed.LocalPath, Sha1: "S0"})
+	files := []*BackupFile{backed, newFile("a.mp4"), newFile("b.mp4"), newFile("c.mp4"), newFile("d.mp4")}
+
+	sums := map[string]string{"a.mp4": "s1", "b.mp4": "s1", "c.mp4": "s0", "d.mp4": ""}
+	hashed := 0
+	plan := NewBackupPlan(db, "album1", files, func(localPath string) (string, error) {
+		hashed++
+		sum := sums[filepath.Base(localPath)]
+		if sum == "" {
+			return "", errors.New("read error")
+		}
+		return sum, nil
+	})
+	if hashed != 4 {
+		t.Errorf("backed up file should not be hashed, hashed %d", hashed)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0] != backed {
+		t.Errorf("unexpected skipped files %v", plan.Skipped)
+	}
+	if len(plan.Duplicates) != 2 {
+		t.Errorf("unexpected duplicate files %v", plan.Duplicates)
+	}
+	if len(plan.Failed) != 1 {
+		t.Errorf("unexpected failed files %v", plan.Failed)
+	}
+	if plan.UploadCount() != 1 || len(plan.Upload["2022/05"]) != 1 || plan.Upload["2022/05"][0].Sha1 != "S1" {
+		t.Errorf("unexpected upload files %v", plan.Upload)
+	}
+	if folders := plan.Folders(); len(folders) != 1 || folders[0] != "2022/05" {
+		t.Errorf("unexpected folders %v", folders)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panalbum
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/utils"
+)
+
+const (
+	// DownloadStateFileName 相簿增量下载记录文件名，保存在下载的根目录下
+	DownloadStateFileName = ".aliyunpan_album_download.json"
+)
+
+type (
+	// NameTemplate 相簿文件保存路径模板，例如 {taken:2006/01}/{name}
+	NameTemplate struct {
+		tpl string
+	}
+
+	// DownloadedFile 已下载的相簿文件
+	DownloadedFile struct {
+		LocalPath   string `json:"localPath"`
+		ContentHash string `json:"contentHash"`
+		Size        int64  `json:"size"`
+		DownloadAt  int64  `json:"downloadAt"`
+	}
+
+	// AlbumDownloadRecord 一个相簿的下载记录，key 为 DownloadFileKey
+	AlbumDownloadRecord struct {
+		LastDownloadAt int64                      `json:"lastDownloadAt"`
+		Files          map[string]*DownloadedFile `json:"files"`
+	}
+
+	// DownloadState 相簿增量下载记录
+	DownloadState struct {
+		path   string
+		locker sync.Mutex
+		Albums map[string]*AlbumDownloadRecord `json:"albums"`
+	}
+)
+
+var (
+	fileTimeLayouts = []string{"2006-01-02 15:04:05", time.RFC3339}
+)
+
+// ParseNameTemplate 解析保存路径模板，支持的变量:
+// {album} 相簿名称, {name} 文件名, {base} 不含扩展名的文件名, {ext} 扩展名, {id} 文件ID,
+// {taken:格式} 拍摄时间, {created:格式} 创建时间, {updated:格式} 修改时间. 时间格式使用Go的时间格式，例如 2006/01
+func ParseNameTemplate(tpl string) (*NameTemplate, error) {
+	rest := tpl
+	for {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("模板缺少 }: %s", tpl)
+		}
+		name, layout, _ := strings.Cut(rest[start+1:start+end], ":")
+		switch name {
+		case "album", "name", "base", "ext", "id":
+		case "taken", "created", "updated":
+			if layout == "" {
+				return nil, fmt.Errorf("时间变量需要指定格式，例如 {%s:2006/01}", name)
+			}
+		default:
+			return nil, fmt.Errorf("不支持的模板变量: {%s}", name)
+		}
+		rest = rest[start+end+1:]
+	}
+	if strings.Contains(rest, "}") {
+		return nil, fmt.Errorf("模板缺少 {: %s", tpl)
+	}
+	return &NameTemplate{tpl: tpl}, nil
+}
+
+// ParseFileTime 解析相簿文件元数据中的时间
+func ParseFileTime(timeStr string) (time.Time, bool) {
+	for _, layout := range fileTimeLayouts {
+		if t, err := time.ParseInLocation(layout, timeStr, time.Local); err == nil {
+			return t.In(time.Local), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// TakenTime 相簿文件的拍摄时间。接口没有返回拍摄时间，使用相簿元数据中的创建时间，没有则使用修改时间
+func TakenTime(f *aliyunpan.FileEntity) (time.Time, bool) {
+	if t, ok := ParseFileTime(f.CreatedAt); ok {
+		return t, true
+	}
+	return ParseFileTime(f.UpdatedAt)
+}
+
+// Render 生成文件保存的相对路径，使用 / 分隔。路径中的 .. 不能跳出保存目录
+func (nt *NameTemplate) Render(albumName string, f *aliyunpan.FileEntity) string {
+	var result strings.Builder
+	rest := nt.tpl
+	for {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			result.WriteString(rest)
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		result.WriteString(rest[:start])
+		name, layout, _ := strings.Cut(rest[start+1:start+end], ":")
+		result.WriteString(nt.value(name, layout, albumName, f))
+		rest = rest[start+end+1:]
+	}
+
+	rendered := strings.ReplaceAll(result.String(), "\\", "/")
+	p := path.Clean("/" + rendered)
+	if p == "/" || strings.HasSuffix(rendered, "/") {
+		// 模板只生成了目录，使用原文件名
+		p = path.Join(p, f.FileName)
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+func (nt *NameTemplate) value(name, layout, albumName string, f *aliyunpan.FileEntity) string {
+	ext := path.Ext(f.FileName)
+	var (
+		t  time.Time
+		ok bool
+	)
+	switch name {
+	case "album":
+		return albumName
+	case "name":
+		return f.FileName
+	case "base":
+		return strings.TrimSuffix(f.FileName, ext)
+	case "ext":
+		return strings.TrimPrefix(ext, ".")
+	case "id":
+		return f.FileId
+	case "taken":
+		t, ok = TakenTime(f)
+	case "created":
+		t, ok = ParseFileTime(f.CreatedAt)
+	case "updated":
+		t, ok = ParseFileTime(f.UpdatedAt)
+	}
+	if !ok {
+		return "unknown"
+	}
+	return t.Format(layout)
+}
+
+// DownloadFileKey 下载记录的key，实况照片拆分的照片和视频文件的ID相同，需要加上文件名区分
+func DownloadFileKey(f *aliyunpan.FileEntity) string {
+	return f.FileId + "/" + f.FileName
+}
+
+// NewDownloadState 创建空的相簿增量下载记录
+func NewDownloadState(statePath string) *DownloadState {
+	return &DownloadState{
+		path:   statePath,
+		Albums: map[string]*AlbumDownloadRecord{},
+	}
+}
+
+// LoadDownloadState 读取相簿增量下载记录，文件不存在则返回空的记录
+func LoadDownloadState(statePath string) (*DownloadState, error) {
+	ds := NewDownloadState(statePath)
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ds, nil
+		}
+		return nil, err
+	}
+	if err = jsoniter.Unmarshal(data, ds); err != nil {
+		return nil, err
+	}
+	if ds.Albums == nil {
+		ds.Albums = map[string]*AlbumDownloadRecord{}
+	}
+	return ds, nil
+}
+
+// Save 保存下载记录
+func (ds *DownloadState) Save() error {
+	ds.locker.Lock()
+	defer ds.locker.Unlock()
+	return utils.WriteJsonFileAtomic(ds.path, ds, 0600)
+}
+
+// IsDownloaded 文件是否已经下载过，并且本地文件没有被删除或者修改大小
+func (ds *DownloadState) IsDownloaded(albumId, key, localPath string) bool {
+	ds.locker.Lock()
+	defer ds.locker.Unlock()
+	record := ds.Albums[albumId]
+	if record == nil || record.Files[key] == nil {
+		return false
+	}
+	df := record.Files[key]
+	if df.LocalPath != localPath {
+		return false
+	}
+	info, err := os.Stat(localPath)
+	return err == nil && !info.IsDir() && info.Size() == df.Size
+}
+
+// MarkDownloaded 记录文件已下载
+func (ds *DownloadState) MarkDownloaded(albumId, key string, df *DownloadedFile) {
+	ds.locker.Lock()
+	defer ds.locker.Unlock()
+	record := ds.Albums[albumId]
+	if record == nil {
+		record = &AlbumDownloadRecord{Files: map[string]*DownloadedFile{}}
+		ds.Albums[albumId] = record
+	}
+	if record.Files == nil {
+		record.Files = map[string]*DownloadedFile{}
+	}
+	record.Files[key] = df
+	if df.DownloadAt > record.LastDownloadAt {
+		record.LastDownloadAt = df.DownloadAt
+	}
+}
@@ -0,0 +1,84 @@
+package panalbum
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestNameTemplate(t *testing.T) {
+	f := &aliyunpan.FileEntity{
+		FileId:    "f1",
+		FileName:  "IMG_0001.HEIC",
+		CreatedAt: "2023-08-09 10:11:12",
+		UpdatedAt: "2024-01-02 03:04:05",
+	}
+	for tpl, want := range map[string]string{
+		"{name}":                              "IMG_0001.HEIC",
+		"{taken:2006/01}/{name}":              "2023/08/IMG_0001.HEIC",
+		"{album}/{updated:2006}/{base}.{ext}": "家庭/2024/IMG_0001.HEIC",
+		"{taken:2006-01-02}/":                 "2023-08-09/IMG_0001.HEIC",
+		"../../{id}_{name}":                   "f1_IMG_0001.HEIC",
+	} {
+		nt, err := ParseNameTemplate(tpl)
+		if err != nil {
+			t.Fatalf("parse %s: %s", tpl, err)
+		}
+		if got := nt.Render("家庭", f); got != want {
+			t.Errorf("render %s: got %s, want %s", tpl, got, want)
+		}
+	}
+
+	noTime := &aliyunpan.FileEntity{FileName: "a.jpg"}
+	nt, _ := ParseNameTemplate("{taken:2006}/{name}")
+	if got := nt.Render("", noTime); got != "unknown/a.jpg" {
+		t.Errorf("unexpected render without time: %s", got)
+	}
+
+	for _, tpl := range []string{"{size}", "{taken}", "{name", "name}"} {
+		if _, err := ParseNameTemplate(tpl); err == nil {
+			t.Errorf("template %s should be invalid", tpl)
+		}
+	}
+}
+
+func TestDownloadState(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, DownloadStateFileName)
+	ds, err := LoadDownloadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localPath := filepath.Join(dir, "a.jpg")
+	os.WriteFile(localPath, []byte("hello"), 0644)
+	f := &aliyunpan.FileEntity{FileId: "f1", FileName: "a.jpg"}
+	if ds.IsDownloaded("album1", DownloadFileKey(f), localPath) {
+		t.Fatal("file should not be downloaded")
+	}
+	ds.MarkDownloaded("album1", DownloadFileKey(f), &DownloadedFile{LocalPath: localPath, Size: 5, DownloadAt: 100})
+	if err = ds.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err = LoadDownloadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ds.IsDownloaded("album1", DownloadFileKey(f), localPath) {
+		t.Error("file should be downloaded")
+	}
+	if ds.Albums["album1"].LastDownloadAt != 100 {
+		t.Errorf("unexpected last download time %d", ds.Albums["album1"].LastDownloadAt)
+	}
+	if ds.IsDownloaded("album1", DownloadFileKey(f), filepath.Join(dir, "b.jpg")) {
+		t.Error("file saved to another path should not be downloaded")
+	}
+
+	// 本地文件被修改后需要重新下载
+	os.WriteFile(localPath, []byte("hello world"), 0644)
+	if ds.IsDownloaded("album1", DownloadFileKey(f), localPath) {
+		t.Error("modified file should be downloaded again")
+	}
+}
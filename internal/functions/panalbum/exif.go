@@ -0,0 +1,176 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panalbum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	exifTagDateTime          = 0x0132
+	exifTagExifIFDPointer    = 0x8769
+	exifTagDateTimeOriginal  = 0x9003
+	exifTagDateTimeDigitized = 0x9004
+
+	exifTypeASCII = 2
+	exifTypeLong  = 4
+
+	// exifDateTimeLayout EXIF中日期的格式
+	exifDateTimeLayout = "2006:01:02 15:04:05"
+
+	// maxExifSegmentSize APP1段的最大长度
+	maxExifSegmentSize = 64 * 1024
+)
+
+var (
+	// ErrExifNotFound 文件中没有EXIF拍摄时间
+	ErrExifNotFound = errors.New("exif datetime not found")
+)
+
+// ReadExifDateTime 读取图片的EXIF拍摄时间，支持JPEG和TIFF格式(包括基于TIFF的RAW格式，例如 DNG, NEF, CR2, ARW).
+// 优先使用 DateTimeOriginal，其次是 DateTimeDigitized 和 DateTime。EXIF中的时间没有时区，按照本地时间解析
+func ReadExifDateTime(filePath string) (time.Time, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	head, err := r.Peek(4)
+	if err != nil {
+		return time.Time{}, ErrExifNotFound
+	}
+	switch {
+	case head[0] == 0xFF && head[1] == 0xD8:
+		tiff, err := readJpegExif(r)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return parseTiffDateTime(tiff)
+	case bytes.Equal(head, []byte("II*\x00")) || bytes.Equal(head, []byte("MM\x00*")):
+		// TIFF格式的IFD可能在文件任意位置，只读取文件开头的部分
+		tiff, _ := io.ReadAll(io.LimitReader(r, 1024*1024))
+		return parseTiffDateTime(tiff)
+	}
+	return time.Time{}, ErrExifNotFound
+}
+
+// readJpegExif 读取JPEG文件中APP1段的TIFF数据
+func readJpegExif(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(2); err != nil { // SOI
+		return nil, ErrExifNotFound
+	}
+	for {
+		marker := make([]byte, 4)
+		if _, err := io.ReadFull(r, marker); err != nil || marker[0] != 0xFF {
+			return nil, ErrExifNotFound
+		}
+		// SOS之后是图像数据，不会再有EXIF
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return nil, ErrExifNotFound
+		}
+		size := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 {
+			return nil, ErrExifNotFound
+		}
+		if marker[1] != 0xE1 || size > maxExifSegmentSize {
+			if _, err := r.Discard(size); err != nil {
+				return nil, ErrExifNotFound
+			}
+			continue
+		}
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, ErrExifNotFound
+		}
+		// APP1段也可能是XMP数据
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+// parseTiffDateTime 从TIFF数据的IFD0和Exif IFD中读取拍摄时间
+func parseTiffDateTime(tiff []byte) (time.Time, error) {
+	if len(tiff) < 8 {
+		return time.Time{}, ErrExifNotFound
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, ErrExifNotFound
+	}
+
+	values := map[uint16]string{}
+	ifd0 := readIfd(tiff, order, order.Uint32(tiff[4:]), values)
+	if offset, ok := ifd0[exifTagExifIFDPointer]; ok {
+		readIfd(tiff, order, offset, values)
+	}
+	for _, tag := range []uint16{exifTagDateTimeOriginal, exifTagDateTimeDigitized, exifTagDateTime} {
+		if v, ok := values[tag]; ok {
+			if t, err := time.ParseInLocation(exifDateTimeLayout, v, time.Local); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, ErrExifNotFound
+}
+
+// readIfd 读取一个IFD中的日期字段保存到 values，返回LONG类型的字段
+func readIfd(tiff []byte, order binary.ByteOrder, offset uint32, values map[uint16]string) map[uint16]uint32 {
+	longs := map[uint16]uint32{}
+	if int64(offset)+2 > int64(len(tiff)) {
+		return longs
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := int64(offset) + 2 + int64(i)*12
+		if entry+12 > int64(len(tiff)) {
+			break
+		}
+		tag := order.Uint16(tiff[entry:])
+		typ := order.Uint16(tiff[entry+2:])
+		n := order.Uint32(tiff[entry+4:])
+		switch typ {
+		case exifTypeLong:
+			longs[tag] = order.Uint32(tiff[entry+8:])
+		case exifTypeASCII:
+			if tag != exifTagDateTime && tag != exifTagDateTimeOriginal && tag != exifTagDateTimeDigitized {
+				continue
+			}
+			// 超过4字节的值保存在偏移量指向的位置
+			start := entry + 8
+			if n > 4 {
+				start = int64(order.Uint32(tiff[entry+8:]))
+			}
+			if start+int64(n) > int64(len(tiff)) {
+				continue
+			}
+			values[tag] = strings.TrimRight(string(tiff[start:start+int64(n)]), "\x00 ")
+		}
+	}
+	return longs
+}
@@ -0,0 +1,118 @@
+package panalbum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// buildTiff 生成包含 DateTime 和 Exif IFD 中 DateTimeOriginal 的TIFF数据
+func buildTiff(order binary.ByteOrder, dateTime, original string) []byte {
+	buf := &bytes.Buffer{}
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(buf, order, uint16(42))
+	binary.Write(buf, order, uint32(8))
+
+	// IFD0 在偏移量8处，之后是 Exif IFD，字符串数据放在最后
+	ifd0Count, exifCount := 2, 1
+	exifOffset := uint32(8 + 2 + ifd0Count*12 + 4)
+	dataOffset := exifOffset + uint32(2+exifCount*12+4)
+	binary.Write(buf, order, uint16(ifd0Count))
+	binary.Write(buf, order, uint16(exifTagDateTime))
+	binary.Write(buf, order, uint16(exifTypeASCII))
+	binary.Write(buf, order, uint32(len(dateTime)+1))
+	binary.Write(buf, order, dataOffset)
+	binary.Write(buf, order, uint16(exifTagExifIFDPointer))
+	binary.Write(buf, order, uint16(exifTypeLong))
+	binary.Write(buf, order, uint32(1))
+	binary.Write(buf, order, exifOffset)
+	binary.Write(buf, order, uint32(0))
+
+	binary.Write(buf, order, uint16(exifCount))
+	binary.Write(buf, order, uint16(exifTagDateTimeOriginal))
+	binary.Write(buf, order, uint16(exifTypeASCII))
+	binary.Write(buf, order, uint32(len(original)+1))
+	binary.Write(buf, order, dataOffset+uint32(len(dateTime)+1))
+	binary.Write(buf, order, uint32(0))
+
+	buf.WriteString(dateTime + "\x00")
+	buf.WriteString(original + "\x00")
+	return buf.Bytes()
+}
+
+func buildJpeg(tiff []byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{0xFF, 0xD8})
+	// APP0 JFIF
+	buf.Write([]byte{0xFF, 0xE0, 0x00, 0x07})
+	buf.WriteString("JFIF\x00")
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	buf.Write([]byte{0xFF, 0xE1})
+	binary.Write(buf, binary.BigEndian, uint16(len(segment)+2))
+	buf.Write(segment)
+	buf.Write([]byte{0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9})
+	return buf.Bytes()
+}
+
+func TestReadExifDateTime(t *testing.T) {
+	dir := t.TempDir()
+	want := time.Date(2021, 7, 3, 18, 30, 5, 0, time.Local)
+
+	jpg := filepath.Join(dir, "a.jpg")
+	os.WriteFile(jpg, buildJpeg(buildTiff(binary.BigEndian, "2022:01:01 00:00:00", "2021:07:03 18:30:05")), 0644)
+	if got, err := ReadExifDateTime(jpg); err != nil || !got.Equal(want) {
+		t.Errorf("jpeg: got %v, %v", got, err)
+	}
+
+	tif := filepath.Join(dir, "b.dng")
+	os.WriteFile(tif, buildTiff(binary.LittleEndian, "2022:01:01 00:00:00", "2021:07:03 18:30:05"), 0644)
+	if got, err := ReadExifDateTime(tif); err != nil || !got.Equal(want) {
+		t.Errorf("tiff: got %v, %v", got, err)
+	}
+
+	png := filepath.Join(dir, "c.png")
+	os.WriteFile(png, []byte("\x89PNG\r\n\x1a\n"), 0644)
+	if _, err := ReadExifDateTime(png); err != ErrExifNotFound {
+		t.Errorf("png: unexpected error %v", err)
+	}
+}
+
+func TestCaptureTime(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Date(2023, 12, 31, 23, 0, 0, 0, time.Local)
+
+	jpg := filepath.Join(dir, "a.JPG")
+	os.WriteFile(jpg, buildJpeg(buildTiff(binary.LittleEndian, "2020:02:29 12:00:00", "")), 0644)
+	if folder := DateFolder(CaptureTime(jpg, modTime)); folder != "2020/02" {
+		t.Errorf("unexpected jpeg folder %s", folder)
+	}
+
+	mp4 := filepath.Join(dir, "b.mp4")
+	os.WriteFile(mp4, []byte("video"), 0644)
+	if folder := DateFolder(CaptureTime(mp4, modTime)); folder != "2023/12" {
+		t.Errorf("unexpected video folder %s", folder)
+	}
+}
+
+func TestIsMediaFile(t *testing.T) {
+	videos := []string{"mp4", "mov"}
+	for name, want := range map[string]bool{
+		"a.JPG":      true,
+		"b.heic":     true,
+		"c.MOV":      true,
+		"d.txt":      false,
+		"e":          false,
+		"dir/f.jpeg": true,
+	} {
+		if IsMediaFile(name, videos) != want {
+			t.Errorf("IsMediaFile(%s) should be %v", name, want)
+		}
+	}
+}
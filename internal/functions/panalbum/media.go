@@ -0,0 +1,73 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panalbum
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ImageExtensions 相册备份支持的图片文件扩展名
+	ImageExtensions = []string{
+		"jpg", "jpeg", "png", "gif", "bmp", "webp", "heic", "heif", "tif", "tiff",
+		"dng", "raw", "cr2", "cr3", "nef", "arw", "orf", "rw2", "raf",
+	}
+)
+
+// fileExt 小写的文件扩展名，不包含 .
+func fileExt(name string) string {
+	return strings.TrimPrefix(strings.ToLower(path.Ext(name)), ".")
+}
+
+// IsImageFile 是否为图片文件
+func IsImageFile(name string) bool {
+	ext := fileExt(name)
+	for _, e := range ImageExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMediaFile 是否为相册备份的文件，即图片文件或者扩展名在 videoExtensions 中的视频文件
+func IsMediaFile(name string, videoExtensions []string) bool {
+	if IsImageFile(name) {
+		return true
+	}
+	ext := fileExt(name)
+	for _, e := range videoExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// CaptureTime 文件的拍摄时间，图片使用EXIF拍摄时间，没有EXIF信息的图片和视频使用文件修改时间
+func CaptureTime(filePath string, modTime time.Time) time.Time {
+	if IsImageFile(filePath) {
+		if t, err := ReadExifDateTime(filePath); err == nil {
+			return t
+		}
+	}
+	return modTime
+}
+
+// DateFolder 按照拍摄时间归档的目录，格式为 YYYY/MM
+func DateFolder(t time.Time) string {
+	return t.Format("2006/01")
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panbackup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/library-go/requester"
+)
+
+const (
+	// ManifestFileName 快照清单文件名，保存在快照目录的根目录下
+	ManifestFileName = ".aliyunpan-manifest.json"
+
+	// ManifestVersion 清单文件格式版本
+	ManifestVersion = "1.0"
+)
+
+type (
+	// ManifestFile 快照清单中的一个文件
+	ManifestFile struct {
+		// Path 相对快照目录的路径，以 / 分隔
+		Path string `json:"path"`
+		// Size 文件大小
+		Size int64 `json:"size"`
+		// Sha1 文件SHA1
+		Sha1 string `json:"sha1"`
+	}
+
+	// Manifest 快照清单
+	Manifest struct {
+		Version string `json:"version"`
+		// Snapshot 快照名称
+		Snapshot string `json:"snapshot"`
+		// LocalFolderPath 备份的本地目录
+		LocalFolderPath string `json:"localFolderPath"`
+		// CreatedAt 快照创建时间
+		CreatedAt string `json:"createdAt"`
+		// Complete 快照是否完整，即本地文件是否已经全部备份成功
+		Complete bool `json:"complete"`
+		// TotalSize 文件总大小
+		TotalSize int64 `json:"totalSize"`
+		// Files 文件列表，按路径排序
+		Files []*ManifestFile `json:"files"`
+	}
+
+	// ManifestDiff 清单对比结果
+	ManifestDiff struct {
+		// Missing 清单中存在，实际不存在的文件
+		Missing []*ManifestFile
+		// Mismatch 大小或者SHA1不一致的文件
+		Mismatch []*ManifestFile
+		// Extra 实际存在，清单中不存在的文件
+		Extra []*ManifestFile
+	}
+)
+
+// IsEmpty 是否完全一致
+func (d *ManifestDiff) IsEmpty() bool {
+	return len(d.Missing) == 0 && len(d.Mismatch) == 0 && len(d.Extra) == 0
+}
+
+// AddFile 增加文件
+func (m *Manifest) AddFile(f *ManifestFile) {
+	m.Files = append(m.Files, f)
+	m.TotalSize += f.Size
+}
+
+// Sort 按路径排序
+func (m *Manifest) Sort() {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+}
+
+// Compare 对比清单和实际的文件列表。sha1为空的文件只对比大小
+func (m *Manifest) Compare(actualFiles []*ManifestFile) *ManifestDiff {
+	diff := &ManifestDiff{}
+	actual := map[string]*ManifestFile{}
+	for _, f := range actualFiles {
+		actual[f.Path] = f
+	}
+	for _, f := range m.Files {
+		a, ok := actual[f.Path]
+		if !ok {
+			diff.Missing = append(diff.Missing, f)
+			continue
+		}
+		delete(actual, f.Path)
+		if a.Size != f.Size {
+			diff.Mismatch = append(diff.Mismatch, f)
+			continue
+		}
+		if a.Sha1 != "" && f.Sha1 != "" && !strings.EqualFold(a.Sha1, f.Sha1) {
+			diff.Mismatch = append(diff.Mismatch, f)
+		}
+	}
+	for _, f := range actualFiles {
+		if _, ok := actual[f.Path]; ok {
+			diff.Extra = append(diff.Extra, f)
+		}
+	}
+	return diff
+}
+
+// SaveManifestFile 保存清单到本地文件
+func SaveManifestFile(m *Manifest, filePath string) error {
+	data, e := json.MarshalIndent(m, "", " ")
+	if e != nil {
+		return e
+	}
+	return ioutil.WriteFile(filePath, data, 0644)
+}
+
+// LoadManifestFile 读取本地清单文件
+func LoadManifestFile(filePath string) (*Manifest, error) {
+	data, e := ioutil.ReadFile(filePath)
+	if e != nil {
+		return nil, e
+	}
+	m := &Manifest{}
+	if e = json.Unmarshal(data, m); e != nil {
+		return nil, e
+	}
+	return m, nil
+}
+
+// LoadPanManifest 直接读取云盘快照目录下的清单文件，不保存到本地
+func LoadPanManifest(panClient *config.PanClient, driveId, snapshotPath string) (*Manifest, error) {
+	client := panClient.OpenapiPanClient()
+	fi, apierr := client.FileInfoByPath(driveId, path.Join(snapshotPath, ManifestFileName))
+	if apierr != nil {
+		return nil, apierr
+	}
+	durl, apierr := client.GetFileDownloadUrl(&aliyunpan.GetFileDownloadUrlParam{
+		DriveId: driveId,
+		FileId:  fi.FileId,
+	})
+	if apierr != nil {
+		return nil, apierr
+	}
+	var data []byte
+	apierr = client.DownloadFileData(durl.Url, aliyunpan.FileDownloadRange{}, func(httpMethod, fullUrl string, headers map[string]string) (*http.Response, error) {
+		resp, e := requester.NewHTTPClient().Req(httpMethod, fullUrl, nil, headers)
+		if e != nil {
+			return resp, e
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp, fmt.Errorf("http status: %s", resp.Status)
+		}
+		data, e = io.ReadAll(resp.Body)
+		return resp, e
+	})
+	if apierr != nil {
+		return nil, apierr
+	}
+	m := &Manifest{}
+	if e := json.Unmarshal(data, m); e != nil {
+		return nil, e
+	}
+	return m, nil
+}
+
+// ListPanSnapshotFiles 获取云盘快照目录下的所有文件，清单文件除外。SHA1使用云盘记录的文件哈希
+func ListPanSnapshotFiles(panClient *config.PanClient, driveId, snapshotPath string) ([]*ManifestFile, error) {
+	snapshotPath = path.Clean(snapshotPath)
+	var apiErr error
+	files := []*ManifestFile{}
+	panClient.OpenapiPanClient().FilesDirectoriesRecurseList(driveId, snapshotPath, func(depth int, _ string, fd *aliyunpan.FileEntity, apierr *apierror.ApiError) bool {
+		if apierr != nil {
+			apiErr = apierr
+			return false
+		}
+		if fd.IsFolder() {
+			return true
+		}
+		relativePath := strings.TrimPrefix(strings.TrimPrefix(fd.Path, snapshotPath), "/")
+		if relativePath == ManifestFileName {
+			return true
+		}
+		files = append(files, &ManifestFile{
+			Path: relativePath,
+			Size: fd.FileSize,
+			Sha1: strings.ToUpper(fd.ContentHash),
+		})
+		return true
+	})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return files, nil
+}
@@ -0,0 +1,53 @@
+package panbackup
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestCompare(t *testing.T) {
+	m := &Manifest{Version: ManifestVersion}
+	m.AddFile(&ManifestFile{Path: "a.txt", Size: 3, Sha1: "AAAA"})
+	m.AddFile(&ManifestFile{Path: "dir/b.txt", Size: 5, Sha1: "bbbb"})
+	m.AddFile(&ManifestFile{Path: "dir/c.txt", Size: 7, Sha1: "cccc"})
+	if m.TotalSize != 15 {
+		t.Errorf("unexpected total size %d", m.TotalSize)
+	}
+
+	diff := m.Compare([]*ManifestFile{
+		{Path: "a.txt", Size: 3, Sha1: "aaaa"},
+		{Path: "dir/b.txt", Size: 5, Sha1: "bbbc"},
+		{Path: "dir/d.txt", Size: 1},
+	})
+	if len(diff.Missing) != 1 || diff.Missing[0].Path != "dir/c.txt" {
+		t.Errorf("unexpected missing files: %v", diff.Missing)
+	}
+	if len(diff.Mismatch) != 1 || diff.Mismatch[0].Path != "dir/b.txt" {
+		t.Errorf("unexpected mismatch files: %v", diff.Mismatch)
+	}
+	if len(diff.Extra) != 1 || diff.Extra[0].Path != "dir/d.txt" {
+		t.Errorf("unexpected extra files: %v", diff.Extra)
+	}
+
+	// 没有SHA1只对比大小
+	diff = m.Compare([]*ManifestFile{{Path: "a.txt", Size: 3}, {Path: "dir/b.txt", Size: 5}, {Path: "dir/c.txt", Size: 7}})
+	if !diff.IsEmpty() {
+		t.Error("manifest should match")
+	}
+}
+
+func TestManifestFile(t *testing.T) {
+	m := &Manifest{Version: ManifestVersion, Snapshot: "2026-10-18T02-00", Complete: true}
+	m.AddFile(&ManifestFile{Path: "a.txt", Size: 3, Sha1: "aaaa"})
+	p := filepath.Join(t.TempDir(), ManifestFileName)
+	if e := SaveManifestFile(m, p); e != nil {
+		t.Fatal(e)
+	}
+	m2, e := LoadManifestFile(p)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if m2.Snapshot != m.Snapshot || !m2.Complete || len(m2.Files) != 1 || m2.Files[0].Sha1 != "aaaa" {
+		t.Errorf("unexpected manifest: %+v", m2)
+	}
+}
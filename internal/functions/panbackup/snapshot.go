@@ -0,0 +1,200 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panbackup
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+)
+
+const (
+	// SnapshotTimeFormat 快照目录名称的时间格式
+	SnapshotTimeFormat = "2006-01-02T15-04"
+)
+
+type (
+	// Snapshot 云盘上的一个备份快照
+	Snapshot struct {
+		// Name 快照名称，即快照目录名
+		Name string
+		// Time 快照时间
+		Time time.Time
+		// Path 快照目录完整路径
+		Path string
+		// File 快照目录
+		File *aliyunpan.FileEntity
+		// Incomplete 快照清单缺失，或者快照创建时未完整备份
+		Incomplete bool
+	}
+	SnapshotList []*Snapshot
+
+	// RetentionPolicy 祖父-父-子(GFS)快照保留策略。各项规则保留的快照取并集，全部未配置则保留所有快照
+	RetentionPolicy struct {
+		// KeepLast 保留最近的N个快照
+		KeepLast int
+		// KeepDaily 保留最近N天，每天最新的一个快照
+		KeepDaily int
+		// KeepWeekly 保留最近N周，每周最新的一个快照
+		KeepWeekly int
+		// KeepMonthly 保留最近N个月，每月最新的一个快照
+		KeepMonthly int
+		// KeepYearly 保留最近N年，每年最新的一个快照
+		KeepYearly int
+	}
+)
+
+// NewSnapshotName 生成快照名称
+func NewSnapshotName(t time.Time) string {
+	return t.Format(SnapshotTimeFormat)
+}
+
+// ParseSnapshotName 从快照名称解析快照时间
+func ParseSnapshotName(name string) (time.Time, bool) {
+	t, e := time.ParseInLocation(SnapshotTimeFormat, name, time.Local)
+	if e != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// IsEmpty 是否未配置任何保留规则
+func (p *RetentionPolicy) IsEmpty() bool {
+	return p == nil || (p.KeepLast <= 0 && p.KeepDaily <= 0 && p.KeepWeekly <= 0 && p.KeepMonthly <= 0 && p.KeepYearly <= 0)
+}
+
+// String 策略描述
+func (p *RetentionPolicy) String() string {
+	if p.IsEmpty() {
+		return "保留全部快照"
+	}
+	items := []string{}
+	if p.KeepLast > 0 {
+		items = append(items, fmt.Sprintf("保留最近%d个", p.KeepLast))
+	}
+	if p.KeepDaily > 0 {
+		items = append(items, fmt.Sprintf("按天保留%d个", p.KeepDaily))
+	}
+	if p.KeepWeekly > 0 {
+		items = append(items, fmt.Sprintf("按周保留%d个", p.KeepWeekly))
+	}
+	if p.KeepMonthly > 0 {
+		items = append(items, fmt.Sprintf("按月保留%d个", p.KeepMonthly))
+	}
+	if p.KeepYearly > 0 {
+		items = append(items, fmt.Sprintf("按年保留%d个", p.KeepYearly))
+	}
+	return strings.Join(items, ", ")
+}
+
+// SelectExpiredSnapshots 根据保留策略选出需要删除的快照，snapshots 必须按时间倒序排列。
+// 每个周期（天、周、月、年）只保留该周期内最新的一个快照，周期数量按存在快照的周期计算。
+// 不完整的快照不占用保留名额，也不会被删除，以免连续备份失败时挤掉最后一个完整的快照
+func SelectExpiredSnapshots(snapshots SnapshotList, policy *RetentionPolicy) SnapshotList {
+	if policy.IsEmpty() {
+		return SnapshotList{}
+	}
+	keep := make([]bool, len(snapshots))
+	buckets := []struct {
+		count  int
+		keyGen func(t time.Time) string
+	}{
+		{policy.KeepLast, func(t time.Time) string { return t.Format(time.RFC3339Nano) }},
+		{policy.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{policy.KeepWeekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", y, w)
+		}},
+		{policy.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{policy.KeepYearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, b := range buckets {
+		if b.count <= 0 {
+			continue
+		}
+		lastKey := ""
+		kept := 0
+		for i, s := range snapshots {
+			if kept >= b.count {
+				break
+			}
+			if s.Incomplete {
+				continue
+			}
+			key := b.keyGen(s.Time)
+			if key == lastKey {
+				continue
+			}
+			lastKey = key
+			keep[i] = true
+			kept++
+		}
+	}
+	expired := SnapshotList{}
+	for i, s := range snapshots {
+		if !keep[i] && !s.Incomplete {
+			expired = append(expired, s)
+		}
+	}
+	return expired
+}
+
+// ListSnapshots 获取云盘备份目录下的快照列表，按时间倒序排列
+func ListSnapshots(panClient *config.PanClient, driveId, panBackupPath string) (SnapshotList, error) {
+	panBackupPath = path.Clean(panBackupPath)
+	dir, apierr := panClient.OpenapiPanClient().FileInfoByPath(driveId, panBackupPath)
+	if apierr != nil {
+		if apierr.Code == apierror.ApiCodeFileNotFoundCode {
+			return SnapshotList{}, nil
+		}
+		return nil, apierr
+	}
+	if !dir.IsFolder() {
+		return nil, fmt.Errorf("备份目录不是文件夹: %s", panBackupPath)
+	}
+	files, apierr := panClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
+		DriveId:      driveId,
+		ParentFileId: dir.FileId,
+	}, 500)
+	if apierr != nil {
+		return nil, apierr
+	}
+	snapshots := SnapshotList{}
+	for _, f := range files {
+		if !f.IsFolder() {
+			continue
+		}
+		t, ok := ParseSnapshotName(f.FileName)
+		if !ok {
+			continue
+		}
+		f.Path = path.Join(panBackupPath, f.FileName)
+		snapshots = append(snapshots, &Snapshot{
+			Name: f.FileName,
+			Time: t,
+			Path: f.Path,
+			File: f,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.After(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
@@ -0,0 +1,95 @@
+package panbackup
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestSnapshots(times ...time.Time) SnapshotList {
+	snapshots := SnapshotList{}
+	for _, t := range times {
+		snapshots = append(snapshots, &Snapshot{Name: NewSnapshotName(t), Time: t})
+	}
+	return snapshots
+}
+
+func TestSnapshotName(t *testing.T) {
+	st := time.Date(2026, 10, 18, 2, 0, 0, 0, time.Local)
+	name := NewSnapshotName(st)
+	if name != "2026-10-18T02-00" {
+		t.Errorf("unexpected snapshot name: %s", name)
+	}
+	if pt, ok := ParseSnapshotName(name); !ok || !pt.Equal(st) {
+		t.Errorf("parse snapshot name failed: %s", name)
+	}
+	if _, ok := ParseSnapshotName("documents"); ok {
+		t.Error("invalid snapshot name should not be parsed")
+	}
+}
+
+func TestSelectExpiredSnapshots(t *testing.T) {
+	// 每天2点和14点各一个快照，共60天，倒序排列
+	now := time.Date(2026, 10, 18, 14, 0, 0, 0, time.Local)
+	times := []time.Time{}
+	for d := 0; d < 60; d++ {
+		day := now.AddDate(0, 0, -d)
+		times = append(times, day, day.Add(-12*time.Hour))
+	}
+	snapshots := newTestSnapshots(times...)
+
+	if len(SelectExpiredSnapshots(snapshots, &RetentionPolicy{})) != 0 {
+		t.Error("empty policy should keep all snapshots")
+	}
+
+	expired := SelectExpiredSnapshots(snapshots, &RetentionPolicy{KeepLast: 3})
+	if len(expired) != len(snapshots)-3 || expired[0] != snapshots[3] {
+		t.Errorf("keepLast: unexpected expired count %d", len(expired))
+	}
+
+	// 每天保留最新的一个，即14点的快照
+	expired = SelectExpiredSnapshots(snapshots, &RetentionPolicy{KeepDaily: 7})
+	if len(expired) != len(snapshots)-7 {
+		t.Errorf("keepDaily: unexpected expired count %d", len(expired))
+	}
+	for _, s := range expired {
+		if s.Time.After(now.AddDate(0, 0, -7)) && s.Time.Hour() == 14 {
+			t.Errorf("keepDaily: snapshot should be kept: %s", s.Name)
+		}
+	}
+
+	// 并集：最近7天 + 4周 + 2个月
+	expired = SelectExpiredSnapshots(snapshots, &RetentionPolicy{KeepDaily: 7, KeepWeekly: 4, KeepMonthly: 2})
+	kept := map[string]bool{}
+	for _, s := range snapshots {
+		kept[s.Name] = true
+	}
+	for _, s := range expired {
+		delete(kept, s.Name)
+	}
+	// 2026-10-18是周日，周快照都是周日14点，前7天已包含第一周；月快照为10-18和09-30，共11个
+	for _, name := range []string{"2026-10-18T14-00", "2026-10-12T14-00", "2026-10-11T14-00", "2026-10-04T14-00", "2026-09-27T14-00", "2026-09-30T14-00"} {
+		if !kept[name] {
+			t.Errorf("snapshot should be kept: %s", name)
+		}
+	}
+	if len(kept) != 11 {
+		t.Errorf("unexpected kept count %d", len(kept))
+	}
+}
+
+func TestSelectExpiredSnapshotsSkipIncomplete(t *testing.T) {
+	now := time.Date(2026, 10, 18, 14, 0, 0, 0, time.Local)
+	times := []time.Time{}
+	for d := 0; d < 5; d++ {
+		times = append(times, now.AddDate(0, 0, -d))
+	}
+	snapshots := newTestSnapshots(times...)
+	// 最近3天备份失败
+	for _, s := range snapshots[:3] {
+		s.Incomplete = true
+	}
+	expired := SelectExpiredSnapshots(snapshots, &RetentionPolicy{KeepDaily: 1})
+	if len(expired) != 1 || expired[0] != snapshots[4] {
+		t.Errorf("incomplete snapshots should not take the keep slots: %d", len(expired))
+	}
+}
@@ -64,6 +64,7 @@ type (
 		IsExecutedPermission bool // 下载成功后是否加上执行权限
 		IsOverwrite          bool // 是否覆盖已存在的文件
 		NoCheck              bool // 不校验文件
+		VerifyChecksum       bool // 下载完成后重新读取文件，对比云盘记录的SHA1和CRC64
 
 		FilePanSource      global.FileSourceType // 要下载的网盘文件来源
 		FilePanPath        string                // 要下载的网盘文件路径
@@ -190,7 +191,7 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 	dtu.Cfg.InstanceStatePath = savePathSymlinkFile.RealPath + DownloadSuffix
 
 	// 打开文件
-	writer, file, err = downloader.NewDownloaderWriterByFilename(savePathSymlinkFile.RealPath, os.O_CREATE|os.O_WRONLY, 0666)
+	writer, file, err = downloader.NewDownloaderWriterByFilename(savePathSymlinkFile.RealPath, os.O_CREATE|os.O_RDWR, 0666)
 	if err != nil {
 		return fmt.Errorf("%s, %s", StrDownloadInitError, err)
 	}
@@ -231,7 +232,26 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 
 			// 先空两行
 			builder.WriteString("\n\n")
+			if limit, max := der.ParallelLimit(); max > 0 {
+				fmt.Fprintf(builder, "parallel: %d/%d\n", limit, max)
+			}
 			tb.Render()
+
+			// 输出所有下载地址的统计信息
+			if stats := der.LoadBalancerStats(); len(stats) > 0 {
+				sourceTb := cmdtable.NewTable(builder)
+				sourceTb.SetHeader([]string{"#", "host", "status", "workers", "latency", "speeds", "downloaded", "errors"})
+				for k, s := range stats {
+					sourceStatus := "ok"
+					if s.Evicted {
+						sourceStatus = "evicted: " + s.EvictReason
+					}
+					sourceTb.Append([]string{strconv.Itoa(k), s.Host(), sourceStatus, strconv.Itoa(s.Active), s.Latency.Round(time.Millisecond).String(),
+						converter.ConvertFileSize(s.Throughput, 2) + "/s", converter.ConvertFileSize(s.Downloaded, 2), fmt.Sprintf("%d/%d", s.Errors, s.Requests)})
+				}
+				builder.WriteString("\n")
+				sourceTb.Render()
+			}
 		}
 
 		// 如果下载速度为0, 剩余下载时间未知, 则用 - 代替
@@ -345,13 +365,16 @@ func (dtu *DownloadTaskUnit) checkFileValid(result *taskframework.TaskUnitRunRes
 		return
 	}
 
-	if dtu.fileInfo.FileSize >= 128*converter.MB {
+	if dtu.VerifyChecksum && dtu.fileInfo.FileSize >= 128*converter.MB {
 		// 大文件, 输出一句提示消息
 		dtu.logf("[%s] 开始检验文件有效性, 请稍候...\n", dtu.taskInfo.Id())
 	}
 
 	// 就在这里处理校验出错
 	err := CheckFileValid(dtu.SavePath, dtu.fileInfo)
+	if err == nil && dtu.VerifyChecksum {
+		err = VerifyFileChecksum(dtu.SavePath, dtu.fileInfo)
+	}
 	if err != nil {
 		result.ResultMessage = StrDownloadChecksumFailed
 		result.Err = err
@@ -14,9 +14,27 @@
 package pandownload
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"hash/crc64"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan/internal/localfile"
-	"os"
+)
+
+type (
+	// FileChecksum 文件的大小和校验值
+	FileChecksum struct {
+		Size int64
+		// Sha1 大写的十六进制SHA1，和云盘的 ContentHash 格式一致
+		Sha1 string
+		// Crc64 十进制的CRC64(ECMA)，和云盘的 Crc64Hash 格式一致
+		Crc64 string
+	}
 )
 
 // CheckFileValid 检测文件有效性
@@ -27,6 +45,68 @@ func CheckFileValid(filePath string, fileInfo *aliyunpan.FileEntity) error {
 	return nil
 }
 
+// VerifyFileChecksum 重新读取本地文件，对比本地文件和云盘记录的文件大小、SHA1和CRC64
+func VerifyFileChecksum(filePath string, fileInfo *aliyunpan.FileEntity) error {
+	if fileInfo == nil || fileInfo.IsFolder() {
+		return nil
+	}
+	sum, err := SumFile(filePath)
+	if err != nil {
+		return err
+	}
+	return CompareChecksum(sum, fileInfo)
+}
+
+// SumFile 读取一次本地文件，同时计算SHA1和CRC64
+func SumFile(filePath string) (*FileChecksum, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return SumReader(f)
+}
+
+// SumReader 读取全部数据，同时计算SHA1和CRC64
+func SumReader(r io.Reader) (*FileChecksum, error) {
+	sha1Hash := sha1.New()
+	crc64Hash := crc64.New(crc64.MakeTable(crc64.ECMA))
+	n, err := io.Copy(io.MultiWriter(sha1Hash, crc64Hash), r)
+	if err != nil {
+		return nil, err
+	}
+	return &FileChecksum{
+		Size:  n,
+		Sha1:  strings.ToUpper(hex.EncodeToString(sha1Hash.Sum(nil))),
+		Crc64: strconv.FormatUint(crc64Hash.Sum64(), 10),
+	}, nil
+}
+
+// CompareChecksum 对比校验值和云盘记录的文件信息。
+// 大小或者任意一个哈希值不一致返回 ErrDownloadChecksumFailed，云盘没有记录任何哈希值时返回 ErrDownloadNotSupportChecksum
+func CompareChecksum(sum *FileChecksum, fileInfo *aliyunpan.FileEntity) error {
+	if sum.Size != fileInfo.FileSize {
+		return ErrDownloadChecksumFailed
+	}
+	checked := false
+	if fileInfo.ContentHash != "" && (fileInfo.ContentHashName == "" || strings.EqualFold(fileInfo.ContentHashName, "sha1")) {
+		if !strings.EqualFold(sum.Sha1, fileInfo.ContentHash) {
+			return ErrDownloadChecksumFailed
+		}
+		checked = true
+	}
+	if fileInfo.Crc64Hash != "" {
+		if sum.Crc64 != fileInfo.Crc64Hash {
+			return ErrDownloadChecksumFailed
+		}
+		checked = true
+	}
+	if !checked {
+		return ErrDownloadNotSupportChecksum
+	}
+	return nil
+}
+
 // FileExist 检查文件是否存在
 //
 // 只有当文件存在, 文件大小不为0或断点续传文件不存在时, 才判断为存在
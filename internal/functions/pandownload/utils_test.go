@@ -0,0 +1,43 @@
+package pandownload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestVerifyFileChecksum(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(filePath, []byte("123456789"), 0644)
+
+	sum, err := SumFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// CRC-64/XZ 的标准校验值
+	if sum.Size != 9 || sum.Sha1 != "F7C3BC1D808E04732ADF679965CCC34CA7AE3441" || sum.Crc64 != "11051210869376104954" {
+		t.Fatalf("unexpected checksum: %+v", sum)
+	}
+
+	fileInfo := &aliyunpan.FileEntity{FileType: "file", FileSize: 9, ContentHash: sum.Sha1, ContentHashName: "sha1", Crc64Hash: sum.Crc64}
+	if err = VerifyFileChecksum(filePath, fileInfo); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	fileInfo.Crc64Hash = "1"
+	if err = VerifyFileChecksum(filePath, fileInfo); err != ErrDownloadChecksumFailed {
+		t.Errorf("crc64 mismatch should fail: %v", err)
+	}
+	fileInfo.Crc64Hash, fileInfo.FileSize = "", 10
+	if err = VerifyFileChecksum(filePath, fileInfo); err != ErrDownloadChecksumFailed {
+		t.Errorf("size mismatch should fail: %v", err)
+	}
+	fileInfo.FileSize, fileInfo.ContentHash = 9, ""
+	if err = VerifyFileChecksum(filePath, fileInfo); err != ErrDownloadNotSupportChecksum {
+		t.Errorf("file without hash should not support checksum: %v", err)
+	}
+	if err = VerifyFileChecksum(filepath.Join(t.TempDir(), "missing"), fileInfo); err == nil {
+		t.Errorf("missing file should fail")
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/tickstep/aliyunpan/internal/config"
@@ -41,6 +42,9 @@ type (
 		targetPath string
 		driveId    string
 
+		// 多个分片同时上传时保护 uploadOpEntity.PartInfoList
+		mu sync.Mutex
+
 		// 网盘上传参数
 		uploadOpEntity *aliyunpan.CreateFileUploadResult
 	}
@@ -72,7 +76,61 @@ func (pu *PanUpload) lazyInit() {
 	}
 }
 
+// Precreate 上传前检查所有分片的上传URL, 有即将过期的URL时预先全部刷新, 避免多个分片同时上传时各自刷新
 func (pu *PanUpload) Precreate() (err error) {
+	if len(pu.uploadOpEntity.PartInfoList) == 0 {
+		return nil
+	}
+	pu.lazyInit()
+	pu.mu.Lock()
+	defer pu.mu.Unlock()
+	for _, item := range pu.uploadOpEntity.PartInfoList {
+		if IsUrlExpiredWithin(item.UploadURL, UploadUrlRefreshAhead) {
+			if err = pu.refreshUploadUrls(); err != nil {
+				// 获取失败时在上传分片时重试
+				logger.Verboseln(err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// partUploadUrl 获取分片的上传URL, URL即将过期时提前刷新所有分片的上传URL
+func (pu *PanUpload) partUploadUrl(partseq int) (string, error) {
+	pu.mu.Lock()
+	defer pu.mu.Unlock()
+	uploadUrl := pu.uploadOpEntity.PartInfoList[partseq].UploadURL
+	if !IsUrlExpiredWithin(uploadUrl, UploadUrlRefreshAhead) {
+		return uploadUrl, nil
+	}
+	if err := pu.refreshUploadUrls(); err != nil {
+		return "", err
+	}
+	return pu.uploadOpEntity.PartInfoList[partseq].UploadURL, nil
+}
+
+// refreshUploadUrls 一次性获取所有分片新的上传URL, 调用前需要加锁
+func (pu *PanUpload) refreshUploadUrls() error {
+	logger.Verbosef("refresh upload urls: %s\n", pu.uploadOpEntity.FileId)
+	// get renew upload url
+	infoList := make([]aliyunpan.FileUploadPartInfoParam, 0)
+	for _, item := range pu.uploadOpEntity.PartInfoList {
+		infoList = append(infoList, aliyunpan.FileUploadPartInfoParam{
+			PartNumber: item.PartNumber,
+		})
+	}
+	refreshUploadParam := &aliyunpan.GetUploadUrlParam{
+		DriveId:      pu.uploadOpEntity.DriveId,
+		FileId:       pu.uploadOpEntity.FileId,
+		PartInfoList: infoList,
+		UploadId:     pu.uploadOpEntity.UploadId,
+	}
+	newUploadInfo, err := pu.panClient.OpenapiPanClient().GetUploadUrl(refreshUploadParam)
+	if err != nil {
+		return err
+	}
+	pu.uploadOpEntity.PartInfoList = newUploadInfo.PartInfoList
 	return nil
 }
 
@@ -85,30 +143,13 @@ func (pu *PanUpload) UploadFile(ctx context.Context, partseq int, partOffset int
 	pu.lazyInit()
 
 	// check url expired or not
-	uploadUrl := pu.uploadOpEntity.PartInfoList[partseq].UploadURL
-	if IsUrlExpired(uploadUrl) {
-		// get renew upload url
-		infoList := make([]aliyunpan.FileUploadPartInfoParam, 0)
-		for _, item := range pu.uploadOpEntity.PartInfoList {
-			infoList = append(infoList, aliyunpan.FileUploadPartInfoParam{
-				PartNumber: item.PartNumber,
-			})
-		}
-		refreshUploadParam := &aliyunpan.GetUploadUrlParam{
-			DriveId:      pu.uploadOpEntity.DriveId,
-			FileId:       pu.uploadOpEntity.FileId,
-			PartInfoList: infoList,
-			UploadId:     pu.uploadOpEntity.UploadId,
-		}
-		newUploadInfo, err := pu.panClient.OpenapiPanClient().GetUploadUrl(refreshUploadParam)
-		if err != nil {
-			logger.Verboseln(err)
-			return false, &uploader.MultiError{
-				Err:        uploader.UploadUrlExpired,
-				Terminated: false,
-			}
+	uploadUrl, err := pu.partUploadUrl(partseq)
+	if err != nil {
+		logger.Verboseln(err)
+		return false, &uploader.MultiError{
+			Err:        uploader.UploadUrlExpired,
+			Terminated: false,
 		}
-		pu.uploadOpEntity.PartInfoList = newUploadInfo.PartInfoList
 	}
 
 	var respErr *uploader.MultiError
@@ -191,13 +232,15 @@ func (pu *PanUpload) UploadFile(ctx context.Context, partseq int, partOffset int
 			case 400, 401, 403, 413, 600:
 				respError = uploader.UploadTerminate
 				respErr = &uploader.MultiError{
+					Err:        uploader.UploadTerminate,
 					Terminated: true,
 				}
 			}
 		} else {
-			// 默认错误
-			respError = uploader.UploadTerminate
+			// 默认错误，网络异常
+			respError = uploader.UploadNetError
 			respErr = &uploader.MultiError{
+				Err:        uploader.UploadNetError,
 				Terminated: true,
 			}
 
@@ -225,7 +268,6 @@ func (pu *PanUpload) UploadFile(ctx context.Context, partseq int, partOffset int
 	}
 
 	// 上传一个分片数据
-	uploadUrl = pu.uploadOpEntity.PartInfoList[partseq].UploadURL
 	apiError := pu.panClient.OpenapiPanClient().UploadFileData(uploadUrl, uploadFunc)
 
 	if respErr != nil {
@@ -239,13 +281,19 @@ func (pu *PanUpload) UploadFile(ctx context.Context, partseq int, partOffset int
 			})
 			if er != nil {
 				return false, &uploader.MultiError{
+					Err:        uploader.UploadUrlExpired,
 					Terminated: false,
 				}
 			}
 
 			// 获取新的上传URL重试一次
+			pu.mu.Lock()
 			pu.uploadOpEntity.PartInfoList[partseq] = guur.PartInfoList[0]
 			uploadUrl = pu.uploadOpEntity.PartInfoList[partseq].UploadURL
+			pu.mu.Unlock()
+			if seeker, ok := r.(io.Seeker); ok {
+				seeker.Seek(0, io.SeekStart)
+			}
 			apiError = pu.panClient.OpenapiPanClient().UploadFileData(uploadUrl, uploadFunc)
 		} else if errors.Is(respErr.Err, uploader.UploadPartAlreadyExist) {
 			// already upload
@@ -14,19 +14,22 @@
 package panupload
 
 import (
-	"errors"
-	"github.com/tickstep/library-go/logger"
-	"io"
+	"bytes"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
+	jsoniter "github.com/json-iterator/go"
 	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/tickstep/aliyunpan/internal/file/uploader"
 	"github.com/tickstep/aliyunpan/internal/localfile"
-	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/aliyunpan/library/filelocker"
+	"github.com/tickstep/bolt"
 	"github.com/tickstep/library-go/jsonhelper"
+	"github.com/tickstep/library-go/logger"
 )
 
 type (
@@ -34,230 +37,316 @@ type (
 	Uploading struct {
 		*localfile.LocalFileMeta
 		State *uploader.InstanceState `json:"state"`
+		// UpdatedAt 最后更新时间，超过 UploadingExpireDuration 没有更新的记录会被清理
+		UpdatedAt int64 `json:"updated_at"`
 	}
 
-	// UploadingDatabase 未完成上传的数据库
+	// UploadingDatabase 未完成上传的数据库，使用BoltDB存储，每个文件一条记录，
+	// key 为文件的绝对路径、大小和修改时间。每次操作时才打开数据库，并使用文件锁保证多个进程可以同时使用
 	UploadingDatabase struct {
-		UploadingList []*Uploading `json:"upload_state"`
-		Timestamp     int64        `json:"timestamp"`
+		dbPath string
+		locker *filelocker.FileLocker
+		mutex  *sync.Mutex
+	}
 
-		dataFile *os.File
+	// legacyUploadingDatabase 旧版本的JSON格式的未完成上传的数据库
+	legacyUploadingDatabase struct {
+		UploadingList []*Uploading `json:"upload_state"`
 	}
 )
 
-// NewUploadingDatabase 初始化未完成上传的数据库, 从库中读取内容
+var (
+	// uploadingBucket 未完成上传记录的bucket
+	uploadingBucket = []byte("uploading")
+
+	// UploadingExpireDuration 未完成上传记录的有效期，过期的上传任务需要重新上传
+	UploadingExpireDuration = 7 * 24 * time.Hour
+)
+
+// NewUploadingDatabase 初始化未完成上传的数据库，导入旧版本的JSON数据库
 func NewUploadingDatabase() (ud *UploadingDatabase, err error) {
-	file, err := os.OpenFile(filepath.Join(config.GetConfigDir(), UploadingFileName), os.O_CREATE|os.O_RDWR, 0777)
-	if err != nil {
-		// 打开文件错误，一般是文件权限问题
-		return nil, err
-	}
+	return newUploadingDatabase(config.GetConfigDir())
+}
 
-	ud = &UploadingDatabase{
-		dataFile: file,
+func newUploadingDatabase(dir string) (*UploadingDatabase, error) {
+	dbPath := filepath.Join(dir, UploadingFileName)
+	ud := &UploadingDatabase{
+		dbPath: dbPath,
+		locker: filelocker.NewFileLocker(dbPath),
+		mutex:  &sync.Mutex{},
 	}
-	info, err := file.Stat()
-	if err != nil {
+	if err := ud.importLegacy(dir); err != nil {
 		return nil, err
 	}
+	return ud, nil
+}
 
-	if info.Size() <= 0 {
-		return ud, nil
-	}
-
-	err = jsonhelper.UnmarshalData(file, ud)
-	if err != nil {
-		// 上传数据库文件内容解析错误
-		// 尝试从备份的文件读取数据
-		bakFile, err1 := os.OpenFile(filepath.Join(config.GetConfigDir(), UploadingBackupFileName), os.O_CREATE|os.O_RDONLY, 0777)
-		if err1 != nil {
-			return nil, err
-		}
-		err2 := jsonhelper.UnmarshalData(bakFile, ud)
-		if err2 != nil {
-			return nil, err
-		}
-		bakFile.Close()
-		// 旧的备份文件可以正常使用，复制备份的数据文件到当前数据文件中
-		ud.copyFile(filepath.Join(config.GetConfigDir(), UploadingFileName), filepath.Join(config.GetConfigDir(), UploadingBackupFileName))
-		return ud, nil
-	}
+// uploadingKey 记录的key：绝对路径 + 文件大小 + 修改时间
+func uploadingKey(meta *localfile.LocalFileMeta) []byte {
+	return []byte(meta.Path.LogicPath + "\x00" + strconv.FormatInt(meta.Length, 10) + "\x00" + strconv.FormatInt(meta.ModTime, 10))
+}
 
-	return ud, nil
+// uploadingPathPrefix 同一个文件所有记录的key前缀
+func uploadingPathPrefix(meta *localfile.LocalFileMeta) []byte {
+	return []byte(meta.Path.LogicPath + "\x00")
 }
 
-// Save 保存内容
-func (ud *UploadingDatabase) Save() error {
-	if ud.dataFile == nil {
-		return errors.New("dataFile is nil")
-	}
+// update 打开数据库执行操作，writable 为 false 时只读
+func (ud *UploadingDatabase) update(writable bool, fn func(bkt *bolt.Bucket) error) error {
+	ud.mutex.Lock()
+	defer ud.mutex.Unlock()
 
-	ud.Timestamp = time.Now().Unix()
+	// 获取文件锁，保证多个进程不会同时打开数据库
+	if err := filelocker.LockFile(ud.locker, 0600, true, 30*time.Second); err != nil {
+		return err
+	}
+	defer filelocker.UnlockFile(ud.locker)
 
-	var (
-		builder = &strings.Builder{}
-		err     = jsonhelper.MarshalData(builder, ud)
-	)
+	db, err := bolt.Open(ud.dbPath, 0600, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer db.Close()
 
-	// 备份旧的数据库文件
-	// 因为下面有文件内容清空、写入新内容的操作。有小概率出现文件保存没有完成程序就退出的问题，这会导致数据库内容丢失。所以这里必须备份一下旧文件
-	err1 := ud.copyFile(filepath.Join(config.GetConfigDir(), UploadingBackupFileName), filepath.Join(config.GetConfigDir(), UploadingFileName))
-	if err1 != nil {
-		logger.Verboseln("备份上传数据库文件出错： {}", err1)
-	} else {
-		logger.Verboseln("成功备份旧的上传数据库文件")
+	if !writable {
+		return db.View(func(tx *bolt.Tx) error {
+			bkt := tx.Bucket(uploadingBucket)
+			if bkt == nil {
+				return nil
+			}
+			return fn(bkt)
+		})
 	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists(uploadingBucket)
+		if err != nil {
+			return err
+		}
+		return fn(bkt)
+	})
+}
 
-	logger.Verboseln("保存最新上传数据库内容")
-	// 清空文件旧内容
-	err = ud.dataFile.Truncate(int64(builder.Len()))
+// importLegacy 导入旧版本的JSON格式的数据库，导入成功后删除旧的文件
+func (ud *UploadingDatabase) importLegacy(dir string) error {
+	legacyFile := filepath.Join(dir, UploadingLegacyFileName)
+	file, err := os.Open(legacyFile)
 	if err != nil {
-		return err
+		return nil
+	}
+	legacy := &legacyUploadingDatabase{}
+	err = jsonhelper.UnmarshalData(file, legacy)
+	file.Close()
+	if err != nil {
+		// 旧的数据库文件已经损坏，只能放弃
+		logger.Verboseln("旧的上传数据库文件解析错误： {}", err)
+	} else {
+		now := time.Now().Unix()
+		for _, uploading := range legacy.UploadingList {
+			if uploading.LocalFileMeta == nil {
+				continue
+			}
+			uploading.UpdatedAt = now
+		}
+		err = ud.update(true, func(bkt *bolt.Bucket) error {
+			for _, uploading := range legacy.UploadingList {
+				if uploading.LocalFileMeta == nil {
+					continue
+				}
+				if e := putUploading(bkt, uploading); e != nil {
+					return e
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 	}
+	os.Remove(legacyFile)
+	os.Remove(filepath.Join(dir, UploadingLegacyBackupFileName))
+	return nil
+}
 
-	// 写入新内容
-	str := builder.String()
-	_, err = ud.dataFile.WriteAt(converter.ToBytes(str), 0)
+func putUploading(bkt *bolt.Bucket, uploading *Uploading) error {
+	data, err := jsoniter.Marshal(uploading)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return bkt.Put(uploadingKey(uploading.LocalFileMeta), data)
 }
 
-// copyFile 复制文件
-func (ud *UploadingDatabase) copyFile(dstFilePath string, srcFilePath string) error {
-	os.Remove(dstFilePath)
-	dstFile, err1 := os.OpenFile(dstFilePath, os.O_CREATE|os.O_WRONLY, 0777)
-	if err1 != nil {
-		return err1
+func getUploading(data []byte) *Uploading {
+	uploading := &Uploading{}
+	if err := jsoniter.Unmarshal(data, uploading); err != nil || uploading.LocalFileMeta == nil {
+		return nil
 	}
-	srcFile, err2 := os.OpenFile(srcFilePath, os.O_CREATE|os.O_RDONLY, 0777)
-	if err2 != nil {
-		return err2
+	return uploading
+}
+
+// deletePath 删除同一个文件的所有记录，keep 不为空时保留该记录
+func deletePath(bkt *bolt.Bucket, prefix, keep []byte) error {
+	keys := [][]byte{}
+	c := bkt.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if keep == nil || !bytes.Equal(k, keep) {
+			keys = append(keys, append([]byte{}, k...))
+		}
 	}
-	_, err3 := io.Copy(dstFile, srcFile)
-	if err3 != nil {
-		return err3
+	for _, k := range keys {
+		if err := bkt.Delete(k); err != nil {
+			return err
+		}
 	}
-	dstFile.Close()
-	srcFile.Close()
 	return nil
 }
 
-// UpdateUploading 更新正在上传
+// UpdateUploading 更新正在上传，同一个文件旧的记录会被删除
 func (ud *UploadingDatabase) UpdateUploading(meta *localfile.LocalFileMeta, state *uploader.InstanceState) {
 	if meta == nil {
 		return
 	}
 
 	meta.CompleteAbsPath()
-	for k, uploading := range ud.UploadingList {
-		if uploading.LocalFileMeta == nil {
-			continue
-		}
-		if uploading.LocalFileMeta.EqualLengthMD5(meta) || uploading.LocalFileMeta.Path.LogicPath == meta.Path.LogicPath {
-			ud.UploadingList[k].State = state
-			return
-		}
-	}
-
-	ud.UploadingList = append(ud.UploadingList, &Uploading{
+	uploading := &Uploading{
 		LocalFileMeta: meta,
 		State:         state,
+		UpdatedAt:     time.Now().Unix(),
+	}
+	err := ud.update(true, func(bkt *bolt.Bucket) error {
+		if err := deletePath(bkt, uploadingPathPrefix(meta), uploadingKey(meta)); err != nil {
+			return err
+		}
+		return putUploading(bkt, uploading)
 	})
+	if err != nil {
+		logger.Verboseln("保存上传数据库记录出错： {}", err)
+	}
 }
 
-func (ud *UploadingDatabase) deleteIndex(k int) {
-	ud.UploadingList = append(ud.UploadingList[:k], ud.UploadingList[k+1:]...)
-}
-
-// Delete 删除
+// Delete 删除文件的上传记录
 func (ud *UploadingDatabase) Delete(meta *localfile.LocalFileMeta) bool {
 	if meta == nil {
 		return false
 	}
 
 	meta.CompleteAbsPath()
-	for k, uploading := range ud.UploadingList {
-		if uploading.LocalFileMeta == nil {
-			continue
-		}
-		if uploading.LocalFileMeta.EqualLengthMD5(meta) || uploading.LocalFileMeta.Path == meta.Path {
-			ud.deleteIndex(k)
-			return true
-		}
+	deleted := false
+	err := ud.update(true, func(bkt *bolt.Bucket) error {
+		deleted = bkt.Get(uploadingKey(meta)) != nil
+		return deletePath(bkt, uploadingPathPrefix(meta), nil)
+	})
+	if err != nil {
+		logger.Verboseln("删除上传数据库记录出错： {}", err)
+		return false
 	}
-	return false
+	return deleted
 }
 
-// Search 搜索
+// Search 搜索文件的上传记录。文件大小或者修改日期不一致，代表本地文件已经更改了，旧的上传记录会被删除
 func (ud *UploadingDatabase) Search(meta *localfile.LocalFileMeta) *uploader.InstanceState {
 	if meta == nil {
 		return nil
 	}
 
 	meta.CompleteAbsPath()
-	ud.clearModTimeChange()
-	for _, uploading := range ud.UploadingList {
-		if uploading.LocalFileMeta == nil {
-			continue
+	var uploading *Uploading
+	err := ud.update(true, func(bkt *bolt.Bucket) error {
+		key := uploadingKey(meta)
+		if data := bkt.Get(key); data != nil {
+			uploading = getUploading(data)
 		}
-		// 优选通过SHA1进行匹配，如果匹配失败则通过文件路径进行匹配
-		// 因为部分上传文件是直接上传的，没有计算SHA1
-		if uploading.LocalFileMeta.EqualLengthSHA1(meta) ||
-			uploading.LocalFileMeta.Path.LogicPath == meta.Path.LogicPath {
-			// 文件大小或者修改日期不一致，代表本地文件已经更改了，保存的旧的上传文件信息已经无用
-			// 移除旧的信息，客户端需要重新上传该文件
-			if meta.Length != uploading.LocalFileMeta.Length ||
-				meta.ModTime != uploading.LocalFileMeta.ModTime {
-				logger.Verboseln("本地文件已经被修改，上传数据记录需要移除，文件需要重新从0开始上传： {}", meta.Path.LogicPath)
-				ud.Delete(meta)
-				return nil
-			}
-
-			// 从上传数据库补全信息并返回
-			meta.SHA1 = uploading.LocalFileMeta.SHA1
-			meta.ParentFolderId = uploading.LocalFileMeta.ParentFolderId
-			meta.UploadOpEntity = uploading.LocalFileMeta.UploadOpEntity
-			return uploading.State
+		if uploading != nil && time.Since(time.Unix(uploading.UpdatedAt, 0)) > UploadingExpireDuration {
+			logger.Verboseln("上传记录已经过期，文件需要重新从0开始上传： {}", meta.Path.LogicPath)
+			uploading = nil
+		}
+		if uploading == nil {
+			// 删除本地文件修改之前的记录
+			return deletePath(bkt, uploadingPathPrefix(meta), nil)
 		}
+		return nil
+	})
+	if err != nil {
+		logger.Verboseln("读取上传数据库出错： {}", err)
+		return nil
+	}
+	if uploading == nil {
+		return nil
 	}
-	return nil
-}
 
-func (ud *UploadingDatabase) clearModTimeChange() {
-	for i := 0; i < len(ud.UploadingList); i++ {
-		uploading := ud.UploadingList[i]
-		if uploading.LocalFileMeta == nil {
-			continue
-		}
+	// 从上传数据库补全信息并返回
+	meta.SHA1 = uploading.LocalFileMeta.SHA1
+	meta.ParentFolderId = uploading.LocalFileMeta.ParentFolderId
+	meta.UploadOpEntity = uploading.LocalFileMeta.UploadOpEntity
+	return uploading.State
+}
 
-		if uploading.ModTime == -1 { // 忽略
-			continue
-		}
+// List 列出所有未完成上传的记录，按照文件路径排序
+func (ud *UploadingDatabase) List() ([]*Uploading, error) {
+	list := []*Uploading{}
+	err := ud.update(false, func(bkt *bolt.Bucket) error {
+		return bkt.ForEach(func(k, v []byte) error {
+			if uploading := getUploading(v); uploading != nil {
+				list = append(list, uploading)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path.LogicPath < list[j].Path.LogicPath })
+	return list, nil
+}
 
-		info, err := os.Stat(uploading.LocalFileMeta.Path.RealPath)
+// Clean 清理过期、无法解析以及本地文件已经删除或者修改的记录，all 为 true 时清理全部记录，返回清理的记录数量
+func (ud *UploadingDatabase) Clean(all bool) (int, error) {
+	count := 0
+	err := ud.update(true, func(bkt *bolt.Bucket) error {
+		keys := [][]byte{}
+		err := bkt.ForEach(func(k, v []byte) error {
+			if all || isUploadingInvalid(getUploading(v)) {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
 		if err != nil {
-			ud.deleteIndex(i)
-			i--
-			cmdUploadVerbose.Warnf("clear invalid file path: %s, err: %s\n", uploading.LocalFileMeta.Path, err)
-			continue
+			return err
 		}
-
-		if uploading.LocalFileMeta.ModTime != info.ModTime().Unix() {
-			ud.deleteIndex(i)
-			i--
-			cmdUploadVerbose.Infof("clear modified file path: %s\n", uploading.LocalFileMeta.Path)
-			continue
+		for _, k := range keys {
+			if e := bkt.Delete(k); e != nil {
+				return e
+			}
 		}
+		count = len(keys)
+		return nil
+	})
+	return count, err
+}
+
+// isUploadingInvalid 上传记录是否已经无效
+func isUploadingInvalid(uploading *Uploading) bool {
+	if uploading == nil {
+		return true
+	}
+	if time.Since(time.Unix(uploading.UpdatedAt, 0)) > UploadingExpireDuration {
+		return true
 	}
+	if uploading.ModTime == -1 { // 忽略
+		return false
+	}
+	info, err := os.Stat(uploading.LocalFileMeta.Path.RealPath)
+	if err != nil {
+		cmdUploadVerbose.Warnf("clear invalid file path: %s, err: %s\n", uploading.LocalFileMeta.Path, err)
+		return true
+	}
+	if info.Size() != uploading.Length || info.ModTime().Unix() != uploading.ModTime {
+		cmdUploadVerbose.Infof("clear modified file path: %s\n", uploading.LocalFileMeta.Path)
+		return true
+	}
+	return false
 }
 
-// Close 关闭数据库
+// Close 关闭数据库，数据库只在每次操作时打开，这里不需要释放资源
 func (ud *UploadingDatabase) Close() error {
-	return ud.dataFile.Close()
+	return nil
 }
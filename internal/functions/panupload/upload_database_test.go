@@ -0,0 +1,110 @@
+package panupload
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/file/uploader"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+)
+
+func newTestFileMeta(t *testing.T, filePath string) *localfile.LocalFileMeta {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &localfile.LocalFileMeta{
+		Path:    localfile.SymlinkFile{LogicPath: filePath, RealPath: filePath},
+		Length:  info.Size(),
+		ModTime: info.ModTime().Unix(),
+	}
+}
+
+func TestUploadingDatabase(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.txt")
+	os.WriteFile(filePath, []byte("hello"), 0644)
+
+	ud, err := newUploadingDatabase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := newTestFileMeta(t, filePath)
+	meta.SHA1 = "sha1"
+	meta.UploadOpEntity = &aliyunpan.CreateFileUploadResult{FileId: "file1", UploadId: "upload1"}
+	state := &uploader.InstanceState{BlockList: []*uploader.BlockState{{ID: 1, UploadDone: true}}}
+	ud.UpdateUploading(meta, state)
+	// 数据库保存了上传地址，只允许当前用户读写
+	if fi, err := os.Stat(ud.dbPath); err != nil {
+		t.Fatal(err)
+	} else if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("database file mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	// 另一个实例也能读到记录
+	ud2, err := newUploadingDatabase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := newTestFileMeta(t, filePath)
+	if s := ud2.Search(found); s == nil || len(s.BlockList) != 1 || found.SHA1 != "sha1" || found.UploadOpEntity.UploadId != "upload1" {
+		t.Fatalf("unexpected state: %+v %+v", s, found)
+	}
+
+	// 本地文件修改后记录失效
+	changed := newTestFileMeta(t, filePath)
+	changed.ModTime++
+	if ud.Search(changed) != nil {
+		t.Errorf("modified file should not be found")
+	}
+	if list, _ := ud.List(); len(list) != 0 {
+		t.Errorf("old record should be deleted: %d", len(list))
+	}
+
+	// 清理过期记录和已经删除的文件
+	ud.UpdateUploading(newTestFileMeta(t, filePath), state)
+	otherPath := filepath.Join(dir, "b.txt")
+	os.WriteFile(otherPath, []byte("world"), 0644)
+	ud.UpdateUploading(newTestFileMeta(t, otherPath), state)
+	if list, _ := ud.List(); len(list) != 2 || list[0].Path.LogicPath != filePath {
+		t.Fatalf("unexpected list: %d", len(list))
+	}
+	os.Remove(otherPath)
+	if count, err := ud.Clean(false); err != nil || count != 1 {
+		t.Errorf("unexpected clean count: %d, %v", count, err)
+	}
+	UploadingExpireDuration = -time.Second
+	defer func() { UploadingExpireDuration = 7 * 24 * time.Hour }()
+	if ud.Search(newTestFileMeta(t, filePath)) != nil {
+		t.Errorf("expired record should not be found")
+	}
+	if ud.Delete(newTestFileMeta(t, filePath)) {
+		t.Errorf("record should already be deleted")
+	}
+}
+
+func TestUploadingDatabaseImportLegacy(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.txt")
+	os.WriteFile(filePath, []byte("hello"), 0644)
+	meta := newTestFileMeta(t, filePath)
+	legacy := `{"upload_state":[{"path":{"logicPath":"` + filepath.ToSlash(filePath) + `","realPath":"` + filepath.ToSlash(filePath) +
+		`"},"length":5,"modtime":` + strconv.FormatInt(meta.ModTime, 10) + `,"state":{"block_list":[]}}],"timestamp":1}`
+	os.WriteFile(filepath.Join(dir, UploadingLegacyFileName), []byte(legacy), 0644)
+
+	ud, err := newUploadingDatabase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, UploadingLegacyFileName)); !os.IsNotExist(err) {
+		t.Errorf("legacy file should be removed")
+	}
+	if ud.Search(newTestFileMeta(t, filePath)) == nil {
+		t.Errorf("legacy record should be imported")
+	}
+}
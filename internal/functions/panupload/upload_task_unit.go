@@ -14,6 +14,7 @@
 package panupload
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -185,7 +186,8 @@ func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 
 	// 创建分片上传器
 	// 阿里云盘默认就是分片上传，每一个分片对应一个part_info
-	// 但是不支持分片同时上传，必须单线程，并且按照顺序从1开始一个一个上传
+	// 所有分片的上传URL预先获取，Parallel > 1 时多个分片同时上传，可以乱序完成
+	// 服务器拒绝乱序的分片时，退回单线程按照顺序从1开始一个一个上传
 	muer := uploader.NewMultiUploader(
 		NewPanUpload(utu.PanClient, utu.SavePath, utu.DriveId, utu.LocalFileChecksum.UploadOpEntity),
 		rio.NewFileReaderAtLen64(utu.LocalFileChecksum.GetFile()), &uploader.MultiUploaderConfig{
@@ -210,7 +212,6 @@ func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 		select {
 		case <-updateChan:
 			utu.UploadingDatabase.UpdateUploading(&utu.LocalFileChecksum.LocalFileMeta, muer.InstanceState())
-			utu.UploadingDatabase.Save()
 		default:
 		}
 
@@ -255,38 +256,17 @@ func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 		// 统计
 		utu.UploadStatistic.AddTotalSize(utu.LocalFileChecksum.Length)
 		utu.UploadingDatabase.Delete(&utu.LocalFileChecksum.LocalFileMeta) // 删除
-		utu.UploadingDatabase.Save()
 		result.Succeed = true
 	})
 	muer.OnError(func(err error) {
-		apiError, ok := err.(*apierror.ApiError)
-		if !ok {
-			// 未知错误类型 (非预期的)
-			// 不重试
-			result.ResultMessage = "上传文件错误"
-			result.Err = err
-			return
-		}
-
-		// 默认需要重试
-		result.NeedRetry = true
-
-		switch apiError.ErrCode() {
-		default:
-			result.ResultMessage = StrUploadFailed
-			result.NeedRetry = false
-			result.Err = apiError
-		}
-		return
+		result.ResultMessage = StrUploadFailed
+		result.NeedRetry = uploadErrorNeedRetry(err)
+		result.Err = err
 	})
 	er := muer.Execute()
 	if er != nil {
 		result.ResultMessage = StrUploadFailed
-		result.NeedRetry = true
-		if errors.Is(er, uploader.UploadNoSuchUpload) {
-			// do not need retry
-			result.NeedRetry = false
-		}
+		result.NeedRetry = uploadErrorNeedRetry(er)
 		result.Err = er
 	}
 	return
@@ -416,6 +396,10 @@ func (utu *UploadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 	case StepUploadRapidUpload:
 		goto stepUploadRapidUpload
 	case StepUploadUpload:
+		// 断点续传，本地记录的进度可能和服务器不一致，从服务器确认的已上传分片继续上传
+		if ee := utu.syncUploadedParts(); ee != nil {
+			logger.Verboseln("sync uploaded parts failed, use local state: " + ee.Error())
+		}
 		goto stepUploadUpload
 	}
 
@@ -621,8 +605,9 @@ stepUploadUpload:
 	if uploadResult != nil && uploadResult.Err != nil {
 		// 处理上传错误
 		if errors.Is(uploadResult.Err, uploader.UploadPartNotSeq) {
-			// 分片乱序错误
-			if ee := utu.amendFileUploadPartNum(); ee != nil {
+			// 分片乱序错误，之后只按顺序上传
+			utu.Parallel = 1
+			if ee := utu.syncUploadedParts(); ee != nil {
 				// 修正分片乱序失败，先令上传任务直接失败
 				logger.Verboseln("WARNING! amend uploaded parts num failed")
 				utu.logf("[%s] %s 无法修正上传分片乱序的错误，建议重新上传\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"))
@@ -679,14 +664,13 @@ stepUploadUpload:
 	return uploadResult
 }
 
-// amendFileUploadPartNum 修正文件分片上传顺序错误
-func (utu *UploadTaskUnit) amendFileUploadPartNum() error {
+// syncUploadedParts 以服务器记录的已上传分片为准，修正本地的分片上传标识.
+// 用于断点续传和修正分片上传顺序错误
+func (utu *UploadTaskUnit) syncUploadedParts() error {
 	if utu.LocalFileChecksum.LocalFileMeta.UploadOpEntity == nil || utu.state == nil {
 		return nil
 	}
-	logger.Verbosef("adjust the uploaded parts num error\n")
-	// 分片出现乱序
-	// 获取的已上传分片信息，修正正确的分片顺序
+	// 获取的已上传分片信息
 	uploadedParts, uper := utu.PanClient.OpenapiPanClient().GetUploadedPartInfoAllItem(&aliyunpan.GetUploadedPartsParam{
 		DriveId:  utu.LocalFileChecksum.LocalFileMeta.UploadOpEntity.DriveId,
 		FileId:   utu.LocalFileChecksum.LocalFileMeta.UploadOpEntity.FileId,
@@ -696,24 +680,54 @@ func (utu *UploadTaskUnit) amendFileUploadPartNum() error {
 		logger.Verbosef("get uploaded parts info error: %+v\n", uper)
 		return uper
 	}
-	// 获取最后上传的分片编号
-	lastUploadedPartNum := -1
-	if len(uploadedParts.UploadedParts) > 0 {
-		lastUploadedPartNum = uploadedParts.UploadedParts[len(uploadedParts.UploadedParts)-1].PartNumber
-	} else {
-		logger.Verbosef("get uploaded parts list is empty\n")
-		return errors.New("uploaded parts list is empty")
-	}
-	// 修正分片上传的标识
-	if lastUploadedPartNum > 0 {
-		logger.Verbosef("get the right uploaded parts num: %d\n", lastUploadedPartNum)
-		for _, w := range utu.state.BlockList {
-			if (w.ID + 1) <= lastUploadedPartNum { // 分片的编号从1开始，BlockList的id是从0开始
-				w.UploadDone = true
-			} else {
-				w.UploadDone = false
-			}
+	doneCount := markUploadedParts(utu.state.BlockList, uploadedParts.UploadedParts)
+	logger.Verbosef("sync uploaded parts from server: %d/%d\n", doneCount, len(utu.state.BlockList))
+	return nil
+}
+
+// markUploadedParts 按照服务器记录的分片编号逐个修正分片的上传标识，返回已上传的分片数量.
+// 多个分片同时上传时已上传的分片可能不连续；分片大小和本地不一致的需要重新上传
+func markUploadedParts(blockList []*uploader.BlockState, uploadedParts []*aliyunpan.GetUploadedPartItem) int {
+	uploadedPartSize := map[int]int64{}
+	for _, part := range uploadedParts {
+		uploadedPartSize[part.PartNumber] = part.PartSize
+	}
+	doneCount := 0
+	for _, w := range blockList {
+		size, ok := uploadedPartSize[w.ID+1] // 分片的编号从1开始，BlockList的id是从0开始
+		w.UploadDone = ok && (size <= 0 || size == w.Range.End-w.Range.Begin)
+		if w.UploadDone {
+			doneCount++
 		}
 	}
-	return nil
+	return doneCount
+}
+
+// uploadErrorNeedRetry 上传出错后是否需要重试.
+// 网络异常，链接过期，服务器限流等错误可以重试；本地文件异常，上传被服务器拒绝，文件大小超出限制等错误重试也无法成功，不再重试，以免浪费重试次数
+func uploadErrorNeedRetry(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, uploader.UploadTerminate) ||
+		errors.Is(err, uploader.UploadNoSuchUpload) ||
+		errors.Is(err, uploader.UploadLocalFileAlreadyClosedError) {
+		return false
+	}
+	var apierr *apierror.ApiError
+	if errors.As(err, &apierr) {
+		switch apierr.Code {
+		case apierror.ApiCodeUploadPayloadTooLarge,
+			apierror.ApiCodeFileNotFoundCode,
+			apierror.ApiCodeUploadFileNotFound,
+			apierror.ApiCodeUserDayFlowOverLimited,
+			apierror.ApiCodeForbidden,
+			apierror.ApiCodePermissionDenied,
+			apierror.ApiCodeUserNotAllowedAccessDrive,
+			apierror.ApiCodeRefreshTokenExpiredCode,
+			apierror.ApiCodeBadRequest:
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,220 @@
+package panupload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open/openapi"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/uploader"
+	"github.com/tickstep/library-go/requester/rio"
+)
+
+// fakeOSS 本地的OSS分片上传服务器, sequential 为 true 时拒绝乱序的分片
+type fakeOSS struct {
+	sequential bool
+	failStatus int // 不为0时所有分片都返回该状态码
+
+	mu        sync.Mutex
+	parts     map[int][]byte
+	last      int // 最后上传成功的分片编号
+	rejected  int
+	active    int32
+	maxActive int32
+}
+
+func (fo *fakeOSS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	active := atomic.AddInt32(&fo.active, 1)
+	defer atomic.AddInt32(&fo.active, -1)
+	for {
+		maxActive := atomic.LoadInt32(&fo.maxActive)
+		if active <= maxActive || atomic.CompareAndSwapInt32(&fo.maxActive, maxActive, active) {
+			break
+		}
+	}
+
+	partNumber, _ := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	fo.mu.Lock()
+	inSequence := partNumber == fo.last+1
+	fo.mu.Unlock()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	if fo.failStatus != 0 {
+		w.WriteHeader(fo.failStatus)
+		return
+	}
+	if fo.sequential && !inSequence {
+		fo.rejected++
+		body := "<Error><Code>PartNotSequential</Code><Message>For sequential multipart upload, you must upload or complete parts with sequential part number.</Message></Error>"
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(body))
+		return
+	}
+	fo.parts[partNumber] = data
+	if partNumber > fo.last {
+		fo.last = partNumber
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// testPanUpload 只记录是否提交, 不请求网盘接口
+type testPanUpload struct {
+	*PanUpload
+	committed bool
+}
+
+func (tu *testPanUpload) CommitFile() error {
+	tu.committed = true
+	return nil
+}
+
+func newTestMultiUploader(t *testing.T, fo *fakeOSS) ([]byte, *testPanUpload, *uploader.MultiUploader) {
+	data := make([]byte, 8*256*1024+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	filePath := filepath.Join(t.TempDir(), "upload")
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+
+	server := httptest.NewServer(fo)
+	t.Cleanup(server.Close)
+
+	blockList := uploader.SplitBlock(int64(len(data)), 256*1024)
+	uploadOpEntity := &aliyunpan.CreateFileUploadResult{FileId: "file", UploadId: "upload"}
+	expires := time.Now().Add(time.Hour).Unix()
+	for i := range blockList {
+		uploadOpEntity.PartInfoList = append(uploadOpEntity.PartInfoList, aliyunpan.FileUploadPartInfoResult{
+			PartNumber: i + 1,
+			UploadURL:  fmt.Sprintf("%s/file?partNumber=%d&Expires=%d", server.URL, i+1, expires),
+		})
+	}
+
+	panClient := config.NewPanClient(nil, aliyunpan_open.NewOpenPanClient(openapi.ApiConfig{}, openapi.ApiToken{}, nil))
+	tu := &testPanUpload{PanUpload: &PanUpload{panClient: panClient, uploadOpEntity: uploadOpEntity}}
+	muer := uploader.NewMultiUploader(tu, rio.NewFileReaderAtLen64(file), &uploader.MultiUploaderConfig{
+		Parallel:  3,
+		BlockSize: 256 * 1024,
+	}, uploadOpEntity, panClient, nil)
+	return data, tu, muer
+}
+
+func runTestMultiUpload(t *testing.T, sequential bool) (*fakeOSS, *uploader.MultiUploader) {
+	fo := &fakeOSS{sequential: sequential, parts: map[int][]byte{}}
+	data, tu, muer := newTestMultiUploader(t, fo)
+	if err := muer.Execute(); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	if !tu.committed || len(fo.parts) != 9 {
+		t.Fatalf("upload not finished: committed %v, parts %d", tu.committed, len(fo.parts))
+	}
+	uploaded := make([]byte, 0, len(data))
+	for i := 1; i <= len(fo.parts); i++ {
+		uploaded = append(uploaded, fo.parts[i]...)
+	}
+	if !bytes.Equal(uploaded, data) {
+		t.Fatalf("uploaded data mismatch")
+	}
+	return fo, muer
+}
+
+func TestMultiUploadParallel(t *testing.T) {
+	fo, muer := runTestMultiUpload(t, false)
+	if fo.maxActive < 2 || fo.maxActive > 3 || muer.Sequential() {
+		t.Errorf("parts should be uploaded in parallel: max active %d", fo.maxActive)
+	}
+}
+
+func TestMultiUploadFallbackSequential(t *testing.T) {
+	fo, muer := runTestMultiUpload(t, true)
+	// 同时上传的分片只有分片1成功, 剩余的分片按顺序上传
+	if fo.rejected < 2 || !muer.Sequential() {
+		t.Errorf("should fallback to sequential upload: rejected %d", fo.rejected)
+	}
+}
+
+func TestMultiUploadTerminate(t *testing.T) {
+	fo := &fakeOSS{failStatus: http.StatusForbidden, parts: map[int][]byte{}}
+	_, tu, muer := newTestMultiUploader(t, fo)
+	err := muer.Execute()
+	if !errors.Is(err, uploader.UploadTerminate) || uploadErrorNeedRetry(err) || tu.committed {
+		t.Errorf("upload should be terminated without retry: %v", err)
+	}
+}
+
+func TestUploadErrorNeedRetry(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{uploader.UploadTerminate, false},
+		{uploader.UploadLocalFileAlreadyClosedError, false},
+		{uploader.UploadNoSuchUpload, false},
+		{apierror.NewApiError(apierror.ApiCodeUploadPayloadTooLarge, "too large"), false},
+		{uploader.UploadUrlExpired, true},
+		{uploader.UploadNetError, true},
+		{uploader.UploadPartsIncomplete, true},
+		{apierror.NewApiError(apierror.ApiCodeTooManyRequests, "too many requests"), true},
+		{apierror.NewFailedApiError("update data error"), true},
+	}
+	for _, c := range cases {
+		if got := uploadErrorNeedRetry(c.err); got != c.want {
+			t.Errorf("uploadErrorNeedRetry(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestMarkUploadedParts(t *testing.T) {
+	blockList := uploader.SplitBlock(1000, 300)
+	blockList[0].UploadDone = true
+	blockList[1].UploadDone = true
+	// 服务器只确认了分片1和3, 分片4的大小不一致需要重新上传
+	n := markUploadedParts(blockList, []*aliyunpan.GetUploadedPartItem{
+		{PartNumber: 1, PartSize: 300},
+		{PartNumber: 3, PartSize: 300},
+		{PartNumber: 4, PartSize: 300},
+	})
+	if n != 2 || !blockList[0].UploadDone || blockList[1].UploadDone || !blockList[2].UploadDone || blockList[3].UploadDone {
+		t.Errorf("unexpected uploaded parts: %d", n)
+	}
+}
+
+func TestIsUrlExpiredWithin(t *testing.T) {
+	expires := time.Now().Add(8 * time.Minute).Unix()
+	u := fmt.Sprintf("https://oss.example.com/file?partNumber=1&Expires=%d", expires)
+	if IsUrlExpired(u) || !IsUrlExpiredWithin(u, UploadUrlRefreshAhead) || !IsUrlExpired("https://oss.example.com/file") {
+		t.Errorf("unexpected url expiry")
+	}
+}
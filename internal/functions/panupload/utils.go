@@ -35,14 +35,19 @@ const (
 	// MaxRapidUploadSize 秒传文件支持的最大文件大小
 	MaxRapidUploadSize = 20 * converter.GB
 
-	// UploadingFileName 上传文件上传状态的文件名
-	UploadingFileName = "aliyunpan_uploading.json"
-	// UploadingBackupFileName 上传文件上传状态的副本
-	UploadingBackupFileName = "aliyunpan_uploading.json.bak"
+	// UploadingFileName 上传文件上传状态的数据库文件名
+	UploadingFileName = "aliyunpan_uploading.db"
+	// UploadingLegacyFileName 旧版本的上传文件上传状态的文件名，打开数据库时会导入并删除
+	UploadingLegacyFileName = "aliyunpan_uploading.json"
+	// UploadingLegacyBackupFileName 旧版本的上传文件上传状态的副本
+	UploadingLegacyBackupFileName = "aliyunpan_uploading.json.bak"
 )
 
 var (
 	cmdUploadVerbose = logger.New("FILE_UPLOAD", config.EnvVerbose)
+
+	// UploadUrlRefreshAhead 分片上传链接在过期前这段时间内提前刷新，保证开始上传分片时链接仍然有效
+	UploadUrlRefreshAhead = 10 * time.Minute
 )
 
 func getBlockSize(fileSize int64) int64 {
@@ -55,17 +60,17 @@ func getBlockSize(fileSize int64) int64 {
 
 // IsUrlExpired 上传链接是否已过期。过期返回True
 func IsUrlExpired(urlStr string) bool {
+	return IsUrlExpiredWithin(urlStr, 5*time.Minute) // 小于5分钟
+}
+
+// IsUrlExpiredWithin 上传链接是否会在 d 时间内过期。无法解析过期时间的链接视为已过期
+func IsUrlExpiredWithin(urlStr string, d time.Duration) bool {
 	expiredTimeSec, err := utils.GetExpiredTimeSecFromOSSUrl(urlStr)
 	if err != nil {
 		// 解析错误，默认过期
 		return true
 	}
-	if (expiredTimeSec - time.Now().Unix()) <= 300 { // 小于5分钟
-		// expired
-		return true
-	}
-	// 返回未过期
-	return false
+	return time.Until(time.Unix(expiredTimeSec, 0)) <= d
 }
 
 func IsVideoFile(fileName string) bool {
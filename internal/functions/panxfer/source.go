@@ -0,0 +1,205 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panxfer
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open"
+	"github.com/tickstep/library-go/requester"
+)
+
+const (
+	// PreHashSize 计算 PreHash 的数据长度
+	PreHashSize = 1024
+)
+
+type (
+	// SourceFile 源账号的云盘文件，通过下载链接按照 Range 读取文件数据，不落地到本地磁盘
+	SourceFile struct {
+		client  *aliyunpan_open.OpenPanClient
+		driveId string
+		fileId  string
+		size    int64
+
+		locker      sync.Mutex
+		downloadUrl string
+		httpClient  *requester.HTTPClient
+	}
+
+	// RangeBody 分片数据流，实现 rio.ReaderLen64
+	RangeBody struct {
+		io.ReadCloser
+		length int64
+	}
+)
+
+// NewSourceFile 创建源文件读取器
+func NewSourceFile(client *aliyunpan_open.OpenPanClient, driveId, fileId string, size int64) *SourceFile {
+	httpClient := requester.NewHTTPClient()
+	httpClient.SetTimeout(0)
+	httpClient.SetKeepAlive(true)
+	return &SourceFile{
+		client:     client,
+		driveId:    driveId,
+		fileId:     fileId,
+		size:       size,
+		httpClient: httpClient,
+	}
+}
+
+// Len 分片数据长度
+func (b *RangeBody) Len() int64 {
+	return b.length
+}
+
+// Len 文件大小
+func (sf *SourceFile) Len() int64 {
+	return sf.size
+}
+
+// url 获取下载链接，refresh 为 true 时重新获取
+func (sf *SourceFile) url(refresh bool) (string, error) {
+	sf.locker.Lock()
+	defer sf.locker.Unlock()
+	if sf.downloadUrl != "" && !refresh {
+		return sf.downloadUrl, nil
+	}
+	durl, apierr := sf.client.GetFileDownloadUrl(&aliyunpan.GetFileDownloadUrlParam{
+		DriveId: sf.driveId,
+		FileId:  sf.fileId,
+	})
+	if apierr != nil {
+		return "", apierr
+	}
+	sf.downloadUrl = durl.Url
+	return sf.downloadUrl, nil
+}
+
+// OpenRange 读取 [begin, end) 范围内的文件数据，下载链接过期时自动重新获取一次
+func (sf *SourceFile) OpenRange(begin, end int64) (*RangeBody, error) {
+	if begin < 0 || end > sf.size || begin >= end {
+		return nil, fmt.Errorf("invalid range: %d-%d, file size: %d", begin, end, sf.size)
+	}
+	for refresh := false; ; refresh = true {
+		downloadUrl, err := sf.url(refresh)
+		if err != nil {
+			return nil, err
+		}
+		var resp *http.Response
+		apierr := sf.client.DownloadFileData(downloadUrl, aliyunpan.FileDownloadRange{
+			Offset: begin,
+			End:    end - 1,
+		}, func(httpMethod, fullUrl string, headers map[string]string) (*http.Response, error) {
+			if begin == 0 && end-1 == 0 {
+				// 只读取第一个字节时接口不会设置Range
+				headers["range"] = "bytes=0-0"
+			}
+			var e error
+			resp, e = sf.httpClient.Req(httpMethod, fullUrl, nil, headers)
+			return resp, e
+		})
+		if apierr != nil {
+			return nil, apierr
+		}
+		switch resp.StatusCode {
+		case http.StatusPartialContent:
+			return &RangeBody{ReadCloser: resp.Body, length: end - begin}, nil
+		case http.StatusOK:
+			if begin == 0 && end == sf.size {
+				return &RangeBody{ReadCloser: resp.Body, length: end - begin}, nil
+			}
+			resp.Body.Close()
+			return nil, fmt.Errorf("下载链接不支持Range请求")
+		case http.StatusForbidden:
+			resp.Body.Close()
+			if !refresh {
+				// 链接过期，重新获取
+				continue
+			}
+		default:
+			resp.Body.Close()
+		}
+		return nil, fmt.Errorf("读取源文件数据失败, http status: %s", resp.Status)
+	}
+}
+
+// ReadAt 实现 io.ReaderAt，用于计算秒传的防伪码
+func (sf *SourceFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= sf.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > sf.size {
+		end = sf.size
+	}
+	body, err := sf.OpenRange(off, end)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:end-off])
+	if err == nil && end-off < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// CalcPreHash 计算文件的 PreHash，即文件前 1KB 数据的SHA1
+func CalcPreHash(r io.ReaderAt, size int64) (string, error) {
+	length := int64(PreHashSize)
+	if size < length {
+		length = size
+	}
+	buf := make([]byte, length)
+	if length > 0 {
+		if _, err := r.ReadAt(buf, 0); err != nil && err != io.EOF {
+			return "", err
+		}
+	}
+	sha1w := sha1.New()
+	sha1w.Write(buf)
+	return strings.ToUpper(hex.EncodeToString(sha1w.Sum(nil))), nil
+}
+
+// CalcProofCode 计算秒传的防伪码，需要读取源文件中由目标账号的 AccessToken 决定位置的数据
+func CalcProofCode(accessToken string, sf *SourceFile) (string, error) {
+	r := &proofReader{SourceFile: sf}
+	proofCode := aliyunpan.CalcProofCode(accessToken, r, sf.size)
+	if r.err != nil {
+		return "", r.err
+	}
+	return proofCode, nil
+}
+
+// proofReader 记录读取数据的错误，aliyunpan.CalcProofCode 会忽略读取错误
+type proofReader struct {
+	*SourceFile
+	err error
+}
+
+func (r *proofReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.SourceFile.ReadAt(p, off)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,75 @@
+package panxfer
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open"
+)
+
+// newTestSourceFile 使用本地HTTP服务模拟下载链接
+func newTestSourceFile(t *testing.T, data []byte) *SourceFile {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var begin, end int64
+		if _, err := fmt.Sscanf(r.Header.Get("range"), "bytes=%d-%d", &begin, &end); err != nil || end >= int64(len(data)) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", begin, end, len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[begin : end+1])
+	}))
+	t.Cleanup(server.Close)
+	sf := NewSourceFile(&aliyunpan_open.OpenPanClient{}, "drive", "file", int64(len(data)))
+	sf.downloadUrl = server.URL
+	return sf
+}
+
+func TestSourceFileOpenRange(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 10))
+	sf := newTestSourceFile(t, data)
+	for _, r := range [][2]int64{{0, 1}, {0, 100}, {10, 25}, {99, 100}} {
+		body, err := sf.OpenRange(r[0], r[1])
+		if err != nil {
+			t.Fatalf("open range %v: %v", r, err)
+		}
+		b, _ := io.ReadAll(body)
+		body.Close()
+		if !bytes.Equal(b, data[r[0]:r[1]]) || body.Len() != r[1]-r[0] {
+			t.Errorf("range %v: %q", r, b)
+		}
+	}
+	if _, err := sf.OpenRange(50, 101); err == nil {
+		t.Errorf("range beyond file size should fail")
+	}
+
+	buf := make([]byte, 8)
+	if n, err := sf.ReadAt(buf, 96); n != 4 || err != io.EOF || string(buf[:n]) != "6789" {
+		t.Errorf("read at end: %d, %v, %q", n, err, buf[:n])
+	}
+}
+
+func TestCalcPreHash(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 3000)
+	sf := newTestSourceFile(t, data)
+	preHash, err := CalcPreHash(sf, sf.Len())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum(data[:PreHashSize])
+	if preHash != strings.ToUpper(hex.EncodeToString(sum[:])) {
+		t.Errorf("pre hash: %s", preHash)
+	}
+
+	proofCode, err := CalcProofCode("token", sf)
+	if err != nil || proofCode != "YWFhYWFhYWE=" {
+		t.Errorf("proof code: %s, %v", proofCode, err)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panxfer
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/utils"
+)
+
+const (
+	// StateFileName 跨账号复制的进度记录文件名，保存在配置目录下
+	StateFileName = "aliyunpan_xfer_state.json"
+
+	// FileStatusUploading 文件正在上传，记录了上传任务可以断点续传
+	FileStatusUploading = "uploading"
+	// FileStatusDone 文件已经复制完成
+	FileStatusDone = "done"
+
+	// StateExpiration 进度记录的有效期，过期的上传任务服务器已经不再保留
+	StateExpiration = 7 * 24 * time.Hour
+)
+
+type (
+	// FileRecord 单个文件的复制进度
+	FileRecord struct {
+		SrcPath     string `json:"srcPath"`
+		DstPath     string `json:"dstPath"`
+		ContentHash string `json:"contentHash"`
+		Size        int64  `json:"size"`
+		Status      string `json:"status"`
+		// Rapid 是否秒传
+		Rapid bool `json:"rapid"`
+		// UploadEntity 目标账号的上传任务，上传完成后清空
+		UploadEntity *aliyunpan.CreateFileUploadResult `json:"uploadEntity,omitempty"`
+		BlockSize    int64                             `json:"blockSize,omitempty"`
+		UpdatedAt    int64                             `json:"updatedAt"`
+	}
+
+	// JobRecord 一次复制任务的进度，key 为源文件ID
+	JobRecord struct {
+		Files map[string]*FileRecord `json:"files"`
+	}
+
+	// TransferState 跨账号复制的进度记录
+	TransferState struct {
+		path     string
+		locker   sync.Mutex
+		lastSave time.Time
+		Jobs     map[string]*JobRecord `json:"jobs"`
+	}
+)
+
+// JobKey 复制任务的key，源和目标的账号、网盘、路径都相同的复制任务共用进度记录
+func JobKey(srcUserId, srcDriveId, srcPath, dstUserId, dstDriveId, dstPath string) string {
+	return strings.Join([]string{srcUserId, srcDriveId, srcPath, dstUserId, dstDriveId, dstPath}, "|")
+}
+
+// NewTransferState 创建空的进度记录
+func NewTransferState(statePath string) *TransferState {
+	return &TransferState{
+		path: statePath,
+		Jobs: map[string]*JobRecord{},
+	}
+}
+
+// LoadTransferState 读取进度记录，文件不存在则返回空的记录
+func LoadTransferState(statePath string) (*TransferState, error) {
+	ts := NewTransferState(statePath)
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ts, nil
+		}
+		return nil, err
+	}
+	if err = jsoniter.Unmarshal(data, ts); err != nil {
+		return nil, err
+	}
+	if ts.Jobs == nil {
+		ts.Jobs = map[string]*JobRecord{}
+	}
+	return ts, nil
+}
+
+// Save 保存进度记录，记录中包含上传地址，只允许当前用户读写
+func (ts *TransferState) Save() error {
+	ts.locker.Lock()
+	defer ts.locker.Unlock()
+	if err := utils.WriteJsonFileAtomic(ts.path, ts, 0600); err != nil {
+		return err
+	}
+	ts.lastSave = time.Now()
+	return nil
+}
+
+// SaveIfDue 距离上次保存超过 interval 才保存进度记录，避免每个分片都重写整个文件
+func (ts *TransferState) SaveIfDue(interval time.Duration) error {
+	ts.locker.Lock()
+	due := time.Since(ts.lastSave) >= interval
+	ts.locker.Unlock()
+	if !due {
+		return nil
+	}
+	return ts.Save()
+}
+
+// RemoveJob 删除复制任务的进度记录
+func (ts *TransferState) RemoveJob(jobKey string) {
+	ts.locker.Lock()
+	defer ts.locker.Unlock()
+	delete(ts.Jobs, jobKey)
+}
+
+// PruneExpired 删除 before 之前更新的文件记录，以及没有文件记录的复制任务
+func (ts *TransferState) PruneExpired(before int64) {
+	ts.locker.Lock()
+	defer ts.locker.Unlock()
+	for jobKey, job := range ts.Jobs {
+		for fileId, fr := range job.Files {
+			if fr.UpdatedAt < before {
+				delete(job.Files, fileId)
+			}
+		}
+		if len(job.Files) == 0 {
+			delete(ts.Jobs, jobKey)
+		}
+	}
+}
+
+// GetFile 获取源文件的复制进度，源文件的内容或者目标路径改变后之前的进度无效，返回nil
+func (ts *TransferState) GetFile(jobKey string, f *aliyunpan.FileEntity, dstPath string) *FileRecord {
+	ts.locker.Lock()
+	defer ts.locker.Unlock()
+	job := ts.Jobs[jobKey]
+	if job == nil || job.Files[f.FileId] == nil {
+		return nil
+	}
+	fr := job.Files[f.FileId]
+	if fr.DstPath != dstPath || fr.Size != f.FileSize || !strings.EqualFold(fr.ContentHash, f.ContentHash) {
+		return nil
+	}
+	return fr
+}
+
+// PutFile 记录源文件的复制进度
+func (ts *TransferState) PutFile(jobKey, srcFileId string, fr *FileRecord) {
+	ts.locker.Lock()
+	defer ts.locker.Unlock()
+	job := ts.Jobs[jobKey]
+	if job == nil {
+		job = &JobRecord{}
+		ts.Jobs[jobKey] = job
+	}
+	if job.Files == nil {
+		job.Files = map[string]*FileRecord{}
+	}
+	job.Files[srcFileId] = fr
+}
+
+// IsDone 源文件是否已经复制完成
+func (ts *TransferState) IsDone(jobKey string, f *aliyunpan.FileEntity, dstPath string) bool {
+	fr := ts.GetFile(jobKey, f, dstPath)
+	return fr != nil && fr.Status == FileStatusDone
+}
@@ -0,0 +1,101 @@
+package panxfer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestTransferState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), StateFileName)
+	ts, err := LoadTransferState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobKey := JobKey("u1", "d1", "/src", "u2", "d2", "/dst")
+	f := &aliyunpan.FileEntity{FileId: "f1", FileSize: 10, ContentHash: "ABC"}
+	ts.PutFile(jobKey, f.FileId, &FileRecord{
+		DstPath:     "/dst/src/a.txt",
+		ContentHash: "abc",
+		Size:        10,
+		Status:      FileStatusDone,
+	})
+	if err = ts.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err = LoadTransferState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ts.IsDone(jobKey, f, "/dst/src/a.txt") {
+		t.Errorf("file should be done")
+	}
+	if ts.IsDone(jobKey, f, "/dst/src/b.txt") {
+		t.Errorf("different target path should not be done")
+	}
+	changed := &aliyunpan.FileEntity{FileId: "f1", FileSize: 10, ContentHash: "DEF"}
+	if ts.GetFile(jobKey, changed, "/dst/src/a.txt") != nil {
+		t.Errorf("changed file should not reuse the record")
+	}
+	if ts.IsDone(JobKey("u1", "d1", "/src", "u3", "d3", "/dst"), f, "/dst/src/a.txt") {
+		t.Errorf("other job should not be done")
+	}
+}
+
+func TestTransferStatePrune(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), StateFileName)
+	ts := NewTransferState(statePath)
+	job1 := JobKey("u1", "d1", "/src", "u2", "d2", "/dst")
+	job2 := JobKey("u1", "d1", "/src2", "u2", "d2", "/dst")
+	ts.PutFile(job1, "f1", &FileRecord{Status: FileStatusUploading, UpdatedAt: 100})
+	ts.PutFile(job1, "f2", &FileRecord{Status: FileStatusDone, UpdatedAt: 300})
+	ts.PutFile(job2, "f3", &FileRecord{Status: FileStatusDone, UpdatedAt: 100})
+
+	ts.PruneExpired(200)
+	if len(ts.Jobs) != 1 || ts.Jobs[job1] == nil {
+		t.Fatalf("expired job should be removed: %v", ts.Jobs)
+	}
+	if _, ok := ts.Jobs[job1].Files["f1"]; ok {
+		t.Errorf("expired file record should be removed")
+	}
+	if _, ok := ts.Jobs[job1].Files["f2"]; !ok {
+		t.Errorf("recent file record should be kept")
+	}
+
+	ts.RemoveJob(job1)
+	if len(ts.Jobs) != 0 {
+		t.Errorf("job should be removed")
+	}
+}
+
+func TestTransferStateSaveIfDue(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), StateFileName)
+	ts := NewTransferState(statePath)
+	if err := ts.SaveIfDue(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("state file mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	ts.PutFile(JobKey("u1", "d1", "/src", "u2", "d2", "/dst"), "f1", &FileRecord{Status: FileStatusDone})
+	if err = ts.SaveIfDue(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := LoadTransferState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Jobs) != 0 {
+		t.Errorf("state should not be saved before the interval")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupdate
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/tickstep/library-go/requester"
+)
+
+const (
+	// checksumAssetSuffix 发布文件的 SHA-256 校验文件名称后缀，格式和 sha256sum 命令的输出一致
+	checksumAssetSuffix = "sha256sums.txt"
+	// signatureAssetSuffix 校验文件的签名文件后缀
+	signatureAssetSuffix = ".sig"
+)
+
+var (
+	// ReleasePublicKey 校验文件签名的 ed25519 公钥（base64编码），编译时通过
+	// -ldflags "-X github.com/tickstep/aliyunpan/internal/panupdate.ReleasePublicKey=..." 设置，为空则不校验签名
+	ReleasePublicKey = ""
+
+	// ErrChecksumNotFound 发布版本没有校验文件
+	ErrChecksumNotFound = fmt.Errorf("发布版本没有 SHA-256 校验文件")
+)
+
+// parseChecksums 解析校验文件，返回文件名和SHA-256的对应关系
+func parseChecksums(data []byte) map[string]string {
+	r := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		// 二进制模式的文件名以 * 开头
+		r[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return r
+}
+
+// verifySignature 使用公钥校验签名，签名可以是原始的64字节或者base64编码
+func verifySignature(data, sig []byte, publicKey string) error {
+	pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("内置的签名公钥无效")
+	}
+	if len(sig) != ed25519.SignatureSize {
+		if sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err != nil {
+			return fmt.Errorf("签名文件格式错误")
+		}
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return fmt.Errorf("校验文件签名无效")
+	}
+	return nil
+}
+
+// verifyReleaseFile 校验下载的发布文件。下载发布版本的校验文件，内置了公钥时还会校验校验文件的签名
+func verifyReleaseFile(client *requester.HTTPClient, release *ReleaseInfo, filename string, data []byte) error {
+	checksumAsset := release.findAsset(func(name string) bool {
+		return strings.HasSuffix(strings.ToLower(name), checksumAssetSuffix)
+	})
+	if checksumAsset == nil {
+		return ErrChecksumNotFound
+	}
+	manifest, err := downloadAsset(client, checksumAsset.BrowserDownloadURL, -1, false)
+	if err != nil {
+		return fmt.Errorf("下载校验文件失败: %s", err)
+	}
+
+	if ReleasePublicKey != "" {
+		sigAsset := release.findAsset(func(name string) bool {
+			return name == checksumAsset.Name+signatureAssetSuffix
+		})
+		if sigAsset == nil {
+			return fmt.Errorf("发布版本没有校验文件的签名")
+		}
+		sig, err := downloadAsset(client, sigAsset.BrowserDownloadURL, -1, false)
+		if err != nil {
+			return fmt.Errorf("下载签名文件失败: %s", err)
+		}
+		if err = verifySignature(manifest, sig, ReleasePublicKey); err != nil {
+			return err
+		}
+	}
+
+	expected, ok := parseChecksums(manifest)[filename]
+	if !ok {
+		return fmt.Errorf("校验文件中没有 %s 的记录", filename)
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("SHA-256 校验失败, 期望: %s, 实际: %s", expected, actual)
+	}
+	return nil
+}
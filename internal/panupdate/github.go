@@ -13,6 +13,8 @@
 // limitations under the License.
 package panupdate
 
+import "strings"
+
 type (
 	// AssetInfo asset 信息
 	AssetInfo struct {
@@ -25,7 +27,27 @@ type (
 
 	// ReleaseInfo 发布信息
 	ReleaseInfo struct {
-		TagName string       `json:"tag_name"`
-		Assets  []*AssetInfo `json:"assets"`
+		TagName string `json:"tag_name"`
+		// Prerelease 是否是预发布(Beta)版本
+		Prerelease bool         `json:"prerelease"`
+		Assets     []*AssetInfo `json:"assets"`
 	}
 )
+
+// IsBeta 是否是Beta版本
+func (r *ReleaseInfo) IsBeta() bool {
+	return r.Prerelease || strings.Contains(strings.ToLower(r.TagName), "beta")
+}
+
+// findAsset 查找指定名称的 asset
+func (r *ReleaseInfo) findAsset(match func(name string) bool) *AssetInfo {
+	for _, asset := range r.Assets {
+		if asset == nil || asset.State != "uploaded" {
+			continue
+		}
+		if match(asset.Name) {
+			return asset
+		}
+	}
+	return nil
+}
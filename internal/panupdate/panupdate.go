@@ -16,15 +16,16 @@ package panupdate
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -44,6 +45,18 @@ import (
 
 const (
 	ReleaseName = "aliyunpan"
+
+	// ChannelStable 正式版本更新通道
+	ChannelStable = "stable"
+	// ChannelBeta Beta版本更新通道，包括预发布版本
+	ChannelBeta = "beta"
+)
+
+var (
+	// githubReleasesUrl github 发布版本接口地址
+	githubReleasesUrl = "https://api.github.com/repos/tickstep/aliyunpan/releases"
+	// tickstepReleasesUrl tickstep 服务器发布版本接口地址
+	tickstepReleasesUrl = "http://api.tickstep.com/update/tickstep/aliyunpan/releases"
 )
 
 type info struct {
@@ -52,6 +65,18 @@ type info struct {
 	downloadURL string
 }
 
+// UpdateOptions 更新选项
+type UpdateOptions struct {
+	// Yes 不需要确认直接更新
+	Yes bool
+	// Channel 更新通道：stable, beta
+	Channel string
+	// Version 指定更新的版本，例如 v0.3.7，可以用于降级
+	Version string
+	// NoVerify 跳过更新文件的校验，旧的发布版本没有校验文件
+	NoVerify bool
+}
+
 type tsResp struct {
 	Code int         `json:"code"`
 	Data interface{} `json:"data"`
@@ -66,7 +91,7 @@ func getReleaseFromTickstep(client *requester.HTTPClient, showPrompt bool) *Rele
 	if err != nil {
 		ipAddr = "127.0.0.1"
 	}
-	fmt.Fprintf(&fullUrl, "http://api.tickstep.com/update/tickstep/aliyunpan/releases/latest?ip=%s&os=%s&arch=%s&version=%s", ipAddr, runtime.GOOS, runtime.GOARCH, global.AppVersion)
+	fmt.Fprintf(&fullUrl, "%s/latest?ip=%s&os=%s&arch=%s&version=%s", tickstepReleasesUrl, ipAddr, runtime.GOOS, runtime.GOARCH, global.AppVersion)
 	//fmt.Fprintf(&fullUrl, "http://localhost:8997/update/tickstep/aliyunpan/releases/latest?ip=%s&os=%s&arch=%s&version=%s", ipAddr, runtime.GOOS, runtime.GOARCH, global.AppVersion)
 	resp, err := client.Req(http.MethodGet, fullUrl.String(), nil, nil)
 	if resp != nil {
@@ -109,26 +134,85 @@ func getReleaseFromTickstep(client *requester.HTTPClient, showPrompt bool) *Rele
 }
 
 func getReleaseFromGithub(client *requester.HTTPClient, showPrompt bool) *ReleaseInfo {
-	resp, err := client.Req(http.MethodGet, "https://api.github.com/repos/tickstep/aliyunpan/releases/latest", nil, nil)
+	releaseInfo := ReleaseInfo{}
+	if err := getGithubJson(client, githubReleasesUrl+"/latest", &releaseInfo); err != nil {
+		if showPrompt {
+			fmt.Printf("获取版本信息错误: %s\n", err)
+		}
+		return nil
+	}
+	return &releaseInfo
+}
+
+// getGithubJson 获取 github 接口数据
+func getGithubJson(client *requester.HTTPClient, apiUrl string, v interface{}) error {
+	resp, err := client.Req(http.MethodGet, apiUrl, nil, nil)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
 	if err != nil {
-		if showPrompt {
-			logger.Verbosef("获取数据错误: %s\n", err)
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	return jsonhelper.UnmarshalData(resp.Body, v)
+}
+
+// getReleaseByTag 获取指定版本的发布信息
+func getReleaseByTag(client *requester.HTTPClient, tag string) (*ReleaseInfo, error) {
+	releaseInfo := &ReleaseInfo{}
+	if err := getGithubJson(client, githubReleasesUrl+"/tags/"+url.PathEscape(tag), releaseInfo); err != nil {
+		return nil, fmt.Errorf("获取版本 %s 失败: %s", tag, err)
+	}
+	if releaseInfo.TagName == "" {
+		return nil, fmt.Errorf("版本 %s 不存在", tag)
+	}
+	return releaseInfo, nil
+}
+
+// getLatestBetaRelease 获取最新的发布版本，包括Beta版本，版本号相同的优先使用正式版本
+func getLatestBetaRelease(client *requester.HTTPClient) (*ReleaseInfo, error) {
+	var releaseList []*ReleaseInfo
+	if err := getGithubJson(client, githubReleasesUrl+"?per_page=30", &releaseList); err != nil {
+		return nil, err
+	}
+	var latest *ReleaseInfo
+	for _, r := range releaseList {
+		if r == nil || !strings.HasPrefix(r.TagName, "v") {
+			continue
 		}
-		return nil
+		if latest == nil {
+			latest = r
+			continue
+		}
+		v, latestVer := utils.ParseVersionNum(r.TagName), utils.ParseVersionNum(latest.TagName)
+		if v > latestVer || (v == latestVer && latest.IsBeta() && !r.IsBeta()) {
+			latest = r
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("没有可用的发布版本")
 	}
+	return latest, nil
+}
 
-	releaseInfo := ReleaseInfo{}
-	err = jsonhelper.UnmarshalData(resp.Body, &releaseInfo)
-	if err != nil {
-		if showPrompt {
-			fmt.Printf("json数据解析失败: %s\n", err)
+// fetchRelease 根据更新选项获取目标版本的发布信息
+func fetchRelease(client *requester.HTTPClient, opt *UpdateOptions) (*ReleaseInfo, error) {
+	switch {
+	case opt.Version != "":
+		tag := opt.Version
+		if !strings.HasPrefix(tag, "v") {
+			tag = "v" + tag
 		}
-		return nil
+		return getReleaseByTag(client, tag)
+	case opt.Channel == ChannelBeta:
+		return getLatestBetaRelease(client)
 	}
-	return &releaseInfo
+	if releaseInfo := GetLatestReleaseInfo(true); releaseInfo != nil {
+		return releaseInfo, nil
+	}
+	return nil, fmt.Errorf("获取最新版本信息失败")
 }
 
 func GetLatestReleaseInfo(showPrompt bool) *ReleaseInfo {
@@ -163,50 +247,98 @@ func GetLatestReleaseInfo(showPrompt bool) *ReleaseInfo {
 	return releaseInfo
 }
 
-// CheckUpdate 检测更新
-func CheckUpdate(version string, yes bool) {
+// CheckUpdate 检测更新，没有更新或者取消更新时返回nil
+func CheckUpdate(version string, opt *UpdateOptions) error {
+	if opt == nil {
+		opt = &UpdateOptions{}
+	}
 	if !checkaccess.AccessRDWR(cmdutil.ExecutablePath()) {
-		fmt.Printf("程序目录不可写, 无法更新.\n")
-		return
+		return errors.New("程序目录不可写, 无法更新")
 	}
 	fmt.Println("检测更新中, 稍候...")
 	client := config.Config.HTTPClient("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/83.0.4103.116 Safari/537.36")
 	client.SetTimeout(time.Duration(0) * time.Second)
 	client.SetKeepAlive(true)
 
-	releaseInfo := GetLatestReleaseInfo(true)
-	if releaseInfo == nil {
-		fmt.Printf("获取版本信息失败!\n")
-		return
+	releaseInfo, err := fetchRelease(client, opt)
+	if err != nil {
+		return fmt.Errorf("获取版本信息失败: %s", err)
 	}
 
-	// 没有更新, 或忽略 Beta 版本, 和版本前缀不符的
-	if strings.Contains(releaseInfo.TagName, "Beta") || !strings.HasPrefix(releaseInfo.TagName, "v") || utils.ParseVersionNum(version) >= utils.ParseVersionNum(releaseInfo.TagName) {
-		fmt.Printf("未检测到更新!\n")
-		return
+	if opt.Version == "" {
+		// 没有更新, 或正式版本通道忽略 Beta 版本, 和版本前缀不符的
+		if (opt.Channel != ChannelBeta && releaseInfo.IsBeta()) || !strings.HasPrefix(releaseInfo.TagName, "v") || utils.ParseVersionNum(version) >= utils.ParseVersionNum(releaseInfo.TagName) {
+			fmt.Printf("未检测到更新!\n")
+			return nil
+		}
+		fmt.Printf("检测到新版本: %s\n", releaseInfo.TagName)
+	} else {
+		fmt.Printf("指定更新的版本: %s\n", releaseInfo.TagName)
 	}
 
-	fmt.Printf("检测到新版本: %s\n", releaseInfo.TagName)
-
 	line := cmdliner.NewLiner()
 	defer line.Close()
 
-	if !yes {
+	if !opt.Yes {
 		y, err := line.State.Prompt("是否进行更新 (y/n): ")
 		if err != nil {
-			fmt.Printf("输入错误: %s\n", err)
-			return
+			return fmt.Errorf("输入错误: %s", err)
 		}
 
 		if y != "y" && y != "Y" {
 			fmt.Printf("更新取消.\n")
-			return
+			return nil
+		}
+	}
+
+	targetList := matchReleaseAssets(releaseInfo, runtime.GOOS, runtime.GOARCH)
+	var target info
+	switch len(targetList) {
+	case 0:
+		return fmt.Errorf("未匹配到当前系统的程序更新文件, GOOS: %s, GOARCH: %s", runtime.GOOS, runtime.GOARCH)
+	case 1:
+		target = *targetList[0]
+	default:
+		fmt.Println()
+		for k := range targetList {
+			fmt.Printf("%d: %s\n", k, targetList[k].filename)
+		}
+
+		fmt.Println()
+		t, err := line.State.Prompt("输入序号以下载更新: ")
+		if err != nil {
+			return err
+		}
+
+		i, err := strconv.Atoi(t)
+		if err != nil {
+			return fmt.Errorf("输入错误: %s", err)
+		}
+
+		if i < 0 || i >= len(targetList) {
+			return errors.New("输入错误: 序号不在范围内")
 		}
+
+		target = *targetList[i]
 	}
 
+	execPath := cmdutil.Executable()
+	if err = downloadAndInstall(client, releaseInfo, &target, opt.NoVerify, execPath, configurationPath()); err != nil {
+		if err == ErrChecksumNotFound {
+			return fmt.Errorf("更新失败: %s\n旧的发布版本没有校验文件, 确认需要更新请使用 -no-verify 跳过校验", err)
+		}
+		return fmt.Errorf("更新失败: %s", err)
+	}
+	fmt.Printf("更新完毕, 请重启程序. 旧版本已保存为 %s, 可以使用 update -rollback 回滚\n", oldExecutablePath(execPath))
+	return nil
+}
+
+// matchReleaseAssets 匹配当前系统的程序更新文件
+func matchReleaseAssets(releaseInfo *ReleaseInfo, goos, goarch string) []*info {
 	builder := &strings.Builder{}
-	builder.WriteString(ReleaseName + "-" + releaseInfo.TagName + "-" + runtime.GOOS + "-.*?")
-	switch runtime.GOARCH {
+	builder.WriteString(regexp.QuoteMeta(ReleaseName + "-" + releaseInfo.TagName + "-" + goos + "-"))
+	builder.WriteString(".*?")
+	switch goarch {
 	case "amd64":
 		builder.WriteString("(amd64|x86_64|x64)")
 	case "386":
@@ -224,7 +356,7 @@ func CheckUpdate(version string, yes bool) {
 	case "mips64le":
 		builder.WriteString("(mips64le|mips64el)")
 	default:
-		builder.WriteString(runtime.GOARCH)
+		builder.WriteString(goarch)
 	}
 	builder.WriteString("\\.zip")
 
@@ -244,50 +376,35 @@ func CheckUpdate(version string, yes bool) {
 			})
 		}
 	}
+	return targetList
+}
 
-	var target info
-	switch len(targetList) {
-	case 0:
-		fmt.Printf("未匹配到当前系统的程序更新文件, GOOS: %s, GOARCH: %s\n", runtime.GOOS, runtime.GOARCH)
-		return
-	case 1:
-		target = *targetList[0]
-	default:
-		fmt.Println()
-		for k := range targetList {
-			fmt.Printf("%d: %s\n", k, targetList[k].filename)
-		}
-
-		fmt.Println()
-		t, err := line.State.Prompt("输入序号以下载更新: ")
-		if err != nil {
-			fmt.Printf("%s\n", err)
-			return
-		}
-
-		i, err := strconv.Atoi(t)
-		if err != nil {
-			fmt.Printf("输入错误: %s\n", err)
-			return
-		}
-
-		if i < 0 || i >= len(targetList) {
-			fmt.Printf("输入错误: 序号不在范围内\n")
-			return
-		}
-
-		target = *targetList[i]
-	}
-
+// downloadAndInstall 下载更新文件，校验通过后进行安装
+func downloadAndInstall(client *requester.HTTPClient, releaseInfo *ReleaseInfo, target *info, noVerify bool, execPath, configPath string) error {
 	if target.size > 0x7fffffff {
-		fmt.Printf("file size too large: %d\n", target.size)
-		return
+		return fmt.Errorf("file size too large: %d", target.size)
 	}
 
 	fmt.Printf("准备下载更新: %s\n", target.filename)
+	data, err := downloadAsset(client, target.downloadURL, target.size, true)
+	if err != nil {
+		return fmt.Errorf("下载更新文件发生错误: %s", err)
+	}
+	fmt.Printf("\n下载完毕\n")
+
+	if noVerify {
+		fmt.Printf("警告: 已跳过更新文件的校验\n")
+	} else {
+		if err = verifyReleaseFile(client, releaseInfo, target.filename, data); err != nil {
+			return err
+		}
+		fmt.Printf("更新文件校验通过\n")
+	}
+	return installRelease(data, execPath, configPath)
+}
 
-	// 开始下载
-	buf := cachepool.RawMallocByteSlice(int(target.size))
+// downloadAsset 下载发布文件，size 小于0表示文件大小未知
+func downloadAsset(client *requester.HTTPClient, downloadUrl string, size int64, showProgress bool) ([]byte, error) {
 	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 		logger.Verboseln("下载文件：" + req.URL.String())
 		req.Header.Del("Referer") // aliyundrive会检测盗链行为，所以删除Referer
@@ -296,30 +413,35 @@ func CheckUpdate(version string, yes bool) {
 	header := map[string]string{}
 	header["Referer"] = ""
 	header["User-Agent"] = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/106.0.0.0 Safari/537.36 Edg/106.0.1370.42"
-	resp, err := client.Req("GET", target.downloadURL, nil, header)
+	resp, err := client.Req("GET", downloadUrl, nil, header)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
 	if err != nil {
-		fmt.Printf("下载更新文件发生错误: %s\n", err)
-		return
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	if size < 0 {
+		return ioutil.ReadAll(resp.Body)
 	}
 	total, _ := strconv.Atoi(resp.Header.Get("Content-Length"))
-	if total > 0 {
-		if int64(total) != target.size {
-			if es, e := ioutil.ReadAll(resp.Body); e == nil {
-				// 发生错误
-				logger.Verboseln(string(es))
-			}
-			fmt.Printf("下载更新文件发生错误: %s\n", err)
-			return
+	if total > 0 && int64(total) != size {
+		if es, e := ioutil.ReadAll(resp.Body); e == nil {
+			// 发生错误
+			logger.Verboseln(string(es))
 		}
+		return nil, fmt.Errorf("文件大小不匹配, 期望: %d, 实际: %d", size, total)
 	}
 
 	// 初始化数据
 	var readErr error
+	buf := cachepool.RawMallocByteSlice(int(size))
 	downloadSize := 0
 	nn := 0
-	nn64 := int64(0)
 	downloadStatus := transfer.NewDownloadStatus()
-	downloadStatus.AddTotalSize(target.size)
+	downloadStatus.AddTotalSize(size)
 
 	statusIndicator := func(status *transfer.DownloadStatus) {
 		status.UpdateSpeeds() // 更新速度
@@ -340,53 +462,40 @@ func CheckUpdate(version string, yes bool) {
 	}
 
 	// 读取数据
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for downloadSize < len(buf) && readErr == nil {
-			nn, readErr = resp.Body.Read(buf[downloadSize:])
-			nn64 = int64(nn)
-
-			// 更新速度统计
-			downloadStatus.AddSpeedsDownloaded(nn64)
-			downloadStatus.AddDownloaded(nn64)
-			downloadSize += nn
-
-			if statusIndicator != nil {
-				statusIndicator(downloadStatus)
-			}
-		}
-	}()
-	wg.Wait()
+	for downloadSize < len(buf) && readErr == nil {
+		nn, readErr = resp.Body.Read(buf[downloadSize:])
 
-	if int64(downloadSize) == target.size {
-		// 下载完成
-		fmt.Printf("\n下载完毕\n")
-	} else {
-		fmt.Printf("\n下载更新文件失败\n")
-		return
+		// 更新速度统计
+		downloadStatus.AddSpeedsDownloaded(int64(nn))
+		downloadStatus.AddDownloaded(int64(nn))
+		downloadSize += nn
+
+		if showProgress {
+			statusIndicator(downloadStatus)
+		}
+	}
+	if int64(downloadSize) != size {
+		return nil, fmt.Errorf("下载的文件不完整")
 	}
+	return buf, nil
+}
 
-	// 读取文件
-	reader, err := zip.NewReader(bytes.NewReader(buf), target.size)
+// installRelease 安装更新文件，zip 中的程序文件替换当前程序，其他文件更新到配置目录
+func installRelease(data []byte, execPath, configPath string) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
-		fmt.Printf("读取更新文件发生错误: %s\n", err)
-		return
+		return fmt.Errorf("读取更新文件发生错误: %s", err)
 	}
 
-	//execPath := cmdutil.ExecutablePath()
-	configPath := configurationPath()
-
-	var fileNum, errTimes int
+	execUpdated := false
 	for _, zipFile := range reader.File {
-		if zipFile == nil {
+		if zipFile == nil || zipFile.FileInfo().IsDir() {
 			continue
 		}
 
-		info := zipFile.FileInfo()
-
-		if info.IsDir() {
+		name := zipFile.Name[strings.Index(zipFile.Name, "/")+1:]
+		if strings.Contains(name, "..") {
+			fmt.Printf("忽略不安全的 zip 路径: %s\n", zipFile.Name)
 			continue
 		}
 
@@ -396,30 +505,29 @@ func CheckUpdate(version string, yes bool) {
 			continue
 		}
 
-		fileNum++
-
-		name := zipFile.Name[strings.Index(zipFile.Name, "/")+1:]
-		if name == ReleaseName {
+		if name == ReleaseName || name == ReleaseName+".exe" {
 			// 执行文件
-			err = update(cmdutil.Executable(), rc)
+			err = updateExecutable(execPath, rc)
+			if err == nil {
+				execUpdated = true
+			}
 		} else {
 			// 配置文件
 			err = update(filepath.Join(configPath, name), rc)
 		}
+		rc.Close()
 
 		if err != nil {
-			errTimes++
+			if name == ReleaseName || name == ReleaseName+".exe" {
+				return fmt.Errorf("更新程序文件发生错误: %s", err)
+			}
 			fmt.Printf("发生错误, zip 路径: %s, 错误: %s\n", zipFile.Name, err)
-			continue
 		}
 	}
-
-	if errTimes == fileNum {
-		fmt.Printf("更新失败\n")
-		return
+	if !execUpdated {
+		return fmt.Errorf("更新文件中没有程序文件")
 	}
-
-	fmt.Printf("更新完毕, 请重启程序\n")
+	return nil
 }
 
 // ConfigurationPath 获取程序配置所在目录
@@ -0,0 +1,196 @@
+package panupdate
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tickstep/library-go/requester"
+)
+
+// fakeReleaseServer 模拟 github 发布接口和文件下载
+type fakeReleaseServer struct {
+	*httptest.Server
+	releases []*ReleaseInfo
+	files    map[string][]byte
+}
+
+func newFakeReleaseServer() *fakeReleaseServer {
+	s := &fakeReleaseServer{files: map[string][]byte{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(s.releases)
+	})
+	mux.HandleFunc("/releases/tags/", func(w http.ResponseWriter, r *http.Request) {
+		tag := filepath.Base(r.URL.Path)
+		for _, release := range s.releases {
+			if release.TagName == tag {
+				json.NewEncoder(w).Encode(release)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.files[filepath.Base(r.URL.Path)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *fakeReleaseServer) addRelease(tag string, prerelease bool, files map[string][]byte) {
+	release := &ReleaseInfo{TagName: tag, Prerelease: prerelease}
+	for name, data := range files {
+		s.files[name] = data
+		release.Assets = append(release.Assets, &AssetInfo{
+			Name:               name,
+			State:              "uploaded",
+			Size:               int64(len(data)),
+			BrowserDownloadURL: s.URL + "/download/" + name,
+		})
+	}
+	s.releases = append(s.releases, release)
+}
+
+func zipRelease(t *testing.T, tag, content string) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	f, err := w.Create(ReleaseName + "-" + tag + "/" + ReleaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(content))
+	w.Close()
+	return buf.Bytes()
+}
+
+func checksumLine(name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name)
+}
+
+func TestFetchRelease(t *testing.T) {
+	server := newFakeReleaseServer()
+	defer server.Close()
+	defer func(u string) { githubReleasesUrl = u }(githubReleasesUrl)
+	githubReleasesUrl = server.URL + "/releases"
+
+	server.addRelease("v0.3.8", false, nil)
+	server.addRelease("v0.3.9-beta1", true, nil)
+	server.addRelease("v0.3.7", false, nil)
+
+	client := requester.NewHTTPClient()
+	r, err := fetchRelease(client, &UpdateOptions{Channel: ChannelBeta})
+	if err != nil || r.TagName != "v0.3.9-beta1" || !r.IsBeta() {
+		t.Errorf("unexpected beta release: %+v, %v", r, err)
+	}
+	r, err = fetchRelease(client, &UpdateOptions{Version: "0.3.7"})
+	if err != nil || r.TagName != "v0.3.7" {
+		t.Errorf("unexpected pinned release: %+v, %v", r, err)
+	}
+	if _, err = fetchRelease(client, &UpdateOptions{Version: "v9.9.9"}); err == nil {
+		t.Errorf("unknown version should fail")
+	}
+}
+
+func TestDownloadAndInstall(t *testing.T) {
+	server := newFakeReleaseServer()
+	defer server.Close()
+	defer func(k string) { ReleasePublicKey = k }(ReleasePublicKey)
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	ReleasePublicKey = base64.StdEncoding.EncodeToString(pub)
+
+	assetName := ReleaseName + "-v0.3.8-linux-amd64.zip"
+	assetData := zipRelease(t, "v0.3.8", "new binary")
+	manifest := []byte(checksumLine(assetName, assetData))
+	server.addRelease("v0.3.8", false, map[string][]byte{
+		assetName:                                  assetData,
+		ReleaseName + "-v0.3.8-sha256sums.txt":     manifest,
+		ReleaseName + "-v0.3.8-sha256sums.txt.sig": []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, manifest))),
+	})
+	// 校验值错误的版本
+	badName := ReleaseName + "-v0.3.9-linux-amd64.zip"
+	badData := zipRelease(t, "v0.3.9", "tampered binary")
+	badManifest := []byte(checksumLine(badName, []byte("original binary")))
+	server.addRelease("v0.3.9", false, map[string][]byte{
+		badName:                                badData,
+		ReleaseName + "-v0.3.9-sha256sums.txt": badManifest,
+		ReleaseName + "-v0.3.9-sha256sums.txt.sig": ed25519.Sign(priv, badManifest),
+	})
+	// 没有校验文件的版本
+	oldName := ReleaseName + "-v0.3.6-linux-amd64.zip"
+	server.addRelease("v0.3.6", false, map[string][]byte{oldName: zipRelease(t, "v0.3.6", "old binary")})
+
+	dir := t.TempDir()
+	execPath := filepath.Join(dir, ReleaseName)
+	os.WriteFile(execPath, []byte("current binary"), 0755)
+	client := requester.NewHTTPClient()
+
+	release := server.releases[1]
+	targets := matchReleaseAssets(release, "linux", "amd64")
+	if len(targets) != 1 {
+		t.Fatalf("unexpected targets: %v", targets)
+	}
+	if err := downloadAndInstall(client, release, targets[0], false, execPath, dir); err == nil {
+		t.Errorf("checksum mismatch should fail")
+	}
+
+	release = server.releases[2]
+	targets = matchReleaseAssets(release, "linux", "amd64")
+	if err := downloadAndInstall(client, release, targets[0], false, execPath, dir); err != ErrChecksumNotFound {
+		t.Errorf("missing checksum should fail, got %v", err)
+	}
+	if data, _ := os.ReadFile(execPath); string(data) != "current binary" {
+		t.Fatalf("executable should not be changed: %s", data)
+	}
+
+	release = server.releases[0]
+	targets = matchReleaseAssets(release, "linux", "amd64")
+	if err := downloadAndInstall(client, release, targets[0], false, execPath, dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(execPath); string(data) != "new binary" {
+		t.Errorf("unexpected executable: %s", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, ReleaseName+".old")); string(data) != "current binary" {
+		t.Errorf("unexpected old executable: %s", data)
+	}
+
+	// 签名无效
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	server.files[ReleaseName+"-v0.3.8-sha256sums.txt.sig"] = ed25519.Sign(otherKey, manifest)
+	if err := downloadAndInstall(client, release, targets[0], false, execPath, dir); err == nil {
+		t.Errorf("invalid signature should fail")
+	}
+
+	// 回滚，再次回滚恢复
+	if err := Rollback(execPath); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(execPath); string(data) != "current binary" {
+		t.Errorf("unexpected executable after rollback: %s", data)
+	}
+	if err := Rollback(execPath); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(execPath); string(data) != "new binary" {
+		t.Errorf("unexpected executable after second rollback: %s", data)
+	}
+}
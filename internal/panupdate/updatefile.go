@@ -18,6 +18,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func update(targetPath string, src io.Reader) error {
@@ -61,3 +62,68 @@ func update(targetPath string, src io.Reader) error {
 	}
 	return nil
 }
+
+// oldExecutablePath 保存的上一个版本的程序文件路径，例如 aliyunpan.old
+func oldExecutablePath(execPath string) string {
+	name := strings.TrimSuffix(filepath.Base(execPath), ".exe")
+	return filepath.Join(filepath.Dir(execPath), name+".old")
+}
+
+// updateExecutable 更新程序文件，先写入临时文件再替换，上一个版本的程序保存为 aliyunpan.old 用于回滚
+func updateExecutable(execPath string, src io.Reader) error {
+	info, err := os.Stat(execPath)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := execPath + ".new"
+	newFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(newFile, src); err != nil {
+		newFile.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err = newFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	oldPath := oldExecutablePath(execPath)
+	os.Remove(oldPath)
+	if err = os.Rename(execPath, oldPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Rename(tmpPath, execPath); err != nil {
+		// 恢复原来的程序
+		os.Rename(oldPath, execPath)
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// Rollback 回滚到更新前的版本，当前版本保存为 aliyunpan.old，再次回滚可以恢复
+func Rollback(execPath string) error {
+	oldPath := oldExecutablePath(execPath)
+	if _, err := os.Stat(oldPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("没有可以回滚的版本: %s 不存在", oldPath)
+		}
+		return err
+	}
+
+	tmpPath := execPath + ".rollback"
+	os.Remove(tmpPath)
+	if err := os.Rename(execPath, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(oldPath, execPath); err != nil {
+		os.Rename(tmpPath, execPath)
+		return err
+	}
+	return os.Rename(tmpPath, oldPath)
+}
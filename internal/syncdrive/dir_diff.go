@@ -0,0 +1,225 @@
+package syncdrive
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+)
+
+const (
+	// DiffReasonType 一边是文件一边是目录
+	DiffReasonType = "type"
+	// DiffReasonSize 文件大小不一致
+	DiffReasonSize = "size"
+	// DiffReasonSha1 文件SHA1不一致
+	DiffReasonSha1 = "sha1"
+)
+
+type (
+	// DirDiffMismatch 两边都存在但是内容不一致的文件
+	DirDiffMismatch struct {
+		RelativePath string
+		LocalFile    *LocalFileItem
+		PanFile      *PanFileItem
+		// Reason 不一致的原因：type, size, sha1
+		Reason string
+	}
+
+	// DirDiffResult 本地目录和云盘目录的对比结果
+	DirDiffResult struct {
+		// OnlyLocal 只在本地存在的文件和目录
+		OnlyLocal LocalFileList
+		// OnlyPan 只在云盘存在的文件和目录
+		OnlyPan PanFileList
+		// Mismatch 两边都存在但是内容不一致的文件
+		Mismatch []*DirDiffMismatch
+		// SameCount 两边一致的文件和目录数量
+		SameCount int
+	}
+
+	// LocalSha1Func 计算本地文件SHA1
+	LocalSha1Func func(file *LocalFileItem) (string, error)
+
+	// LocalHashCache 本地文件SHA1缓存，文件路径、大小和修改时间都不变时直接使用缓存的SHA1，保存为JSON文件
+	LocalHashCache struct {
+		filePath string
+		mutex    *sync.Mutex
+		items    map[string]*localHashCacheItem
+		changed  bool
+	}
+
+	localHashCacheItem struct {
+		Size    int64  `json:"size"`
+		ModTime int64  `json:"modTime"`
+		Sha1    string `json:"sha1"`
+	}
+)
+
+// DiffDirectory 对比本地目录和云盘目录的文件，使用和同步任务相同的交集和差集逻辑。
+// sha1Func 不为空时，大小相同的文件还会对比SHA1
+func DiffDirectory(localFolderPath string, localFiles LocalFileList, panFolderPath string, panFiles PanFileList, sha1Func LocalSha1Func) (*DirDiffResult, error) {
+	localFilesSet := &localFileSet{
+		items:           localFiles,
+		localFolderPath: localFolderPath,
+	}
+	panFilesSet := &panFileSet{
+		items:         panFiles,
+		panFolderPath: panFolderPath,
+	}
+	result := &DirDiffResult{
+		OnlyLocal: localFilesSet.Difference(panFilesSet),
+		OnlyPan:   panFilesSet.Difference(localFilesSet),
+		Mismatch:  []*DirDiffMismatch{},
+	}
+	localSame, panSame := localFilesSet.Intersection(panFilesSet)
+	for k, localFile := range localSame {
+		panFile := panSame[k]
+		reason := ""
+		switch {
+		case localFile.IsFolder() != panFile.IsFolder():
+			reason = DiffReasonType
+		case localFile.IsFolder():
+		case localFile.FileSize != panFile.FileSize:
+			reason = DiffReasonSize
+		case sha1Func != nil && panFile.Sha1Hash != "":
+			sha1, err := sha1Func(localFile)
+			if err != nil {
+				return nil, err
+			}
+			if !strings.EqualFold(sha1, panFile.Sha1Hash) {
+				reason = DiffReasonSha1
+			}
+		}
+		if reason == "" {
+			result.SameCount++
+			continue
+		}
+		result.Mismatch = append(result.Mismatch, &DirDiffMismatch{
+			RelativePath: localFilesSet.getRelativePath(localFile.Path),
+			LocalFile:    localFile,
+			PanFile:      panFile,
+			Reason:       reason,
+		})
+	}
+
+	sort.Slice(result.OnlyLocal, func(i, j int) bool { return result.OnlyLocal[i].Path < result.OnlyLocal[j].Path })
+	sort.Slice(result.OnlyPan, func(i, j int) bool { return result.OnlyPan[i].Path < result.OnlyPan[j].Path })
+	sort.Slice(result.Mismatch, func(i, j int) bool { return result.Mismatch[i].RelativePath < result.Mismatch[j].RelativePath })
+	return result, nil
+}
+
+// ScanLocalDirectory 递归获取本地目录下的所有文件和目录，不包含目录本身
+func ScanLocalDirectory(localFolderPath string) (LocalFileList, error) {
+	files := LocalFileList{}
+	err := filepath.Walk(localFolderPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == localFolderPath {
+			return nil
+		}
+		files = append(files, newLocalFileItem(info, filePath))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ScanPanDirectory 递归获取云盘目录下的所有文件和目录，不包含目录本身
+func ScanPanDirectory(panClient *config.PanClient, driveId, panFolderPath string) (PanFileList, *apierror.ApiError) {
+	panFolderPath = path.Clean(panFolderPath)
+	files := PanFileList{}
+	var apiErr *apierror.ApiError
+	panClient.OpenapiPanClient().FilesDirectoriesRecurseList(driveId, panFolderPath, func(depth int, _ string, fd *aliyunpan.FileEntity, apierr *apierror.ApiError) bool {
+		if apierr != nil {
+			apiErr = apierr
+			return false
+		}
+		if depth == 0 {
+			return true
+		}
+		files = append(files, NewPanFileItem(fd))
+		return true
+	})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return files, nil
+}
+
+// NewLocalHashCache 创建本地文件SHA1缓存，缓存文件不存在或者无法解析时使用空的缓存
+func NewLocalHashCache(filePath string) *LocalHashCache {
+	c := &LocalHashCache{
+		filePath: filePath,
+		mutex:    &sync.Mutex{},
+		items:    map[string]*localHashCacheItem{},
+	}
+	if data, err := os.ReadFile(filePath); err == nil {
+		json.Unmarshal(data, &c.items)
+	}
+	return c
+}
+
+// Sha1 获取本地文件的SHA1，文件没有变化时使用缓存
+func (c *LocalHashCache) Sha1(file *LocalFileItem) (string, error) {
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return "", err
+	}
+	key := filepath.Clean(file.Path)
+	c.mutex.Lock()
+	item, ok := c.items[key]
+	c.mutex.Unlock()
+	if ok && item.Size == info.Size() && item.ModTime == info.ModTime().UnixNano() {
+		return item.Sha1, nil
+	}
+
+	sha1 := aliyunpan.DefaultZeroSizeFileContentHash
+	if info.Size() > 0 {
+		localFile := localfile.NewLocalFileEntity(file.Path)
+		if err = localFile.OpenPath(); err != nil {
+			return "", err
+		}
+		err = localFile.Sum(localfile.CHECKSUM_SHA1)
+		localFile.Close()
+		if err != nil {
+			return "", err
+		}
+		sha1 = localFile.SHA1
+	}
+
+	c.mutex.Lock()
+	c.items[key] = &localHashCacheItem{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Sha1: sha1}
+	c.changed = true
+	c.mutex.Unlock()
+	return sha1, nil
+}
+
+// Save 保存缓存文件，缓存没有变化时不写文件
+func (c *LocalHashCache) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.changed {
+		return nil
+	}
+	data, err := json.Marshal(c.items)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(c.filePath, data, 0644); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
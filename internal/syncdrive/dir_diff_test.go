@@ -0,0 +1,79 @@
+package syncdrive
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffDirectory(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "a", "empty"), 0755)
+	os.WriteFile(filepath.Join(dir, "a", "same.txt"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(dir, "a", "size.txt"), []byte("local size"), 0644)
+	os.WriteFile(filepath.Join(dir, "a", "hash.txt"), []byte("1234"), 0644)
+	os.WriteFile(filepath.Join(dir, "local.txt"), []byte("local"), 0644)
+	os.WriteFile(filepath.Join(dir, "dir"), []byte("file"), 0644)
+
+	localFiles, err := ScanLocalDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(localFiles) != 7 {
+		t.Fatalf("unexpected local files: %d", len(localFiles))
+	}
+
+	sum := sha1.Sum([]byte("same"))
+	panFiles := PanFileList{
+		{Path: "/pan/a", FileType: "folder"},
+		{Path: "/pan/a/same.txt", FileType: "file", FileSize: 4, Sha1Hash: hex.EncodeToString(sum[:])},
+		{Path: "/pan/a/size.txt", FileType: "file", FileSize: 3},
+		{Path: "/pan/a/hash.txt", FileType: "file", FileSize: 4, Sha1Hash: "0000000000000000000000000000000000000000"},
+		{Path: "/pan/dir", FileType: "folder"},
+		{Path: "/pan/pan.txt", FileType: "file", FileSize: 3},
+	}
+
+	result, err := DiffDirectory(dir, localFiles, "/pan", panFiles, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.OnlyLocal) != 2 || len(result.OnlyPan) != 1 || len(result.Mismatch) != 2 || result.SameCount != 3 {
+		t.Fatalf("unexpected result: local=%d pan=%d mismatch=%d same=%d",
+			len(result.OnlyLocal), len(result.OnlyPan), len(result.Mismatch), result.SameCount)
+	}
+	if result.Mismatch[0].RelativePath != "a/size.txt" || result.Mismatch[0].Reason != DiffReasonSize ||
+		result.Mismatch[1].RelativePath != "dir" || result.Mismatch[1].Reason != DiffReasonType {
+		t.Errorf("unexpected mismatch: %+v %+v", result.Mismatch[0], result.Mismatch[1])
+	}
+	if result.OnlyPan[0].Path != "/pan/pan.txt" {
+		t.Errorf("unexpected only pan: %s", result.OnlyPan[0].Path)
+	}
+
+	// 对比SHA1，第二次使用缓存
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	cache := NewLocalHashCache(cacheFile)
+	result, err = DiffDirectory(dir, localFiles, "/pan", panFiles, cache.Sha1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Mismatch) != 3 || result.Mismatch[0].RelativePath != "a/hash.txt" || result.Mismatch[0].Reason != DiffReasonSha1 {
+		t.Fatalf("unexpected mismatch: %+v", result.Mismatch[0])
+	}
+	if err = cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	cache = NewLocalHashCache(cacheFile)
+	if len(cache.items) != 2 {
+		t.Errorf("unexpected cache items: %d", len(cache.items))
+	}
+	calls := 0
+	cached := func(file *LocalFileItem) (string, error) {
+		calls++
+		return cache.Sha1(file)
+	}
+	if _, err = DiffDirectory(dir, localFiles, "/pan", panFiles, cached); err != nil || cache.changed {
+		t.Errorf("sha1 should be loaded from cache, calls: %d, err: %v", calls, err)
+	}
+}
@@ -37,15 +37,18 @@ type (
 
 		panClient *config.PanClient
 
-		syncItem        *SyncFileItem
-		maxDownloadRate int64 // 限制最大下载速度
-		maxUploadRate   int64 // 限制最大上传速度
+		syncItem *SyncFileItem
+		// 限速控制器
+		rateController *syncRateController
 
 		localFolderCreateMutex *sync.Mutex
 		panFolderCreateMutex   *sync.Mutex
 
 		// 文件记录器，存储同步文件记录
 		fileRecorder *log.FileRecorder
+
+		// 历史版本保留策略
+		versionPolicy *SyncVersionPolicy
 	}
 )
 
@@ -227,10 +230,9 @@ func (f *FileActionTask) downloadFile(ctx context.Context) error {
 	status.AddDownloaded(f.syncItem.DownloadRange.Begin)
 	status.SetTotalSize(f.syncItem.PanFile.FileSize)
 	// 限速
-	if f.maxDownloadRate > 0 {
-		rl := speeds.NewRateLimit(f.maxDownloadRate)
-		defer rl.Stop()
-		status.SetRateLimit(rl)
+	if rl := f.rateController.newRateLimit(true, status.SetRateLimit); rl != nil {
+		defer f.rateController.releaseRateLimit(rl)
+		status.SetRateLimit(rl.RateLimit())
 	}
 	worker.SetDownloadStatus(status)
 	completed := make(chan struct{}, 0)
@@ -464,14 +466,24 @@ func (f *FileActionTask) uploadFile(ctx context.Context) error {
 		}
 		if efi != nil && efi.FileId != "" {
 			panFileId = efi.FileId
+			panFileSha1Str = efi.ContentHash
 		}
 		if panFileId != "" {
-			if strings.ToUpper(panFileSha1Str) == strings.ToUpper(sha1Str) {
+			// 使用云盘文件的SHA1判断内容是否一致，避免内容一致的文件被重复删除上传（开启历史版本时还会产生重复的版本）。
+			// 本地SHA1为空说明 PreHash 不匹配，内容一定不同，不能当作一致跳过上传
+			if sha1Str != "" && strings.ToUpper(panFileSha1Str) == strings.ToUpper(sha1Str) {
 				logger.Verbosef("检测到同名文件，文件内容完全一致，无需重复上传: %s\n", targetPanFilePath)
 				f.syncItem.Status = SyncFileStatusSuccess
 				f.syncItem.StatusUpdateTime = utils.NowTimeStr()
 				f.syncFileDb.Update(f.syncItem)
 				return nil
+			} else if f.versionPolicy != nil {
+				// 保存旧文件为历史版本
+				efi.Path = targetPanFilePath
+				if e := archivePanFileVersion(f.panClient, f.panFolderCreateMutex, f.syncItem.DriveId, f.syncItem.PanFolderPath, efi, f.versionPolicy); e != nil {
+					logger.Verbosef("保存云盘旧文件为历史版本失败: %s\n", targetPanFilePath)
+					return e
+				}
 			} else {
 				// 删除云盘文件
 				dp := &aliyunpan.FileBatchActionParam{
@@ -540,7 +552,7 @@ func (f *FileActionTask) uploadFile(ctx context.Context) error {
 		// 检测链接是否过期
 		// check url expired or not
 		uploadUrl := f.syncItem.UploadEntity.PartInfoList[f.syncItem.UploadPartSeq].UploadURL
-		if panupload.IsUrlExpired(uploadUrl) {
+		if panupload.IsUrlExpiredWithin(uploadUrl, panupload.UploadUrlRefreshAhead) {
 			// get renew upload url
 			logger.Verbosef("链接过期，获取新的上传链接: %s\n", targetPanFilePath)
 			infoList := make([]aliyunpan.FileUploadPartInfoParam, 0)
@@ -578,10 +590,8 @@ func (f *FileActionTask) uploadFile(ctx context.Context) error {
 	}
 
 	// 限速配置
-	var rateLimit *speeds.RateLimit
-	if f.maxUploadRate > 0 {
-		rateLimit = speeds.NewRateLimit(f.maxUploadRate)
-	}
+	rateLimit := f.rateController.newRateLimit(false, nil)
+	defer f.rateController.releaseRateLimit(rateLimit)
 	// 速度指示器
 	speedsStat := &speeds.Speeds{}
 	// 进度指示器
@@ -636,7 +646,7 @@ func (f *FileActionTask) uploadFile(ctx context.Context) error {
 			if f.syncItem.UploadRange.End > f.syncItem.LocalFile.FileSize {
 				f.syncItem.UploadRange.End = f.syncItem.LocalFile.FileSize
 			}
-			fileReader := uploader.NewBufioSplitUnit(rio.NewFileReaderAtLen64(localFile.GetFile()), *f.syncItem.UploadRange, speedsStat, rateLimit, nil)
+			fileReader := uploader.NewBufioSplitUnit(rio.NewFileReaderAtLen64(localFile.GetFile()), *f.syncItem.UploadRange, speedsStat, rateLimit.RateLimit(), nil)
 
 			if uploadDone, terr := worker.UploadFile(ctx, f.syncItem.UploadPartSeq, f.syncItem.UploadRange.Begin, f.syncItem.UploadRange.End, fileReader, uploadClient); terr == nil {
 				if uploadDone {
@@ -467,11 +467,11 @@ func (f *FileActionTaskManager) getFromSyncDb(act SyncFileAction) *FileActionTas
 						syncFileDb:             f.task.syncFileDb,
 						panClient:              f.task.panClient,
 						syncItem:               file,
-						maxDownloadRate:        f.syncOption.MaxDownloadRate,
-						maxUploadRate:          f.syncOption.MaxUploadRate,
+						rateController:         f.task.rateController,
 						localFolderCreateMutex: f.localCreateMutex,
 						panFolderCreateMutex:   f.panCreateMutex,
 						fileRecorder:           f.syncOption.FileRecorder,
+						versionPolicy:          f.task.VersionPolicy,
 					}
 				}
 			}
@@ -487,11 +487,11 @@ func (f *FileActionTaskManager) getFromSyncDb(act SyncFileAction) *FileActionTas
 						syncFileDb:             f.task.syncFileDb,
 						panClient:              f.task.panClient,
 						syncItem:               file,
-						maxDownloadRate:        f.syncOption.MaxDownloadRate,
-						maxUploadRate:          f.syncOption.MaxUploadRate,
+						rateController:         f.task.rateController,
 						localFolderCreateMutex: f.localCreateMutex,
 						panFolderCreateMutex:   f.panCreateMutex,
 						fileRecorder:           f.syncOption.FileRecorder,
+						versionPolicy:          f.task.VersionPolicy,
 					}
 				}
 			}
@@ -509,11 +509,11 @@ func (f *FileActionTaskManager) getFromSyncDb(act SyncFileAction) *FileActionTas
 						syncFileDb:             f.task.syncFileDb,
 						panClient:              f.task.panClient,
 						syncItem:               file,
-						maxDownloadRate:        f.syncOption.MaxDownloadRate,
-						maxUploadRate:          f.syncOption.MaxUploadRate,
+						rateController:         f.task.rateController,
 						localFolderCreateMutex: f.localCreateMutex,
 						panFolderCreateMutex:   f.panCreateMutex,
 						fileRecorder:           f.syncOption.FileRecorder,
+						versionPolicy:          f.task.VersionPolicy,
 					}
 				}
 			}
@@ -544,7 +544,17 @@ func (f *FileActionTaskManager) fileActionTaskExecutor(ctx context.Context) {
 			uploadWaitGroup.Wait()
 			return
 		default:
+			// 不在同步时间窗口内，不再开始新的文件，正在传输的文件会继续完成。
+			// 同步数据库中还有未执行的文件，不能结束执行进程，等待下一个时间窗口
+			if now := time.Now(); !f.task.scheduler.IsActive(now) {
+				select {
+				case <-ctx.Done():
+				case <-time.After(f.task.scheduler.NextActive(now).Sub(now)):
+				}
+				continue
+			}
 			actionIsEmptyOfThisTerm := true
+
 			// do upload
 			uploadItem := f.getFromSyncDb(SyncFileActionUpload)
 			if uploadItem != nil {
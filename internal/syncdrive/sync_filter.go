@@ -0,0 +1,385 @@
+package syncdrive
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// IgnoreFileName 同步目录中的忽略规则文件名，语法和 .gitignore 一致
+	IgnoreFileName string = ".aliyunpanignore"
+)
+
+type (
+	// SyncFilterRule 同步任务的文件过滤规则
+	SyncFilterRule struct {
+		// Include 包含规则，gitignore语法。不为空时只同步匹配的文件，文件夹不受影响
+		Include []string `json:"include,omitempty"`
+		// Exclude 排除规则，gitignore语法，支持 ! 取反
+		Exclude []string `json:"exclude,omitempty"`
+		// MinSize 文件最小大小，例如：1KB，小于该值的文件不同步
+		MinSize string `json:"minSize,omitempty"`
+		// MaxSize 文件最大大小，例如：4GB，大于该值的文件不同步
+		MaxSize string `json:"maxSize,omitempty"`
+		// MaxAge 文件最大修改时长，例如：30d，12h，修改时间早于该时长的文件不同步
+		MaxAge string `json:"maxAge,omitempty"`
+		// SkipHidden 是否跳过隐藏文件和系统文件
+		SkipHidden bool `json:"skipHidden,omitempty"`
+	}
+
+	// ignorePattern 一条gitignore规则
+	ignorePattern struct {
+		raw     string
+		re      *regexp.Regexp
+		negate  bool
+		dirOnly bool
+		// base 规则所在的目录，相对同步根目录
+		base string
+	}
+
+	// syncFilter 同步过滤器，由 SyncFilterRule 编译而来
+	syncFilter struct {
+		localRootPath string
+		include       []*ignorePattern
+		exclude       []*ignorePattern
+		minSize       int64
+		maxSize       int64
+		maxAge        time.Duration
+		skipHidden    bool
+
+		// ignoreFileCache .aliyunpanignore 文件规则缓存，key为相对同步根目录的目录路径
+		ignoreFileCache map[string][]*ignorePattern
+		mutex           *sync.Mutex
+	}
+
+	// filterFileInfo 过滤器需要的文件信息
+	filterFileInfo struct {
+		// RelativePath 相对同步根目录的路径，使用 / 分隔
+		RelativePath string
+		FileName     string
+		FileSize     int64
+		IsFolder     bool
+		UpdatedAt    time.Time
+		// LocalPath 本地文件完整路径，非本地文件为空
+		LocalPath string
+	}
+)
+
+// IsEmpty 是否未配置任何规则
+func (r *SyncFilterRule) IsEmpty() bool {
+	return r == nil || (len(r.Include) == 0 && len(r.Exclude) == 0 && r.MinSize == "" && r.MaxSize == "" &&
+		r.MaxAge == "" && !r.SkipHidden)
+}
+
+// String 规则描述
+func (r *SyncFilterRule) String() string {
+	if r == nil {
+		return ""
+	}
+	items := []string{}
+	if len(r.Include) > 0 {
+		items = append(items, "包含: "+strings.Join(r.Include, ","))
+	}
+	if len(r.Exclude) > 0 {
+		items = append(items, "排除: "+strings.Join(r.Exclude, ","))
+	}
+	if r.MinSize != "" {
+		items = append(items, "最小: "+r.MinSize)
+	}
+	if r.MaxSize != "" {
+		items = append(items, "最大: "+r.MaxSize)
+	}
+	if r.MaxAge != "" {
+		items = append(items, "最近修改: "+r.MaxAge)
+	}
+	if r.SkipHidden {
+		items = append(items, "跳过隐藏文件")
+	}
+	return strings.Join(items, "; ")
+}
+
+// newSyncFilter 编译过滤规则
+func newSyncFilter(rule *SyncFilterRule, localRootPath string) (*syncFilter, error) {
+	f := &syncFilter{
+		localRootPath:   strings.ReplaceAll(localRootPath, "\\", "/"),
+		ignoreFileCache: map[string][]*ignorePattern{},
+		mutex:           &sync.Mutex{},
+	}
+	if rule == nil {
+		return f, nil
+	}
+	f.include = parseIgnorePatterns(rule.Include, "")
+	f.exclude = parseIgnorePatterns(rule.Exclude, "")
+	if rule.MinSize != "" {
+		s, e := converter.ParseFileSizeStr(rule.MinSize)
+		if e != nil {
+			return nil, fmt.Errorf("minSize格式错误: %s", rule.MinSize)
+		}
+		f.minSize = s
+	}
+	if rule.MaxSize != "" {
+		s, e := converter.ParseFileSizeStr(rule.MaxSize)
+		if e != nil {
+			return nil, fmt.Errorf("maxSize格式错误: %s", rule.MaxSize)
+		}
+		f.maxSize = s
+	}
+	if rule.MaxAge != "" {
+		d, e := parseAgeStr(rule.MaxAge)
+		if e != nil {
+			return nil, fmt.Errorf("maxAge格式错误: %s", rule.MaxAge)
+		}
+		f.maxAge = d
+	}
+	f.skipHidden = rule.SkipHidden
+	return f, nil
+}
+
+// parseAgeStr 解析时长，除了 time.ParseDuration 支持的格式外，还支持 d(天)、w(周) 单位
+func parseAgeStr(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	unit := s[len(s)-1]
+	if unit == 'd' || unit == 'w' {
+		n, e := strconv.Atoi(s[:len(s)-1])
+		if e != nil {
+			return 0, e
+		}
+		d := time.Duration(n) * 24 * time.Hour
+		if unit == 'w' {
+			d *= 7
+		}
+		return d, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// parseIgnorePatterns 解析gitignore规则列表
+func parseIgnorePatterns(lines []string, base string) []*ignorePattern {
+	patterns := []*ignorePattern{}
+	for _, line := range lines {
+		if p := newIgnorePattern(line, base); p != nil {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// newIgnorePattern 解析一条gitignore规则，空行和注释返回nil
+func newIgnorePattern(line, base string) *ignorePattern {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	line = strings.TrimSpace(line)
+	p := &ignorePattern{
+		raw:  line,
+		base: base,
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+
+	// 规则中间或开头包含 / 的，相对规则所在目录匹配；否则匹配任意层级的文件名
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	expr := globToRegexp(line)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(.*/)?" + expr + "$"
+	}
+	re, e := regexp.Compile(expr)
+	if e != nil {
+		logger.Verboseln("invalid ignore pattern: ", p.raw, e)
+		return nil
+	}
+	p.re = re
+	return p
+}
+
+// globToRegexp 将gitignore通配符转换为正则表达式
+func globToRegexp(glob string) string {
+	sb := &strings.Builder{}
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				// ** 匹配任意层级
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					sb.WriteString("(.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// match 规则是否匹配该路径，relativePath 为相对同步根目录的路径
+func (p *ignorePattern) match(relativePath string, isFolder bool) bool {
+	if p.dirOnly && !isFolder {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(relativePath, p.base+"/") {
+			return false
+		}
+		relativePath = strings.TrimPrefix(relativePath, p.base+"/")
+	}
+	return p.re.MatchString(relativePath)
+}
+
+// matchIgnorePatterns 按顺序匹配规则，最后一条匹配的规则生效。返回是否被排除
+func matchIgnorePatterns(patterns []*ignorePattern, relativePath string, isFolder bool) (matched, excluded bool) {
+	for _, p := range patterns {
+		if p.match(relativePath, isFolder) {
+			matched = true
+			excluded = !p.negate
+		}
+	}
+	return
+}
+
+// ResetIgnoreFileCache 清空 .aliyunpanignore 规则缓存，每一轮扫描开始时调用，以便规则文件的修改能生效
+func (f *syncFilter) ResetIgnoreFileCache() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.ignoreFileCache = map[string][]*ignorePattern{}
+}
+
+// loadIgnoreFile 读取本地目录下的 .aliyunpanignore 规则文件
+func (f *syncFilter) loadIgnoreFile(relativeDir string) []*ignorePattern {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if patterns, ok := f.ignoreFileCache[relativeDir]; ok {
+		return patterns
+	}
+	patterns := []*ignorePattern{}
+	file, e := os.Open(path.Join(f.localRootPath, relativeDir, IgnoreFileName))
+	if e == nil {
+		lines := []string{}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		file.Close()
+		patterns = parseIgnorePatterns(lines, relativeDir)
+		logger.Verbosef("load ignore file %s, %d rules\n", path.Join(relativeDir, IgnoreFileName), len(patterns))
+	}
+	f.ignoreFileCache[relativeDir] = patterns
+	return patterns
+}
+
+// isExcludedByPattern 按照 exclude 规则以及各级目录下的 .aliyunpanignore 规则判断是否排除，越深层级的规则优先级越高
+func (f *syncFilter) isExcludedByPattern(relativePath string, isFolder bool) bool {
+	excluded := false
+	if m, e := matchIgnorePatterns(f.exclude, relativePath, isFolder); m {
+		excluded = e
+	}
+
+	dir := ""
+	parts := strings.Split(relativePath, "/")
+	for i := 0; i < len(parts); i++ {
+		if i > 0 {
+			dir = path.Join(dir, parts[i-1])
+		}
+		if m, e := matchIgnorePatterns(f.loadIgnoreFile(dir), relativePath, isFolder); m {
+			excluded = e
+		}
+	}
+	return excluded
+}
+
+// Skip 是否跳过该文件，返回跳过的原因
+func (f *syncFilter) Skip(fi *filterFileInfo) (bool, string) {
+	if f == nil || fi == nil {
+		return false, ""
+	}
+	relativePath := strings.Trim(strings.ReplaceAll(fi.RelativePath, "\\", "/"), "/")
+	if relativePath == "" || relativePath == "." {
+		return false, ""
+	}
+
+	if f.skipHidden {
+		if strings.HasPrefix(fi.FileName, ".") {
+			return true, "隐藏文件"
+		}
+		if fi.LocalPath != "" && isHiddenOrSystemFile(fi.LocalPath) {
+			return true, "隐藏文件或系统文件"
+		}
+	}
+
+	if f.isExcludedByPattern(relativePath, fi.IsFolder) {
+		return true, "匹配排除规则"
+	}
+
+	// 以下规则只对文件生效
+	if fi.IsFolder {
+		return false, ""
+	}
+	if len(f.include) > 0 {
+		if _, included := matchIgnorePatterns(f.include, relativePath, false); !included {
+			return true, "不匹配包含规则"
+		}
+	}
+	if f.minSize > 0 && fi.FileSize < f.minSize {
+		return true, "文件小于最小限制"
+	}
+	if f.maxSize > 0 && fi.FileSize > f.maxSize {
+		return true, "文件大于最大限制"
+	}
+	if f.maxAge > 0 && !fi.UpdatedAt.IsZero() && time.Since(fi.UpdatedAt) > f.maxAge {
+		return true, "文件修改时间超过限制"
+	}
+	return false, ""
+}
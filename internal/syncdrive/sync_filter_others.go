@@ -0,0 +1,8 @@
+//go:build !windows
+
+package syncdrive
+
+// isHiddenOrSystemFile 非Windows系统以 . 开头的文件即为隐藏文件，已经在文件名中判断
+func isHiddenOrSystemFile(localPath string) bool {
+	return false
+}
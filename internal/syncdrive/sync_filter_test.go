@@ -0,0 +1,104 @@
+package syncdrive
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSyncFilterPattern(t *testing.T) {
+	filter, e := newSyncFilter(&SyncFilterRule{
+		Exclude: []string{"*.tmp", "node_modules/", "/build", "docs/**/draft*", "!keep.tmp"},
+	}, "/not/existed/root")
+	if e != nil {
+		t.Fatal(e)
+	}
+	cases := []struct {
+		path     string
+		isFolder bool
+		skip     bool
+	}{
+		{"a.tmp", false, true},
+		{"sub/dir/b.tmp", false, true},
+		{"sub/keep.tmp", false, false},
+		{"web/node_modules", true, true},
+		{"web/node_modules", false, false},
+		{"build", true, true},
+		{"src/build", true, false},
+		{"docs/draft1.md", false, true},
+		{"docs/a/b/draft2.md", false, true},
+		{"docs/a/final.md", false, false},
+	}
+	for _, c := range cases {
+		skip, _ := filter.Skip(&filterFileInfo{RelativePath: c.path, FileName: path.Base(c.path), IsFolder: c.isFolder})
+		if skip != c.skip {
+			t.Errorf("%s: expect skip=%v, got %v", c.path, c.skip, skip)
+		}
+	}
+}
+
+func TestSyncFilterSizeAndAge(t *testing.T) {
+	filter, e := newSyncFilter(&SyncFilterRule{
+		Include:    []string{"*.jpg", "*.png"},
+		MinSize:    "1KB",
+		MaxSize:    "1MB",
+		MaxAge:     "7d",
+		SkipHidden: true,
+	}, "/not/existed/root")
+	if e != nil {
+		t.Fatal(e)
+	}
+	now := time.Now()
+	cases := []struct {
+		fi   *filterFileInfo
+		skip bool
+	}{
+		{&filterFileInfo{RelativePath: "a/1.jpg", FileName: "1.jpg", FileSize: 2048, UpdatedAt: now}, false},
+		{&filterFileInfo{RelativePath: "a/1.txt", FileName: "1.txt", FileSize: 2048, UpdatedAt: now}, true},
+		{&filterFileInfo{RelativePath: "a/2.png", FileName: "2.png", FileSize: 100, UpdatedAt: now}, true},
+		{&filterFileInfo{RelativePath: "a/3.png", FileName: "3.png", FileSize: 2 * 1024 * 1024, UpdatedAt: now}, true},
+		{&filterFileInfo{RelativePath: "a/4.png", FileName: "4.png", FileSize: 2048, UpdatedAt: now.Add(-8 * 24 * time.Hour)}, true},
+		{&filterFileInfo{RelativePath: "a/.5.png", FileName: ".5.png", FileSize: 2048, UpdatedAt: now}, true},
+		{&filterFileInfo{RelativePath: "a", FileName: "a", IsFolder: true}, false},
+	}
+	for _, c := range cases {
+		if skip, _ := filter.Skip(c.fi); skip != c.skip {
+			t.Errorf("%s: expect skip=%v, got %v", c.fi.RelativePath, c.skip, skip)
+		}
+	}
+
+	if _, e := newSyncFilter(&SyncFilterRule{MaxAge: "abc"}, "/"); e == nil {
+		t.Errorf("expect maxAge parse error")
+	}
+}
+
+func TestSyncFilterIgnoreFile(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(path.Join(root, "sub"), 0755)
+	os.WriteFile(path.Join(root, IgnoreFileName), []byte("# comment\n*.log\n"), 0644)
+	os.WriteFile(path.Join(root, "sub", IgnoreFileName), []byte("!important.log\ncache/\n"), 0644)
+
+	filter, e := newSyncFilter(nil, root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	cases := []struct {
+		path     string
+		isFolder bool
+		skip     bool
+	}{
+		{"a.log", false, true},
+		{"sub/b.log", false, true},
+		{"sub/important.log", false, false},
+		{"important.log", false, true},
+		{"sub/cache", true, true},
+		{"cache", true, false},
+	}
+	for _, c := range cases {
+		skip, _ := filter.Skip(&filterFileInfo{RelativePath: c.path, FileName: path.Base(c.path), IsFolder: c.isFolder})
+		if skip != c.skip {
+			t.Errorf("%s: expect skip=%v, got %v", c.path, c.skip, skip)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package syncdrive
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// isHiddenOrSystemFile 文件是否带有隐藏或者系统属性
+func isHiddenOrSystemFile(localPath string) bool {
+	p, e := windows.UTF16PtrFromString(localPath)
+	if e != nil {
+		return false
+	}
+	attrs, e := windows.GetFileAttributes(p)
+	if e != nil {
+		return false
+	}
+	return attrs&(windows.FILE_ATTRIBUTE_HIDDEN|windows.FILE_ATTRIBUTE_SYSTEM) != 0
+}
@@ -0,0 +1,397 @@
+package syncdrive
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/requester/rio/speeds"
+)
+
+type (
+	// SyncSchedule 同步计划，包括同步时间窗口和分时段限速
+	SyncSchedule struct {
+		// Windows 允许同步的时间窗口，为空则全天同步。格式：[星期] HH:MM-HH:MM，例如：01:00-06:00, Mon-Fri 22:00-07:00, Sat,Sun 00:00-24:00
+		Windows []string `json:"windows,omitempty"`
+		// Bandwidth 分时段限速，按顺序匹配第一个符合的时间段，都不符合则使用全局限速配置
+		Bandwidth []*SyncBandwidthProfile `json:"bandwidth,omitempty"`
+	}
+
+	// SyncBandwidthProfile 时间段限速配置
+	SyncBandwidthProfile struct {
+		// Window 时间段，格式和同步时间窗口一致
+		Window string `json:"window"`
+		// MaxDownloadRate 最大下载速度，例如：1MB，0代表不限速
+		MaxDownloadRate string `json:"maxDownloadRate,omitempty"`
+		// MaxUploadRate 最大上传速度，例如：1MB，0代表不限速
+		MaxUploadRate string `json:"maxUploadRate,omitempty"`
+	}
+
+	// timeWindow 时间窗口
+	timeWindow struct {
+		// days 生效的星期，下标为 time.Weekday
+		days [7]bool
+		// start 开始时间，当天的分钟数
+		start int
+		// end 结束时间，当天的分钟数，小于开始时间代表跨越午夜
+		end int
+	}
+
+	bandwidthProfile struct {
+		window          *timeWindow
+		maxDownloadRate int64
+		maxUploadRate   int64
+	}
+
+	// syncScheduler 编译后的同步计划
+	syncScheduler struct {
+		windows   []*timeWindow
+		bandwidth []*bandwidthProfile
+	}
+
+	// syncRateController 限速控制器，按照分时段限速配置动态调整正在传输的文件的速度
+	syncRateController struct {
+		mutex           *sync.Mutex
+		scheduler       *syncScheduler
+		maxDownloadRate int64 // 全局下载限速
+		maxUploadRate   int64 // 全局上传限速
+
+		limits map[*syncRateLimit]struct{}
+	}
+
+	// syncRateLimit 单个文件传输使用的限速器。
+	// 限速时段切换时替换为新的 RateLimit，而不是修改正在使用的 RateLimit 的 MaxRate：
+	// RateLimit 的后台协程会并发读取 MaxRate，并且按照整个生命周期统计平均速度，降低限速后传输会停顿很长时间
+	syncRateLimit struct {
+		mutex      *sync.Mutex
+		isDownload bool
+		rate       int64
+		current    *speeds.RateLimit
+		// retired 已经被替换的限速器，可能仍有协程阻塞在上面，释放时才停止
+		retired []*speeds.RateLimit
+		// onChange 替换限速器时的回调
+		onChange func(rl *speeds.RateLimit)
+	}
+)
+
+// unlimitedRate 不限速。RateLimit 不支持 0 代表不限速，使用最大值代替
+const unlimitedRate int64 = math.MaxInt64
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	"0": time.Sunday, "1": time.Monday, "2": time.Tuesday, "3": time.Wednesday,
+	"4": time.Thursday, "5": time.Friday, "6": time.Saturday, "7": time.Sunday,
+}
+
+// IsEmpty 是否未配置任何计划
+func (s *SyncSchedule) IsEmpty() bool {
+	return s == nil || (len(s.Windows) == 0 && len(s.Bandwidth) == 0)
+}
+
+// String 计划描述
+func (s *SyncSchedule) String() string {
+	if s.IsEmpty() {
+		return ""
+	}
+	items := []string{}
+	if len(s.Windows) > 0 {
+		items = append(items, "时间窗口: "+strings.Join(s.Windows, "; "))
+	}
+	for _, b := range s.Bandwidth {
+		rate := []string{}
+		if b.MaxDownloadRate != "" {
+			rate = append(rate, "↓"+b.MaxDownloadRate)
+		}
+		if b.MaxUploadRate != "" {
+			rate = append(rate, "↑"+b.MaxUploadRate)
+		}
+		items = append(items, fmt.Sprintf("限速 %s: %s", b.Window, strings.Join(rate, " ")))
+	}
+	return strings.Join(items, ", ")
+}
+
+// parseClock 解析 HH:MM 格式的时间，返回当天的分钟数
+func parseClock(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("时间格式错误: %s", s)
+	}
+	h, e1 := strconv.Atoi(parts[0])
+	m, e2 := strconv.Atoi(parts[1])
+	if e1 != nil || e2 != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("时间格式错误: %s", s)
+	}
+	return h*60 + m, nil
+}
+
+// parseWeekdays 解析星期，支持 Mon-Fri, Sat,Sun, 1-5 等格式
+func parseWeekdays(s string) ([7]bool, error) {
+	days := [7]bool{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		rangeParts := strings.Split(item, "-")
+		if len(rangeParts) > 2 {
+			return days, fmt.Errorf("星期格式错误: %s", item)
+		}
+		begin, ok := weekdayNames[rangeParts[0]]
+		if !ok {
+			return days, fmt.Errorf("星期格式错误: %s", item)
+		}
+		end := begin
+		if len(rangeParts) == 2 {
+			if end, ok = weekdayNames[rangeParts[1]]; !ok {
+				return days, fmt.Errorf("星期格式错误: %s", item)
+			}
+		}
+		for d := begin; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseTimeWindow 解析时间窗口，格式：[星期] HH:MM-HH:MM
+func parseTimeWindow(s string) (*timeWindow, error) {
+	fields := strings.Fields(s)
+	w := &timeWindow{}
+	clock := ""
+	switch len(fields) {
+	case 1:
+		w.days = [7]bool{true, true, true, true, true, true, true}
+		clock = fields[0]
+	case 2:
+		days, e := parseWeekdays(fields[0])
+		if e != nil {
+			return nil, e
+		}
+		w.days = days
+		clock = fields[1]
+	default:
+		return nil, fmt.Errorf("时间窗口格式错误: %s", s)
+	}
+	parts := strings.Split(clock, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("时间窗口格式错误: %s", s)
+	}
+	var e error
+	if w.start, e = parseClock(parts[0]); e != nil {
+		return nil, e
+	}
+	if w.end, e = parseClock(parts[1]); e != nil {
+		return nil, e
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("时间窗口开始和结束时间不能相同: %s", s)
+	}
+	return w, nil
+}
+
+// contains 时间是否在窗口内。跨越午夜的窗口，星期以开始时间为准
+func (w *timeWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	weekday := t.Weekday()
+	if w.start < w.end {
+		return w.days[weekday] && minute >= w.start && minute < w.end
+	}
+	yesterday := (weekday + 6) % 7
+	return (w.days[weekday] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
+
+// parseRate 解析速度，为空或者0代表不限速
+func parseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	rate, e := converter.ParseFileSizeStr(s)
+	if e != nil {
+		return 0, fmt.Errorf("速度格式错误: %s", s)
+	}
+	return rate, nil
+}
+
+// newSyncScheduler 编译同步计划，未配置则返回nil
+func newSyncScheduler(schedule *SyncSchedule) (*syncScheduler, error) {
+	if schedule.IsEmpty() {
+		return nil, nil
+	}
+	s := &syncScheduler{}
+	for _, item := range schedule.Windows {
+		w, e := parseTimeWindow(item)
+		if e != nil {
+			return nil, e
+		}
+		s.windows = append(s.windows, w)
+	}
+	for _, item := range schedule.Bandwidth {
+		if item == nil {
+			continue
+		}
+		w, e := parseTimeWindow(item.Window)
+		if e != nil {
+			return nil, e
+		}
+		b := &bandwidthProfile{window: w}
+		if b.maxDownloadRate, e = parseRate(item.MaxDownloadRate); e != nil {
+			return nil, e
+		}
+		if b.maxUploadRate, e = parseRate(item.MaxUploadRate); e != nil {
+			return nil, e
+		}
+		s.bandwidth = append(s.bandwidth, b)
+	}
+	return s, nil
+}
+
+// IsActive 当前时间是否允许同步
+func (s *syncScheduler) IsActive(now time.Time) bool {
+	if s == nil || len(s.windows) == 0 {
+		return true
+	}
+	for _, w := range s.windows {
+		if w.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextActive 下一个允许同步的时间，当前已经允许同步则返回 now
+func (s *syncScheduler) NextActive(now time.Time) time.Time {
+	if s.IsActive(now) {
+		return now
+	}
+	// 时间窗口精确到分钟，最多查找一周
+	t := now.Truncate(time.Minute)
+	for i := 0; i <= 7*24*60; i++ {
+		t = t.Add(time.Minute)
+		if s.IsActive(t) {
+			return t
+		}
+	}
+	return now.Add(time.Minute)
+}
+
+// hasBandwidthProfile 是否配置了分时段限速
+func (s *syncScheduler) hasBandwidthProfile() bool {
+	return s != nil && len(s.bandwidth) > 0
+}
+
+// Rates 获取当前时间的限速，0代表不限速
+func (s *syncScheduler) Rates(now time.Time, defaultDownloadRate, defaultUploadRate int64) (int64, int64) {
+	if s != nil {
+		for _, b := range s.bandwidth {
+			if b.window.contains(now) {
+				return b.maxDownloadRate, b.maxUploadRate
+			}
+		}
+	}
+	return defaultDownloadRate, defaultUploadRate
+}
+
+func newSyncRateController(scheduler *syncScheduler, maxDownloadRate, maxUploadRate int64) *syncRateController {
+	return &syncRateController{
+		mutex:           &sync.Mutex{},
+		scheduler:       scheduler,
+		maxDownloadRate: maxDownloadRate,
+		maxUploadRate:   maxUploadRate,
+		limits:          map[*syncRateLimit]struct{}{},
+	}
+}
+
+func toRateLimitValue(rate int64) int64 {
+	if rate <= 0 {
+		return unlimitedRate
+	}
+	return rate
+}
+
+// rateOf 获取指定时间的限速值
+func (c *syncRateController) rateOf(now time.Time, isDownload bool) int64 {
+	downloadRate, uploadRate := c.scheduler.Rates(now, c.maxDownloadRate, c.maxUploadRate)
+	if isDownload {
+		return toRateLimitValue(downloadRate)
+	}
+	return toRateLimitValue(uploadRate)
+}
+
+// newRateLimit 创建文件传输使用的限速器，不需要限速则返回nil。使用完成后需要调用 releaseRateLimit 释放。
+// onChange 在限速时段切换、限速器被替换时调用，可以为nil
+func (c *syncRateController) newRateLimit(isDownload bool, onChange func(rl *speeds.RateLimit)) *syncRateLimit {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	rate := c.rateOf(time.Now(), isDownload)
+	if rate == unlimitedRate && !c.scheduler.hasBandwidthProfile() {
+		// 始终不限速
+		return nil
+	}
+	l := &syncRateLimit{
+		mutex:      c.mutex,
+		isDownload: isDownload,
+		rate:       rate,
+		current:    speeds.NewRateLimit(rate),
+		onChange:   onChange,
+	}
+	c.limits[l] = struct{}{}
+	return l
+}
+
+// releaseRateLimit 释放限速器
+func (c *syncRateController) releaseRateLimit(l *syncRateLimit) {
+	if c == nil || l == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.limits, l)
+	l.current.Stop()
+	for _, rl := range l.retired {
+		rl.Stop()
+	}
+	l.retired = nil
+}
+
+// apply 按照当前时间调整所有正在使用的限速器，限速值改变时替换为新的限速器
+func (c *syncRateController) apply(now time.Time) {
+	if c == nil || !c.scheduler.hasBandwidthProfile() {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for l := range c.limits {
+		rate := c.rateOf(now, l.isDownload)
+		if rate == l.rate {
+			continue
+		}
+		l.retired = append(l.retired, l.current)
+		l.rate = rate
+		l.current = speeds.NewRateLimit(rate)
+		if l.onChange != nil {
+			l.onChange(l.current)
+		}
+	}
+}
+
+// RateLimit 获取当前使用的限速器
+func (l *syncRateLimit) RateLimit() *speeds.RateLimit {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.current
+}
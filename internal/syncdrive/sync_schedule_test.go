@@ -0,0 +1,174 @@
+package syncdrive
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/waitgroup"
+	"github.com/tickstep/library-go/requester/rio/speeds"
+)
+
+func TestSyncScheduleWindow(t *testing.T) {
+	s, e := newSyncScheduler(&SyncSchedule{Windows: []string{"01:00-06:00", "Sat,Sun 22:00-24:00", "Fri 23:00-02:00"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 2026-10-16 是周五
+	cases := []struct {
+		t      time.Time
+		active bool
+	}{
+		{time.Date(2026, 10, 14, 1, 0, 0, 0, time.Local), true},
+		{time.Date(2026, 10, 14, 6, 0, 0, 0, time.Local), false},
+		{time.Date(2026, 10, 14, 23, 30, 0, 0, time.Local), false},
+		{time.Date(2026, 10, 16, 23, 30, 0, 0, time.Local), true},
+		{time.Date(2026, 10, 17, 0, 30, 0, 0, time.Local), true},
+		{time.Date(2026, 10, 17, 22, 30, 0, 0, time.Local), true},
+		{time.Date(2026, 10, 18, 0, 30, 0, 0, time.Local), false},
+	}
+	for _, c := range cases {
+		if s.IsActive(c.t) != c.active {
+			t.Errorf("%s: expected active=%v", c.t, c.active)
+		}
+	}
+
+	var empty *syncScheduler
+	if !empty.IsActive(time.Now()) {
+		t.Error("empty schedule should always be active")
+	}
+
+	for _, w := range []string{"25:00-06:00", "01:00", "Xyz 01:00-02:00", "01:00-01:00", "Mon 1:00-2:00 x"} {
+		if _, e := newSyncScheduler(&SyncSchedule{Windows: []string{w}}); e == nil {
+			t.Errorf("invalid window should be detected: %s", w)
+		}
+	}
+}
+
+func TestSyncScheduleNextActive(t *testing.T) {
+	s, e := newSyncScheduler(&SyncSchedule{Windows: []string{"01:00-06:00", "Sat 22:00-24:00"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 2026-10-16 是周五
+	cases := []struct {
+		now, next time.Time
+	}{
+		{time.Date(2026, 10, 16, 2, 0, 0, 0, time.Local), time.Date(2026, 10, 16, 2, 0, 0, 0, time.Local)},
+		{time.Date(2026, 10, 16, 12, 0, 30, 0, time.Local), time.Date(2026, 10, 17, 1, 0, 0, 0, time.Local)},
+		{time.Date(2026, 10, 17, 6, 0, 0, 0, time.Local), time.Date(2026, 10, 17, 22, 0, 0, 0, time.Local)},
+	}
+	for _, c := range cases {
+		if next := s.NextActive(c.now); !next.Equal(c.next) {
+			t.Errorf("%s: expected next active %s, got %s", c.now, c.next, next)
+		}
+	}
+}
+
+// 任务在时间窗口之外启动，扫描结束后也不能报告同步完成
+func TestFileActionExecutorOutOfWindow(t *testing.T) {
+	start := time.Now().Add(2 * time.Hour)
+	window := start.Format("15:04") + "-" + start.Add(time.Hour).Format("15:04")
+	scheduler, e := newSyncScheduler(&SyncSchedule{Windows: []string{window}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	task := &SyncTask{
+		resourceMutex:  &sync.Mutex{},
+		scanLoopIsDone: true,
+		scheduler:      scheduler,
+		syncOption:     SyncOption{FileDownloadParallel: 1, FileUploadParallel: 1},
+	}
+	mgr := NewFileActionTaskManager(task)
+	mgr.wg = waitgroup.NewWaitGroup(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	mgr.setExecuteLoopFlag(false)
+	go mgr.fileActionTaskExecutor(ctx)
+
+	time.Sleep(200 * time.Millisecond)
+	if mgr.IsExecuteLoopIsDone() {
+		t.Errorf("executor should wait for the next window")
+	}
+	cancel()
+	mgr.wg.Wait()
+	if mgr.IsExecuteLoopIsDone() {
+		t.Errorf("canceled executor should not report completion")
+	}
+}
+
+func TestSyncScheduleWeekdays(t *testing.T) {
+	days, e := parseWeekdays("Mon-Fri")
+	if e != nil || days != [7]bool{false, true, true, true, true, true, false} {
+		t.Errorf("unexpected weekdays: %v %v", days, e)
+	}
+	days, e = parseWeekdays("Fri-Mon")
+	if e != nil || days != [7]bool{true, true, false, false, false, true, true} {
+		t.Errorf("unexpected weekdays: %v %v", days, e)
+	}
+	days, e = parseWeekdays("6,7")
+	if e != nil || days != [7]bool{true, false, false, false, false, false, true} {
+		t.Errorf("unexpected weekdays: %v %v", days, e)
+	}
+}
+
+func TestSyncRateController(t *testing.T) {
+	s, e := newSyncScheduler(&SyncSchedule{Bandwidth: []*SyncBandwidthProfile{
+		{Window: "Mon-Fri 09:00-18:00", MaxDownloadRate: "1MB", MaxUploadRate: "512KB"},
+		{Window: "00:00-06:00", MaxDownloadRate: "0"},
+	}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	// 2026-10-14 是周三
+	down, up := s.Rates(time.Date(2026, 10, 14, 10, 0, 0, 0, time.Local), 100, 200)
+	if down != 1024*1024 || up != 512*1024 {
+		t.Errorf("unexpected office hours rate: %d %d", down, up)
+	}
+	down, up = s.Rates(time.Date(2026, 10, 14, 1, 0, 0, 0, time.Local), 100, 200)
+	if down != 0 || up != 0 {
+		t.Errorf("unexpected night rate: %d %d", down, up)
+	}
+	down, up = s.Rates(time.Date(2026, 10, 14, 20, 0, 0, 0, time.Local), 100, 200)
+	if down != 100 || up != 200 {
+		t.Errorf("unexpected default rate: %d %d", down, up)
+	}
+
+	c := newSyncRateController(s, 0, 0)
+	var changed *speeds.RateLimit
+	rl := c.newRateLimit(true, func(r *speeds.RateLimit) { changed = r })
+	if rl == nil {
+		t.Fatal("rate limit should be created when bandwidth profile configured")
+	}
+	c.apply(time.Date(2026, 10, 14, 10, 0, 0, 0, time.Local))
+	first := rl.RateLimit()
+	if first.MaxRate != 1024*1024 {
+		t.Errorf("unexpected max rate: %d", first.MaxRate)
+	}
+	// 同一时段内不替换限速器
+	c.apply(time.Date(2026, 10, 14, 11, 0, 0, 0, time.Local))
+	if rl.RateLimit() != first {
+		t.Error("rate limit should not be replaced in the same window")
+	}
+	// 切换时段后替换为新的限速器，不修改旧的限速器
+	c.apply(time.Date(2026, 10, 14, 20, 0, 0, 0, time.Local))
+	if rl.RateLimit() == first || rl.RateLimit().MaxRate != unlimitedRate || changed != rl.RateLimit() {
+		t.Errorf("unexpected max rate: %d", rl.RateLimit().MaxRate)
+	}
+	if first.MaxRate != 1024*1024 {
+		t.Error("replaced rate limit should not be modified")
+	}
+	c.releaseRateLimit(rl)
+	if len(c.limits) != 0 {
+		t.Error("rate limit should be released")
+	}
+
+	// 未配置分时段限速并且全局不限速，不需要限速器
+	if newSyncRateController(nil, 0, 0).newRateLimit(false, nil) != nil {
+		t.Error("rate limit should not be created")
+	}
+	var nilController *syncRateController
+	if nilController.newRateLimit(true, nil) != nil {
+		t.Error("nil controller should not create rate limit")
+	}
+}
@@ -52,6 +52,14 @@ type (
 		LastSyncTime string `json:"lastSyncTime"`
 		// ScanTimeInterval 扫描文件时间间隔，单位秒
 		ScanTimeInterval int64 `json:"-"`
+		// FilterRule 文件过滤规则
+		FilterRule *SyncFilterRule `json:"filterRule,omitempty"`
+		// VersionPolicy 历史版本保留策略，为空则不保留历史版本。只对上传备份模式有效
+		VersionPolicy *SyncVersionPolicy `json:"versionPolicy,omitempty"`
+		// Paused 任务是否已暂停，暂停的任务不会启动
+		Paused bool `json:"paused,omitempty"`
+		// Schedule 同步计划，包括同步时间窗口和分时段限速
+		Schedule *SyncSchedule `json:"schedule,omitempty"`
 
 		syncDbFolderPath string
 		localFileDb      LocalSyncDb
@@ -73,6 +81,13 @@ type (
 
 		plugin      plugins.Plugin
 		pluginMutex *sync.Mutex
+
+		filter *syncFilter
+
+		scheduler      *syncScheduler
+		rateController *syncRateController
+		// 是否已经提示等待同步时间窗口
+		scheduleWaitPrompted bool
 	}
 )
 
@@ -152,6 +167,15 @@ func (t *SyncTask) String() string {
 		driveName = "资源盘"
 	}
 	builder.WriteString("目标网盘: " + driveName + "\n")
+	if !t.FilterRule.IsEmpty() {
+		builder.WriteString("过滤规则: " + t.FilterRule.String() + "\n")
+	}
+	if t.VersionPolicy != nil && t.Mode == Upload {
+		builder.WriteString("历史版本: " + t.VersionPolicy.String() + "\n")
+	}
+	if !t.Schedule.IsEmpty() {
+		builder.WriteString("同步计划: " + t.Schedule.String() + "\n")
+	}
 	return builder.String()
 }
 
@@ -193,6 +217,21 @@ func (t *SyncTask) Start() error {
 		}
 	}
 
+	// 文件过滤规则
+	if filter, e := newSyncFilter(t.FilterRule, t.LocalFolderPath); e != nil {
+		return fmt.Errorf("过滤规则配置错误：%s", e)
+	} else {
+		t.filter = filter
+	}
+
+	// 同步计划
+	if scheduler, e := newSyncScheduler(t.Schedule); e != nil {
+		return fmt.Errorf("同步计划配置错误：%s", e)
+	} else {
+		t.scheduler = scheduler
+		t.rateController = newSyncRateController(scheduler, t.syncOption.MaxDownloadRate, t.syncOption.MaxUploadRate)
+	}
+
 	// check root dir & init
 	if b, e := utils.PathExists(t.LocalFolderPath); e == nil {
 		if !b {
@@ -239,6 +278,11 @@ func (t *SyncTask) Start() error {
 		t.Policy = SyncPolicyIncrement
 	}
 
+	// 启动分时段限速进程
+	if t.scheduler.hasBandwidthProfile() {
+		go t.rateControlLoop(t.ctx)
+	}
+
 	// 启动文件扫描进程
 	t.SetScanLoopFlag(false)
 	if t.Mode == Upload {
@@ -308,6 +352,42 @@ func (t *SyncTask) SetScanLoopFlag(done bool) {
 	t.scanLoopIsDone = done
 }
 
+// waitForScheduleWindow 当前是否在同步时间窗口内，不在则等待1秒后返回false
+func (t *SyncTask) waitForScheduleWindow() bool {
+	if t.scheduler.IsActive(time.Now()) {
+		t.scheduleWaitPrompted = false
+		return true
+	}
+	if !t.scheduleWaitPrompted {
+		t.scheduleWaitPrompted = true
+		PromptPrintln("当前不在同步时间窗口内，等待下一个时间窗口: " + strings.Join(t.Schedule.Windows, "; "))
+	}
+	time.Sleep(1 * time.Second)
+	return false
+}
+
+// rateControlLoop 按照分时段限速配置动态调整传输速度
+func (t *SyncTask) rateControlLoop(ctx context.Context) {
+	t.wg.AddDelta()
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.rateController.apply(time.Now())
+		}
+	}
+}
+
+// isSetup 任务是否已经启动过
+func (t *SyncTask) isSetup() bool {
+	return t.resourceMutex != nil && t.fileActionTaskManager != nil
+}
+
 // IsTaskCompletely 任务是否已经完成
 func (t *SyncTask) IsTaskCompletely() bool {
 	// 扫描完成+执行完成+一次运行模式
@@ -392,7 +472,26 @@ func (t *SyncTask) discardLocalFileDb(filePath string, startTimeUnix int64) bool
 	return r
 }
 
+// isFilteredLocalFile 本地文件是否被过滤规则排除
+func (t *SyncTask) isFilteredLocalFile(file *LocalFileItem) (bool, string) {
+	localRootPath := strings.ReplaceAll(t.LocalFolderPath, "\\", "/")
+	return t.filter.Skip(&filterFileInfo{
+		RelativePath: strings.TrimPrefix(strings.ReplaceAll(file.Path, "\\", "/"), localRootPath),
+		FileName:     file.FileName,
+		FileSize:     file.FileSize,
+		IsFolder:     file.IsFolder(),
+		UpdatedAt:    file.UpdateTime(),
+		LocalPath:    file.Path,
+	})
+}
+
 func (t *SyncTask) skipLocalFile(file *LocalFileItem) bool {
+	// 过滤规则
+	if skip, reason := t.isFilteredLocalFile(file); skip {
+		PromptPrintln("过滤规则跳过本地文件(" + reason + "): " + file.Path)
+		return true
+	}
+
 	// 插件回调
 	pluginParam := &plugins.SyncScanLocalFilePrepareParams{
 		LocalFilePath:      file.Path,
@@ -407,6 +506,7 @@ func (t *SyncTask) skipLocalFile(file *LocalFileItem) bool {
 	if result, er := t.plugin.SyncScanLocalFilePrepareCallback(plugins.GetContext(t.panUser), pluginParam); er == nil && result != nil {
 		if strings.Compare("no", result.SyncScanLocalApproved) == 0 {
 			// skip this file
+			PromptPrintln("插件禁止扫描本地文件: " + file.Path)
 			return true
 		}
 	}
@@ -474,10 +574,15 @@ func (t *SyncTask) scanLocalFile(ctx context.Context) {
 					time.Sleep(1 * time.Second)
 					continue // 需要等待文件上传进程完成才能开启新一轮扫描
 				}
+				// 确认是否在同步时间窗口内
+				if !t.waitForScheduleWindow() {
+					continue
+				}
 				delayTimeCount -= 1
 				logger.Verboseln("start scan local file process at ", utils.NowTimeStr())
 				t.SetScanLoopFlag(false)
 				t.fileActionTaskManager.StartFileActionTaskExecutor()
+				t.filter.ResetIgnoreFileCache()
 				PromptPrintln("开始进行文件扫描...")
 			}
 
@@ -516,10 +621,9 @@ func (t *SyncTask) scanLocalFile(ctx context.Context) {
 					continue
 				}
 
-				// 检查JS插件
+				// 检查过滤规则和JS插件
 				localFile := newLocalFileItem(file, item.path+"/"+file.Name())
 				if t.skipLocalFile(localFile) {
-					PromptPrintln("插件禁止扫描本地文件: " + localFile.Path)
 					continue
 				}
 
@@ -590,7 +694,12 @@ func (t *SyncTask) scanLocalFile(ctx context.Context) {
 			panFileScanList := PanFileList{}
 			for _, pf := range panFileList {
 				pf.Path = path.Join(GetPanFileFullPathFromLocalPath(item.path, t.LocalFolderPath, t.PanFolderPath), pf.FileName)
-				panFileScanList = append(panFileScanList, NewPanFileItem(pf))
+				panFile := NewPanFileItem(pf)
+				if skip, _ := t.isFilteredPanFile(panFile); skip {
+					// 被过滤的文件不参与对比，避免被当作多余文件删除
+					continue
+				}
+				panFileScanList = append(panFileScanList, panFile)
 			}
 
 			// 对比文件
@@ -631,7 +740,30 @@ func (t *SyncTask) discardPanFileDb(filePath string, startTimeUnix int64) bool {
 	return r
 }
 
+// isFilteredPanFile 云盘文件是否被过滤规则排除
+func (t *SyncTask) isFilteredPanFile(file *PanFileItem) (bool, string) {
+	panRootPath := strings.ReplaceAll(t.PanFolderPath, "\\", "/")
+	relativePath := strings.TrimPrefix(strings.ReplaceAll(file.Path, "\\", "/"), panRootPath)
+	if isVersionsFolderPath(relativePath) {
+		// 历史版本目录不参与同步
+		return true, "历史版本目录"
+	}
+	return t.filter.Skip(&filterFileInfo{
+		RelativePath: relativePath,
+		FileName:     file.FileName,
+		FileSize:     file.FileSize,
+		IsFolder:     file.IsFolder(),
+		UpdatedAt:    file.UpdateTime(),
+	})
+}
+
 func (t *SyncTask) skipPanFile(file *PanFileItem) bool {
+	// 过滤规则
+	if skip, reason := t.isFilteredPanFile(file); skip {
+		PromptPrintln("过滤规则跳过云盘文件(" + reason + "): " + file.Path)
+		return true
+	}
+
 	// 插件回调
 	pluginParam := &plugins.SyncScanPanFilePrepareParams{
 		DriveId:            file.DriveId,
@@ -647,6 +779,7 @@ func (t *SyncTask) skipPanFile(file *PanFileItem) bool {
 	if result, er := t.plugin.SyncScanPanFilePrepareCallback(plugins.GetContext(t.panUser), pluginParam); er == nil && result != nil {
 		if strings.Compare("no", result.SyncScanPanApproved) == 0 {
 			// skip this file
+			PromptPrintln("插件禁止扫描云盘文件: " + file.Path)
 			return true
 		}
 	}
@@ -699,10 +832,15 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 					time.Sleep(1 * time.Second)
 					continue // 需要等待文件上传进程完成才能开启新一轮扫描
 				}
+				// 确认是否在同步时间窗口内
+				if !t.waitForScheduleWindow() {
+					continue
+				}
 				delayTimeCount -= 1
 				logger.Verboseln("start scan pan file process at ", utils.NowTimeStr())
 				t.SetScanLoopFlag(false)
 				t.fileActionTaskManager.StartFileActionTaskExecutor()
+				t.filter.ResetIgnoreFileCache()
 				PromptPrintln("开始进行文件扫描...")
 			}
 			obj := folderQueue.Pop()
@@ -737,9 +875,8 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 				file.Path = path.Join(item.Path, file.FileName)
 				panFile := NewPanFileItem(file)
 
-				// 检查JS插件
+				// 检查过滤规则和JS插件
 				if t.skipPanFile(panFile) {
-					PromptPrintln("插件禁止扫描云盘文件: " + panFile.Path)
 					continue
 				}
 
@@ -771,6 +908,10 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 					continue
 				}
 				localFile := newLocalFileItem(file, localFolderPath+"/"+file.Name())
+				if skip, _ := t.isFilteredLocalFile(localFile); skip {
+					// 被过滤的文件不参与对比，避免被当作多余文件删除
+					continue
+				}
 				logger.Verboseln("扫描到本地文件：" + localFile.Path)
 
 				// 查询本地扫描数据库
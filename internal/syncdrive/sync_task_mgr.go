@@ -8,7 +8,9 @@ import (
 	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/library-go/logger"
 	"io/ioutil"
+	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -51,6 +53,15 @@ type (
 		ConfigVer    string      `json:"configVer"`
 		SyncTaskList []*SyncTask `json:"syncTaskList"`
 	}
+
+	// SyncTaskResult 同步任务在一段时间内的文件同步结果
+	SyncTaskResult struct {
+		Task *SyncTask
+		// Succeeded 同步成功的文件
+		Succeeded SyncFileList
+		// Failed 同步失败的文件，包括文件名不合法等无法同步的文件
+		Failed SyncFileList
+	}
 )
 
 var (
@@ -111,6 +122,14 @@ func (m *SyncTaskManager) parseConfigFile() error {
 	return nil
 }
 
+// LoadSyncTaskList 读取配置文件中的同步任务列表
+func (m *SyncTaskManager) LoadSyncTaskList() ([]*SyncTask, error) {
+	if e := m.parseConfigFile(); e != nil {
+		return nil, e
+	}
+	return m.syncDriveConfig.SyncTaskList, nil
+}
+
 func (m *SyncTaskManager) ConfigFilePath() string {
 	return path.Join(m.SyncConfigFolderPath, "sync_drive_config.json")
 }
@@ -165,6 +184,12 @@ func (m *SyncTaskManager) Start(tasks []*SyncTask, cycleMode CycleMode, scanTime
 			task.UserId = m.PanUser.UserId
 		}
 
+		// check paused
+		if task.Paused {
+			fmt.Println("任务已暂停，跳过: ", task.NameLabel())
+			continue
+		}
+
 		// check pan path
 		if !utils.IsPanAbsPath(task.PanFolderPath) {
 			task.PanFolderPath = "/" + task.PanFolderPath
@@ -201,7 +226,9 @@ func (m *SyncTaskManager) Start(tasks []*SyncTask, cycleMode CycleMode, scanTime
 	}
 	// save config file
 	if m.useConfigFile {
-		ioutil.WriteFile(m.ConfigFilePath(), []byte(utils.ObjectToJsonStr(m.syncDriveConfig, true)), 0755)
+		if e := m.saveConfigFile(); e != nil {
+			logger.Verboseln("save sync config file error: ", e)
+		}
 	}
 	return true, nil
 }
@@ -222,13 +249,19 @@ func (m *SyncTaskManager) Stop() (bool, error) {
 
 	// save config file
 	if m.useConfigFile {
-		ioutil.WriteFile(m.ConfigFilePath(), []byte(utils.ObjectToJsonStr(m.syncDriveConfig, true)), 0755)
+		if e := m.saveConfigFile(); e != nil {
+			logger.Verboseln("save sync config file error: ", e)
+		}
 	}
 	return true, nil
 }
 
 func (m *SyncTaskManager) IsAllTaskCompletely() bool {
 	for _, task := range m.syncDriveConfig.SyncTaskList {
+		if !task.isSetup() {
+			// 未启动的任务
+			continue
+		}
 		if !task.IsTaskCompletely() {
 			return false
 		}
@@ -239,8 +272,199 @@ func (m *SyncTaskManager) IsAllTaskCompletely() bool {
 // DoTaskSyncCompletelyPluginCallback 调用任务同步完成的回调函数
 func (m *SyncTaskManager) DoTaskSyncCompletelyPluginCallback() {
 	for _, task := range m.syncDriveConfig.SyncTaskList {
-		if task.IsTaskCompletely() {
+		if task.isSetup() && task.IsTaskCompletely() {
 			task.doAllFileSyncPluginCallback()
 		}
 	}
 }
+
+// SaveSyncTaskList 保存同步任务列表到配置文件
+func (m *SyncTaskManager) SaveSyncTaskList(tasks []*SyncTask) error {
+	if m.syncDriveConfig == nil {
+		m.syncDriveConfig = &SyncDriveConfig{
+			ConfigVer: "1.0",
+		}
+	}
+	m.syncDriveConfig.SyncTaskList = tasks
+	return m.saveConfigFile()
+}
+
+// saveConfigFile 保存配置文件。配置文件包含同步任务列表，只允许当前用户读写
+func (m *SyncTaskManager) saveConfigFile() error {
+	if b, _ := utils.PathExists(m.SyncConfigFolderPath); !b {
+		os.MkdirAll(m.SyncConfigFolderPath, 0755)
+	}
+	return utils.WriteFileAtomic(m.ConfigFilePath(), []byte(utils.ObjectToJsonStr(m.syncDriveConfig, true)), 0600)
+}
+
+// LoadOrCreateSyncTaskList 读取配置文件中的同步任务列表，配置文件不存在则返回空列表
+func (m *SyncTaskManager) LoadOrCreateSyncTaskList() ([]*SyncTask, error) {
+	if b, _ := utils.PathExists(m.ConfigFilePath()); !b {
+		m.syncDriveConfig = &SyncDriveConfig{
+			ConfigVer:    "1.0",
+			SyncTaskList: []*SyncTask{},
+		}
+		return m.syncDriveConfig.SyncTaskList, nil
+	}
+	return m.LoadSyncTaskList()
+}
+
+// FindSyncTask 查找同步任务，key 可以是任务ID、任务名称或者任务序号（从1开始）
+func FindSyncTask(tasks []*SyncTask, key string) (int, *SyncTask) {
+	for idx, task := range tasks {
+		if task.Id != "" && task.Id == key {
+			return idx, task
+		}
+	}
+	for idx, task := range tasks {
+		if task.Name == key {
+			return idx, task
+		}
+	}
+	if n, e := strconv.Atoi(key); e == nil && n > 0 && n <= len(tasks) {
+		return n - 1, tasks[n-1]
+	}
+	return -1, nil
+}
+
+// CheckSyncTask 检查同步任务配置是否正确，并补全默认值
+func CheckSyncTask(task *SyncTask) error {
+	if task.Name == "" {
+		return fmt.Errorf("任务名称不能为空")
+	}
+	if task.LocalFolderPath == "" || !utils.IsLocalAbsPath(task.LocalFolderPath) {
+		return fmt.Errorf("本地路径必须是绝对路径: %s", task.LocalFolderPath)
+	}
+	if task.PanFolderPath == "" {
+		return fmt.Errorf("云盘路径不能为空")
+	}
+	if !utils.IsPanAbsPath(task.PanFolderPath) {
+		task.PanFolderPath = "/" + task.PanFolderPath
+	}
+	task.PanFolderPath = path.Clean(task.PanFolderPath)
+	if task.Mode != Upload && task.Mode != Download {
+		return fmt.Errorf("不支持的备份模式: %s", task.Mode)
+	}
+	if task.Policy == "" {
+		task.Policy = SyncPolicyIncrement
+	}
+	if task.Policy != SyncPolicyExclusive && task.Policy != SyncPolicyIncrement {
+		return fmt.Errorf("不支持的备份策略: %s", task.Policy)
+	}
+	if task.DriveName == "" {
+		task.DriveName = "backup"
+	}
+	if task.DriveName != "backup" && task.DriveName != "resource" {
+		return fmt.Errorf("不支持的网盘: %s", task.DriveName)
+	}
+	if _, e := newSyncFilter(task.FilterRule, task.LocalFolderPath); e != nil {
+		return fmt.Errorf("过滤规则配置错误：%s", e)
+	}
+	if _, e := newSyncScheduler(task.Schedule); e != nil {
+		return fmt.Errorf("同步计划配置错误：%s", e)
+	}
+	return nil
+}
+
+// SyncDbFolderPath 同步任务数据库所在的目录
+func (m *SyncTaskManager) SyncDbFolderPath(task *SyncTask) string {
+	return path.Join(m.SyncConfigFolderPath, task.Id)
+}
+
+// ResetSyncTaskDb 删除同步任务的数据库，下次启动任务时会重新扫描文件并创建数据库
+func (m *SyncTaskManager) ResetSyncTaskDb(task *SyncTask) error {
+	if task.Id == "" {
+		return nil
+	}
+	return os.RemoveAll(m.SyncDbFolderPath(task))
+}
+
+// openSyncFileDb 打开同步任务的文件同步过程数据库，数据库不存在则返回nil
+func (m *SyncTaskManager) openSyncFileDb(task *SyncTask) SyncFileDb {
+	if task.Id == "" {
+		return nil
+	}
+	dbPath := path.Join(m.SyncDbFolderPath(task), "sync.bolt")
+	if b, _ := utils.PathExists(dbPath); !b {
+		return nil
+	}
+	return NewSyncFileDb(dbPath)
+}
+
+// GetSyncFileList 获取同步任务指定状态的文件同步记录
+func (m *SyncTaskManager) GetSyncFileList(task *SyncTask, status SyncFileStatus) (SyncFileList, error) {
+	db := m.openSyncFileDb(task)
+	if db == nil {
+		return SyncFileList{}, nil
+	}
+	files, e := db.GetFileList(status)
+	if e != nil {
+		return nil, e
+	}
+	if files == nil {
+		files = SyncFileList{}
+	}
+	return files, nil
+}
+
+// RetryFailedSyncFiles 将同步失败的文件重新加入同步队列，返回重新加入的文件数量
+func (m *SyncTaskManager) RetryFailedSyncFiles(task *SyncTask) (int, error) {
+	db := m.openSyncFileDb(task)
+	if db == nil {
+		return 0, nil
+	}
+	files, e := db.GetFileList(SyncFileStatusFailed)
+	if e != nil {
+		return 0, e
+	}
+	count := 0
+	for _, file := range files {
+		file.Status = SyncFileStatusCreate
+		file.StatusUpdateTime = utils.NowTimeStr()
+		if _, e = db.Update(file); e != nil {
+			return count, e
+		}
+		count++
+	}
+	return count, nil
+}
+
+// GetSyncTaskResults 获取所有已启动的任务从 since 开始的文件同步结果
+func (m *SyncTaskManager) GetSyncTaskResults(since time.Time) ([]*SyncTaskResult, error) {
+	results := []*SyncTaskResult{}
+	if m.syncDriveConfig == nil {
+		return results, nil
+	}
+	// 状态更新时间只精确到秒
+	since = since.Truncate(time.Second)
+	inRange := func(files SyncFileList) SyncFileList {
+		r := SyncFileList{}
+		for _, file := range files {
+			ts, e := time.ParseInLocation("2006-01-02 15:04:05", file.StatusUpdateTime, time.Local)
+			if e != nil || ts.Before(since) {
+				continue
+			}
+			r = append(r, file)
+		}
+		return r
+	}
+	for _, task := range m.syncDriveConfig.SyncTaskList {
+		if !task.isSetup() {
+			continue
+		}
+		result := &SyncTaskResult{Task: task}
+		for _, status := range []SyncFileStatus{SyncFileStatusSuccess, SyncFileStatusFailed, SyncFileStatusIllegal} {
+			files, e := m.GetSyncFileList(task, status)
+			if e != nil {
+				return nil, e
+			}
+			if status == SyncFileStatusSuccess {
+				result.Succeeded = inRange(files)
+			} else {
+				result.Failed = append(result.Failed, inRange(files)...)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,80 @@
+package syncdrive
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestFindSyncTask(t *testing.T) {
+	tasks := []*SyncTask{
+		{Name: "文档备份", Id: "5b2d7c10-e927-4e72-8f9d-5abb3bb04814"},
+		{Name: "2", Id: "a3d1f6b2-0c1e-4a7e-9a51-2b3c4d5e6f70"},
+	}
+	if idx, task := FindSyncTask(tasks, "a3d1f6b2-0c1e-4a7e-9a51-2b3c4d5e6f70"); idx != 1 || task != tasks[1] {
+		t.Error("find task by id failed")
+	}
+	if idx, task := FindSyncTask(tasks, "文档备份"); idx != 0 || task != tasks[0] {
+		t.Error("find task by name failed")
+	}
+	// 名称优先于序号
+	if idx, _ := FindSyncTask(tasks, "2"); idx != 1 {
+		t.Error("find task by name failed")
+	}
+	if idx, task := FindSyncTask(tasks, "1"); idx != 0 || task != tasks[0] {
+		t.Error("find task by index failed")
+	}
+	if idx, task := FindSyncTask(tasks, "3"); idx != -1 || task != nil {
+		t.Error("task should not be found")
+	}
+}
+
+func TestCheckSyncTask(t *testing.T) {
+	task := &SyncTask{
+		Name:            "文档备份",
+		LocalFolderPath: t.TempDir(),
+		PanFolderPath:   "sync_drive/docs/",
+		Mode:            Upload,
+	}
+	if e := CheckSyncTask(task); e != nil {
+		t.Fatal(e)
+	}
+	if task.PanFolderPath != "/sync_drive/docs" || task.Policy != SyncPolicyIncrement || task.DriveName != "backup" {
+		t.Errorf("unexpected task: %+v", task)
+	}
+
+	task.Mode = SyncTwoWay
+	if e := CheckSyncTask(task); e == nil {
+		t.Error("sync mode should not be supported")
+	}
+	task.Mode = Download
+	task.FilterRule = &SyncFilterRule{MinSize: "abc"}
+	if e := CheckSyncTask(task); e == nil {
+		t.Error("invalid filter rule should be detected")
+	}
+}
+
+func TestSyncConfigFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file mode is not supported on windows")
+	}
+	m := &SyncTaskManager{
+		SyncConfigFolderPath: t.TempDir(),
+		syncDriveConfig:      &SyncDriveConfig{ConfigVer: "1.0"},
+		useConfigFile:        true,
+	}
+	// 旧版本创建的配置文件
+	if e := os.WriteFile(m.ConfigFilePath(), []byte("{}"), 0755); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := m.Stop(); e != nil {
+		t.Fatal(e)
+	}
+	fi, e := os.Stat(m.ConfigFilePath())
+	if e != nil {
+		t.Fatal(e)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("config file mode = %v, want 0600", fi.Mode().Perm())
+	}
+}
@@ -0,0 +1,339 @@
+package syncdrive
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// VersionsFolderName 历史版本目录名称，位于云盘同步目录的根目录下
+	VersionsFolderName string = ".versions"
+
+	// VersionTimeFormat 历史版本文件名的时间格式
+	VersionTimeFormat string = "2006-01-02T15-04-05"
+)
+
+type (
+	// SyncVersionPolicy 历史版本保留策略。上传备份覆盖云盘文件前，旧文件会被移动到历史版本目录
+	SyncVersionPolicy struct {
+		// KeepLast 保留最近的N个版本
+		KeepLast int `json:"keepLast,omitempty"`
+		// KeepDailyDays 最近D天内每天保留一个版本（当天最新的版本）
+		KeepDailyDays int `json:"keepDailyDays,omitempty"`
+	}
+
+	// PanFileVersion 云盘文件的一个历史版本
+	PanFileVersion struct {
+		// Name 版本名称，即历史版本目录下的文件名
+		Name string
+		// VersionTime 版本时间
+		VersionTime time.Time
+		// File 版本文件
+		File *aliyunpan.FileEntity
+
+		// seq 同一时间的版本序号
+		seq int
+	}
+	PanFileVersionList []*PanFileVersion
+)
+
+var (
+	ErrVersionNotExisted = fmt.Errorf("历史版本不存在")
+)
+
+// String 策略描述
+func (p *SyncVersionPolicy) String() string {
+	if p == nil {
+		return ""
+	}
+	items := []string{}
+	if p.KeepLast > 0 {
+		items = append(items, fmt.Sprintf("保留最近%d个版本", p.KeepLast))
+	}
+	if p.KeepDailyDays > 0 {
+		items = append(items, fmt.Sprintf("%d天内每天保留一个版本", p.KeepDailyDays))
+	}
+	if len(items) == 0 {
+		return "保留全部版本"
+	}
+	return strings.Join(items, ", ")
+}
+
+// GetVersionsFolderPath 获取云盘文件对应的历史版本目录，即 <同步根目录>/.versions/<相对路径>
+func GetVersionsFolderPath(panRootPath, panFilePath string) string {
+	panRootPath = path.Clean(strings.ReplaceAll(panRootPath, "\\", "/"))
+	panFilePath = path.Clean(strings.ReplaceAll(panFilePath, "\\", "/"))
+	relativePath := strings.TrimPrefix(strings.TrimPrefix(panFilePath, panRootPath), "/")
+	return path.Join(panRootPath, VersionsFolderName, relativePath)
+}
+
+// isVersionsFolderPath 相对同步根目录的路径是否是历史版本目录
+func isVersionsFolderPath(relativePath string) bool {
+	relativePath = strings.Trim(strings.ReplaceAll(relativePath, "\\", "/"), "/")
+	return relativePath == VersionsFolderName || strings.HasPrefix(relativePath, VersionsFolderName+"/")
+}
+
+// newVersionName 生成版本名称，格式为 <时间>[-序号]<扩展名>。时间只精确到秒，和 existed 中的版本重名时增加序号
+func newVersionName(versionTime time.Time, fileName string, existed map[string]bool) string {
+	prefix := versionTime.In(time.Local).Format(VersionTimeFormat)
+	ext := path.Ext(fileName)
+	name := prefix + ext
+	for seq := 1; existed[name]; seq++ {
+		name = prefix + "-" + strconv.Itoa(seq) + ext
+	}
+	return name
+}
+
+// parseVersionTime 从版本名称解析版本时间
+func parseVersionTime(name string) (time.Time, bool) {
+	if len(name) < len(VersionTimeFormat) {
+		return time.Time{}, false
+	}
+	t, e := time.ParseInLocation(VersionTimeFormat, name[:len(VersionTimeFormat)], time.Local)
+	if e != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// parseVersionSeq 从版本名称解析同一时间的版本序号，没有序号为0
+func parseVersionSeq(name string) int {
+	suffix := strings.TrimSuffix(name[len(VersionTimeFormat):], path.Ext(name))
+	if !strings.HasPrefix(suffix, "-") {
+		return 0
+	}
+	seq, e := strconv.Atoi(suffix[1:])
+	if e != nil {
+		return 0
+	}
+	return seq
+}
+
+// ListPanFileVersions 获取云盘文件的历史版本列表，按时间倒序排列
+func ListPanFileVersions(panClient *config.PanClient, driveId, panRootPath, panFilePath string) (PanFileVersionList, error) {
+	versionsDirPath := GetVersionsFolderPath(panRootPath, panFilePath)
+	versionsDir, apierr := panClient.OpenapiPanClient().FileInfoByPath(driveId, versionsDirPath)
+	if apierr != nil {
+		if apierr.Code == apierror.ApiCodeFileNotFoundCode {
+			return PanFileVersionList{}, nil
+		}
+		return nil, apierr
+	}
+	files, apierr := panClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
+		DriveId:      driveId,
+		ParentFileId: versionsDir.FileId,
+	}, 500)
+	if apierr != nil {
+		return nil, apierr
+	}
+	versions := PanFileVersionList{}
+	for _, f := range files {
+		if f.IsFolder() {
+			continue
+		}
+		vt, ok := parseVersionTime(f.FileName)
+		if !ok {
+			continue
+		}
+		f.Path = path.Join(versionsDirPath, f.FileName)
+		versions = append(versions, &PanFileVersion{
+			Name:        f.FileName,
+			VersionTime: vt,
+			File:        f,
+			seq:         parseVersionSeq(f.FileName),
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].VersionTime.Equal(versions[j].VersionTime) {
+			return versions[i].seq > versions[j].seq
+		}
+		return versions[i].VersionTime.After(versions[j].VersionTime)
+	})
+	return versions, nil
+}
+
+// selectExpiredVersions 根据保留策略选出需要删除的版本，versions 必须按时间倒序排列
+func selectExpiredVersions(versions PanFileVersionList, policy *SyncVersionPolicy, now time.Time) PanFileVersionList {
+	if policy == nil || (policy.KeepLast <= 0 && policy.KeepDailyDays <= 0) {
+		// 未配置保留规则，保留全部版本
+		return PanFileVersionList{}
+	}
+	keep := map[string]bool{}
+	for i, v := range versions {
+		if i < policy.KeepLast {
+			keep[v.Name] = true
+		}
+	}
+	if policy.KeepDailyDays > 0 {
+		y, m, d := now.Date()
+		earliest := time.Date(y, m, d, 0, 0, 0, 0, now.Location()).AddDate(0, 0, -(policy.KeepDailyDays - 1))
+		days := map[string]bool{}
+		for _, v := range versions {
+			if v.VersionTime.Before(earliest) {
+				continue
+			}
+			day := v.VersionTime.Format("2006-01-02")
+			if !days[day] {
+				// 倒序排列，第一个即为当天最新的版本
+				days[day] = true
+				keep[v.Name] = true
+			}
+		}
+	}
+	expired := PanFileVersionList{}
+	for _, v := range versions {
+		if !keep[v.Name] {
+			expired = append(expired, v)
+		}
+	}
+	return expired
+}
+
+// archivePanFileVersion 将云盘文件移动到历史版本目录，并按照保留策略清理过期的版本
+func archivePanFileVersion(panClient *config.PanClient, panFolderCreateMutex *sync.Mutex, driveId, panRootPath string, file *aliyunpan.FileEntity, policy *SyncVersionPolicy) error {
+	versionsDirPath := GetVersionsFolderPath(panRootPath, file.Path)
+	if panFolderCreateMutex != nil {
+		panFolderCreateMutex.Lock()
+	}
+	versionsDir, apierr := panClient.OpenapiPanClient().MkdirByFullPath(driveId, versionsDirPath)
+	if panFolderCreateMutex != nil {
+		panFolderCreateMutex.Unlock()
+	}
+	if apierr != nil || versionsDir == nil || versionsDir.FileId == "" {
+		logger.Verbosef("创建历史版本目录失败: %s\n", versionsDirPath)
+		if apierr != nil {
+			return apierr
+		}
+		return fmt.Errorf("创建历史版本目录失败: %s", versionsDirPath)
+	}
+
+	// 已存在的版本名称，同一秒内修改的版本需要增加序号
+	existedFiles, apierr := panClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
+		DriveId:      driveId,
+		ParentFileId: versionsDir.FileId,
+	}, 500)
+	if apierr != nil {
+		return apierr
+	}
+	existed := map[string]bool{}
+	for _, f := range existedFiles {
+		existed[f.FileName] = true
+	}
+	versionTime := utils.ParseTimeStr(file.UpdatedAt)
+	if versionTime.Year() <= 1971 {
+		// 时间解析失败
+		versionTime = time.Now()
+	}
+	versionName := newVersionName(versionTime, file.FileName, existed)
+
+	// 移动到历史版本目录，然后重命名为版本名称
+	if _, apierr = panClient.OpenapiPanClient().FileMove(&aliyunpan.FileMoveParam{
+		DriveId:        driveId,
+		FileId:         file.FileId,
+		ToDriveId:      driveId,
+		ToParentFileId: versionsDir.FileId,
+	}); apierr != nil {
+		logger.Verbosef("移动文件到历史版本目录失败: %s, %s\n", file.Path, apierr)
+		return apierr
+	}
+	if _, apierr = panClient.OpenapiPanClient().FileRename(driveId, file.FileId, versionName); apierr != nil {
+		logger.Verbosef("重命名历史版本文件失败: %s, %s\n", file.Path, apierr)
+		// 移回原目录，避免旧文件以原文件名残留在历史版本目录中
+		if _, e := panClient.OpenapiPanClient().FileMove(&aliyunpan.FileMoveParam{
+			DriveId:        driveId,
+			FileId:         file.FileId,
+			ToDriveId:      driveId,
+			ToParentFileId: file.ParentFileId,
+		}); e != nil {
+			logger.Verbosef("移回历史版本文件失败: %s, %s\n", file.Path, e)
+		}
+		return apierr
+	}
+	PromptPrintln("保存历史版本：" + path.Join(versionsDirPath, versionName))
+
+	// 清理过期版本
+	pruneFileVersions(panClient, driveId, panRootPath, file.Path, policy)
+	return nil
+}
+
+// pruneFileVersions 按照保留策略清理过期的版本，过期版本会被移到回收站
+func pruneFileVersions(panClient *config.PanClient, driveId, panRootPath, panFilePath string, policy *SyncVersionPolicy) {
+	versions, e := ListPanFileVersions(panClient, driveId, panRootPath, panFilePath)
+	if e != nil {
+		logger.Verbosef("获取历史版本列表失败: %s, %s\n", panFilePath, e)
+		return
+	}
+	for _, v := range selectExpiredVersions(versions, policy, time.Now()) {
+		if _, apierr := panClient.OpenapiPanClient().FileDelete(&aliyunpan.FileBatchActionParam{
+			DriveId: driveId,
+			FileId:  v.File.FileId,
+		}); apierr != nil {
+			logger.Verbosef("删除过期版本失败: %s, %s\n", v.File.Path, apierr)
+			continue
+		}
+		PromptPrintln("删除过期历史版本：" + v.File.Path)
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// RestorePanFileVersion 将云盘文件恢复到指定的历史版本。当前文件会先作为新的历史版本保存，因此恢复操作可以撤销
+func RestorePanFileVersion(panClient *config.PanClient, driveId, panRootPath, panFilePath, versionName string, policy *SyncVersionPolicy) error {
+	panFilePath = path.Clean(strings.ReplaceAll(panFilePath, "\\", "/"))
+	versions, e := ListPanFileVersions(panClient, driveId, panRootPath, panFilePath)
+	if e != nil {
+		return e
+	}
+	var target *PanFileVersion
+	for _, v := range versions {
+		if v.Name == versionName || strings.TrimSuffix(v.Name, path.Ext(v.Name)) == versionName {
+			target = v
+			break
+		}
+	}
+	if target == nil {
+		return ErrVersionNotExisted
+	}
+
+	// 先把版本文件移回原目录，避免保存当前文件时被当作过期版本清理掉
+	parentDir, apierr := panClient.OpenapiPanClient().MkdirByFullPath(driveId, path.Dir(panFilePath))
+	if apierr != nil {
+		return apierr
+	}
+	if _, apierr = panClient.OpenapiPanClient().FileMove(&aliyunpan.FileMoveParam{
+		DriveId:        driveId,
+		FileId:         target.File.FileId,
+		ToDriveId:      driveId,
+		ToParentFileId: parentDir.FileId,
+	}); apierr != nil {
+		return apierr
+	}
+
+	// 保存当前文件为历史版本
+	current, apierr := panClient.OpenapiPanClient().FileInfoByPath(driveId, panFilePath)
+	if apierr != nil && apierr.Code != apierror.ApiCodeFileNotFoundCode {
+		return apierr
+	}
+	if current != nil && current.FileId != "" {
+		current.Path = panFilePath
+		if e := archivePanFileVersion(panClient, nil, driveId, panRootPath, current, policy); e != nil {
+			return e
+		}
+	}
+
+	// 恢复文件名
+	if _, apierr = panClient.OpenapiPanClient().FileRename(driveId, target.File.FileId, path.Base(panFilePath)); apierr != nil {
+		return apierr
+	}
+	return nil
+}
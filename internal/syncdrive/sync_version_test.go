@@ -0,0 +1,78 @@
+package syncdrive
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetVersionsFolderPath(t *testing.T) {
+	p := GetVersionsFolderPath("/sync_drive/docs", "/sync_drive/docs/a/b/设计.docx")
+	if p != "/sync_drive/docs/.versions/a/b/设计.docx" {
+		t.Errorf("unexpected versions folder path: %s", p)
+	}
+	if !isVersionsFolderPath("/.versions/a/b/设计.docx") || !isVersionsFolderPath(".versions") {
+		t.Error("versions folder should be detected")
+	}
+	if isVersionsFolderPath("/a/.versions.txt") {
+		t.Error("normal file should not be detected as versions folder")
+	}
+}
+
+func TestParseVersionTime(t *testing.T) {
+	vt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.Local)
+	name := newVersionName(vt, "设计.docx", nil)
+	if name != "2024-05-01T10-30-00.docx" {
+		t.Errorf("unexpected version name: %s", name)
+	}
+	pt, ok := parseVersionTime(name)
+	if !ok || !pt.Equal(vt) {
+		t.Errorf("parse version time failed: %s", name)
+	}
+	if _, ok = parseVersionTime("readme.md"); ok {
+		t.Error("invalid version name should not be parsed")
+	}
+
+	// 同一秒内的版本增加序号
+	name = newVersionName(vt, "设计.docx", map[string]bool{"2024-05-01T10-30-00.docx": true, "2024-05-01T10-30-00-1.docx": true})
+	if name != "2024-05-01T10-30-00-2.docx" {
+		t.Errorf("unexpected version name: %s", name)
+	}
+	if pt, ok = parseVersionTime(name); !ok || !pt.Equal(vt) || parseVersionSeq(name) != 2 {
+		t.Errorf("parse version name failed: %s", name)
+	}
+	if parseVersionSeq("2024-05-01T10-30-00.docx") != 0 {
+		t.Error("version without seq should be 0")
+	}
+}
+
+func TestSelectExpiredVersions(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+	versions := PanFileVersionList{}
+	// 每天两个版本，共5天，倒序排列
+	for d := 0; d < 5; d++ {
+		for _, h := range []int{11, 9} {
+			vt := now.AddDate(0, 0, -d).Add(time.Duration(h-12) * time.Hour)
+			versions = append(versions, &PanFileVersion{Name: newVersionName(vt, "a.txt", nil), VersionTime: vt})
+		}
+	}
+
+	if len(selectExpiredVersions(versions, &SyncVersionPolicy{}, now)) != 0 {
+		t.Error("empty policy should keep all versions")
+	}
+
+	expired := selectExpiredVersions(versions, &SyncVersionPolicy{KeepLast: 3}, now)
+	if len(expired) != 7 || expired[0].Name != versions[3].Name {
+		t.Errorf("keepLast: unexpected expired count %d", len(expired))
+	}
+
+	// 最近3天每天保留一个，再加上最近2个
+	expired = selectExpiredVersions(versions, &SyncVersionPolicy{KeepLast: 2, KeepDailyDays: 3}, now)
+	if len(expired) != 6 {
+		t.Errorf("keepDailyDays: unexpected expired count %d", len(expired))
+	}
+	for _, v := range expired {
+		if v.Name == versions[0].Name || v.Name == versions[1].Name || v.Name == versions[2].Name || v.Name == versions[4].Name {
+			t.Errorf("version should be kept: %s", v.Name)
+		}
+	}
+}
@@ -136,6 +136,7 @@ func (te *TaskExecutor) Execute() {
 						task.Unit.OnFailed(result)
 						if te.IsFailedDeque {
 							// 加入失败队列
+							task.Result = result
 							te.failedDeque.Append(task)
 						}
 						task.Unit.OnComplete(result)
@@ -155,6 +156,7 @@ func (te *TaskExecutor) Execute() {
 				task.Unit.OnFailed(result)
 				if te.IsFailedDeque {
 					// 加入失败队列
+					task.Result = result
 					te.failedDeque.Append(task)
 				}
 				task.Unit.OnComplete(result)
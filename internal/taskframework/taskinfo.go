@@ -23,6 +23,8 @@ type (
 	TaskInfoItem struct {
 		Info *TaskInfo
 		Unit TaskUnit
+		// Result 最后一次执行的结果，只有失败队列中的任务才会记录
+		Result *TaskUnitRunResult
 	}
 )
 
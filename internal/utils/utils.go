@@ -27,6 +27,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
@@ -215,6 +216,38 @@ func ObjectToJsonStr(v interface{}, useIndent bool) string {
 	return r
 }
 
+// WriteFileAtomic 写入临时文件并同步到磁盘后，重命名为目标文件，防止写入中断导致文件损坏
+func WriteFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	tmpPath := filePath + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+// WriteJsonFileAtomic 以JSON格式保存对象到文件，目录不存在则创建，写入方式同 WriteFileAtomic
+func WriteJsonFileAtomic(filePath string, v interface{}, perm os.FileMode) error {
+	data, err := jsoniter.MarshalIndent(v, "", " ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(filePath, data, perm)
+}
+
 func UuidStr() string {
 	u4 := uuid.NewV4()
 	return u4.String()
@@ -2,6 +2,9 @@ package utils
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -66,3 +69,20 @@ func TestParseVersionNum3(t *testing.T) {
 func TestParseVersionNum4(t *testing.T) {
 	fmt.Println(ParseVersionNum("v"))
 }
+
+func TestWriteJsonFileAtomic(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state", "state.json")
+	if err := WriteJsonFileAtomic(filePath, map[string]int{"a": 1}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil || string(data) != "{\n \"a\": 1\n}" {
+		t.Errorf("unexpected content: %q, %v", data, err)
+	}
+	if fi, err := os.Stat(filePath); err != nil || (runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0) {
+		t.Errorf("file should not be readable by others: %v", fi.Mode())
+	}
+	if _, err := os.Stat(filePath + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temp file should be renamed")
+	}
+}
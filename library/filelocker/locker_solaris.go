@@ -8,7 +8,8 @@ import (
 
 // LockFile acquires an advisory lock on a file descriptor.
 func LockFile(locker *FileLocker, mode os.FileMode, exclusive bool, timeout time.Duration) error {
-	f, err := os.OpenFile(locker.LockFilePath, os.O_CREATE, mode)
+	// 写锁需要以可写方式打开文件
+	f, err := os.OpenFile(locker.LockFilePath, os.O_CREATE|os.O_RDWR, mode)
 	if err != nil {
 		return err
 	}
@@ -21,6 +22,7 @@ func LockFile(locker *FileLocker, mode os.FileMode, exclusive bool, timeout time
 		if t.IsZero() {
 			t = time.Now()
 		} else if timeout > 0 && time.Since(t) > timeout {
+			locker.lockFile.Close()
 			return ErrTimeout
 		}
 		var lock syscall.Flock_t
@@ -53,5 +55,7 @@ func UnlockFile(locker *FileLocker) error {
 	lock.Len = 0
 	lock.Type = syscall.F_UNLCK
 	lock.Whence = 0
-	return syscall.FcntlFlock(uintptr(locker.lockFile.Fd()), syscall.F_SETLK, &lock)
+	err := syscall.FcntlFlock(uintptr(locker.lockFile.Fd()), syscall.F_SETLK, &lock)
+	locker.lockFile.Close()
+	return err
 }
@@ -24,6 +24,7 @@ func LockFile(locker *FileLocker, mode os.FileMode, exclusive bool, timeout time
 		if t.IsZero() {
 			t = time.Now()
 		} else if timeout > 0 && time.Since(t) > timeout {
+			locker.lockFile.Close()
 			return ErrTimeout
 		}
 		flag := syscall.LOCK_SH
@@ -46,5 +47,7 @@ func LockFile(locker *FileLocker, mode os.FileMode, exclusive bool, timeout time
 
 // UnlockFile releases an advisory lock on a file descriptor.
 func UnlockFile(locker *FileLocker) error {
-	return syscall.Flock(int(locker.lockFile.Fd()), syscall.LOCK_UN)
+	err := syscall.Flock(int(locker.lockFile.Fd()), syscall.LOCK_UN)
+	locker.lockFile.Close()
+	return err
 }
@@ -57,6 +57,7 @@ func LockFile(locker *FileLocker, mode os.FileMode, exclusive bool, timeout time
 		if t.IsZero() {
 			t = time.Now()
 		} else if timeout > 0 && time.Since(t) > timeout {
+			locker.lockFile.Close()
 			return ErrTimeout
 		}
 
@@ -41,7 +41,7 @@ type (
 
 		startTime time.Time // 开始下载的时间
 
-		rateLimit *speeds.RateLimit // 限速控制
+		rateLimit atomic.Pointer[speeds.RateLimit] // 限速控制，下载过程中可以替换
 
 		gen *RangeListGen // Range生成状态
 		mu  sync.Mutex
@@ -57,7 +57,7 @@ func NewDownloadStatus() *DownloadStatus {
 
 // SetRateLimit 设置限速
 func (ds *DownloadStatus) SetRateLimit(rl *speeds.RateLimit) {
-	ds.rateLimit = rl
+	ds.rateLimit.Store(rl)
 }
 
 // SetTotalSize 设置总大小
@@ -77,8 +77,8 @@ func (ds *DownloadStatus) AddTotalSize(size int64) {
 
 // AddSpeedsDownloaded 增加已下载数据量, 用于统计速度
 func (ds *DownloadStatus) AddSpeedsDownloaded(d int64) {
-	if ds.rateLimit != nil {
-		ds.rateLimit.Add(d)
+	if rl := ds.rateLimit.Load(); rl != nil {
+		rl.Add(d)
 	}
 	ds.speedsStat.Add(d)
 }
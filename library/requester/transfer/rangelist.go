@@ -24,6 +24,9 @@ type (
 	Range struct {
 		Begin                int64    `json:"begin,omitempty"`
 		End                  int64    `json:"end,omitempty"`
+		// SumBegin, Crc64 分片已写入数据的校验信息, [SumBegin, Begin) 的数据的CRC64为 Crc64, 断点续传时用于校验
+		SumBegin             int64    `json:"sumBegin,omitempty"`
+		Crc64                uint64   `json:"crc64,omitempty"`
 	}
 
 	// RangeGenMode 线程分配方式
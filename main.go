@@ -61,6 +61,9 @@ var (
 
 	// 是否是交互命令行形态
 	isCli bool
+
+	// 配置文件错误
+	configInitErr error
 )
 
 func init() {
@@ -76,8 +79,8 @@ func init() {
 	switch err {
 	case nil:
 	case config.ErrConfigFileNoPermission, config.ErrConfigContentsParseError:
-		fmt.Fprintf(os.Stderr, "FATAL ERROR: config file error: %s\n", err)
-		//os.Exit(1)
+		// 在执行命令前输出错误，以便按照指定的输出格式输出
+		configInitErr = err
 	default:
 		fmt.Printf("WARNING: config init error: %s\n", err)
 	}
@@ -98,11 +101,14 @@ func checkLoginExpiredAndRelogin() {
 func main() {
 	defer config.Config.Close()
 
-	// check & relogin
-	checkLoginExpiredAndRelogin()
+	// 命令行补全需要尽快返回，云盘文件列表在使用时才会初始化登录
+	if !command.IsCompleteMode(os.Args) {
+		// check & relogin
+		checkLoginExpiredAndRelogin()
 
-	// check token expired task
-	command.AutomaticallyRefreshTokenTask() // Token刷新进程，不管是CLI命令行模式，还是直接命令模式，本刷新任务都会执行
+		// check token expired task
+		command.AutomaticallyRefreshTokenTask() // Token刷新进程，不管是CLI命令行模式，还是直接命令模式，本刷新任务都会执行
+	}
 
 	app := cli.NewApp()
 	cmder.SetApp(app)
@@ -140,6 +146,32 @@ func main() {
 			EnvVar:      config.EnvVerbose,
 			Destination: &logger.IsVerbose,
 		},
+		cli.StringFlag{
+			Name:   "output",
+			Usage:  "输出格式: table, json, jsonl, csv。ls, tree, quota, who, loglist, drive, recycle list, album list-file, sharew list 命令支持机器可读格式的输出",
+			Value:  command.OutputFormatTable,
+			EnvVar: config.EnvOutput,
+		},
+	}
+
+	// 每次执行命令前设置输出格式
+	app.Before = func(c *cli.Context) error {
+		if err := command.SetOutputFormat(c.GlobalString("output")); err != nil {
+			fmt.Println(err)
+			if !global.IsAppInCliMode {
+				// 直接退出，Before 返回错误会打印帮助信息
+				cli.HandleExitCoder(cli.NewExitError("", command.ExitCodeUsage))
+			}
+		}
+		if configInitErr != nil {
+			// 只输出一次，直接执行命令的时候以配置错误退出，进入交互模式则继续运行
+			err := command.ConfigError(configInitErr)
+			configInitErr = nil
+			if c.NArg() > 0 {
+				cli.HandleExitCoder(err)
+			}
+		}
+		return nil
 	}
 
 	// 进入交互CLI命令行界面
@@ -181,7 +213,7 @@ func main() {
 				numArgs  = len(lineArgs)
 				// 支持TAB补全文件路径的命令
 				acceptCompleteFilePanCommands = []string{ // 云盘命令
-					"cd", "cp", "xcp", "download", "ls", "mkdir", "mv", "rename", "rm", "upload", "tree",
+					"cd", "cp", "xcp", "download", "ls", "mkdir", "mv", "rename", "rm", "upload", "tree", "du",
 				}
 				acceptCompleteFileLocalCommands = []string{ // 本地命令
 					"lcd", "lls",
@@ -324,13 +356,16 @@ func main() {
 				continue
 			}
 
-			s := []string{os.Args[0]}
-			s = append(s, cmdArgs...)
-
 			// 恢复原始终端状态
 			// 防止运行命令时程序被结束, 终端出现异常
 			line.Pause()
-			c.App.Run(s)
+			if command.IsPipeline(commandLine) {
+				command.RunPipeline(c.App, commandLine)
+			} else {
+				s := []string{os.Args[0]}
+				s = append(s, cmdArgs...)
+				c.App.Run(s)
+			}
 			line.Resume()
 		}
 	}
@@ -370,6 +405,21 @@ func main() {
 		// 显示树形目录 tree
 		command.CmdTree(),
 
+		// 搜索文件 search
+		command.CmdSearch(),
+
+		// 统计目录占用空间 du
+		command.CmdDu(),
+
+		// 对比本地目录和云盘目录 diff
+		command.CmdDiff(),
+
+		// 校验已下载或者已上传的文件 verify
+		command.CmdVerify(),
+
+		// 查找和清理重复文件 dedupe
+		command.CmdDedupe(),
+
 		// 创建目录 mkdir
 		command.CmdMkdir(),
 
@@ -388,12 +438,18 @@ func main() {
 		// 同步备份 sync
 		command.CmdSync(),
 
+		// 快照备份 backup
+		command.CmdBackup(),
+
 		// 上传文件/目录 upload
 		command.CmdUpload(),
 
 		// 下载文件/目录 download
 		command.CmdDownload(),
 
+		// 在已登录的账号之间复制文件/目录 xfer
+		command.CmdXfer(),
+
 		// 显示和修改程序配置项 config
 		command.CmdConfig(),
 
@@ -494,8 +550,27 @@ func main() {
 
 		// 检测程序更新 update
 		{
-			Name:     "update",
-			Usage:    "检测程序更新",
+			Name:      "update",
+			Usage:     "检测程序更新",
+			UsageText: app.Name + " update [arguments...]",
+			Description: `
+	检测并更新程序。下载的更新文件会使用发布版本的 SHA-256 校验文件进行校验，校验通过才会更新。
+	更新后上一个版本的程序保存为 aliyunpan.old，可以使用 -rollback 回滚。
+
+	示例:
+
+	检测并更新到最新的正式版本
+	aliyunpan update
+
+	更新到最新的版本，包括Beta版本
+	aliyunpan update -channel beta
+
+	更新到指定的版本
+	aliyunpan update -version v0.3.7
+
+	回滚到更新前的版本
+	aliyunpan update -rollback
+`,
 			Category: "其他",
 			Action: func(c *cli.Context) error {
 				if c.IsSet("y") {
@@ -503,14 +578,46 @@ func main() {
 						return nil
 					}
 				}
-				panupdate.CheckUpdate(app.Version, c.Bool("y"))
-				return nil
+				if c.Bool("rollback") {
+					if err := panupdate.Rollback(cmdutil.Executable()); err != nil {
+						return command.ReportError(fmt.Errorf("回滚失败: %s", err))
+					}
+					fmt.Printf("回滚完毕, 请重启程序\n")
+					return nil
+				}
+				channel := strings.ToLower(c.String("channel"))
+				if channel != panupdate.ChannelStable && channel != panupdate.ChannelBeta {
+					return command.ReportUsageError("不支持的更新通道: %s, 可选值: stable, beta", c.String("channel"))
+				}
+				return command.ReportError(panupdate.CheckUpdate(app.Version, &panupdate.UpdateOptions{
+					Yes:      c.Bool("y"),
+					Channel:  channel,
+					Version:  c.String("version"),
+					NoVerify: c.Bool("no-verify"),
+				}))
 			},
 			Flags: []cli.Flag{
 				cli.BoolFlag{
 					Name:  "y",
 					Usage: "确认更新",
 				},
+				cli.StringFlag{
+					Name:  "channel",
+					Usage: "更新通道: stable(正式版本), beta(包括Beta版本)",
+					Value: panupdate.ChannelStable,
+				},
+				cli.StringFlag{
+					Name:  "version",
+					Usage: "更新到指定的版本，例如 v0.3.7，可以用于降级",
+				},
+				cli.BoolFlag{
+					Name:  "rollback",
+					Usage: "回滚到更新前的版本",
+				},
+				cli.BoolFlag{
+					Name:  "no-verify",
+					Usage: "跳过更新文件的校验，旧的发布版本没有校验文件时使用",
+				},
 			},
 		},
 
@@ -551,6 +658,15 @@ func main() {
 			},
 		},
 
+		// 批量执行脚本 run-script
+		command.CmdRunScript(),
+
+		// 生成命令行补全脚本 completion
+		command.CmdCompletion(),
+
+		// 补全脚本调用的隐藏命令 __complete
+		command.CmdComplete(),
+
 		// 显示程序环境变量
 		{
 			Name:  "env",